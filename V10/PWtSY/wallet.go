@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
@@ -110,6 +111,65 @@ func (w *Wallet) SaveWallet() error {
 	return encoder.Encode(w)
 }
 
+// Log de auditoria encadeado por hash, no formato de audit/audit_system.go:
+// as mudanças de KYC entram na seção de KYC do relatório de conformidade
+const auditLogPath = "../security_audit.jsonl"
+
+type AuditLog struct {
+	ID        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Action    string    `json:"action"`
+	UserID    string    `json:"user_id"`
+	Details   string    `json:"details"`
+	IPAddress string    `json:"ip_address,omitempty"`
+	Success   bool      `json:"success"`
+	Risk      string    `json:"risk_level"`
+	PrevHash  string    `json:"prev_hash,omitempty"`
+	Hash      string    `json:"hash,omitempty"`
+}
+
+// logKYCChange encadeia o registro ao último do log e o grava. Uma última
+// linha cortada (gravação interrompida) é descartada antes.
+func logKYCChange(action, userID, details string) error {
+	data, err := os.ReadFile(auditLogPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	complete := bytes.LastIndexByte(data, '\n') + 1
+	if complete < len(data) {
+		if err := os.Truncate(auditLogPath, int64(complete)); err != nil {
+			return err
+		}
+	}
+
+	entry := AuditLog{
+		ID:        fmt.Sprintf("AUDIT_%d", time.Now().UnixNano()),
+		Timestamp: time.Now().UTC(),
+		Action:    action,
+		UserID:    userID,
+		Details:   details,
+		Success:   true,
+		Risk:      "MEDIUM",
+	}
+	if lines := bytes.TrimRight(data[:complete], "\n"); len(lines) > 0 {
+		var last AuditLog
+		if err := json.Unmarshal(lines[bytes.LastIndexByte(lines, '\n')+1:], &last); err != nil {
+			return fmt.Errorf("último registro do log de auditoria ilegível: %v", err)
+		}
+		entry.PrevHash = last.Hash
+	}
+	payload, _ := json.Marshal(entry)
+	hash := sha256.Sum256(payload)
+	entry.Hash = hex.EncodeToString(hash[:])
+
+	file, err := os.OpenFile(auditLogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return json.NewEncoder(file).Encode(entry)
+}
+
 func LoadWallet(userID string) (*Wallet, error) {
 	filename := fmt.Sprintf("wallet_%s.json", userID)
 	file, err := os.Open(filename)
@@ -292,9 +352,19 @@ func main() {
 			fmt.Printf("Erro ao carregar carteira: %v\n", err)
 			return
 		}
+		if wallet.KYCVerified {
+			fmt.Println("KYC já verificado para", userID)
+			return
+		}
 		// Aqui você pode implementar uma verificação real (documentos, etc)
 		wallet.KYCVerified = true
-		wallet.SaveWallet()
+		if err := wallet.SaveWallet(); err != nil {
+			fmt.Printf("Erro ao salvar carteira: %v\n", err)
+			return
+		}
+		if err := logKYCChange("KYC_VERIFIED", userID, "KYC verificado pelo comando kyc da carteira "+wallet.Address); err != nil {
+			fmt.Printf("⚠️ KYC fora do log de auditoria: %v\n", err)
+		}
 		fmt.Println("KYC verificado para", userID)
 
 	case "transfer":
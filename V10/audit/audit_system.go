@@ -1,12 +1,22 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"sync"
 	"time"
 )
 
+// Arquivo do log de auditoria encadeado por hash
+const auditLogPath = "../security_audit.jsonl"
+
 type AuditLog struct {
 	ID        string    `json:"id"`
 	Timestamp time.Time `json:"timestamp"`
@@ -16,6 +26,140 @@ type AuditLog struct {
 	IPAddress string    `json:"ip_address,omitempty"`
 	Success   bool      `json:"success"`
 	Risk      string    `json:"risk_level"` // LOW, MEDIUM, HIGH, CRITICAL
+	PrevHash  string    `json:"prev_hash,omitempty"`
+	Hash      string    `json:"hash,omitempty"`
+}
+
+// computeAuditHash calcula o hash do registro encadeado ao anterior sobre
+// o JSON do registro (sem o próprio hash): cada campo é delimitado e
+// escapado, então texto não migra de um campo para o vizinho
+func computeAuditHash(entry AuditLog) string {
+	entry.Hash = ""
+	entry.Timestamp = entry.Timestamp.UTC()
+	data, _ := json.Marshal(entry)
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+// loadAuditLogs lê todos os registros do log de auditoria
+func loadAuditLogs(path string) ([]AuditLog, error) {
+	logs, _, err := readAuditLogs(path)
+	return logs, err
+}
+
+// readAuditLogs lê o log linha a linha e retorna também o tamanho da parte
+// íntegra. Linha ilegível no meio do log é erro; só a última pode estar
+// cortada (gravação interrompida) e é ignorada com aviso.
+func readAuditLogs(path string) ([]AuditLog, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	var logs []AuditLog
+	var valid int64
+	reader := bufio.NewReader(file)
+	for lineNum := 1; ; lineNum++ {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return nil, 0, readErr
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			var entry AuditLog
+			if err := json.Unmarshal(line, &entry); err != nil {
+				if _, peekErr := reader.Peek(1); readErr == io.EOF || peekErr == io.EOF {
+					fmt.Printf("⚠️ Última linha do log de auditoria cortada (linha %d), ignorada\n", lineNum)
+					return logs, valid, nil
+				}
+				return nil, 0, fmt.Errorf("linha %d do log de auditoria ilegível: %v", lineNum, err)
+			}
+			logs = append(logs, entry)
+		}
+		valid += int64(len(line))
+		if readErr == io.EOF {
+			return logs, valid, nil
+		}
+	}
+}
+
+// Topo do log em memória: o log só é lido na primeira gravação
+var auditHead = struct {
+	sync.Mutex
+	hashes map[string]string // Caminho do log -> hash do último registro
+}{hashes: make(map[string]string)}
+
+// lastAuditHash retorna o hash do último registro do log. Na primeira
+// leitura descarta a última linha cortada, para o próximo registro não ser
+// gravado colado nela. Requer auditHead.
+func lastAuditHash(path string) (string, error) {
+	if hash, cached := auditHead.hashes[path]; cached {
+		return hash, nil
+	}
+	logs, valid, err := readAuditLogs(path)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	if info, statErr := os.Stat(path); statErr == nil && info.Size() > valid {
+		if err := os.Truncate(path, valid); err != nil {
+			return "", err
+		}
+	}
+	hash := ""
+	if len(logs) > 0 {
+		hash = logs[len(logs)-1].Hash
+	}
+	auditHead.hashes[path] = hash
+	return hash, nil
+}
+
+// appendAuditLog encadeia o registro ao topo do log e o grava
+func appendAuditLog(path string, entry *AuditLog) error {
+	auditHead.Lock()
+	defer auditHead.Unlock()
+
+	prevHash, err := lastAuditHash(path)
+	if err != nil {
+		return err
+	}
+	entry.PrevHash = prevHash
+	entry.Hash = computeAuditHash(*entry)
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := json.NewEncoder(file).Encode(entry); err != nil {
+		return err
+	}
+	auditHead.hashes[path] = entry.Hash
+	return nil
+}
+
+// verifyAuditChain verifica o encadeamento a partir de um índice
+func verifyAuditChain(logs []AuditLog, start int, prevHash string) error {
+	chained := prevHash != ""
+	for i := start; i < len(logs); i++ {
+		entry := logs[i]
+		// Registros legados (sem hash) só existem antes do primeiro encadeado;
+		// depois dele, hash ausente é registro adulterado
+		if entry.Hash == "" {
+			if chained {
+				return fmt.Errorf("registro %d (%s) sem hash no meio do log encadeado", i, entry.ID)
+			}
+			continue
+		}
+		chained = true
+		if entry.PrevHash != prevHash {
+			return fmt.Errorf("encadeamento quebrado no registro %d (%s)", i, entry.ID)
+		}
+		if computeAuditHash(entry) != entry.Hash {
+			return fmt.Errorf("hash inválido no registro %d (%s)", i, entry.ID)
+		}
+		prevHash = entry.Hash
+	}
+	return nil
 }
 
 type SecurityMetrics struct {
@@ -43,14 +187,9 @@ func logSecurityEvent(action, userID, details, riskLevel string, success bool) {
 	}
 
 	// Log em arquivo JSON estruturado
-	file, err := os.OpenFile("../security_audit.jsonl", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-	if err != nil {
+	if err := appendAuditLog(auditLogPath, &auditLog); err != nil {
 		return
 	}
-	defer file.Close()
-
-	encoder := json.NewEncoder(file)
-	encoder.Encode(auditLog)
 
 	// Log crítico para assinaturas inválidas
 	if riskLevel == "CRITICAL" || riskLevel == "HIGH" || action == "INVALID_SIGNATURE" {
@@ -68,22 +207,11 @@ func generateSecurityReport() {
 	fmt.Println("=== RELATÓRIO DE SEGURANÇA ===")
 
 	// Lê logs de auditoria
-	file, err := os.Open("../security_audit.jsonl")
+	logs, err := loadAuditLogs(auditLogPath)
 	if err != nil {
 		fmt.Println("Erro ao abrir arquivo de auditoria:", err)
 		return
 	}
-	defer file.Close()
-
-	var logs []AuditLog
-	decoder := json.NewDecoder(file)
-	for {
-		var log AuditLog
-		if err := decoder.Decode(&log); err != nil {
-			break
-		}
-		logs = append(logs, log)
-	}
 
 	// Calcula métricas
 	metrics := SecurityMetrics{}
@@ -139,6 +267,11 @@ func main() {
 		fmt.Println("Comandos:")
 		fmt.Println("  report - Gera relatório de segurança")
 		fmt.Println("  test   - Teste do sistema de auditoria")
+		fmt.Println("  verify - Verifica o encadeamento do log")
+		fmt.Println("  export-cef <destino> [--follow] - Exporta em CEF/syslog (udp://, tcp://, file://)")
+		fmt.Println("  compliance <AAAA-MM> <node_id>  - Gera pacote de conformidade assinado")
+		fmt.Println("  compliance-auto <node_id>       - Gera pacotes mensais automaticamente")
+		fmt.Println("  compliance-verify <diretório> <node_id> | --key <pem> - Verifica um pacote com a chave do nó")
 		return
 	}
 
@@ -149,6 +282,74 @@ func main() {
 		logSecurityEvent("TEST_TRANSACTION", "TestUser", "Teste de transação", "LOW", true)
 		logSecurityEvent("SECURITY_VIOLATION", "MaliciousUser", "Tentativa de acesso não autorizado", "CRITICAL", false)
 		fmt.Println("Eventos de teste logados")
+	case "verify":
+		logs, err := loadAuditLogs(auditLogPath)
+		if err != nil {
+			fmt.Println("Erro ao abrir arquivo de auditoria:", err)
+			return
+		}
+		if err := verifyAuditChain(logs, 0, ""); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return
+		}
+		fmt.Printf("✅ Log íntegro (%d registros)\n", len(logs))
+	case "export-cef":
+		if len(os.Args) < 3 {
+			fmt.Println("Erro: informe o destino (udp://host:porta, tcp://host:porta ou file://caminho)")
+			return
+		}
+		exporter := NewCEFExporter(os.Args[2])
+		if len(os.Args) > 3 && os.Args[3] == "--follow" {
+			exporter.Stream(10 * time.Second)
+			return
+		}
+		sent, err := exporter.Export()
+		if err != nil {
+			fmt.Printf("❌ Exportação CEF: %v\n", err)
+			return
+		}
+		fmt.Printf("📤 %d eventos exportados para %s\n", sent, os.Args[2])
+	case "compliance":
+		if len(os.Args) < 4 {
+			fmt.Println("Erro: informe o período (AAAA-MM) e o node_id")
+			return
+		}
+		dir, err := GenerateComplianceBundle(DefaultComplianceConfig(os.Args[3]), os.Args[2])
+		if err != nil {
+			fmt.Printf("❌ Erro ao gerar relatório: %v\n", err)
+			return
+		}
+		fmt.Printf("📑 Pacote de conformidade gerado em %s\n", dir)
+	case "compliance-auto":
+		if len(os.Args) < 3 {
+			fmt.Println("Erro: informe o node_id")
+			return
+		}
+		RunComplianceSchedule(DefaultComplianceConfig(os.Args[2]), time.Hour)
+	case "compliance-verify":
+		if len(os.Args) < 4 {
+			fmt.Println("Erro: informe o diretório do pacote e o node_id (ou --key <arquivo.pem>)")
+			return
+		}
+		var trusted *rsa.PublicKey
+		var err error
+		if os.Args[3] == "--key" && len(os.Args) > 4 {
+			var data []byte
+			if data, err = os.ReadFile(os.Args[4]); err == nil {
+				trusted, err = parsePublicKeyPEM(data)
+			}
+		} else {
+			trusted, err = loadNodePublicKey(DefaultComplianceConfig(os.Args[3]).KeyPairPath)
+		}
+		if err != nil {
+			fmt.Printf("❌ Erro ao carregar chave do nó: %v\n", err)
+			return
+		}
+		if err := VerifyComplianceBundle(os.Args[2], trusted); err != nil {
+			fmt.Printf("❌ Pacote inválido: %v\n", err)
+			return
+		}
+		fmt.Println("✅ Pacote íntegro e assinado pelo nó")
 	default:
 		fmt.Println("Comando não reconhecido")
 	}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestLog grava registros encadeados num log temporário
+func writeTestLog(t *testing.T, entries ...AuditLog) (string, []AuditLog) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "security_audit.jsonl")
+	for i := range entries {
+		if err := appendAuditLog(path, &entries[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	logs, err := loadAuditLogs(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, logs
+}
+
+func testEntry(id, action, details string) AuditLog {
+	return AuditLog{ID: id, Timestamp: time.Date(2025, 5, 10, 12, 0, 0, 0, time.UTC),
+		Action: action, UserID: "alice", Details: details, Success: true, Risk: "LOW"}
+}
+
+func TestAuditHashSeparatesFields(t *testing.T) {
+	a := testEntry("A1", "TRANSACTION", "valor|10")
+	a.IPAddress = "10.0.0.1"
+	b := a
+	b.Details, b.IPAddress = "valor", "10|10.0.0.1"
+	if computeAuditHash(a) == computeAuditHash(b) {
+		t.Fatal("texto movido entre campos não mudou o hash")
+	}
+
+	// O hash não depende do fuso em que o horário foi lido
+	c := a
+	c.Timestamp = a.Timestamp.In(time.FixedZone("BRT", -3*3600))
+	if computeAuditHash(a) != computeAuditHash(c) {
+		t.Fatal("mesmo instante em outro fuso mudou o hash")
+	}
+}
+
+func TestAuditChainDetectsTampering(t *testing.T) {
+	legacy := testEntry("L1", "TRANSACTION", "legado")
+	_, logs := writeTestLog(t,
+		testEntry("A1", "TRANSACTION", "um"),
+		testEntry("A2", "TRANSACTION", "dois"),
+		testEntry("A3", "TRANSACTION", "três"))
+	if err := verifyAuditChain(logs, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// Registros sem hash antes do primeiro encadeado são legados
+	if err := verifyAuditChain(append([]AuditLog{legacy}, logs...), 0, ""); err != nil {
+		t.Fatalf("registro legado no início recusado: %v", err)
+	}
+
+	edited := append([]AuditLog(nil), logs...)
+	edited[1].Details = "dois mil"
+	if err := verifyAuditChain(edited, 0, ""); err == nil {
+		t.Fatal("registro alterado aceito")
+	}
+
+	unhashed := append([]AuditLog(nil), logs...)
+	unhashed[1].Details, unhashed[1].Hash = "dois mil", ""
+	unhashed[2].PrevHash = ""
+	if err := verifyAuditChain(unhashed, 0, ""); err == nil || !strings.Contains(err.Error(), "sem hash") {
+		t.Fatalf("hash apagado no meio do log aceito: %v", err)
+	}
+	if err := verifyAuditChain(unhashed, 1, logs[0].Hash); err == nil {
+		t.Fatal("hash apagado após o cursor aceito")
+	}
+}
+
+func TestAuditHeadIsCached(t *testing.T) {
+	path, logs := writeTestLog(t, testEntry("A1", "TRANSACTION", "um"))
+
+	auditHead.Lock()
+	head, err := lastAuditHash(path)
+	auditHead.Unlock()
+	if err != nil || head != logs[0].Hash {
+		t.Fatalf("topo %s, esperado %s", head, logs[0].Hash)
+	}
+
+	// Novo processo: o topo vem do arquivo uma única vez
+	auditHead.Lock()
+	delete(auditHead.hashes, path)
+	auditHead.Unlock()
+	next := testEntry("A2", "TRANSACTION", "dois")
+	if err := appendAuditLog(path, &next); err != nil {
+		t.Fatal(err)
+	}
+	if next.PrevHash != logs[0].Hash {
+		t.Fatalf("registro encadeado a %q, esperado %q", next.PrevHash, logs[0].Hash)
+	}
+	all, _ := loadAuditLogs(path)
+	if err := verifyAuditChain(all, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadAuditLogsRejectsCorruptLines(t *testing.T) {
+	path, logs := writeTestLog(t,
+		testEntry("A1", "TRANSACTION", "um"),
+		testEntry("A2", "TRANSACTION", "dois"))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Linha ilegível no meio: nada depois dela pode ser descartado em silêncio
+	lines := strings.SplitAfter(string(data), "\n")
+	middle := filepath.Join(t.TempDir(), "security_audit.jsonl")
+	if err := os.WriteFile(middle, []byte(lines[0]+"{lixo\n"+lines[1]), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadAuditLogs(middle); err == nil || !strings.Contains(err.Error(), "linha 2") {
+		t.Fatalf("linha corrompida no meio aceita: %v", err)
+	}
+
+	// Última linha cortada por gravação interrompida: ignorada e descartada
+	// antes do próximo registro
+	torn := string(data) + `{"id": "A3", "timestamp"`
+	if err := os.WriteFile(path, []byte(torn), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadAuditLogs(path)
+	if err != nil || len(loaded) != len(logs) {
+		t.Fatalf("última linha cortada: %d registros, %v", len(loaded), err)
+	}
+	auditHead.Lock()
+	delete(auditHead.hashes, path)
+	auditHead.Unlock()
+	next := testEntry("A3", "TRANSACTION", "três")
+	if err := appendAuditLog(path, &next); err != nil {
+		t.Fatal(err)
+	}
+	all, err := loadAuditLogs(path)
+	if err != nil || len(all) != 3 {
+		t.Fatalf("registro após a linha cortada: %d registros, %v", len(all), err)
+	}
+	if err := verifyAuditChain(all, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+}
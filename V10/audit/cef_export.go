@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// Cabeçalho CEF fixo para os eventos do PTW
+const (
+	cefVendor  = "SyraBlock"
+	cefProduct = "PTW"
+	cefVersion = "10"
+
+	// Facility syslog 13 = log audit (RFC 5424)
+	syslogFacilityAudit = 13
+)
+
+// Cursor de exportação: aponta para o último registro entregue
+type ExportCursor struct {
+	Index     int       `json:"index"`      // Quantidade de registros já entregues
+	LastID    string    `json:"last_id"`    // ID do último registro entregue
+	LastHash  string    `json:"last_hash"`  // Hash do último registro entregue
+	UpdatedAt time.Time `json:"updated_at"` // Momento da última entrega
+}
+
+// CEFExporter envia o log de auditoria em CEF sobre syslog
+type CEFExporter struct {
+	target     string // udp://host:porta, tcp://host:porta ou file://caminho
+	logPath    string
+	cursorPath string
+	hostname   string
+	appName    string
+	timeout    time.Duration
+}
+
+// NewCEFExporter cria um exportador para o destino informado
+func NewCEFExporter(target string) *CEFExporter {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+
+	return &CEFExporter{
+		target:     target,
+		logPath:    auditLogPath,
+		cursorPath: "../security_audit.cursor.json",
+		hostname:   hostname,
+		appName:    "ptw-audit",
+		timeout:    5 * time.Second,
+	}
+}
+
+// cefSeverity converte o nível de risco na escala CEF (0-10)
+func cefSeverity(risk string) int {
+	switch strings.ToUpper(risk) {
+	case "CRITICAL":
+		return 10
+	case "HIGH":
+		return 8
+	case "MEDIUM":
+		return 5
+	case "LOW":
+		return 3
+	default:
+		return 1
+	}
+}
+
+// syslogSeverity converte o nível de risco na severidade syslog
+func syslogSeverity(risk string) int {
+	switch strings.ToUpper(risk) {
+	case "CRITICAL":
+		return 2 // crit
+	case "HIGH":
+		return 3 // err
+	case "MEDIUM":
+		return 4 // warning
+	case "LOW":
+		return 6 // info
+	default:
+		return 7 // debug
+	}
+}
+
+// Escapa campos do cabeçalho CEF ("\" e "|")
+func cefEscapeHeader(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	return strings.ReplaceAll(value, "|", `\|`)
+}
+
+// Escapa valores de extensão CEF ("\", "=" e quebras de linha)
+func cefEscapeExtension(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, "=", `\=`)
+	value = strings.ReplaceAll(value, "\r", `\r`)
+	return strings.ReplaceAll(value, "\n", `\n`)
+}
+
+// FormatCEF converte um registro de auditoria em uma linha CEF
+func FormatCEF(entry AuditLog) string {
+	outcome := "failure"
+	if entry.Success {
+		outcome = "success"
+	}
+
+	extensions := []string{
+		fmt.Sprintf("rt=%d", entry.Timestamp.UnixMilli()),
+		"suser=" + cefEscapeExtension(entry.UserID),
+		"outcome=" + outcome,
+		"msg=" + cefEscapeExtension(entry.Details),
+		"cs1Label=auditId",
+		"cs1=" + cefEscapeExtension(entry.ID),
+		"cs2Label=riskLevel",
+		"cs2=" + cefEscapeExtension(entry.Risk),
+	}
+	if entry.IPAddress != "" {
+		extensions = append(extensions, "src="+cefEscapeExtension(entry.IPAddress))
+	}
+	if entry.Hash != "" {
+		extensions = append(extensions, "cs3Label=chainHash", "cs3="+entry.Hash)
+	}
+
+	return fmt.Sprintf("CEF:0|%s|%s|%s|%s|%s|%d|%s",
+		cefEscapeHeader(cefVendor),
+		cefEscapeHeader(cefProduct),
+		cefEscapeHeader(cefVersion),
+		cefEscapeHeader(entry.Action),
+		cefEscapeHeader(strings.ReplaceAll(strings.ToLower(entry.Action), "_", " ")),
+		cefSeverity(entry.Risk),
+		strings.Join(extensions, " "))
+}
+
+// formatSyslog envolve a linha CEF em uma mensagem RFC 5424
+func (e *CEFExporter) formatSyslog(entry AuditLog) string {
+	pri := syslogFacilityAudit*8 + syslogSeverity(entry.Risk)
+	msgID := entry.Action
+	if msgID == "" || len(msgID) > 32 {
+		msgID = "-"
+	}
+
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s - %s",
+		pri,
+		entry.Timestamp.UTC().Format(time.RFC3339Nano),
+		e.hostname,
+		e.appName,
+		os.Getpid(),
+		msgID,
+		FormatCEF(entry))
+}
+
+// Carrega o cursor de exportação do disco
+func (e *CEFExporter) loadCursor() ExportCursor {
+	var cursor ExportCursor
+
+	data, err := os.ReadFile(e.cursorPath)
+	if err != nil {
+		return cursor
+	}
+	json.Unmarshal(data, &cursor)
+	return cursor
+}
+
+// Salva o cursor de forma atômica (arquivo temporário + rename)
+func (e *CEFExporter) saveCursor(cursor ExportCursor) error {
+	data, err := json.MarshalIndent(cursor, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tempFile := e.cursorPath + ".tmp"
+	if err := os.WriteFile(tempFile, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tempFile, e.cursorPath)
+}
+
+// Abre o destino de envio conforme o esquema do alvo
+func (e *CEFExporter) openSink() (func(string) error, func() error, error) {
+	switch {
+	case strings.HasPrefix(e.target, "udp://"):
+		// Sem confirmação do coletor: best-effort
+		conn, err := net.DialTimeout("udp", strings.TrimPrefix(e.target, "udp://"), e.timeout)
+		if err != nil {
+			return nil, nil, err
+		}
+		send := func(msg string) error {
+			conn.SetWriteDeadline(time.Now().Add(e.timeout))
+			_, err := conn.Write([]byte(msg))
+			return err
+		}
+		return send, conn.Close, nil
+
+	case strings.HasPrefix(e.target, "tcp://"):
+		conn, err := net.DialTimeout("tcp", strings.TrimPrefix(e.target, "tcp://"), e.timeout)
+		if err != nil {
+			return nil, nil, err
+		}
+		// Enquadramento por contagem de octetos (RFC 6587)
+		send := func(msg string) error {
+			conn.SetWriteDeadline(time.Now().Add(e.timeout))
+			_, err := fmt.Fprintf(conn, "%d %s", len(msg), msg)
+			return err
+		}
+		return send, conn.Close, nil
+
+	case strings.HasPrefix(e.target, "file://"):
+		file, err := os.OpenFile(strings.TrimPrefix(e.target, "file://"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, nil, err
+		}
+		send := func(msg string) error {
+			if _, err := file.WriteString(msg + "\n"); err != nil {
+				return err
+			}
+			return file.Sync()
+		}
+		return send, file.Close, nil
+	}
+
+	return nil, nil, fmt.Errorf("destino não suportado: %s (use udp://, tcp:// ou file://)", e.target)
+}
+
+// Export envia os registros ainda não entregues e avança o cursor.
+// O cursor só avança após o envio bem-sucedido: em tcp:// e file:// a
+// entrega é at-least-once. Em udp:// o envio só confirma a escrita local,
+// então a entrega é best-effort (datagrama perdido não é reenviado).
+func (e *CEFExporter) Export() (int, error) {
+	logs, err := loadAuditLogs(e.logPath)
+	if err != nil {
+		return 0, fmt.Errorf("erro ao ler log de auditoria: %v", err)
+	}
+
+	cursor := e.loadCursor()
+	if cursor.Index > len(logs) {
+		return 0, fmt.Errorf("cursor (%d) além do fim do log (%d registros)", cursor.Index, len(logs))
+	}
+
+	// Confere se o cursor ainda aponta para o mesmo registro
+	if cursor.Index > 0 {
+		last := logs[cursor.Index-1]
+		if last.ID != cursor.LastID || last.Hash != cursor.LastHash {
+			return 0, fmt.Errorf("cursor não corresponde ao log (registro %d foi alterado)", cursor.Index)
+		}
+	}
+
+	// Verifica a integridade dos registros pendentes antes de enviar
+	if err := verifyAuditChain(logs, cursor.Index, cursor.LastHash); err != nil {
+		return 0, err
+	}
+
+	if cursor.Index == len(logs) {
+		return 0, nil
+	}
+
+	send, closeSink, err := e.openSink()
+	if err != nil {
+		return 0, err
+	}
+	defer closeSink()
+
+	sent := 0
+	for i := cursor.Index; i < len(logs); i++ {
+		if err := send(e.formatSyslog(logs[i])); err != nil {
+			return sent, fmt.Errorf("erro ao enviar registro %s: %v", logs[i].ID, err)
+		}
+
+		cursor = ExportCursor{
+			Index:     i + 1,
+			LastID:    logs[i].ID,
+			LastHash:  logs[i].Hash,
+			UpdatedAt: time.Now(),
+		}
+		if err := e.saveCursor(cursor); err != nil {
+			return sent, fmt.Errorf("erro ao salvar cursor: %v", err)
+		}
+		sent++
+	}
+
+	return sent, nil
+}
+
+// Stream exporta periodicamente os novos registros do log
+func (e *CEFExporter) Stream(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		sent, err := e.Export()
+		if err != nil {
+			fmt.Printf("❌ Exportação CEF: %v\n", err)
+		} else if sent > 0 {
+			fmt.Printf("📤 %d eventos exportados para %s\n", sent, e.target)
+		}
+		<-ticker.C
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testExporter(t *testing.T, target, logPath string) *CEFExporter {
+	t.Helper()
+	e := NewCEFExporter(target)
+	e.logPath = logPath
+	e.cursorPath = filepath.Join(t.TempDir(), "cursor.json")
+	e.timeout = time.Second
+	return e
+}
+
+func TestFormatCEFEscapes(t *testing.T) {
+	entry := testEntry("A1", "BAD|ACTION", "a=b\nc\\d")
+	entry.Risk = "CRITICAL"
+	line := FormatCEF(entry)
+
+	if !strings.HasPrefix(line, `CEF:0|SyraBlock|PTW|10|BAD\|ACTION|bad\|action|10|`) {
+		t.Fatalf("cabeçalho CEF: %s", line)
+	}
+	if !strings.Contains(line, `msg=a\=b\nc\\d`) {
+		t.Fatalf("extensão sem escape: %s", line)
+	}
+}
+
+func TestCEFExportFileResumesFromCursor(t *testing.T) {
+	logPath, _ := writeTestLog(t, testEntry("A1", "TRANSACTION", "um"), testEntry("A2", "TRANSACTION", "dois"))
+	out := filepath.Join(t.TempDir(), "siem.log")
+	e := testExporter(t, "file://"+out, logPath)
+
+	if sent, err := e.Export(); err != nil || sent != 2 {
+		t.Fatalf("enviados %d: %v", sent, err)
+	}
+	if sent, err := e.Export(); err != nil || sent != 0 {
+		t.Fatalf("reenviados %d: %v", sent, err)
+	}
+
+	third := testEntry("A3", "TRANSACTION", "três")
+	if err := appendAuditLog(logPath, &third); err != nil {
+		t.Fatal(err)
+	}
+	if sent, err := e.Export(); err != nil || sent != 1 {
+		t.Fatalf("enviados %d: %v", sent, err)
+	}
+	data, _ := os.ReadFile(out)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[2], "cs1=A3") {
+		t.Fatalf("saída: %q", lines)
+	}
+	if cursor := e.loadCursor(); cursor.Index != 3 || cursor.LastID != "A3" {
+		t.Fatalf("cursor %+v", cursor)
+	}
+}
+
+func TestCEFExportStopsOnTamperedLog(t *testing.T) {
+	logPath, logs := writeTestLog(t, testEntry("A1", "TRANSACTION", "um"), testEntry("A2", "TRANSACTION", "dois"))
+	e := testExporter(t, "file://"+filepath.Join(t.TempDir(), "siem.log"), logPath)
+
+	logs[1].Details = "dois mil"
+	file, err := os.Create(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoder := json.NewEncoder(file)
+	for _, entry := range logs {
+		encoder.Encode(entry)
+	}
+	file.Close()
+
+	if sent, err := e.Export(); err == nil || sent != 0 {
+		t.Fatalf("log adulterado exportado (%d): %v", sent, err)
+	}
+	if cursor := e.loadCursor(); cursor.Index != 0 {
+		t.Fatalf("cursor avançou: %+v", cursor)
+	}
+}
+
+func TestCEFExportTCPFraming(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		var frames []string
+		for len(frames) < 2 {
+			prefix, err := reader.ReadString(' ')
+			if err != nil {
+				break
+			}
+			size, _ := strconv.Atoi(strings.TrimSpace(prefix))
+			frame := make([]byte, size)
+			if _, err := io.ReadFull(reader, frame); err != nil {
+				break
+			}
+			frames = append(frames, string(frame))
+		}
+		received <- frames
+	}()
+
+	logPath, _ := writeTestLog(t, testEntry("A1", "TRANSACTION", "um"), testEntry("A2", "TRANSACTION", "dois"))
+	e := testExporter(t, "tcp://"+listener.Addr().String(), logPath)
+	if sent, err := e.Export(); err != nil || sent != 2 {
+		t.Fatalf("enviados %d: %v", sent, err)
+	}
+
+	select {
+	case frames := <-received:
+		if len(frames) != 2 || !strings.HasPrefix(frames[0], "<") || !strings.Contains(frames[1], "cs1=A2") {
+			t.Fatalf("quadros: %q", frames)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("coletor não recebeu os eventos")
+	}
+}
@@ -0,0 +1,638 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Estruturas mínimas da blockchain (tokens.json) usadas nos relatórios
+type Token struct {
+	Index        int           `json:"index"`
+	Hash         string        `json:"hash"`
+	Timestamp    string        `json:"timestamp"`
+	Validator    string        `json:"validator,omitempty"`
+	PrevHash     string        `json:"prev_hash,omitempty"`
+	MinerID      string        `json:"miner_id,omitempty"`
+	Transactions []Transaction `json:"transactions,omitempty"`
+}
+
+type Transaction struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Amount    int       `json:"amount"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Par de chaves do nó (mesmo formato de crypto/keypair.go)
+type KeyPair struct {
+	UserID     string `json:"user_id"`
+	PublicKey  string `json:"public_key"`
+	PrivateKey string `json:"private_key"`
+	Address    string `json:"address"`
+}
+
+// Parâmetros de geração do pacote de conformidade
+type ComplianceConfig struct {
+	ChainPath           string
+	AuditPath           string
+	OutputDir           string
+	KeyPairPath         string
+	LargeTransferAmount int
+}
+
+// Linha de transações agregadas por contraparte
+type CounterpartyRow struct {
+	Account      string
+	Counterparty string
+	Sent         int
+	Received     int
+	TxCount      int
+}
+
+// Linha de transação individual (grandes transferências)
+type TransferRow struct {
+	Block     int
+	TxID      string
+	Type      string
+	From      string
+	To        string
+	Amount    int
+	Timestamp string
+}
+
+// Linha baseada em evento de auditoria
+type AuditRow struct {
+	AuditID   string
+	Timestamp string
+	Action    string
+	UserID    string
+	Risk      string
+	Details   string
+}
+
+// ComplianceReport contém todas as seções de um período
+type ComplianceReport struct {
+	Period              string
+	Start               time.Time
+	End                 time.Time
+	ChainTip            string
+	AuditHead           string
+	BlocksInPeriod      int
+	LargeTransferAmount int
+	Counterparties      []CounterpartyRow
+	LargeTransfers      []TransferRow
+	KYCChanges          []AuditRow
+	RejectedTxs         []AuditRow
+	ValidatorIncidents  []AuditRow
+}
+
+// Manifesto assinado do pacote
+type ComplianceManifest struct {
+	Period    string            `json:"period"`
+	Start     time.Time         `json:"start"`
+	End       time.Time         `json:"end"`
+	ChainTip  string            `json:"chain_tip"`
+	AuditHead string            `json:"audit_head"`
+	Files     map[string]string `json:"files"` // nome -> sha256
+	SignedBy  string            `json:"signed_by"`
+}
+
+// Ações de auditoria classificadas por seção
+var (
+	rejectedTxActions = map[string]bool{
+		"TRANSACTION_REJECTED": true,
+		"INVALID_SIGNATURE":    true,
+		"REPLAY_ATTACK":        true,
+	}
+	validatorIncidentActions = map[string]bool{
+		"INVALID_BLOCK":        true,
+		"DOUBLE_SIGN":          true,
+		"VALIDATOR_SLASHED":    true,
+		"VALIDATOR_JAILED":     true,
+		"VALIDATOR_MISBEHAVED": true,
+	}
+)
+
+func DefaultComplianceConfig(nodeID string) ComplianceConfig {
+	return ComplianceConfig{
+		ChainPath:           "../tokens.json",
+		AuditPath:           auditLogPath,
+		OutputDir:           "../compliance_reports",
+		KeyPairPath:         filepath.Join("..", "PWtSY", fmt.Sprintf("keypair_%s.json", nodeID)),
+		LargeTransferAmount: 10000,
+	}
+}
+
+// parsePeriod converte "AAAA-MM" no intervalo [início, fim) em UTC
+func parsePeriod(period string) (time.Time, time.Time, error) {
+	start, err := time.Parse("2006-01", period)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("período inválido %q (use AAAA-MM)", period)
+	}
+	return start, start.AddDate(0, 1, 0), nil
+}
+
+func inPeriod(t, start, end time.Time) bool {
+	return !t.Before(start) && t.Before(end)
+}
+
+func loadChain(path string) ([]Token, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var chain []Token
+	if err := json.Unmarshal(data, &chain); err != nil {
+		return nil, err
+	}
+	return chain, nil
+}
+
+func auditRow(entry AuditLog) AuditRow {
+	return AuditRow{
+		AuditID:   entry.ID,
+		Timestamp: entry.Timestamp.UTC().Format(time.RFC3339),
+		Action:    entry.Action,
+		UserID:    entry.UserID,
+		Risk:      entry.Risk,
+		Details:   entry.Details,
+	}
+}
+
+// BuildComplianceReport monta o relatório a partir da cadeia e do log de auditoria.
+// A saída depende apenas dos dados de entrada do período, então é reproduzível.
+func BuildComplianceReport(cfg ComplianceConfig, period string) (*ComplianceReport, error) {
+	start, end, err := parsePeriod(period)
+	if err != nil {
+		return nil, err
+	}
+
+	chain, err := loadChain(cfg.ChainPath)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao carregar blockchain: %v", err)
+	}
+	logs, err := loadAuditLogs(cfg.AuditPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("erro ao carregar auditoria: %v", err)
+	}
+	if err := verifyAuditChain(logs, 0, ""); err != nil {
+		return nil, fmt.Errorf("log de auditoria corrompido: %v", err)
+	}
+
+	report := &ComplianceReport{
+		Period:              period,
+		Start:               start,
+		End:                 end,
+		LargeTransferAmount: cfg.LargeTransferAmount,
+	}
+
+	// Transações do período por contraparte
+	pairs := make(map[string]*CounterpartyRow)
+	addFlow := func(account, counterparty string, sent, received int) {
+		key := account + "\x00" + counterparty
+		row, exists := pairs[key]
+		if !exists {
+			row = &CounterpartyRow{Account: account, Counterparty: counterparty}
+			pairs[key] = row
+		}
+		row.Sent += sent
+		row.Received += received
+		row.TxCount++
+	}
+
+	for _, block := range chain {
+		blockTime, _ := time.Parse(time.RFC3339, block.Timestamp)
+		if blockTime.Before(end) {
+			report.ChainTip = block.Hash
+		}
+		if inPeriod(blockTime, start, end) {
+			report.BlocksInPeriod++
+		}
+
+		for _, tx := range block.Transactions {
+			txTime := tx.Timestamp
+			if txTime.IsZero() {
+				txTime = blockTime
+			}
+			if !inPeriod(txTime, start, end) {
+				continue
+			}
+
+			addFlow(tx.From, tx.To, tx.Amount, 0)
+			addFlow(tx.To, tx.From, 0, tx.Amount)
+
+			if tx.Amount >= cfg.LargeTransferAmount {
+				report.LargeTransfers = append(report.LargeTransfers, TransferRow{
+					Block:     block.Index,
+					TxID:      tx.ID,
+					Type:      tx.Type,
+					From:      tx.From,
+					To:        tx.To,
+					Amount:    tx.Amount,
+					Timestamp: txTime.UTC().Format(time.RFC3339),
+				})
+			}
+		}
+	}
+
+	for _, row := range pairs {
+		report.Counterparties = append(report.Counterparties, *row)
+	}
+	sort.Slice(report.Counterparties, func(i, j int) bool {
+		a, b := report.Counterparties[i], report.Counterparties[j]
+		if a.Account != b.Account {
+			return a.Account < b.Account
+		}
+		return a.Counterparty < b.Counterparty
+	})
+	sort.SliceStable(report.LargeTransfers, func(i, j int) bool {
+		a, b := report.LargeTransfers[i], report.LargeTransfers[j]
+		if a.Block != b.Block {
+			return a.Block < b.Block
+		}
+		return a.TxID < b.TxID
+	})
+
+	// Eventos de auditoria do período (já em ordem do log encadeado)
+	for _, entry := range logs {
+		if entry.Timestamp.Before(end) && entry.Hash != "" {
+			report.AuditHead = entry.Hash
+		}
+		if !inPeriod(entry.Timestamp, start, end) {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(entry.Action, "KYC"):
+			report.KYCChanges = append(report.KYCChanges, auditRow(entry))
+		case rejectedTxActions[entry.Action] || (entry.Action == "TRANSACTION" && !entry.Success):
+			report.RejectedTxs = append(report.RejectedTxs, auditRow(entry))
+		case validatorIncidentActions[entry.Action]:
+			report.ValidatorIncidents = append(report.ValidatorIncidents, auditRow(entry))
+		}
+	}
+
+	return report, nil
+}
+
+// Escreve um CSV com cabeçalho e linhas
+func writeCSV(path string, header []string, rows [][]string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write(header)
+	writer.WriteAll(rows)
+	return writer.Error()
+}
+
+func auditRowsCSV(rows []AuditRow) [][]string {
+	result := make([][]string, 0, len(rows))
+	for _, r := range rows {
+		result = append(result, []string{r.AuditID, r.Timestamp, r.Action, r.UserID, r.Risk, r.Details})
+	}
+	return result
+}
+
+var auditCSVHeader = []string{"audit_id", "timestamp", "action", "user_id", "risk_level", "details"}
+
+func (r *ComplianceReport) writeCSVFiles(dir string) error {
+	counterparties := make([][]string, 0, len(r.Counterparties))
+	for _, c := range r.Counterparties {
+		counterparties = append(counterparties, []string{
+			c.Account, c.Counterparty, strconv.Itoa(c.Sent), strconv.Itoa(c.Received), strconv.Itoa(c.TxCount),
+		})
+	}
+	if err := writeCSV(filepath.Join(dir, "transactions_by_counterparty.csv"),
+		[]string{"account", "counterparty", "sent", "received", "tx_count"}, counterparties); err != nil {
+		return err
+	}
+
+	transfers := make([][]string, 0, len(r.LargeTransfers))
+	for _, t := range r.LargeTransfers {
+		transfers = append(transfers, []string{
+			strconv.Itoa(t.Block), t.TxID, t.Type, t.From, t.To, strconv.Itoa(t.Amount), t.Timestamp,
+		})
+	}
+	if err := writeCSV(filepath.Join(dir, "large_transfers.csv"),
+		[]string{"block", "tx_id", "type", "from", "to", "amount", "timestamp"}, transfers); err != nil {
+		return err
+	}
+
+	sections := map[string][]AuditRow{
+		"kyc_changes.csv":            r.KYCChanges,
+		"rejected_transactions.csv":  r.RejectedTxs,
+		"validator_misbehaviour.csv": r.ValidatorIncidents,
+	}
+	for name, rows := range sections {
+		if err := writeCSV(filepath.Join(dir, name), auditCSVHeader, auditRowsCSV(rows)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const complianceHTML = `<!DOCTYPE html>
+<html lang="pt-BR">
+<head>
+<meta charset="utf-8">
+<title>Relatório de Conformidade PTW - {{.Period}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #999; padding: 4px 8px; text-align: left; }
+th { background: #eee; }
+</style>
+</head>
+<body>
+<h1>Relatório de Conformidade - {{.Period}}</h1>
+<p>Período: {{.Start.Format "2006-01-02"}} a {{.End.Format "2006-01-02"}} (exclusivo)<br>
+Blocos no período: {{.BlocksInPeriod}}<br>
+Topo da cadeia: <code>{{.ChainTip}}</code><br>
+Topo do log de auditoria: <code>{{.AuditHead}}</code></p>
+
+<h2>Transações por contraparte</h2>
+<table>
+<tr><th>Conta</th><th>Contraparte</th><th>Enviado</th><th>Recebido</th><th>Transações</th></tr>
+{{range .Counterparties}}<tr><td>{{.Account}}</td><td>{{.Counterparty}}</td><td>{{.Sent}}</td><td>{{.Received}}</td><td>{{.TxCount}}</td></tr>
+{{end}}</table>
+
+<h2>Grandes transferências (&ge; {{.LargeTransferAmount}})</h2>
+<table>
+<tr><th>Bloco</th><th>Transação</th><th>Tipo</th><th>De</th><th>Para</th><th>Valor</th><th>Data</th></tr>
+{{range .LargeTransfers}}<tr><td>{{.Block}}</td><td>{{.TxID}}</td><td>{{.Type}}</td><td>{{.From}}</td><td>{{.To}}</td><td>{{.Amount}}</td><td>{{.Timestamp}}</td></tr>
+{{end}}</table>
+
+{{define "auditTable"}}<table>
+<tr><th>Auditoria</th><th>Data</th><th>Ação</th><th>Usuário</th><th>Risco</th><th>Detalhes</th></tr>
+{{range .}}<tr><td>{{.AuditID}}</td><td>{{.Timestamp}}</td><td>{{.Action}}</td><td>{{.UserID}}</td><td>{{.Risk}}</td><td>{{.Details}}</td></tr>
+{{end}}</table>{{end}}
+<h2>Mudanças de status KYC</h2>
+{{template "auditTable" .KYCChanges}}
+
+<h2>Transações rejeitadas</h2>
+{{template "auditTable" .RejectedTxs}}
+
+<h2>Incidentes de validadores</h2>
+{{template "auditTable" .ValidatorIncidents}}
+</body>
+</html>
+`
+
+func (r *ComplianceReport) writeHTML(path string) error {
+	tmpl, err := template.New("compliance").Parse(complianceHTML)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return tmpl.Execute(file, r)
+}
+
+func loadNodePrivateKey(path string) (*KeyPair, *rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var keyPair KeyPair
+	if err := json.Unmarshal(data, &keyPair); err != nil {
+		return nil, nil, err
+	}
+
+	block, _ := pem.Decode([]byte(keyPair.PrivateKey))
+	if block == nil {
+		return nil, nil, fmt.Errorf("falha ao decodificar chave privada")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, nil, fmt.Errorf("não é uma chave RSA")
+	}
+	return &keyPair, rsaKey, nil
+}
+
+// loadNodePublicKey lê a chave pública do par de chaves do nó
+func loadNodePublicKey(path string) (*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keyPair KeyPair
+	if err := json.Unmarshal(data, &keyPair); err != nil {
+		return nil, err
+	}
+	return parsePublicKeyPEM([]byte(keyPair.PublicKey))
+}
+
+func parsePublicKeyPEM(data []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("falha ao decodificar chave pública")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("não é uma chave RSA")
+	}
+	return rsaPub, nil
+}
+
+// keyAddress deriva o endereço da chave pública (mesma regra de crypto/keypair.go)
+func keyAddress(pub *rsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(der)
+	return "SYRA" + base64.StdEncoding.EncodeToString(hash[:])[:32], nil
+}
+
+func fileSHA256(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// GenerateComplianceBundle gera HTML, CSVs e o manifesto assinado pelo nó
+func GenerateComplianceBundle(cfg ComplianceConfig, period string) (string, error) {
+	report, err := BuildComplianceReport(cfg, period)
+	if err != nil {
+		return "", err
+	}
+
+	keyPair, privateKey, err := loadNodePrivateKey(cfg.KeyPairPath)
+	if err != nil {
+		return "", fmt.Errorf("erro ao carregar chave do nó: %v", err)
+	}
+
+	dir := filepath.Join(cfg.OutputDir, period)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	if err := report.writeHTML(filepath.Join(dir, "report.html")); err != nil {
+		return "", fmt.Errorf("erro ao gerar HTML: %v", err)
+	}
+	if err := report.writeCSVFiles(dir); err != nil {
+		return "", fmt.Errorf("erro ao gerar CSV: %v", err)
+	}
+
+	manifest := ComplianceManifest{
+		Period:    period,
+		Start:     report.Start,
+		End:       report.End,
+		ChainTip:  report.ChainTip,
+		AuditHead: report.AuditHead,
+		Files:     make(map[string]string),
+		SignedBy:  keyPair.Address,
+	}
+	for _, name := range []string{
+		"report.html",
+		"transactions_by_counterparty.csv",
+		"large_transfers.csv",
+		"kyc_changes.csv",
+		"rejected_transactions.csv",
+		"validator_misbehaviour.csv",
+	} {
+		hash, err := fileSHA256(filepath.Join(dir, name))
+		if err != nil {
+			return "", err
+		}
+		manifest.Files[name] = hash
+	}
+
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "manifest.json"), manifestBytes, 0644); err != nil {
+		return "", err
+	}
+
+	// Assina o manifesto (que contém o hash de todos os arquivos)
+	digest := sha256.Sum256(manifestBytes)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	signatureFile := base64.StdEncoding.EncodeToString(signature) + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "manifest.sig"), []byte(signatureFile), 0644); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "node_public_key.pem"), []byte(keyPair.PublicKey), 0644); err != nil {
+		return "", err
+	}
+
+	return dir, nil
+}
+
+// VerifyComplianceBundle confere a assinatura e os hashes de um pacote com
+// a chave conhecida do nó. A node_public_key.pem do pacote não serve para
+// isso: quem altera o pacote pode reassiná-lo e trocar a chave junto.
+func VerifyComplianceBundle(dir string, trusted *rsa.PublicKey) error {
+	if trusted == nil {
+		return fmt.Errorf("chave pública do nó não informada")
+	}
+	manifestBytes, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return err
+	}
+	sigData, err := os.ReadFile(filepath.Join(dir, "manifest.sig"))
+	if err != nil {
+		return err
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sigData)))
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256(manifestBytes)
+	if err := rsa.VerifyPKCS1v15(trusted, crypto.SHA256, digest[:], signature); err != nil {
+		return fmt.Errorf("assinatura do manifesto inválida")
+	}
+
+	var manifest ComplianceManifest
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return err
+	}
+	address, err := keyAddress(trusted)
+	if err != nil {
+		return err
+	}
+	if manifest.SignedBy != address {
+		return fmt.Errorf("manifesto assinado por %s, esperado %s", manifest.SignedBy, address)
+	}
+	for name, expected := range manifest.Files {
+		hash, err := fileSHA256(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		if hash != expected {
+			return fmt.Errorf("arquivo %s foi alterado", name)
+		}
+	}
+	return nil
+}
+
+// previousPeriod é o mês anterior ao instante informado. A conta parte do
+// dia 1: AddDate(0, -1, 0) em 31/03 normaliza para 03/03 e daria março.
+func previousPeriod(now time.Time) string {
+	now = now.UTC()
+	firstDay := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return firstDay.AddDate(0, -1, 0).Format("2006-01")
+}
+
+// RunComplianceSchedule gera o pacote do mês anterior assim que ele fecha
+func RunComplianceSchedule(cfg ComplianceConfig, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		period := previousPeriod(time.Now())
+		if _, err := os.Stat(filepath.Join(cfg.OutputDir, period, "manifest.sig")); os.IsNotExist(err) {
+			dir, err := GenerateComplianceBundle(cfg, period)
+			if err != nil {
+				fmt.Printf("❌ Relatório de conformidade %s: %v\n", period, err)
+			} else {
+				fmt.Printf("📑 Relatório de conformidade %s gerado em %s\n", period, dir)
+			}
+		}
+		<-ticker.C
+	}
+}
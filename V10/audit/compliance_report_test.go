@@ -0,0 +1,182 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testKeyPair grava um par de chaves no formato de crypto/keypair.go
+func testKeyPair(t *testing.T, path string) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	private, _ := x509.MarshalPKCS8PrivateKey(key)
+	public, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	address, _ := keyAddress(&key.PublicKey)
+	data, _ := json.Marshal(KeyPair{
+		UserID:     "node1",
+		PublicKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public})),
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: private})),
+		Address:    address,
+	})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func testComplianceConfig(t *testing.T) (ComplianceConfig, *rsa.PrivateKey) {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := ComplianceConfig{
+		ChainPath:           filepath.Join(dir, "tokens.json"),
+		AuditPath:           filepath.Join(dir, "security_audit.jsonl"),
+		OutputDir:           filepath.Join(dir, "compliance_reports"),
+		KeyPairPath:         filepath.Join(dir, "keypair_node1.json"),
+		LargeTransferAmount: 1000,
+	}
+	chain := []Token{{Index: 1, Hash: "BLOCK_1", Timestamp: "2025-05-10T12:00:00Z", Transactions: []Transaction{
+		{ID: "tx1", Type: "transfer", From: "alice", To: "bob", Amount: 5000},
+	}}}
+	data, _ := json.Marshal(chain)
+	if err := os.WriteFile(cfg.ChainPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	rejected := testEntry("A1", "TRANSACTION_REJECTED", "saldo insuficiente")
+	if err := appendAuditLog(cfg.AuditPath, &rejected); err != nil {
+		t.Fatal(err)
+	}
+	return cfg, testKeyPair(t, cfg.KeyPairPath)
+}
+
+// resign reassina o manifesto como faria quem adulterou o pacote
+func resign(t *testing.T, dir string, key *rsa.PrivateKey, edit func(*ComplianceManifest)) {
+	t.Helper()
+	data, _ := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	var manifest ComplianceManifest
+	json.Unmarshal(data, &manifest)
+	edit(&manifest)
+	data, _ = json.MarshalIndent(manifest, "", "  ")
+	digest := sha256.Sum256(data)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, "manifest.json"), data, 0644)
+	os.WriteFile(filepath.Join(dir, "manifest.sig"), []byte(base64.StdEncoding.EncodeToString(signature)+"\n"), 0644)
+}
+
+func TestComplianceBundleVerifiesWithNodeKey(t *testing.T) {
+	cfg, nodeKey := testComplianceConfig(t)
+	dir, err := GenerateComplianceBundle(cfg, "2025-05")
+	if err != nil {
+		t.Fatal(err)
+	}
+	trusted, err := loadNodePublicKey(cfg.KeyPairPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyComplianceBundle(dir, trusted); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyComplianceBundle(dir, nil); err == nil {
+		t.Fatal("pacote verificado sem chave do nó")
+	}
+
+	// Arquivo alterado depois da assinatura
+	csvPath := filepath.Join(dir, "large_transfers.csv")
+	original, _ := os.ReadFile(csvPath)
+	os.WriteFile(csvPath, []byte(strings.ReplaceAll(string(original), "5000", "50")), 0644)
+	if err := VerifyComplianceBundle(dir, trusted); err == nil || !strings.Contains(err.Error(), "alterado") {
+		t.Fatalf("arquivo alterado aceito: %v", err)
+	}
+
+	// Quem altera o pacote reassina com a própria chave e troca a PEM do pacote
+	attacker := testKeyPair(t, filepath.Join(t.TempDir(), "keypair_attacker.json"))
+	resign(t, dir, attacker, func(m *ComplianceManifest) {
+		hash, _ := fileSHA256(csvPath)
+		m.Files["large_transfers.csv"] = hash
+		m.SignedBy, _ = keyAddress(&attacker.PublicKey)
+	})
+	public, _ := x509.MarshalPKIXPublicKey(&attacker.PublicKey)
+	os.WriteFile(filepath.Join(dir, "node_public_key.pem"), pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public}), 0644)
+	if err := VerifyComplianceBundle(dir, trusted); err == nil {
+		t.Fatal("pacote reassinado por outra chave aceito")
+	}
+
+	// Assinatura válida, mas o manifesto declara outro signatário
+	os.WriteFile(csvPath, original, 0644)
+	resign(t, dir, nodeKey, func(m *ComplianceManifest) {
+		hash, _ := fileSHA256(csvPath)
+		m.Files["large_transfers.csv"] = hash
+		m.SignedBy = "SYRAoutro"
+	})
+	if err := VerifyComplianceBundle(dir, trusted); err == nil || !strings.Contains(err.Error(), "assinado por") {
+		t.Fatalf("signatário divergente aceito: %v", err)
+	}
+}
+
+func TestPreviousPeriod(t *testing.T) {
+	cases := map[string]string{
+		"2026-03-31T10:00:00Z":      "2026-02",
+		"2026-03-01T00:00:00Z":      "2026-02",
+		"2026-05-31T23:59:59Z":      "2026-04",
+		"2026-01-15T08:00:00Z":      "2025-12",
+		"2026-03-01T01:00:00+03:00": "2026-01", // 28/02 22:00 em UTC
+	}
+	for now, want := range cases {
+		instant, err := time.Parse(time.RFC3339, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := previousPeriod(instant); got != want {
+			t.Errorf("%s: período %s, esperado %s", now, got, want)
+		}
+	}
+}
+
+func TestComplianceBundleListsValidatorIncidentsAndKYC(t *testing.T) {
+	cfg, _ := testComplianceConfig(t)
+
+	// Registros como os gravados pelo nó (network/audit_log.go) ao aplicar
+	// uma evidência e pela carteira (PWtSY) ao verificar o KYC
+	for _, entry := range []AuditLog{
+		{ID: "N1", Action: "DOUBLE_SIGN", UserID: "node-B", Details: "dupla assinatura na altura 2, rodada 0 (bloco 2)", Risk: "CRITICAL", Success: true},
+		{ID: "N2", Action: "VALIDATOR_SLASHED", UserID: "node-B", Details: "1 de stake retirados (10%) por dupla assinatura (bloco 2)", Risk: "HIGH", Success: true},
+		{ID: "N3", Action: "VALIDATOR_JAILED", UserID: "node-B", Details: "preso por dupla assinatura (bloco 2)", Risk: "HIGH", Success: true},
+		{ID: "W1", Action: "KYC_VERIFIED", UserID: "alice", Details: "KYC verificado pelo comando kyc da carteira", Risk: "MEDIUM", Success: true},
+	} {
+		entry.Timestamp = time.Date(2025, 5, 11, 9, 0, 0, 0, time.UTC)
+		if err := appendAuditLog(cfg.AuditPath, &entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dir, err := GenerateComplianceBundle(cfg, "2025-05")
+	if err != nil {
+		t.Fatal(err)
+	}
+	incidents, _ := os.ReadFile(filepath.Join(dir, "validator_misbehaviour.csv"))
+	for _, action := range []string{"DOUBLE_SIGN", "VALIDATOR_SLASHED", "VALIDATOR_JAILED"} {
+		if !strings.Contains(string(incidents), action+",node-B") {
+			t.Fatalf("%s ausente dos incidentes:\n%s", action, incidents)
+		}
+	}
+	kyc, _ := os.ReadFile(filepath.Join(dir, "kyc_changes.csv"))
+	if !strings.Contains(string(kyc), "KYC_VERIFIED,alice") {
+		t.Fatalf("mudança de KYC ausente:\n%s", kyc)
+	}
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"math/rand"
@@ -24,6 +23,8 @@ type ConsensusRound struct {
     BlockHash      string      `json:"block_hash"`
     SelectedValidator string   `json:"selected_validator"`
     Validators     []Validator `json:"validators"`
+    Slot           int         `json:"slot"`
+    Seed           string      `json:"seed"` // Semente RANDAO usada na seleção
     Timestamp      time.Time   `json:"timestamp"`
     Confirmed      bool        `json:"confirmed"`
 }
@@ -32,6 +33,8 @@ type StakePool struct {
     Validators map[string]*Validator `json:"validators"`
     TotalStake int                   `json:"total_stake"`
     MinStake   int                   `json:"min_stake"`
+    Seed       string                `json:"seed"` // Semente RANDAO copiada da cadeia
+    Slot       int                   `json:"slot"` // Próximo slot de seleção
 }
 
 func loadStakePool() *StakePool {
@@ -41,12 +44,19 @@ func loadStakePool() *StakePool {
             Validators: make(map[string]*Validator),
             TotalStake: 0,
             MinStake:   10, // Mínimo 10 SYRA para ser validador
+            Seed:       genesisSeed(),
         }
     }
     defer file.Close()
 
     var pool StakePool
     json.NewDecoder(file).Decode(&pool)
+    if pool.Validators == nil {
+        pool.Validators = make(map[string]*Validator)
+    }
+    if pool.Seed == "" {
+        pool.Seed = genesisSeed() // Pool gravado antes da semente
+    }
     return &pool
 }
 
@@ -66,6 +76,9 @@ func (sp *StakePool) addValidator(userID string, stake int, address string) erro
     if stake < sp.MinStake {
         return fmt.Errorf("stake mínimo é %d SYRA", sp.MinStake)
     }
+    if _, exists := sp.Validators[userID]; exists {
+        return fmt.Errorf("%s já é validador", userID)
+    }
 
     validator := &Validator{
         UserID:     userID,
@@ -81,57 +94,37 @@ func (sp *StakePool) addValidator(userID string, stake int, address string) erro
     return nil
 }
 
-func (sp *StakePool) selectValidator(blockHash string) *Validator {
-    if len(sp.Validators) == 0 {
-        return nil
-    }
-
-    // Algoritmo de seleção baseado em stake + reputação
-    var candidates []struct {
-        validator *Validator
-        weight    float64
-    }
-
+// selectValidator sorteia o validador do slot entre todos os ativos, com
+// probabilidade proporcional a stake * reputação. A semente é a do beacon
+// RANDAO da cadeia, então o resultado não depende do hash do bloco nem do
+// relógio local e todo nó chega ao mesmo validador.
+func (sp *StakePool) selectValidator(slot int) *Validator {
+    var candidates []*Validator
+    var totalWeight uint64
     for _, validator := range sp.Validators {
-        if !validator.IsActive {
-            continue
+        if validator.IsActive && validator.Stake > 0 && validator.Reputation > 0 {
+            candidates = append(candidates, validator)
+            totalWeight += uint64(validator.Stake) * uint64(validator.Reputation)
         }
-
-        // Peso = stake * (reputação/100) * fator temporal
-        timeFactor := 1.0
-        if time.Since(validator.LastValidation) < time.Hour {
-            timeFactor = 0.5 // Reduz chance se validou recentemente
-        }
-
-        weight := float64(validator.Stake) * (float64(validator.Reputation) / 100.0) * timeFactor
-        candidates = append(candidates, struct {
-            validator *Validator
-            weight    float64
-        }{validator, weight})
     }
-
-    if len(candidates) == 0 {
+    if totalWeight == 0 {
         return nil
     }
 
-    // Ordena por peso
+    // Ordem fixa para que o sorteio seja o mesmo em qualquer nó
     sort.Slice(candidates, func(i, j int) bool {
-        return candidates[i].weight > candidates[j].weight
+        return candidates[i].UserID < candidates[j].UserID
     })
 
-    // Seleciona randomicamente entre os top 3 candidatos
-    maxCandidates := 3
-    if len(candidates) < maxCandidates {
-        maxCandidates = len(candidates)
+    target := sampleIndex(sp.Seed, slot, totalWeight)
+    for _, validator := range candidates {
+        weight := uint64(validator.Stake) * uint64(validator.Reputation)
+        if target < weight {
+            return validator
+        }
+        target -= weight
     }
-
-    // Usa hash do bloco como seed para determinismo
-    hash := sha256.Sum256([]byte(blockHash))
-    seed := int64(hash[0])<<56 | int64(hash[1])<<48 | int64(hash[2])<<40 | int64(hash[3])<<32
-    randGen := rand.New(rand.NewSource(seed))
-
-    selectedIndex := randGen.Intn(maxCandidates)
-    return candidates[selectedIndex].validator
+    return candidates[len(candidates)-1]
 }
 
 func (sp *StakePool) processValidation(validatorID string, success bool) {
@@ -159,16 +152,20 @@ func (sp *StakePool) processValidation(validatorID string, success bool) {
 func performConsensus(blockHash string) *ConsensusRound {
     pool := loadStakePool()
     
-    // Seleciona validador
-    selectedValidator := pool.selectValidator(blockHash)
+    // Seleciona validador do próximo slot
+    slot := pool.Slot
+    selectedValidator := pool.selectValidator(slot)
     if selectedValidator == nil {
         return nil
     }
+    pool.Slot++
 
     round := &ConsensusRound{
         RoundID:           fmt.Sprintf("ROUND_%d", time.Now().UnixNano()),
         BlockHash:         blockHash,
         SelectedValidator: selectedValidator.UserID,
+        Slot:              slot,
+        Seed:              pool.Seed,
         Timestamp:         time.Now(),
         Confirmed:         false,
     }
@@ -182,8 +179,8 @@ func performConsensus(blockHash string) *ConsensusRound {
 
     // Simula processo de consenso (em implementação real seria distribuído)
     fmt.Printf("🔄 Consenso iniciado para bloco %s\n", blockHash[:16])
-    fmt.Printf("   Validador selecionado: %s (Stake: %d, Reputação: %d)\n", 
-        selectedValidator.UserID, selectedValidator.Stake, selectedValidator.Reputation)
+    fmt.Printf("   Validador selecionado: %s (Stake: %d, Reputação: %d, slot %d, semente %s)\n",
+        selectedValidator.UserID, selectedValidator.Stake, selectedValidator.Reputation, slot, pool.Seed[:16])
 
     // Simula validação
     time.Sleep(time.Millisecond * 100) // Simula tempo de processamento
@@ -226,11 +223,13 @@ func performConsensus(blockHash string) *ConsensusRound {
 
 func main() {
     if len(os.Args) < 2 {
-        fmt.Println("Uso: go run pos_consensus.go <comando> [parametros]")
+        fmt.Println("Uso: go run . <comando> [parametros]")
         fmt.Println("Comandos:")
         fmt.Println("  add_validator <user_id> <stake> <address> - Adiciona validador")
         fmt.Println("  consensus <block_hash>                   - Executa consenso")
         fmt.Println("  pool_status                              - Status do pool")
+        fmt.Println("  seed <semente>                           - Usa a semente RANDAO publicada pela cadeia")
+        fmt.Println("  select <slot>                            - Validador sorteado para o slot")
         return
     }
 
@@ -274,6 +273,7 @@ func main() {
         fmt.Printf("Total de Stake: %d SYRA\n", pool.TotalStake)
         fmt.Printf("Stake Mínimo: %d SYRA\n", pool.MinStake)
         fmt.Printf("Validadores Ativos: %d\n", len(pool.Validators))
+        fmt.Printf("Semente RANDAO: %s\n", pool.Seed)
         
         for _, validator := range pool.Validators {
             status := "INATIVO"
@@ -284,6 +284,35 @@ func main() {
                 validator.UserID, validator.Stake, validator.Reputation, status)
         }
 
+    case "seed":
+        if len(os.Args) < 3 {
+            fmt.Println("Erro: informe a semente (comando beacon do console do nó)")
+            return
+        }
+        pool := loadStakePool()
+        if err := pool.setSeed(os.Args[2]); err != nil {
+            fmt.Printf("Erro: %v\n", err)
+            return
+        }
+        pool.saveStakePool()
+        fmt.Printf("🎲 Semente RANDAO atualizada: %s\n", pool.Seed[:16])
+
+    case "select":
+        if len(os.Args) < 3 {
+            fmt.Println("Erro: informe o slot")
+            return
+        }
+        var slot int
+        fmt.Sscanf(os.Args[2], "%d", &slot)
+
+        pool := loadStakePool()
+        validator := pool.selectValidator(slot)
+        if validator == nil {
+            fmt.Println("Nenhum validador disponível")
+            return
+        }
+        fmt.Printf("Slot %d (semente %s): %s\n", slot, pool.Seed[:16], validator.UserID)
+
     default:
         fmt.Println("Comando não reconhecido")
     }
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+)
+
+// Semente RANDAO da seleção. Os compromissos e as revelações são transações
+// assinadas da cadeia (network/randao.go) e a semente de cada época sai do
+// estado replicado; este pool só a copia (comando "seed", com o valor do
+// comando "beacon" do console do nó) para sortear os slots localmente. A
+// seleção usa a semente e o número do slot, nunca o hash do bloco.
+
+const (
+	randaoGenesisSeed   = "PTW_RANDAO_GENESIS"
+	maxSamplingAttempts = 64
+)
+
+// genesisSeed é a semente da primeira época, a mesma da cadeia
+func genesisSeed() string {
+	seed := sha256.Sum256([]byte(randaoGenesisSeed))
+	return hex.EncodeToString(seed[:])
+}
+
+// setSeed troca a semente por uma publicada pela cadeia
+func (sp *StakePool) setSeed(seed string) error {
+	if raw, err := hex.DecodeString(seed); err != nil || len(raw) != sha256.Size {
+		return fmt.Errorf("semente deve ser um SHA-256 em hex")
+	}
+	sp.Seed = seed
+	return nil
+}
+
+// sampleIndex sorteia um número em [0, n) a partir da semente e do slot,
+// sem viés de módulo
+func sampleIndex(seed string, slot int, n uint64) uint64 {
+	limit := ^uint64(0) - ^uint64(0)%n
+	for attempt := 0; attempt < maxSamplingAttempts; attempt++ {
+		h := sha256.New()
+		fmt.Fprintf(h, "%s|%d|%d", seed, slot, attempt)
+		v := binary.BigEndian.Uint64(h.Sum(nil))
+		if v < limit {
+			return v % n
+		}
+	}
+	return 0
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func testPool(t *testing.T, stakes map[string]int) *StakePool {
+	t.Helper()
+	pool := &StakePool{Validators: make(map[string]*Validator), MinStake: 10, Seed: genesisSeed()}
+	for id, stake := range stakes {
+		if err := pool.addValidator(id, stake, "SYRA_"+id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return pool
+}
+
+// randaoSeed gera uma semente no formato da publicada pela cadeia
+func randaoSeed(label string) string {
+	sum := sha256.Sum256([]byte(label))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestSelectionFollowsChainSeed(t *testing.T) {
+	stakes := map[string]int{"alice": 100, "bob": 50, "carol": 30}
+	first, second, other := testPool(t, stakes), testPool(t, stakes), testPool(t, stakes)
+	seed := randaoSeed("época 1")
+	if err := first.setSeed(seed); err != nil {
+		t.Fatal(err)
+	}
+	second.setSeed(seed)
+	other.setSeed(randaoSeed("época 2"))
+
+	differs := false
+	for slot := 0; slot < 50; slot++ {
+		chosen := first.selectValidator(slot).UserID
+		if chosen != second.selectValidator(slot).UserID {
+			t.Fatalf("slot %d sorteou validadores diferentes", slot)
+		}
+		differs = differs || chosen != other.selectValidator(slot).UserID
+	}
+	if !differs {
+		t.Fatal("seleção não depende da semente")
+	}
+	if err := first.setSeed("não é hex"); err == nil || first.Seed != seed {
+		t.Fatal("semente inválida aceita")
+	}
+}
+
+func TestSelectionIsStakeWeightedOverAllValidators(t *testing.T) {
+	stakes := map[string]int{"v1": 400, "v2": 200, "v3": 100, "v4": 100, "v5": 100, "v6": 100}
+	pool := testPool(t, stakes)
+
+	const slots = 20000
+	counts := make(map[string]int)
+	for slot := 0; slot < slots; slot++ {
+		counts[pool.selectValidator(slot).UserID]++
+	}
+
+	// Todos os ativos são sorteados, não só os 3 de maior peso
+	total := 0
+	for _, stake := range stakes {
+		total += stake
+	}
+	for id, stake := range stakes {
+		expected := float64(slots) * float64(stake) / float64(total)
+		if got := float64(counts[id]); got < expected*0.85 || got > expected*1.15 {
+			t.Fatalf("%s sorteado %d vezes, esperado ~%.0f", id, counts[id], expected)
+		}
+	}
+
+	pool.Validators["v1"].IsActive = false
+	for slot := 0; slot < 1000; slot++ {
+		if pool.selectValidator(slot).UserID == "v1" {
+			t.Fatal("validador inativo sorteado")
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tabelas de endereços no estilo do addrman do Bitcoin Core: cada endereço
+// ocupa uma posição fixa, escolhida por um hash com chave secreta. Quem não
+// conhece a chave não consegue escolher endereços que caiam em buckets
+// livres, e cada grupo de rede só alcança uma fração fixa das tabelas.
+const (
+	addrBucketSize           = 64 // Posições por bucket
+	newBucketsPerSourceGroup = 64 // Buckets "new" alcançáveis por uma mesma origem
+	triedBucketsPerGroup     = 8  // Buckets "tried" alcançáveis por uma mesma /16
+
+	localNetGroup = "local" // Loopback e redes privadas
+
+	addrHorizon     = 30 * 24 * time.Hour // Sem notícias há mais que isso: descartável
+	addrRetries     = 3                   // Falhas sem nenhum sucesso
+	addrMaxFailures = 10                  // Falhas toleradas de quem já funcionou
+	addrMinFailAge  = 7 * 24 * time.Hour  // ... se não for visto há uma semana
+)
+
+type addrTable int
+
+const (
+	tableNone addrTable = iota
+	tableNew
+	tableTried
+)
+
+// addrBuckets mapeia bucket -> posição -> "ip:porta" (só os ocupados)
+type addrBuckets map[int]map[int]string
+
+func (b addrBuckets) count() int {
+	total := 0
+	for _, slots := range b {
+		total += len(slots)
+	}
+	return total
+}
+
+func (addr *KnownAddress) key() string {
+	return net.JoinHostPort(addr.IP, addr.Port)
+}
+
+// isTerrible indica endereços que podem ser substituídos numa colisão
+func (addr *KnownAddress) isTerrible(now time.Time) bool {
+	// Tentado no último minuto: ainda não dá para julgar
+	if now.Sub(addr.LastAttempt) < time.Minute {
+		return false
+	}
+	if now.Sub(addr.LastSeen) > addrHorizon {
+		return true
+	}
+	if addr.ConnectSuccess == 0 && addr.ConnectFailures >= addrRetries {
+		return true
+	}
+	return addr.ConnectFailures >= addrMaxFailures && now.Sub(addr.LastSeen) > addrMinFailAge
+}
+
+// netGroup agrupa o IP pela faixa que um mesmo operador costuma controlar:
+// /16 no IPv4 e /32 no IPv6. Loopback e redes privadas formam um grupo só.
+func netGroup(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return "host:" + strings.ToLower(ip)
+	}
+	if parsed.IsLoopback() || parsed.IsPrivate() || parsed.IsLinkLocalUnicast() || parsed.IsUnspecified() {
+		return localNetGroup
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return fmt.Sprintf("%d.%d.0.0/16", v4[0], v4[1])
+	}
+	prefix := make(net.IP, net.IPv6len)
+	copy(prefix, parsed.To16()[:4])
+	return prefix.String() + "/32"
+}
+
+// sourceGroup identifica quem anunciou o endereço: o grupo de rede do peer
+// ou, sem IP, o tipo da fonte ("dns", "hardcoded", ...)
+func sourceGroup(source, sourceIP string) string {
+	if sourceIP == "" {
+		return "source:" + source
+	}
+	return netGroup(sourceIP)
+}
+
+// loadBucketKey lê a chave secreta dos buckets ou gera uma nova. A chave
+// persiste para que as posições sobrevivam a reinícios.
+func loadBucketKey(path string) [32]byte {
+	var key [32]byte
+	if data, err := os.ReadFile(path); err == nil {
+		raw, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err == nil && len(raw) == len(key) {
+			copy(key[:], raw)
+			return key
+		}
+		fmt.Printf("⚠️ Chave dos buckets inválida em %s, gerando outra\n", path)
+	}
+
+	if _, err := crand.Read(key[:]); err != nil {
+		panic(fmt.Sprintf("erro ao gerar chave dos buckets: %v", err))
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(key[:])), 0600); err != nil {
+		fmt.Printf("⚠️ Não foi possível gravar a chave dos buckets: %v\n", err)
+	}
+	return key
+}
+
+func (am *AddrManager) keyedHash(parts ...string) uint64 {
+	h := sha256.New()
+	h.Write(am.key[:])
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return binary.BigEndian.Uint64(h.Sum(nil)[:8])
+}
+
+// newBucket: cada origem só alcança newBucketsPerSourceGroup buckets
+func (am *AddrManager) newBucket(group, source string) int {
+	h1 := am.keyedHash("new1", group, source) % newBucketsPerSourceGroup
+	return int(am.keyedHash("new2", source, strconv.FormatUint(h1, 10)) % uint64(am.maxNewBuckets))
+}
+
+// triedBucket: cada /16 só alcança triedBucketsPerGroup buckets
+func (am *AddrManager) triedBucket(key, group string) int {
+	h1 := am.keyedHash("tried1", key) % triedBucketsPerGroup
+	return int(am.keyedHash("tried2", group, strconv.FormatUint(h1, 10)) % uint64(am.maxTriedBuckets))
+}
+
+func (am *AddrManager) bucketPosition(table addrTable, bucket int, key string) int {
+	return int(am.keyedHash("pos", strconv.Itoa(int(table)), strconv.Itoa(bucket), key) % addrBucketSize)
+}
+
+func (am *AddrManager) tableFor(table addrTable) addrBuckets {
+	if table == tableTried {
+		return am.triedTable
+	}
+	return am.newTable
+}
+
+// detach tira o endereço da posição que ocupa (o registro continua)
+func (am *AddrManager) detach(addr *KnownAddress) {
+	if addr.table == tableNone {
+		return
+	}
+	table := am.tableFor(addr.table)
+	if slots := table[addr.bucket]; slots[addr.pos] == addr.key() {
+		delete(slots, addr.pos)
+		if len(slots) == 0 {
+			delete(table, addr.bucket)
+		}
+	}
+	addr.table = tableNone
+}
+
+func (am *AddrManager) place(addr *KnownAddress, table addrTable, bucket, pos int) {
+	buckets := am.tableFor(table)
+	if buckets[bucket] == nil {
+		buckets[bucket] = make(map[int]string)
+	}
+	buckets[bucket][pos] = addr.key()
+	addr.table, addr.bucket, addr.pos = table, bucket, pos
+}
+
+// forgetIfUnused apaga o registro de um endereço fora das tabelas, a não
+// ser que ele guarde um ban ou um pin de chave
+func (am *AddrManager) forgetIfUnused(key string) {
+	addr, exists := am.knownAddresses[key]
+	if !exists || addr.table != tableNone || addr.Banned || addr.KeyPin != "" {
+		return
+	}
+	delete(am.knownAddresses, key)
+}
+
+// addToNew põe o endereço no bucket "new" da sua origem. Uma posição
+// ocupada só é tomada de um endereço ruim; senão o novo é recusado.
+func (am *AddrManager) addToNew(addr *KnownAddress) bool {
+	if addr.table != tableNone {
+		return true
+	}
+
+	key := addr.key()
+	bucket := am.newBucket(netGroup(addr.IP), addr.SourceGroup)
+	pos := am.bucketPosition(tableNew, bucket, key)
+
+	if occupant, taken := am.newTable[bucket][pos]; taken {
+		existing := am.knownAddresses[occupant]
+		if existing != nil && !existing.isTerrible(time.Now()) {
+			return false
+		}
+		delete(am.newTable[bucket], pos)
+		if existing != nil {
+			existing.table = tableNone
+			am.forgetIfUnused(occupant)
+		}
+	}
+
+	am.place(addr, tableNew, bucket, pos)
+	return true
+}
+
+// makeTried move o endereço para o bucket "tried" da sua /16. Quem
+// ocupava a posição volta para "new" em vez de ser esquecido.
+func (am *AddrManager) makeTried(addr *KnownAddress) {
+	if addr.table == tableTried {
+		return
+	}
+	am.detach(addr)
+
+	key := addr.key()
+	bucket := am.triedBucket(key, netGroup(addr.IP))
+	pos := am.bucketPosition(tableTried, bucket, key)
+
+	if occupant, taken := am.triedTable[bucket][pos]; taken {
+		delete(am.triedTable[bucket], pos)
+		if evicted := am.knownAddresses[occupant]; evicted != nil {
+			evicted.table = tableNone
+			if !am.addToNew(evicted) {
+				am.forgetIfUnused(occupant)
+			}
+		}
+	}
+
+	am.place(addr, tableTried, bucket, pos)
+}
+
+// sampleTable percorre os buckets ocupados em ordem aleatória, tirando um
+// endereço de cada por rodada: um grupo confinado a poucos buckets não
+// domina a amostra, por mais endereços que tenha anunciado
+func (am *AddrManager) sampleTable(table addrBuckets, max int, accept func(*KnownAddress) bool) []*KnownAddress {
+	queues := make([][]string, 0, len(table))
+	for _, slots := range table {
+		keys := make([]string, 0, len(slots))
+		for _, key := range slots {
+			keys = append(keys, key)
+		}
+		am.rand.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+		queues = append(queues, keys)
+	}
+	am.rand.Shuffle(len(queues), func(i, j int) { queues[i], queues[j] = queues[j], queues[i] })
+
+	result := make([]*KnownAddress, 0, max)
+	for len(result) < max && len(queues) > 0 {
+		next := queues[:0]
+		for _, queue := range queues {
+			if len(result) >= max {
+				break
+			}
+			if addr := am.knownAddresses[queue[0]]; addr != nil && accept(addr) {
+				result = append(result, addr)
+			}
+			if len(queue) > 1 {
+				next = append(next, queue[1:])
+			}
+		}
+		queues = next
+	}
+	return result
+}
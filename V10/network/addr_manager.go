@@ -7,10 +7,14 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 )
 
+// Máximo de conexões de saída gravadas como âncoras
+const maxAnchors = 2
+
 // Estrutura que representa um endereço de peer conhecido
 type KnownAddress struct {
 	IP              string    `json:"ip"`
@@ -20,23 +24,39 @@ type KnownAddress struct {
 	AttemptCount    int       `json:"attempt_count"`
 	ConnectSuccess  int       `json:"connect_success"`
 	ConnectFailures int       `json:"connect_failures"`
-	Source          string    `json:"source"` // "dns", "peer", "local", "hardcoded"
+	Source          string    `json:"source"` // "dns", "dht", "peer", "local", "hardcoded"
 	Services        uint64    `json:"services"`
 	Banned          bool      `json:"banned"`
 	BanExpires      time.Time `json:"ban_expires"`
+	BanReason       string    `json:"ban_reason,omitempty"`
+	NodeID          string    `json:"node_id,omitempty"`
+	KeyPin          string    `json:"key_pin,omitempty"`      // Fingerprint da chave do nó (TOFU)
+	SourceGroup     string    `json:"source_group,omitempty"` // Grupo de rede de quem anunciou o endereço
+
+	// Posição nas tabelas de buckets (recalculada ao carregar)
+	table  addrTable
+	bucket int
+	pos    int
 }
 
 // Gerenciador de endereços conhecido
 type AddrManager struct {
 	mtx             sync.RWMutex
+	saveMtx         sync.Mutex               // Serializa gravações do arquivo de peers
 	knownAddresses  map[string]*KnownAddress // key = "ip:port"
 	filePath        string
-	newAddresses    map[string]*KnownAddress // Endereços recentemente descobertos
-	triedAddresses  map[string]*KnownAddress // Endereços já tentados
+	newTable        addrBuckets // Endereços recentemente descobertos, por origem
+	triedTable      addrBuckets // Endereços já conectados com sucesso, por /16
 	maxNewBuckets   int
 	maxTriedBuckets int
+	key             [32]byte // Chave secreta que espalha os endereços pelos buckets
+	anchorsPath     string
+	anchors         []string // Conexões de saída da execução anterior
 	saveInterval    time.Duration
 	rand            *rand.Rand
+	stop            chan struct{} // Fechado no Stop
+	saverDone       chan struct{} // Fechado quando a rotina de salvamento termina
+	stopOnce        sync.Once
 }
 
 // Cria novo gerenciador de endereços
@@ -48,11 +68,13 @@ func NewAddrManager(dataDir string) *AddrManager {
 
 	return &AddrManager{
 		knownAddresses:  make(map[string]*KnownAddress),
-		newAddresses:    make(map[string]*KnownAddress),
-		triedAddresses:  make(map[string]*KnownAddress),
+		newTable:        make(addrBuckets),
+		triedTable:      make(addrBuckets),
 		filePath:        filepath.Join(dataDir, "peers.json"),
 		maxNewBuckets:   1024,
 		maxTriedBuckets: 256,
+		key:             loadBucketKey(filepath.Join(dataDir, "addrman.key")),
+		anchorsPath:     filepath.Join(dataDir, "anchors.json"),
 		saveInterval:    5 * time.Minute,
 		rand:            rand.New(rand.NewSource(time.Now().UnixNano())),
 	}
@@ -60,20 +82,40 @@ func NewAddrManager(dataDir string) *AddrManager {
 
 // Inicia o gerenciador e carrega endereços do disco
 func (am *AddrManager) Start() {
-	// Carrega endereços salvos
+	// Carrega endereços salvos e as âncoras da última execução
 	am.loadAddresses()
+	am.loadAnchors()
 
 	// Inicia rotina de salvamento periódico
+	am.stop = make(chan struct{})
+	am.saverDone = make(chan struct{})
 	go func() {
+		defer close(am.saverDone)
 		ticker := time.NewTicker(am.saveInterval)
 		defer ticker.Stop()
 
-		for range ticker.C {
-			am.saveAddresses()
+		for {
+			select {
+			case <-am.stop:
+				return
+			case <-ticker.C:
+				am.saveAddresses()
+			}
 		}
 	}()
 }
 
+// Stop encerra o salvamento periódico e grava os endereços uma última vez
+func (am *AddrManager) Stop() {
+	am.stopOnce.Do(func() {
+		if am.stop != nil {
+			close(am.stop)
+			<-am.saverDone
+		}
+		am.saveAddresses()
+	})
+}
+
 // Carrega endereços conhecidos do disco
 func (am *AddrManager) loadAddresses() {
 	am.mtx.Lock()
@@ -93,24 +135,32 @@ func (am *AddrManager) loadAddresses() {
 		return
 	}
 
-	// Processa os endereços carregados
+	// Processa os endereços carregados. As posições dependem da chave
+	// secreta, então são recalculadas em vez de lidas do arquivo.
 	for _, addr := range addresses {
 		key := net.JoinHostPort(addr.IP, addr.Port)
+		if addr.SourceGroup == "" {
+			addr.SourceGroup = sourceGroup(addr.Source, "")
+		}
 		am.knownAddresses[key] = addr
 
 		// Endereços que já foram conectados com sucesso vão para tried
 		if addr.ConnectSuccess > 0 {
-			am.triedAddresses[key] = addr
-		} else {
-			am.newAddresses[key] = addr
+			am.makeTried(addr)
+		} else if !am.addToNew(addr) {
+			am.forgetIfUnused(key)
 		}
 	}
 
-	fmt.Printf("📋 Carregados %d peers conhecidos do disco\n", len(addresses))
+	fmt.Printf("📋 Carregados %d peers conhecidos do disco (%d new, %d tried)\n",
+		len(am.knownAddresses), am.newTable.count(), am.triedTable.count())
 }
 
 // Salva endereços conhecidos no disco
 func (am *AddrManager) saveAddresses() {
+	am.saveMtx.Lock()
+	defer am.saveMtx.Unlock()
+
 	am.mtx.RLock()
 	defer am.mtx.RUnlock()
 
@@ -149,6 +199,13 @@ func (am *AddrManager) saveAddresses() {
 
 // Adiciona um novo endereço
 func (am *AddrManager) AddAddress(ip, port, source string) {
+	am.AddAddressFrom(ip, port, source, "")
+}
+
+// AddAddressFrom adiciona um endereço anunciado pelo peer em sourceIP.
+// O bucket "new" depende do grupo de rede de quem anunciou: um atacante
+// que controla uma faixa só alcança uma fração fixa da tabela.
+func (am *AddrManager) AddAddressFrom(ip, port, source, sourceIP string) {
 	am.mtx.Lock()
 	defer am.mtx.Unlock()
 
@@ -160,6 +217,10 @@ func (am *AddrManager) AddAddress(ip, port, source string) {
 		if source == "hardcoded" || source == "dns" {
 			addr.Source = source
 		}
+		// Registros de ban/pin fora das tabelas voltam a ser candidatos
+		if addr.table == tableNone && !addr.Banned {
+			am.addToNew(addr)
+		}
 		return
 	}
 
@@ -169,11 +230,191 @@ func (am *AddrManager) AddAddress(ip, port, source string) {
 		Port:         port,
 		LastSeen:     time.Now(),
 		Source:       source,
+		SourceGroup:  sourceGroup(source, sourceIP),
 		AttemptCount: 0,
 	}
 
-	am.knownAddresses[key] = addr
-	am.newAddresses[key] = addr
+	// Sem posição livre no bucket o endereço é descartado
+	if am.addToNew(addr) {
+		am.knownAddresses[key] = addr
+	}
+}
+
+// Registra os serviços anunciados por um peer no handshake
+func (am *AddrManager) SetServices(ip, port string, services uint64) {
+	am.mtx.Lock()
+	defer am.mtx.Unlock()
+
+	if addr, exists := am.knownAddresses[net.JoinHostPort(ip, port)]; exists {
+		addr.Services = services
+		addr.LastSeen = time.Now()
+	}
+}
+
+// PinNodeKey fixa a chave do nó no primeiro contato (TOFU) e a exige depois.
+// Retorna erro se o ID já estiver fixado a outra chave.
+func (am *AddrManager) PinNodeKey(nodeID, ip, port, fingerprint string) error {
+	am.mtx.Lock()
+
+	for _, addr := range am.knownAddresses {
+		if addr.NodeID == nodeID && addr.KeyPin != "" && addr.KeyPin != fingerprint {
+			am.mtx.Unlock()
+			return fmt.Errorf("chave do nó %s não corresponde à chave fixada (%.16s...)", nodeID, addr.KeyPin)
+		}
+	}
+
+	key := net.JoinHostPort(ip, port)
+	addr, exists := am.knownAddresses[key]
+	if !exists {
+		addr = &KnownAddress{
+			IP:          ip,
+			Port:        port,
+			LastSeen:    time.Now(),
+			Source:      "peer",
+			SourceGroup: sourceGroup("peer", ip),
+		}
+		// O pin fica guardado mesmo que o bucket esteja cheio
+		am.knownAddresses[key] = addr
+		am.addToNew(addr)
+	}
+
+	newPin := addr.NodeID != nodeID || addr.KeyPin != fingerprint
+	addr.NodeID = nodeID
+	addr.KeyPin = fingerprint
+	am.mtx.Unlock()
+
+	// Persiste imediatamente novos pins
+	if newPin {
+		fmt.Printf("📌 Chave do nó %s fixada (%.16s...)\n", nodeID, fingerprint)
+		go am.saveAddresses()
+	}
+	return nil
+}
+
+// PinnedKey retorna a fingerprint fixada para o ID do nó, se houver
+func (am *AddrManager) PinnedKey(nodeID string) string {
+	am.mtx.RLock()
+	defer am.mtx.RUnlock()
+
+	for _, addr := range am.knownAddresses {
+		if addr.NodeID == nodeID && addr.KeyPin != "" {
+			return addr.KeyPin
+		}
+	}
+	return ""
+}
+
+// Ban bane o endereço até a expiração e grava o arquivo de peers na hora,
+// para que o ban sobreviva a um reinício do nó
+func (am *AddrManager) Ban(ip, port, nodeID string, duration time.Duration, reason string) {
+	am.mtx.Lock()
+	key := net.JoinHostPort(ip, port)
+	addr, exists := am.knownAddresses[key]
+	if !exists {
+		// Endereços banidos não entram nas tabelas, só no registro
+		addr = &KnownAddress{
+			IP:          ip,
+			Port:        port,
+			LastSeen:    time.Now(),
+			Source:      "peer",
+			SourceGroup: sourceGroup("peer", ip),
+		}
+		am.knownAddresses[key] = addr
+	}
+	if nodeID != "" {
+		addr.NodeID = nodeID
+	}
+	addr.Banned = true
+	addr.BanExpires = time.Now().Add(duration)
+	addr.BanReason = reason
+	am.mtx.Unlock()
+
+	fmt.Printf("🚫 %s banido até %s (%s)\n", key, addr.BanExpires.Format(time.RFC3339), reason)
+	am.saveAddresses()
+}
+
+// BanNode bane todos os endereços já associados ao ID do nó.
+// Retorna quantos endereços foram banidos.
+func (am *AddrManager) BanNode(nodeID string, duration time.Duration, reason string) int {
+	am.mtx.Lock()
+	count := 0
+	for _, addr := range am.knownAddresses {
+		if addr.NodeID != nodeID {
+			continue
+		}
+		addr.Banned = true
+		addr.BanExpires = time.Now().Add(duration)
+		addr.BanReason = reason
+		count++
+	}
+	am.mtx.Unlock()
+
+	if count > 0 {
+		fmt.Printf("🚫 Nó %s banido em %d endereço(s) (%s)\n", nodeID, count, reason)
+		am.saveAddresses()
+	}
+	return count
+}
+
+// Unban remove o ban dos endereços que correspondem ao alvo
+// ("ip:porta", IP ou ID do nó). Retorna quantos foram liberados.
+func (am *AddrManager) Unban(target string) int {
+	am.mtx.Lock()
+	count := 0
+	for key, addr := range am.knownAddresses {
+		if !addr.Banned || (key != target && addr.IP != target && addr.NodeID != target) {
+			continue
+		}
+		addr.Banned = false
+		addr.BanExpires = time.Time{}
+		addr.BanReason = ""
+		count++
+	}
+	am.mtx.Unlock()
+
+	if count > 0 {
+		am.saveAddresses()
+	}
+	return count
+}
+
+// IsBanned informa se o endereço ou o ID do nó têm ban ativo
+func (am *AddrManager) IsBanned(ip, port, nodeID string) bool {
+	am.mtx.RLock()
+	defer am.mtx.RUnlock()
+
+	now := time.Now()
+	if addr, exists := am.knownAddresses[net.JoinHostPort(ip, port)]; exists &&
+		addr.Banned && now.Before(addr.BanExpires) {
+		return true
+	}
+	if nodeID == "" {
+		return false
+	}
+	for _, addr := range am.knownAddresses {
+		if addr.NodeID == nodeID && addr.Banned && now.Before(addr.BanExpires) {
+			return true
+		}
+	}
+	return false
+}
+
+// BannedAddresses lista cópias dos endereços com ban ativo, do que expira primeiro
+func (am *AddrManager) BannedAddresses() []KnownAddress {
+	am.mtx.RLock()
+	defer am.mtx.RUnlock()
+
+	now := time.Now()
+	result := []KnownAddress{}
+	for _, addr := range am.knownAddresses {
+		if addr.Banned && now.Before(addr.BanExpires) {
+			result = append(result, *addr)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].BanExpires.Before(result[j].BanExpires)
+	})
+	return result
 }
 
 // Marca um endereço como tentado
@@ -195,8 +436,7 @@ func (am *AddrManager) Attempt(ip, port string, success bool) {
 		addr.LastSeen = time.Now()
 
 		// Mover para "tried" bucket
-		delete(am.newAddresses, key)
-		am.triedAddresses[key] = addr
+		am.makeTried(addr)
 	} else {
 		addr.ConnectFailures++
 
@@ -208,48 +448,42 @@ func (am *AddrManager) Attempt(ip, port string, success bool) {
 	}
 }
 
-// Obtém um lote de endereços bons para tentar
+// Obtém um lote de endereços para tentar. A amostragem percorre os
+// buckets, não os endereços, para que nenhum grupo de rede domine o lote.
 func (am *AddrManager) GetAddresses(max int, includeNew, includeTried bool) []*KnownAddress {
-	am.mtx.RLock()
-	defer am.mtx.RUnlock()
+	am.mtx.Lock() // am.rand não é seguro para uso concorrente
+	defer am.mtx.Unlock()
 
 	now := time.Now()
 	result := make([]*KnownAddress, 0, max)
 	added := make(map[string]bool)
 
-	addFromMap := func(addresses map[string]*KnownAddress, count int) int {
-		addedCount := 0
-		for key, addr := range addresses {
-			if len(result) >= max || addedCount >= count {
-				break
-			}
-
-			// Pula endereços banidos
-			if addr.Banned && now.Before(addr.BanExpires) {
-				continue
-			}
-
-			// Evita duplicatas
-			if added[key] {
-				continue
-			}
-
+	accept := func(addr *KnownAddress) bool {
+		// Pula endereços banidos e evita duplicatas
+		return !(addr.Banned && now.Before(addr.BanExpires)) && !added[addr.key()]
+	}
+	addFrom := func(table addrBuckets, count int) {
+		for _, addr := range am.sampleTable(table, count, accept) {
 			result = append(result, addr)
-			added[key] = true
-			addedCount++
+			added[addr.key()] = true
 		}
-		return addedCount
 	}
 
-	// Primeiro, adiciona endereços já testados com sucesso (mais confiáveis)
+	// Primeiro, metade do lote vem dos endereços já testados com sucesso
 	if includeTried {
-		addFromMap(am.triedAddresses, max/2)
+		count := max / 2
+		if !includeNew {
+			count = max
+		}
+		addFrom(am.triedTable, count)
 	}
 
-	// Depois, se precisar, adiciona novos endereços
+	// Depois completa com novos endereços e, se faltar, de novo com tried
 	if includeNew && len(result) < max {
-		remaining := max - len(result)
-		addFromMap(am.newAddresses, remaining)
+		addFrom(am.newTable, max-len(result))
+	}
+	if includeTried && len(result) < max {
+		addFrom(am.triedTable, max-len(result))
 	}
 
 	// Embaralha a lista para não favorecer sempre os mesmos peers
@@ -260,49 +494,30 @@ func (am *AddrManager) GetAddresses(max int, includeNew, includeTried bool) []*K
 	return result
 }
 
-// GetGoodAddresses retorna endereços com boa reputação
+// GetGoodAddresses retorna endereços com boa reputação: primeiro os de
+// tried, depois os de new, sempre sem os que já se mostraram ruins
 func (am *AddrManager) GetGoodAddresses(max int) []*KnownAddress {
-	am.mtx.RLock()
-	defer am.mtx.RUnlock()
+	am.mtx.Lock() // am.rand não é seguro para uso concorrente
+	defer am.mtx.Unlock()
 
 	now := time.Now()
 	result := make([]*KnownAddress, 0, max)
 	added := make(map[string]bool)
 
-	// Primeiro adiciona endereços "tried" com alta taxa de sucesso
-	for key, addr := range am.triedAddresses {
+	accept := func(addr *KnownAddress) bool {
 		if addr.Banned && now.Before(addr.BanExpires) {
-			continue
-		}
-
-		// Calcula pontuação de confiabilidade
-		successRatio := float64(addr.ConnectSuccess) / float64(addr.AttemptCount+1)
-
-		// Peers bons têm alto índice de sucesso
-		if successRatio > 0.7 {
-			result = append(result, addr)
-			added[key] = true
-
-			if len(result) >= max {
-				break
-			}
+			return false
 		}
+		return !added[addr.key()] && !addr.isTerrible(now)
 	}
 
-	// Se precisar de mais, adiciona de "new"
-	if len(result) < max {
-		// Prefere peers de fontes confiáveis
-		for _, source := range []string{"hardcoded", "dns", "peer", "local"} {
-			for key, addr := range am.newAddresses {
-				if added[key] || len(result) >= max {
-					continue
-				}
-
-				if addr.Source == source && (!addr.Banned || now.After(addr.BanExpires)) {
-					result = append(result, addr)
-					added[key] = true
-				}
-			}
+	for _, table := range []addrBuckets{am.triedTable, am.newTable} {
+		if len(result) >= max {
+			break
+		}
+		for _, addr := range am.sampleTable(table, max-len(result), accept) {
+			result = append(result, addr)
+			added[addr.key()] = true
 		}
 	}
 
@@ -326,6 +541,7 @@ func (am *AddrManager) CleanupAddresses() {
 	for _, addr := range am.knownAddresses {
 		if addr.Banned && now.After(addr.BanExpires) {
 			addr.Banned = false
+			addr.BanReason = ""
 			fmt.Printf("🔓 Ban expirado para %s:%s\n", addr.IP, addr.Port)
 		}
 	}
@@ -349,9 +565,8 @@ func (am *AddrManager) CleanupAddresses() {
 		}
 
 		if shouldRemove {
+			am.detach(addr)
 			delete(am.knownAddresses, key)
-			delete(am.newAddresses, key)
-			delete(am.triedAddresses, key)
 			removed++
 		}
 	}
@@ -360,3 +575,59 @@ func (am *AddrManager) CleanupAddresses() {
 		fmt.Printf("🧹 Limpeza concluída: %d endereços antigos removidos\n", removed)
 	}
 }
+
+// Anchors retorna as conexões de saída gravadas na execução anterior
+func (am *AddrManager) Anchors() []string {
+	am.mtx.RLock()
+	defer am.mtx.RUnlock()
+	return append([]string(nil), am.anchors...)
+}
+
+// SaveAnchors grava as conexões de saída atuais em anchors.json. Ao
+// reiniciar, o nó volta primeiro a elas, e não à tabela de endereços que
+// um atacante pode ter envenenado enquanto ele estava fora.
+func (am *AddrManager) SaveAnchors(anchors []string) {
+	if len(anchors) > maxAnchors {
+		anchors = anchors[:maxAnchors]
+	}
+
+	am.saveMtx.Lock()
+	defer am.saveMtx.Unlock()
+
+	data, err := json.MarshalIndent(anchors, "", "  ")
+	if err != nil {
+		fmt.Printf("❌ Erro ao serializar âncoras: %v\n", err)
+		return
+	}
+	tempFile := am.anchorsPath + ".tmp"
+	if err := os.WriteFile(tempFile, data, 0600); err != nil {
+		fmt.Printf("❌ Erro ao gravar âncoras: %v\n", err)
+		return
+	}
+	if err := os.Rename(tempFile, am.anchorsPath); err != nil {
+		fmt.Printf("❌ Erro ao substituir arquivo de âncoras: %v\n", err)
+		os.Remove(tempFile)
+	}
+}
+
+// loadAnchors lê as âncoras gravadas pela execução anterior
+func (am *AddrManager) loadAnchors() {
+	data, err := os.ReadFile(am.anchorsPath)
+	if err != nil {
+		return
+	}
+
+	var anchors []string
+	if err := json.Unmarshal(data, &anchors); err != nil {
+		fmt.Printf("❌ Erro ao decodificar âncoras: %v\n", err)
+		return
+	}
+	if len(anchors) > maxAnchors {
+		anchors = anchors[:maxAnchors]
+	}
+
+	am.mtx.Lock()
+	am.anchors = anchors
+	am.mtx.Unlock()
+	fmt.Printf("⚓ %d âncora(s) da execução anterior\n", len(anchors))
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNetGroup(t *testing.T) {
+	cases := map[string]string{
+		"8.8.4.4":       "8.8.0.0/16",
+		"8.8.200.1":     "8.8.0.0/16",
+		"127.0.0.1":     localNetGroup,
+		"192.168.1.20":  localNetGroup,
+		"10.1.2.3":      localNetGroup,
+		"2001:db8:1::1": "2001:db8::/32",
+		"seed.ptw.net":  "host:seed.ptw.net",
+	}
+	for ip, want := range cases {
+		if got := netGroup(ip); got != want {
+			t.Errorf("netGroup(%s) = %s, esperado %s", ip, got, want)
+		}
+	}
+}
+
+func TestSingleSubnetCannotFillNewTable(t *testing.T) {
+	am := NewAddrManager(t.TempDir())
+
+	// Atacante em 1.2.0.0/16 anuncia 10 mil endereços da própria faixa
+	for i := 0; i < 10000; i++ {
+		am.AddAddressFrom(fmt.Sprintf("1.2.%d.%d", i/250, i%250+1), "8333", "peer", "1.2.0.1")
+	}
+	limit := newBucketsPerSourceGroup * addrBucketSize
+	if got := am.newTable.count(); got > limit {
+		t.Fatalf("uma origem ocupou %d posições, limite %d", got, limit)
+	}
+
+	// Endereços honestos, cada um anunciado por uma /16 diferente
+	honest := 0
+	for i := 0; i < 200; i++ {
+		ip := fmt.Sprintf("%d.%d.0.1", 20+i/200, i%200)
+		am.AddAddressFrom(ip, "8333", "peer", fmt.Sprintf("%d.%d.9.9", 100+i/200, i%200))
+		if _, exists := am.knownAddresses[net.JoinHostPort(ip, "8333")]; exists {
+			honest++
+		}
+	}
+	if honest < 170 {
+		t.Fatalf("só %d de 200 endereços honestos entraram na tabela", honest)
+	}
+
+	// A amostra percorre buckets: o atacante não domina o lote
+	attacker := 0
+	for _, addr := range am.GetAddresses(100, true, true) {
+		if strings.HasPrefix(addr.IP, "1.2.") {
+			attacker++
+		}
+	}
+	if attacker >= 50 {
+		t.Fatalf("atacante ocupou %d de 100 endereços da amostra", attacker)
+	}
+}
+
+func TestTriedTableLimitsSubnet(t *testing.T) {
+	am := NewAddrManager(t.TempDir())
+
+	for i := 0; i < 2000; i++ {
+		ip := fmt.Sprintf("5.6.%d.%d", i/250, i%250+1)
+		am.AddAddressFrom(ip, "8333", "peer", fmt.Sprintf("%d.%d.1.1", 30+i/250, i%250))
+		am.Attempt(ip, "8333", true)
+	}
+
+	limit := triedBucketsPerGroup * addrBucketSize
+	if got := am.triedTable.count(); got > limit {
+		t.Fatalf("uma /16 ocupou %d posições em tried, limite %d", got, limit)
+	}
+	if am.newTable.count() == 0 {
+		t.Fatal("endereços expulsos de tried deveriam voltar para new")
+	}
+}
+
+func TestNewCollisionReplacesOnlyTerrible(t *testing.T) {
+	am := NewAddrManager(t.TempDir())
+
+	rival := &KnownAddress{IP: "1.1.1.2", Port: "8333", LastSeen: time.Now(), SourceGroup: "source:peer"}
+	bucket := am.newBucket(netGroup(rival.IP), rival.SourceGroup)
+	pos := am.bucketPosition(tableNew, bucket, rival.key())
+
+	// Força um ocupante na posição que o rival usaria
+	occupant := &KnownAddress{IP: "1.1.1.1", Port: "8333", LastSeen: time.Now(), SourceGroup: "source:peer"}
+	am.knownAddresses[occupant.key()] = occupant
+	am.place(occupant, tableNew, bucket, pos)
+
+	if am.addToNew(rival) {
+		t.Fatal("endereço bom não deveria perder a posição")
+	}
+
+	// Sem nenhum sucesso após várias falhas o ocupante vira descartável
+	occupant.ConnectFailures = addrRetries
+	if !am.addToNew(rival) {
+		t.Fatal("endereço ruim deveria ceder a posição")
+	}
+	if am.newTable[bucket][pos] != rival.key() {
+		t.Fatal("rival não ocupou a posição")
+	}
+	if _, exists := am.knownAddresses[occupant.key()]; exists {
+		t.Fatal("ocupante sem ban nem pin deveria ser esquecido")
+	}
+}
+
+func TestBucketPositionsSurviveRestart(t *testing.T) {
+	dir := t.TempDir()
+	am := NewAddrManager(dir)
+	am.AddAddressFrom("9.9.9.9", "8333", "peer", "4.4.4.4")
+	am.AddAddress("8.8.8.8", "8333", "dns")
+	am.Attempt("8.8.8.8", "8333", true)
+	am.saveAddresses()
+
+	reloaded := NewAddrManager(dir)
+	reloaded.loadAddresses()
+	if reloaded.key != am.key {
+		t.Fatal("chave secreta dos buckets não persistiu")
+	}
+	for key, addr := range am.knownAddresses {
+		got, exists := reloaded.knownAddresses[key]
+		if !exists {
+			t.Fatalf("%s sumiu após reinício", key)
+		}
+		if got.table != addr.table || got.bucket != addr.bucket || got.pos != addr.pos {
+			t.Fatalf("%s mudou de posição: %v/%d/%d -> %v/%d/%d",
+				key, addr.table, addr.bucket, addr.pos, got.table, got.bucket, got.pos)
+		}
+	}
+}
+
+func TestAnchorsPersistAcrossRestart(t *testing.T) {
+	dir := t.TempDir()
+	NewAddrManager(dir).SaveAnchors([]string{"1.1.1.1:8333", "2.2.2.2:8333", "3.3.3.3:8333"})
+
+	reloaded := NewAddrManager(dir)
+	reloaded.loadAnchors()
+	anchors := reloaded.Anchors()
+	if len(anchors) != maxAnchors || anchors[0] != "1.1.1.1:8333" || anchors[1] != "2.2.2.2:8333" {
+		t.Fatalf("âncoras inesperadas: %v", anchors)
+	}
+}
+
+func TestOutboundNetgroupLimit(t *testing.T) {
+	node := NewP2PNode("node-X", "127.0.0.1", 0)
+	node.Peers["out"] = &Peer{ID: "out", Address: "8.8.1.1", conn: newPeerConn(nil, false, wireBinary)}
+	node.Peers["in"] = &Peer{ID: "in", Address: "9.9.1.1", conn: newPeerConn(nil, true, wireBinary)}
+	node.Peers["local"] = &Peer{ID: "local", Address: "127.0.0.1", conn: newPeerConn(nil, false, wireBinary)}
+
+	if err := node.checkOutboundNetgroup("8.8.200.3"); err == nil {
+		t.Fatal("segunda saída para 8.8.0.0/16 deveria ser recusada")
+	}
+	if err := node.checkOutboundNetgroup("9.9.2.2"); err != nil {
+		t.Fatalf("conexões de entrada não contam no limite: %v", err)
+	}
+	if err := node.checkOutboundNetgroup("127.0.0.1"); err != nil {
+		t.Fatalf("loopback fica fora do limite: %v", err)
+	}
+}
+
+func TestNodeReconnectsToAnchors(t *testing.T) {
+	nodeA := newTestNode(t, "node-A")
+	anchor := net.JoinHostPort("127.0.0.1", fmt.Sprintf("%d", nodeA.Port))
+
+	// Âncora gravada por uma "execução anterior" do nó D
+	nodeD := NewP2PNode("node-D", "127.0.0.1", 0)
+	nodeD.dataDir = t.TempDir()
+	NewAddrManager(nodeD.dataDir).SaveAnchors([]string{anchor})
+	if err := nodeD.StartNode(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { nodeD.Stop(context.Background()) })
+
+	connected := waitFor(t, defaultWait, func() bool {
+		return len(nodeD.connectedPeerIDs()) == 1 && len(nodeA.connectedPeerIDs()) == 1
+	})
+	if !connected {
+		t.Fatal("nó D não reconectou à âncora")
+	}
+
+	// A conexão de saída continua gravada para o próximo reinício
+	reloaded := NewAddrManager(nodeD.dataDir)
+	reloaded.loadAnchors()
+	if anchors := reloaded.Anchors(); len(anchors) != 1 || anchors[0] != anchor {
+		t.Fatalf("âncoras após reconexão: %v", anchors)
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Pontuação de mau comportamento que leva à desconexão do peer
+const misbehaviorThreshold = 100
+
+// Limites de mensagens por minuto, por peer e por tipo. Consenso, inventário
+// e respostas de getdata chegam em rajadas no sync e nas rodadas BFT, então
+// cada tipo tem a própria conta; tipos fora da tabela usam o padrão.
+const (
+	defaultRateLimit = 100
+	blockFloodLimit  = 5 // Blocos não pedidos em blockFloodWindow
+	blockFloodWindow = 10 * time.Second
+)
+
+var messageRateLimits = map[string]int{
+	MSG_CONSENSUS_REQUEST: 300,
+	MSG_CONSENSUS_VOTE:    1200,
+	MSG_INV:               600,
+	MSG_GET_DATA:          600,
+	MSG_NOT_FOUND:         600,
+	MSG_NEW_BLOCK:         1000, // Inclui as respostas de getdata
+	MSG_NEW_TRANSACTION:   1000,
+	MSG_CMPCT_BLOCK:       300,
+	MSG_GET_BLOCK_TXN:     300,
+	MSG_BLOCK_TXN:         300,
+	MSG_SYNC_REQUEST:      300,
+	MSG_SYNC_RESPONSE:     300,
+}
+
+func rateLimitFor(msgType string) int {
+	if limit, exists := messageRateLimits[msgType]; exists {
+		return limit
+	}
+	return defaultRateLimit
+}
+
+// Violações detectadas por AnalyzePeerBehavior
+var (
+	errRateLimited     = errors.New("rate limit excedido")
+	errSuspiciousFlood = errors.New("flood de blocos")
+)
+
+// SecurityManager mantém a pontuação de mau comportamento; os bans
+// ficam no AddrManager (ver peer_ban.go)
+type SecurityManager struct {
+	node         *P2PNode
+	mtx          sync.Mutex
+	trustedPeers map[string]bool
+	rateLimiter  map[string][]time.Time
+	misbehavior  map[string]int
+	blockFloods  map[string][]time.Time // Blocos não pedidos por peer
+}
+
+func NewSecurityManager(node *P2PNode) *SecurityManager {
+	return &SecurityManager{
+		node:         node,
+		trustedPeers: make(map[string]bool),
+		rateLimiter:  make(map[string][]time.Time),
+		misbehavior:  make(map[string]int),
+		blockFloods:  make(map[string][]time.Time),
+	}
+}
+
+// Assinatura digital de mensagens
+func (sm *SecurityManager) SignMessage(message *NetworkMessage, privateKey *rsa.PrivateKey) error {
+	// Serializa a mensagem sem a assinatura
+	messageBytes, err := signingBytes(message)
+	if err != nil {
+		return err
+	}
+
+	// Cria hash da mensagem
+	hash := sha256.Sum256(messageBytes)
+
+	// Assina o hash
+	signature, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, hash[:])
+	if err != nil {
+		return err
+	}
+
+	message.Signature = base64.StdEncoding.EncodeToString(signature)
+	return nil
+}
+
+// Verificação de assinatura
+func (sm *SecurityManager) VerifyMessage(message *NetworkMessage, publicKey *rsa.PublicKey) bool {
+	if publicKey == nil || message.Signature == "" {
+		return false
+	}
+
+	// Mensagens binárias são verificadas sobre os bytes recebidos, que
+	// incluem campos de versões mais novas que não foram decodificados
+	messageBytes := message.signed
+	if messageBytes == nil {
+		var err error
+		if messageBytes, err = signingBytes(message); err != nil {
+			return false
+		}
+	}
+
+	hash := sha256.Sum256(messageBytes)
+
+	signature, err := base64.StdEncoding.DecodeString(message.Signature)
+	if err != nil {
+		return false
+	}
+
+	err = rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hash[:], signature)
+	return err == nil
+}
+
+// Rate limiting
+func (sm *SecurityManager) CheckRateLimit(peerID string, maxRequests int, timeWindow time.Duration) bool {
+	sm.mtx.Lock()
+	defer sm.mtx.Unlock()
+
+	return sm.checkRateLimitLocked(peerID, maxRequests, timeWindow)
+}
+
+func (sm *SecurityManager) checkRateLimitLocked(peerID string, maxRequests int, timeWindow time.Duration) bool {
+	now := sm.now()
+
+	// Limpa requests antigos
+	if requests, exists := sm.rateLimiter[peerID]; exists {
+		validRequests := []time.Time{}
+		for _, reqTime := range requests {
+			if now.Sub(reqTime) < timeWindow {
+				validRequests = append(validRequests, reqTime)
+			}
+		}
+		sm.rateLimiter[peerID] = validRequests
+	}
+
+	// Verifica limite
+	if len(sm.rateLimiter[peerID]) >= maxRequests {
+		return false
+	}
+
+	// Adiciona nova request
+	sm.rateLimiter[peerID] = append(sm.rateLimiter[peerID], now)
+	return true
+}
+
+// now usa o relógio do nó (virtual no simulador)
+func (sm *SecurityManager) now() time.Time {
+	if sm.node != nil && sm.node.clock != nil {
+		return sm.node.clock.Now()
+	}
+	return time.Now()
+}
+
+// Anti-spam e detecção de ataques. A violação é devolvida para que o
+// chamador aplique a penalidade correspondente.
+func (sm *SecurityManager) AnalyzePeerBehavior(peerID string, msg *NetworkMessage) error {
+	sm.mtx.Lock()
+	defer sm.mtx.Unlock()
+
+	// Rate limiting por tipo de mensagem
+	if !sm.checkRateLimitLocked(peerID+"|"+msg.Type, rateLimitFor(msg.Type), time.Minute) {
+		fmt.Printf("⚠️ Rate limit de %s excedido para peer %s\n", msg.Type, peerID)
+		return errRateLimited
+	}
+
+	// Verifica padrões suspeitos
+	if sm.detectSuspiciousPatterns(peerID, msg) {
+		fmt.Printf("🚨 Comportamento suspeito detectado: %s\n", peerID)
+		return errSuspiciousFlood
+	}
+
+	return nil
+}
+
+// detectSuspiciousPatterns detecta flood de blocos: só contam os blocos
+// que o nó não pediu via getdata
+func (sm *SecurityManager) detectSuspiciousPatterns(peerID string, msg *NetworkMessage) bool {
+	if msg.Type != MSG_NEW_BLOCK || sm.solicitedBlock(msg) {
+		return false
+	}
+	now := sm.now()
+	recent := sm.blockFloods[peerID][:0]
+	for _, t := range sm.blockFloods[peerID] {
+		if now.Sub(t) < blockFloodWindow {
+			recent = append(recent, t)
+		}
+	}
+	sm.blockFloods[peerID] = append(recent, now)
+	return len(sm.blockFloods[peerID]) > blockFloodLimit
+}
+
+// solicitedBlock: o bloco responde a um getdata ainda pendente
+func (sm *SecurityManager) solicitedBlock(msg *NetworkMessage) bool {
+	block, ok := msg.Data.(*Token)
+	if !ok || sm.node == nil || sm.node.requestedInv == nil {
+		return false
+	}
+	return sm.node.requestedInv.Has(InvItem{Type: INV_BLOCK, Hash: block.Hash}.key())
+}
+
+// RecordMisbehavior soma pontos de mau comportamento ao peer.
+// Retorna true quando o peer atinge o limite e deve ser banido; a
+// pontuação é zerada, pois a partir daí vale o ban.
+func (sm *SecurityManager) RecordMisbehavior(peerID string, points int, reason string) bool {
+	sm.mtx.Lock()
+	defer sm.mtx.Unlock()
+
+	sm.misbehavior[peerID] += points
+	score := sm.misbehavior[peerID]
+	fmt.Printf("⚠️ Peer %s penalizado em %d pontos (%s) - total %d\n", peerID, points, reason, score)
+
+	if score >= misbehaviorThreshold {
+		delete(sm.misbehavior, peerID)
+		return true
+	}
+	return false
+}
+
+// MisbehaviorScores retorna uma cópia das pontuações atuais
+func (sm *SecurityManager) MisbehaviorScores() map[string]int {
+	sm.mtx.Lock()
+	defer sm.mtx.Unlock()
+
+	scores := make(map[string]int, len(sm.misbehavior))
+	for peerID, score := range sm.misbehavior {
+		scores[peerID] = score
+	}
+	return scores
+}
+
+// ResetMisbehavior zera a pontuação do peer (ex.: após unban manual)
+func (sm *SecurityManager) ResetMisbehavior(peerID string) {
+	sm.mtx.Lock()
+	defer sm.mtx.Unlock()
+
+	delete(sm.misbehavior, peerID)
+}
+
+// === Integração com o P2PNode ===
+
+// Pontos de penalidade por tipo de falha
+const (
+	penaltyInvalidBlock     = 100 // Bloco que nunca seria válido: ban imediato
+	penaltyInvalidSignature = 50
+	penaltyRateLimit        = 20
+	penaltyUnsolicited      = 20 // Dados que não foram pedidos
+	penaltyBehavior         = 10
+)
+
+// signOutbound preenche o remetente e assina a mensagem com a chave do nó
+func (node *P2PNode) signOutbound(msg *NetworkMessage) error {
+	if node.identity == nil {
+		return fmt.Errorf("nó sem identidade para assinar mensagens")
+	}
+
+	msg.From = node.ID
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+	return node.security.SignMessage(msg, node.identity.key)
+}
+
+// verifyInbound valida assinatura e comportamento antes do dispatch
+func (node *P2PNode) verifyInbound(peer *Peer, msg *NetworkMessage) bool {
+	if msg.From != peer.ID {
+		node.penalizePeer(peer.ID, penaltyInvalidSignature,
+			fmt.Sprintf("remetente %q diferente do peer da conexão", msg.From))
+		return false
+	}
+
+	if !node.security.VerifyMessage(msg, peer.publicKey) {
+		logSecurityEvent("INVALID_SIGNATURE", peer.ID,
+			fmt.Sprintf("Mensagem %s com assinatura inválida", msg.Type), "HIGH", false)
+		node.penalizePeer(peer.ID, penaltyInvalidSignature, "assinatura de mensagem inválida")
+		return false
+	}
+
+	if err := node.security.AnalyzePeerBehavior(peer.ID, msg); err != nil {
+		points := penaltyBehavior
+		if err == errRateLimited {
+			points = penaltyRateLimit
+		}
+		node.penalizePeer(peer.ID, points, err.Error())
+		return false
+	}
+	return true
+}
+
+// penalizePeer registra a falha e bane o peer ao atingir o limite
+func (node *P2PNode) penalizePeer(peerID string, points int, reason string) {
+	if !node.security.RecordMisbehavior(peerID, points, reason) {
+		return
+	}
+
+	logSecurityEvent("PEER_DISCONNECTED", peerID,
+		fmt.Sprintf("Limite de mau comportamento atingido: %s", reason), "HIGH", true)
+	node.banConnectedPeer(peerID, defaultBanDuration, reason)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSignedMessageSurvivesWireEncoding(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm := NewSecurityManager(nil)
+
+	block := testBlock(7, "PREV")
+	msg := &NetworkMessage{
+		Type:      MSG_NEW_BLOCK,
+		From:      "node-A",
+		To:        "node-B",
+		Data:      &block,
+		Timestamp: time.Now(),
+	}
+	if err := sm.SignMessage(msg, key); err != nil {
+		t.Fatal(err)
+	}
+
+	// A assinatura vale nos dois formatos: o JSON é reconvertido para binário
+	for _, format := range []wireFormat{wireBinary, wireJSON} {
+		raw, err := encodeMessage(msg, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		received, err := decodeMessage(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sm.VerifyMessage(received, &key.PublicKey) {
+			t.Fatalf("assinatura válida rejeitada após transmissão em %s", format)
+		}
+
+		tampered, err := decodeMessage(bytes.Replace(raw, []byte("TEST_BLOCK_0007"), []byte("TEST_BLOCK_0008"), 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sm.VerifyMessage(tampered, &key.PublicKey) {
+			t.Fatalf("mensagem adulterada aceita em %s", format)
+		}
+	}
+}
+
+func TestForgedMessagesDisconnectPeer(t *testing.T) {
+	nodeA := newTestNode(t, "node-A")
+	nodeB := newTestNode(t, "node-B")
+
+	if !nodeB.ConnectToAddress("127.0.0.1", fmt.Sprintf("%d", nodeA.Port)) {
+		t.Fatal("B não conseguiu conectar em A")
+	}
+
+	nodeB.mutex.RLock()
+	pc := nodeB.Peers["node-A"].conn
+	nodeB.mutex.RUnlock()
+
+	// B envia mensagens sem passar pela assinatura
+	for i := 0; i < 2; i++ {
+		pc.send(&NetworkMessage{
+			Type:      MSG_HEARTBEAT,
+			From:      "node-B",
+			To:        "node-A",
+			Data:      &heartbeatMessage{Height: 999},
+			Timestamp: time.Now(),
+			Signature: base64.StdEncoding.EncodeToString([]byte("forjada")),
+		})
+	}
+
+	if !waitFor(t, defaultWait, func() bool { return len(nodeA.connectedPeerIDs()) == 0 }) {
+		t.Fatal("A deveria desconectar B após assinaturas inválidas")
+	}
+	if !nodeA.isBanned("node-B", "127.0.0.1", nodeB.Port) {
+		t.Fatal("B deveria estar banido por A")
+	}
+
+	nodeA.mutex.RLock()
+	height := nodeA.Peers["node-B"].Height
+	nodeA.mutex.RUnlock()
+	if height == 999 {
+		t.Fatal("mensagem forjada não deveria ter sido processada")
+	}
+}
+
+func TestRateLimitIsPerMessageType(t *testing.T) {
+	node := NewP2PNode("node-A", "127.0.0.1", 0)
+
+	// Rajada de votos de uma rodada BFT não consome o limite dos heartbeats
+	vote := &NetworkMessage{Type: MSG_CONSENSUS_VOTE, From: "peer"}
+	for i := 0; i < defaultRateLimit*2; i++ {
+		if err := node.security.AnalyzePeerBehavior("peer", vote); err != nil {
+			t.Fatalf("voto %d recusado: %v", i, err)
+		}
+	}
+	heartbeat := &NetworkMessage{Type: MSG_HEARTBEAT, From: "peer"}
+	if err := node.security.AnalyzePeerBehavior("peer", heartbeat); err != nil {
+		t.Fatalf("heartbeat recusado depois dos votos: %v", err)
+	}
+}
+
+func TestOnlyUnsolicitedBlocksCountAsFlood(t *testing.T) {
+	node := NewP2PNode("node-A", "127.0.0.1", 0)
+	blockMsg := func(i int) *NetworkMessage {
+		block := testBlock(i, "PREV")
+		return &NetworkMessage{Type: MSG_NEW_BLOCK, From: "peer", Data: &block}
+	}
+
+	// Respostas a getdata durante o sync não são flood
+	for i := 1; i <= 3*blockFloodLimit; i++ {
+		msg := blockMsg(i)
+		node.requestedInv.Add(InvItem{Type: INV_BLOCK, Hash: msg.Data.(*Token).Hash}.key())
+		if err := node.security.AnalyzePeerBehavior("peer", msg); err != nil {
+			t.Fatalf("bloco pedido %d recusado: %v", i, err)
+		}
+	}
+
+	for i := 100; i < 100+blockFloodLimit; i++ {
+		if err := node.security.AnalyzePeerBehavior("peer", blockMsg(i)); err != nil {
+			t.Fatalf("bloco não pedido %d dentro do limite recusado: %v", i, err)
+		}
+	}
+	if err := node.security.AnalyzePeerBehavior("peer", blockMsg(200)); err != errSuspiciousFlood {
+		t.Fatalf("esperado flood de blocos, obtido %v", err)
+	}
+}
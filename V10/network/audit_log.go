@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Log de auditoria do nó, no formato encadeado por hash de
+// audit/audit_system.go. Eventos de segurança e as punições de validadores
+// aplicadas pelos blocos entram aqui; o relatório de conformidade
+// (audit/compliance_report.go) monta a seção de incidentes a partir deles.
+// A carteira também grava no arquivo (mudanças de KYC), então o topo é
+// relido do fim do arquivo a cada gravação em vez de ficar em cache.
+
+const auditTailSize = 64 * 1024 // Fim do arquivo lido para achar o último registro
+
+// Arquivo do log de auditoria (o mesmo lido por audit/)
+var securityAuditPath = "../security_audit.jsonl"
+
+var auditMtx sync.Mutex
+
+// AuditLog é o registro de audit/audit_system.go; a ordem dos campos entra no hash
+type AuditLog struct {
+	ID        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Action    string    `json:"action"`
+	UserID    string    `json:"user_id"`
+	Details   string    `json:"details"`
+	IPAddress string    `json:"ip_address,omitempty"`
+	Success   bool      `json:"success"`
+	Risk      string    `json:"risk_level"` // LOW, MEDIUM, HIGH, CRITICAL
+	PrevHash  string    `json:"prev_hash,omitempty"`
+	Hash      string    `json:"hash,omitempty"`
+}
+
+// computeAuditHash: mesma regra de audit/audit_system.go
+func computeAuditHash(entry AuditLog) string {
+	entry.Hash = ""
+	entry.Timestamp = entry.Timestamp.UTC()
+	data, _ := json.Marshal(entry)
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+// lastAuditHash lê o hash do último registro pelo fim do arquivo. Uma
+// última linha cortada (gravação interrompida) é descartada, para o próximo
+// registro não ser gravado colado nela.
+func lastAuditHash(file *os.File) (string, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	start := max(info.Size()-auditTailSize, 0)
+	tail := make([]byte, info.Size()-start)
+	if _, err := file.ReadAt(tail, start); err != nil {
+		return "", err
+	}
+
+	complete := bytes.LastIndexByte(tail, '\n') + 1
+	if complete < len(tail) {
+		fmt.Printf("⚠️ Última linha do log de auditoria cortada, descartada\n")
+		if err := file.Truncate(start + int64(complete)); err != nil {
+			return "", err
+		}
+	}
+	lines := bytes.TrimRight(tail[:complete], "\n")
+	if len(lines) == 0 {
+		return "", nil
+	}
+	newline := bytes.LastIndexByte(lines, '\n')
+	if newline < 0 && start > 0 {
+		return "", fmt.Errorf("último registro do log de auditoria maior que %d bytes", auditTailSize)
+	}
+	var last AuditLog
+	if err := json.Unmarshal(lines[newline+1:], &last); err != nil {
+		return "", fmt.Errorf("último registro do log de auditoria ilegível: %v", err)
+	}
+	return last.Hash, nil
+}
+
+// appendAuditLog encadeia o registro ao topo do log e o grava
+func appendAuditLog(path string, entry *AuditLog) error {
+	auditMtx.Lock()
+	defer auditMtx.Unlock()
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	prevHash, err := lastAuditHash(file)
+	if err != nil {
+		return err
+	}
+	entry.PrevHash = prevHash
+	entry.Hash = computeAuditHash(*entry)
+	return json.NewEncoder(file).Encode(entry)
+}
+
+// logSecurityEvent mostra o evento e o grava no log de auditoria
+func logSecurityEvent(eventType, user, description, severity string, resolved bool) {
+	fmt.Printf("🔒 [SECURITY] [%s] User: %s | Desc: %s | Severity: %s | Resolved: %v\n",
+		eventType, user, description, severity, resolved)
+
+	entry := AuditLog{
+		ID:        fmt.Sprintf("AUDIT_%d", time.Now().UnixNano()),
+		Timestamp: time.Now(),
+		Action:    eventType,
+		UserID:    user,
+		Details:   description,
+		Success:   resolved,
+		Risk:      severity,
+	}
+	if err := appendAuditLog(securityAuditPath, &entry); err != nil {
+		fmt.Printf("⚠️ Evento %s fora do log de auditoria: %v\n", eventType, err)
+	}
+}
+
+// validatorIncident é uma punição aplicada por um bloco (evidence.go, randao.go)
+type validatorIncident struct {
+	Action    string // DOUBLE_SIGN, VALIDATOR_SLASHED ou VALIDATOR_JAILED
+	Validator string
+	Details   string
+	Risk      string
+}
+
+// auditIncidents registra as punições do bloco recém-adicionado. Só o
+// addBlock chama: a reconstrução do estado na partida não repete registros.
+func (node *P2PNode) auditIncidents(block *Token, incidents []validatorIncident) {
+	for _, incident := range incidents {
+		logSecurityEvent(incident.Action, incident.Validator,
+			fmt.Sprintf("%s (bloco %d)", incident.Details, block.Index), incident.Risk, true)
+	}
+}
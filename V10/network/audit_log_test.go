@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestMain desvia o log de auditoria: os testes não gravam no arquivo real
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "ptw-audit")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	securityAuditPath = filepath.Join(dir, "security_audit.jsonl")
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// readAuditLog lê o log e confere o encadeamento
+func readAuditLog(t *testing.T, path string) []AuditLog {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var logs []AuditLog
+	prevHash := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry AuditLog
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("registro %d ilegível: %v", len(logs)+1, err)
+		}
+		if entry.PrevHash != prevHash || computeAuditHash(entry) != entry.Hash {
+			t.Fatalf("encadeamento quebrado no registro %d (%s)", len(logs)+1, entry.ID)
+		}
+		prevHash = entry.Hash
+		logs = append(logs, entry)
+	}
+	return logs
+}
+
+func TestDoubleSignIsAudited(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "security_audit.jsonl")
+	previous := securityAuditPath
+	securityAuditPath = path
+	defer func() { securityAuditPath = previous }()
+
+	node := newTestNode(t, "node-A")
+	keyB := walletKey("node-B")
+	node.stakingGenesis = &StakingGenesis{Validators: []ValidatorStake{
+		{ID: "node-A", Owner: addr("alice"), Amount: 100, PubKey: encodePublicKey(&node.identity.key.PublicKey)},
+		{ID: "node-B", Owner: addr("bob"), Amount: 10, PubKey: encodePublicKey(&keyB.PublicKey)},
+	}}
+	genesis := testBlock(1, "")
+	commitBlock(t, node, &genesis)
+	if !node.validateAndAddBlock(&genesis) {
+		t.Fatal("bloco 1 rejeitado")
+	}
+
+	// B assina dois precommits conflitantes na altura 2; A denuncia e o
+	// bloco com a evidência pune B
+	precommit := func(blockHash string) *ConsensusVote {
+		vote := &ConsensusVote{Height: 2, Type: votePrecommit, BlockHash: blockHash, Voter: "node-B"}
+		signature, err := signConsensus(keyB, voteSignBytes(node.localChainID(), vote))
+		if err != nil {
+			t.Fatal(err)
+		}
+		vote.Signature = signature
+		return vote
+	}
+	ev := &DoubleSignEvidence{VoteA: precommit("BLOCK_X_000000000000"), VoteB: precommit("BLOCK_Y_000000000000")}
+	report := Transaction{ID: "EVIDENCE_" + ev.id()[:32], Type: TX_EVIDENCE, From: "node-A", To: "node-B", Evidence: ev}
+	if err := signTx(node.identity.key, &report); err != nil {
+		t.Fatal(err)
+	}
+	block := testBlock(2, genesis.Hash)
+	block.Transactions = []Transaction{report}
+	commitBlock(t, node, &block)
+	if !node.validateAndAddBlock(&block) {
+		t.Fatal("bloco com a evidência rejeitado")
+	}
+	if !node.ChainState().Jailed["node-B"] {
+		t.Fatal("B não foi preso")
+	}
+
+	found := make(map[string]AuditLog)
+	for _, entry := range readAuditLog(t, path) {
+		if entry.UserID == "node-B" {
+			found[entry.Action] = entry
+		}
+	}
+	for _, action := range []string{"DOUBLE_SIGN", "VALIDATOR_SLASHED", "VALIDATOR_JAILED"} {
+		if _, ok := found[action]; !ok {
+			t.Fatalf("%s de node-B ausente do log de auditoria: %+v", action, found)
+		}
+	}
+	if found["DOUBLE_SIGN"].Risk != "CRITICAL" || found["VALIDATOR_SLASHED"].Details != "1 de stake retirados (10%) por dupla assinatura (bloco 2)" {
+		t.Fatalf("registros da punição: %+v", found)
+	}
+
+	// A reconstrução do estado (partida do nó) não repete os registros
+	node.stateMtx.Lock()
+	node.state = nil
+	node.stateMtx.Unlock()
+	node.ChainState()
+	if logs := readAuditLog(t, path); len(logs) != 3 {
+		t.Fatalf("%d registros após reconstruir o estado", len(logs))
+	}
+
+	// Gravação interrompida: a linha cortada é descartada e o log continua íntegro
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"id": "AUDIT_cortado", "timest`)
+	file.Close()
+	logSecurityEvent("INVALID_SIGNATURE", "mallory", "teste", "HIGH", false)
+	if logs := readAuditLog(t, path); len(logs) != 4 || logs[3].UserID != "mallory" {
+		t.Fatalf("registro após a linha cortada: %+v", logs)
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Limites de tamanho por tipo de mensagem. Um frame acima do limite do
+// seu tipo é descartado antes de decodificar Data, e o peer é penalizado.
+const (
+	defaultMessageLimit     = 64 * 1024 // Tipos sem limite próprio
+	penaltyOversizedMessage = 20
+)
+
+var messageSizeLimits = map[string]int{
+	MSG_INTRODUCTION:      16 * 1024,
+	MSG_INTRODUCTION_ACK:  16 * 1024,
+	MSG_REJECT:            4 * 1024,
+	MSG_HEARTBEAT:         4 * 1024,
+	MSG_CONSENSUS_VOTE:    8 * 1024,
+	MSG_CONSENSUS_REQUEST: 4 * 1024 * 1024,
+	MSG_CONSENSUS_START:   4 * 1024,
+	MSG_NEW_BLOCK:         4 * 1024 * 1024,
+	MSG_CMPCT_BLOCK:       1024 * 1024,
+	MSG_GET_BLOCK_TXN:     256 * 1024,
+	MSG_BLOCK_TXN:         4 * 1024 * 1024,
+	MSG_SYNC_REQUEST:      4 * 1024,
+	MSG_SYNC_RESPONSE:     maxFrameSize,
+	MSG_NEW_TRANSACTION:   64 * 1024,
+	MSG_INV:               128 * 1024, // maxInvPerMessage itens
+	MSG_GET_DATA:          128 * 1024,
+	MSG_NOT_FOUND:         128 * 1024,
+	MSG_ADDR_REQUEST:      4 * 1024,
+	MSG_ADDR_RESPONSE:     256 * 1024,
+}
+
+// maxMessageSize retorna o tamanho máximo do payload para o tipo
+func maxMessageSize(msgType string) int {
+	if limit, exists := messageSizeLimits[msgType]; exists {
+		return limit
+	}
+	return defaultMessageLimit
+}
+
+// oversizedMessageError indica um frame válido, mas grande demais para o
+// tipo; o frame já foi consumido e a conexão segue utilizável
+type oversizedMessageError struct {
+	msgType string
+	size    int
+}
+
+func (e *oversizedMessageError) Error() string {
+	return fmt.Sprintf("mensagem %s com %d bytes excede o limite de %d", e.msgType, e.size, maxMessageSize(e.msgType))
+}
+
+// Paginação das respostas de sync
+const (
+	maxSyncBlocks      = 500
+	syncResponseBudget = maxFrameSize - 64*1024 // Folga para o envelope da mensagem
+	syncResponseFields = maxWireFields - 1024   // Campos binários por resposta
+)
+
+// Banda por peer (token bucket). A rajada comporta uma resposta de sync
+// completa; acima da taxa a leitura do peer espera, o que segura o
+// remetente pelo controle de fluxo do TCP.
+const (
+	peerRecvRate       = 2 * 1024 * 1024 // Bytes/s recebidos de cada peer
+	peerSendRate       = 2 * 1024 * 1024 // Bytes/s enviados a cada peer
+	peerBandwidthBurst = maxFrameSize
+)
+
+// tokenBucket libera rate bytes por segundo, acumulando até burst
+type tokenBucket struct {
+	mtx    sync.Mutex
+	clock  Clock
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(clock Clock, rate, burst int) *tokenBucket {
+	return &tokenBucket{
+		clock:  clock,
+		rate:   float64(rate),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   clock.Now(),
+	}
+}
+
+// take consome n bytes e retorna quanto o chamador deve esperar. O saldo
+// pode ficar negativo: um frame maior que a rajada passa, mas atrasa os
+// seguintes.
+func (b *tokenBucket) take(n int) time.Duration {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	now := b.clock.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// throttledReader aplica o limite de recepção sobre a conexão; sem bucket
+// (durante o handshake) não limita
+type throttledReader struct {
+	r       io.Reader
+	clock   Clock
+	bucket  *tokenBucket
+	onDelay func(time.Duration)
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if n > 0 && t.bucket != nil {
+		if wait := t.bucket.take(n); wait > 0 {
+			if t.onDelay != nil {
+				t.onDelay(wait)
+			}
+			sleep(t.clock, wait)
+		}
+	}
+	return n, err
+}
+
+// Prioridades de envio: a fila mais prioritária é sempre esvaziada primeiro
+const (
+	priorityConsensus = iota // Consenso e controle (heartbeat, reject)
+	priorityBlock            // Blocos, sync e inventário de blocos
+	priorityTx               // Transações e inventário de transações
+	priorityAddr             // Endereços, DHT e demais mensagens
+	numPriorities
+)
+
+// Mensagens pendentes por peer em cada prioridade
+var sendQueueSizes = [numPriorities]int{64, 128, 512, 64}
+
+var priorityNames = [numPriorities]string{"consensus", "block", "tx", "addr"}
+
+// messagePriority classifica a mensagem para a fila de envio
+func messagePriority(msg *NetworkMessage) int {
+	switch msg.Type {
+	case MSG_CONSENSUS_REQUEST, MSG_CONSENSUS_VOTE, MSG_CONSENSUS_START, MSG_HEARTBEAT, MSG_REJECT:
+		return priorityConsensus
+	case MSG_NEW_BLOCK, MSG_CMPCT_BLOCK, MSG_GET_BLOCK_TXN, MSG_BLOCK_TXN,
+		MSG_SYNC_REQUEST, MSG_SYNC_RESPONSE, MSG_DIFFICULTY_UPDATE, MSG_DIFFICULTY_ACK:
+		return priorityBlock
+	case MSG_NEW_TRANSACTION:
+		return priorityTx
+	case MSG_INV, MSG_GET_DATA, MSG_NOT_FOUND:
+		if inv, ok := msg.Data.(*invMessage); ok {
+			for _, item := range inv.Items {
+				if item.Type == INV_BLOCK {
+					return priorityBlock
+				}
+			}
+		}
+		return priorityTx
+	}
+	return priorityAddr
+}
+
+// sendQueue guarda as mensagens de saída de um peer, limitadas por prioridade
+type sendQueue struct {
+	mtx    sync.Mutex
+	queues [numPriorities][]*NetworkMessage
+	ready  chan struct{} // Sinaliza o writeLoop
+}
+
+func newSendQueue() *sendQueue {
+	return &sendQueue{ready: make(chan struct{}, 1)}
+}
+
+// push enfileira sem bloquear; false quando a fila da prioridade está cheia
+func (q *sendQueue) push(msg *NetworkMessage, priority int) bool {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	if len(q.queues[priority]) >= sendQueueSizes[priority] {
+		return false
+	}
+	q.queues[priority] = append(q.queues[priority], msg)
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// pop retorna a mensagem mais prioritária (nil se não houver)
+func (q *sendQueue) pop() *NetworkMessage {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	for priority := range q.queues {
+		if queue := q.queues[priority]; len(queue) > 0 {
+			msg := queue[0]
+			queue[0] = nil
+			q.queues[priority] = queue[1:]
+			return msg
+		}
+	}
+	return nil
+}
+
+// lengths retorna quantas mensagens aguardam em cada prioridade
+func (q *sendQueue) lengths() [numPriorities]int {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	var lengths [numPriorities]int
+	for priority, queue := range q.queues {
+		lengths[priority] = len(queue)
+	}
+	return lengths
+}
+
+// === Métricas de tráfego ===
+
+// countTraffic soma n ao contador (GetTrafficStats)
+func (node *P2PNode) countTraffic(name string, n int) {
+	node.trafficMtx.Lock()
+	node.trafficStats[name] += n
+	node.trafficMtx.Unlock()
+}
+
+// GetTrafficStats retorna os contadores de mensagens descartadas ou
+// atrasadas pelos limites de tamanho, banda e fila, e o total aguardando
+// envio em cada prioridade (queued:<prioridade>)
+func (node *P2PNode) GetTrafficStats() map[string]int {
+	node.trafficMtx.Lock()
+	stats := make(map[string]int, len(node.trafficStats)+numPriorities)
+	for name, value := range node.trafficStats {
+		stats[name] = value
+	}
+	node.trafficMtx.Unlock()
+
+	var queued [numPriorities]int
+	node.mutex.RLock()
+	for _, peer := range node.Peers {
+		if peer.conn == nil {
+			continue
+		}
+		for priority, n := range peer.conn.sendQueue.lengths() {
+			queued[priority] += n
+		}
+	}
+	node.mutex.RUnlock()
+
+	for priority, name := range priorityNames {
+		stats["queued:"+name] = queued[priority]
+	}
+	return stats
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadFrameRejectsOversizedType(t *testing.T) {
+	// Heartbeat de 8 KiB (em JSON): frame válido, mas acima do limite do tipo
+	payload := fmt.Sprintf(`{"type":%q,"data":%q}`, MSG_HEARTBEAT, strings.Repeat("x", 8*1024))
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, uint32(len(payload)))
+	buf.WriteString(payload)
+	if err := writeFrame(&buf, &NetworkMessage{Type: MSG_HEARTBEAT, From: "A"}, wireBinary); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := readFrame(&buf)
+	var oversized *oversizedMessageError
+	if !errors.As(err, &oversized) || oversized.msgType != MSG_HEARTBEAT {
+		t.Fatalf("esperado erro de tamanho para heartbeat, obtido %v", err)
+	}
+	// O frame grande foi consumido: o seguinte é lido normalmente
+	msg, err := readFrame(&buf)
+	if err != nil || msg.From != "A" {
+		t.Fatalf("frame seguinte não lido: %v %+v", err, msg)
+	}
+
+	big := &NetworkMessage{Type: MSG_CONSENSUS_VOTE, Data: &ConsensusVote{BlockHash: strings.Repeat("x", 16*1024)}}
+	if err := writeFrame(&buf, big, wireBinary); !errors.As(err, &oversized) {
+		t.Fatalf("envio acima do limite deveria falhar: %v", err)
+	}
+}
+
+func TestSendQueuePriorityAndBounds(t *testing.T) {
+	queue := newSendQueue()
+	messages := []*NetworkMessage{
+		{Type: MSG_ADDR_RESPONSE},
+		{Type: MSG_NEW_TRANSACTION},
+		{Type: MSG_INV, Data: &invMessage{Items: []InvItem{{Type: INV_TX, Hash: "t"}}}},
+		{Type: MSG_INV, Data: &invMessage{Items: []InvItem{{Type: INV_BLOCK, Hash: "b"}}}},
+		{Type: MSG_NEW_BLOCK},
+		{Type: MSG_CONSENSUS_VOTE},
+	}
+	for _, msg := range messages {
+		if !queue.push(msg, messagePriority(msg)) {
+			t.Fatalf("fila vazia recusou %s", msg.Type)
+		}
+	}
+
+	want := []*NetworkMessage{messages[5], messages[3], messages[4], messages[1], messages[2], messages[0]}
+	for i, expected := range want {
+		if got := queue.pop(); got != expected {
+			t.Fatalf("posição %d: obtido %s, esperado %s", i, got.Type, expected.Type)
+		}
+	}
+	if queue.pop() != nil {
+		t.Fatal("fila deveria estar vazia")
+	}
+
+	for i := 0; i < sendQueueSizes[priorityAddr]; i++ {
+		queue.push(&NetworkMessage{Type: MSG_ADDR_RESPONSE}, priorityAddr)
+	}
+	if queue.push(&NetworkMessage{Type: MSG_ADDR_RESPONSE}, priorityAddr) {
+		t.Fatal("fila cheia aceitou mensagem")
+	}
+	// Outras prioridades têm limite próprio
+	if !queue.push(&NetworkMessage{Type: MSG_CONSENSUS_VOTE}, priorityConsensus) {
+		t.Fatal("voto recusado por causa da fila de endereços")
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	clock := NewVirtualClock(simEpoch)
+	bucket := newTokenBucket(clock, 1000, 2000)
+
+	if wait := bucket.take(1500); wait != 0 {
+		t.Fatalf("dentro da rajada não deveria esperar: %v", wait)
+	}
+	if wait := bucket.take(1000); wait != 500*time.Millisecond {
+		t.Fatalf("esperado 500ms de espera, obtido %v", wait)
+	}
+
+	clock.advanceTo(simEpoch.Add(2500 * time.Millisecond))
+	// 2,5s a 1000 B/s repõem 2500 bytes, limitados à rajada de 2000
+	if wait := bucket.take(2000); wait != 0 {
+		t.Fatalf("saldo não reposto: %v", wait)
+	}
+}
+
+func TestThrottledReaderDelaysAboveRate(t *testing.T) {
+	var delayed time.Duration
+	reader := &throttledReader{
+		r:       bytes.NewReader(make([]byte, 3000)),
+		clock:   realClock{},
+		bucket:  newTokenBucket(realClock{}, 100*1000, 1000),
+		onDelay: func(wait time.Duration) { delayed += wait },
+	}
+
+	start := time.Now()
+	buf := make([]byte, 3000)
+	if n, err := reader.Read(buf); n != 3000 || err != nil {
+		t.Fatalf("leitura incompleta: %d %v", n, err)
+	}
+	// 2000 bytes acima da rajada a 100 kB/s: ~20ms
+	if delayed < 15*time.Millisecond || time.Since(start) < delayed {
+		t.Fatalf("leitura deveria esperar ~20ms: atraso %v, decorrido %v", delayed, time.Since(start))
+	}
+}
+
+func TestSyncResponseIsPaginated(t *testing.T) {
+	node := NewP2PNode("node-S", "127.0.0.1", 0)
+	prev := ""
+	for i := 1; i <= maxSyncBlocks+20; i++ {
+		block := testBlock(i, prev)
+		block.Hash = fmt.Sprintf("TEST_BLOCK_%06d_xxxxxxxxxxxx", i)
+		node.Blockchain = append(node.Blockchain, block)
+		prev = block.Hash
+	}
+
+	reply := node.handleSyncRequest(&NetworkMessage{
+		Type: MSG_SYNC_REQUEST,
+		From: "peer",
+		Data: &syncRequest{CurrentHeight: 10},
+	})
+	data := reply.Data.(*syncResponse)
+	if len(data.Blocks) != maxSyncBlocks || data.Blocks[0].Index != 11 {
+		t.Fatalf("página inesperada: %d blocos a partir de %d", len(data.Blocks), data.Blocks[0].Index)
+	}
+	if data.Height != maxSyncBlocks+20 {
+		t.Fatalf("altura anunciada incorreta: %v", data.Height)
+	}
+}
+
+func TestOversizedOutboundIsDroppedAndCounted(t *testing.T) {
+	nodeA := newTestNode(t, "node-A")
+	nodeB := newTestNode(t, "node-B")
+	if err := nodeA.connectToPeer(&Peer{Address: "127.0.0.1", Port: nodeB.Port}); err != nil {
+		t.Fatal(err)
+	}
+
+	huge := &rejectMessage{Reason: strings.Repeat("9", 8*1024)}
+	if err := nodeA.sendToPeer("node-B", &NetworkMessage{Type: MSG_REJECT, Data: huge}); err != nil {
+		t.Fatal(err)
+	}
+	if !waitFor(t, defaultWait, func() bool { return nodeA.GetTrafficStats()["oversized_out:"+MSG_REJECT] == 1 }) {
+		t.Fatalf("reject grande não descartado: %v", nodeA.GetTrafficStats())
+	}
+	if score := nodeB.security.MisbehaviorScores()["node-A"]; score != 0 {
+		t.Fatalf("B não deveria ter recebido a mensagem: pontuação %d", score)
+	}
+}
+
+func TestLargeSyncRespectsBandwidth(t *testing.T) {
+	dir := t.TempDir()
+	sn := NewSimNetwork(1)
+	nodeA := sn.NewNode("A", filepath.Join(dir, "A"))
+	nodeB := sn.NewNode("B", filepath.Join(dir, "B"))
+	for _, node := range []*P2PNode{nodeA, nodeB} {
+		if err := node.StartNode(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// ~20 MiB de blocos: passa da rajada do bucket e exige duas páginas de sync
+	const blocks = 200
+	padding := []string{strings.Repeat("p", 100*1024)}
+	prev := ""
+	for i := 1; i <= blocks; i++ {
+		block := testBlock(i, prev)
+		block.Hash = fmt.Sprintf("TEST_BLOCK_%06d_xxxxxxxxxxxx", i)
+		block.HashParts = padding
+		nodeA.Blockchain = append(nodeA.Blockchain, block)
+		prev = block.Hash
+	}
+	nodeB.ChainID = nodeA.Blockchain[0].Hash // Do genesis.json comum
+
+	connected := make(chan bool, 1)
+	go func() { connected <- nodeB.ConnectToAddress(nodeA.Address, strconv.Itoa(nodeA.Port)) }()
+	sn.RunFor(30 * time.Second)
+	if err := sn.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !<-connected {
+		t.Fatal("B não conectou a A")
+	}
+	if height := chainHeight(nodeB); height != blocks {
+		t.Fatalf("B sincronizou %d de %d blocos", height, blocks)
+	}
+	// O envio de A segura a segunda página até o bucket repor o saldo
+	if nodeA.GetTrafficStats()["delayed_out:"+MSG_SYNC_RESPONSE] == 0 {
+		t.Fatalf("envio deveria ter sido limitado: %v", nodeA.GetTrafficStats())
+	}
+}
@@ -0,0 +1,759 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Consenso BFT no estilo Tendermint. Cada altura passa por rodadas; em
+// cada rodada um proponente rotativo propõe um bloco e os validadores votam
+// em duas fases, prevote e precommit. Quem vê +2/3 de prevotes num bloco
+// (polka) trava nele e só destrava com uma polka mais recente, por isso dois
+// blocos nunca recebem +2/3 de precommits na mesma altura enquanto os
+// bizantinos tiverem menos de 1/3 do poder de voto. Os timeouts crescem a
+// cada rodada para que a rede volte a progredir depois de perdas ou de um
+// proponente silencioso.
+//
+// bftEngine é só a máquina de estados: não envia nada nem toma locks. Cada
+// entrada (proposta, voto, timeout) acumula ações que o nó executa depois
+// (consensus.go).
+
+// Tipos de voto
+const (
+	votePrevote   = "prevote"
+	votePrecommit = "precommit"
+)
+
+// Etapas de uma rodada
+type bftStep int
+
+const (
+	stepPropose bftStep = iota
+	stepPrevote
+	stepPrecommit
+)
+
+func (s bftStep) String() string {
+	return [...]string{"propose", "prevote", "precommit"}[s]
+}
+
+const (
+	minValidatorStake   = 10
+	bftTimeoutPropose   = 3 * time.Second
+	bftTimeoutPrevote   = time.Second
+	bftTimeoutPrecommit = time.Second
+	bftTimeoutDelta     = 500 * time.Millisecond // Acréscimo por rodada
+	bftMaxFutureMsgs    = 512                    // Mensagens guardadas de alturas à frente
+)
+
+var (
+	errBadConsensusSignature = errors.New("assinatura de consenso inválida")
+	errEquivocation          = errors.New("validador assinou duas mensagens conflitantes")
+)
+
+// bftTimeout é o prazo da etapa na rodada informada
+func bftTimeout(step bftStep, round int) time.Duration {
+	base := map[bftStep]time.Duration{
+		stepPropose:   bftTimeoutPropose,
+		stepPrevote:   bftTimeoutPrevote,
+		stepPrecommit: bftTimeoutPrecommit,
+	}[step]
+	return base + time.Duration(round)*bftTimeoutDelta
+}
+
+// consensusProposal é o corpo de MSG_CONSENSUS_REQUEST. POLRound é a rodada
+// da polka que justifica repropor um bloco travado (-1 sem polka).
+type consensusProposal struct {
+	Height    int    `json:"height"`
+	Round     int    `json:"round"`
+	POLRound  int    `json:"pol_round"`
+	Block     Token  `json:"block"`
+	Proposer  string `json:"proposer"`
+	Signature string `json:"signature"` // Chave de identidade do proponente
+}
+
+// ConsensusVote é um prevote ou precommit; BlockHash vazio é o voto nil
+type ConsensusVote struct {
+	Height    int    `json:"height"`
+	Round     int    `json:"round"`
+	Type      string `json:"type"`
+	BlockHash string `json:"block_hash,omitempty"`
+	Voter     string `json:"voter"`
+	Signature string `json:"signature"` // Chave de identidade do validador
+}
+
+// consensusStart é o corpo de MSG_CONSENSUS_START: o remetente quer decidir
+// a altura e os demais validadores entram nela
+type consensusStart struct {
+	Height int `json:"height"`
+}
+
+// CommitCertificate prova a decisão de um bloco: precommits assinados de
+// mais de 2/3 do poder de voto na mesma rodada
+type CommitCertificate struct {
+	Height     int             `json:"height"`
+	Round      int             `json:"round"`
+	BlockHash  string          `json:"block_hash"`
+	Precommits []ConsensusVote `json:"precommits"`
+}
+
+// === Assinaturas ===
+
+// voteSignBytes são os bytes assinados pelo validador; o chain ID impede
+// que um voto valha em outra rede
+func voteSignBytes(chainID string, v *ConsensusVote) []byte {
+	e := &wireEncoder{}
+	e.string(1, "vote")
+	e.string(2, chainID)
+	e.int(3, int64(v.Height))
+	e.int(4, int64(v.Round))
+	e.string(5, v.Type)
+	e.string(6, v.BlockHash)
+	e.string(7, v.Voter)
+	return e.buf
+}
+
+// proposalSignBytes cobre o bloco inteiro, não só o hash
+func proposalSignBytes(chainID string, p *consensusProposal) []byte {
+	block := p.Block
+	block.Commit = nil
+	e := &wireEncoder{}
+	e.string(1, "proposal")
+	e.string(2, chainID)
+	e.int(3, int64(p.Height))
+	e.int(4, int64(p.Round))
+	e.int(5, int64(p.POLRound))
+	e.message(6, &block)
+	e.string(7, p.Proposer)
+	return e.buf
+}
+
+func signConsensus(key *rsa.PrivateKey, data []byte) (string, error) {
+	hash := sha256.Sum256(data)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+func verifyConsensus(key *rsa.PublicKey, data []byte, signature string) bool {
+	raw, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || key == nil {
+		return false
+	}
+	hash := sha256.Sum256(data)
+	return rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], raw) == nil
+}
+
+// === Conjunto de validadores ===
+
+type bftValidator struct {
+	ID    string
+	Power int
+	key   *rsa.PublicKey
+}
+
+// validatorSet é fixo durante uma altura; o proponente é sorteado com a
+// semente do beacon RANDAO da época (randao.go), na ordem por ID
+type validatorSet struct {
+	validators []bftValidator
+	index      map[string]int
+	total      int
+	seed       string
+}
+
+func newValidatorSet(validators []bftValidator) *validatorSet {
+	vs := &validatorSet{index: make(map[string]int)}
+	for _, v := range validators {
+		if _, dup := vs.index[v.ID]; dup || v.Power <= 0 {
+			continue
+		}
+		vs.index[v.ID] = 0
+		vs.validators = append(vs.validators, v)
+	}
+	sort.Slice(vs.validators, func(i, j int) bool { return vs.validators[i].ID < vs.validators[j].ID })
+	for i, v := range vs.validators {
+		vs.index[v.ID] = i
+		vs.total += v.Power
+	}
+	return vs
+}
+
+func (vs *validatorSet) get(id string) (*bftValidator, bool) {
+	i, exists := vs.index[id]
+	if !exists {
+		return nil, false
+	}
+	return &vs.validators[i], true
+}
+
+func (vs *validatorSet) size() int { return len(vs.validators) }
+
+// keyedPower soma o poder dos validadores com chave conhecida
+func (vs *validatorSet) keyedPower() int {
+	power := 0
+	for _, v := range vs.validators {
+		if v.key != nil {
+			power += v.Power
+		}
+	}
+	return power
+}
+
+// proposer sorteia o proponente da altura e rodada com probabilidade
+// proporcional ao poder; a mesma semente dá o mesmo proponente em todo nó
+func (vs *validatorSet) proposer(height, round int) string {
+	if len(vs.validators) == 0 {
+		return ""
+	}
+	target := sampleIndex(vs.seed, height, round, uint64(vs.total))
+	for _, v := range vs.validators {
+		if target < uint64(v.Power) {
+			return v.ID
+		}
+		target -= uint64(v.Power)
+	}
+	return vs.validators[len(vs.validators)-1].ID
+}
+
+// proposedUpTo: o validador é o proponente de alguma rodada até maxRound
+// da altura. Uma reproposta carrega o bloco montado numa rodada anterior,
+// então o autor do bloco (Validator, quem recebe a recompensa) pode ser o
+// proponente de uma rodada anterior, nunca alguém fora do sorteio.
+func (vs *validatorSet) proposedUpTo(validator string, height, maxRound int) bool {
+	for round := 0; round <= maxRound; round++ {
+		if vs.proposer(height, round) == validator {
+			return true
+		}
+	}
+	return false
+}
+
+// hasQuorum: mais de 2/3 do poder total
+func (vs *validatorSet) hasQuorum(power int) bool {
+	return power*3 > vs.total*2
+}
+
+// exceedsThird: mais de 1/3, ao menos um validador honesto
+func (vs *validatorSet) exceedsThird(power int) bool {
+	return power*3 > vs.total
+}
+
+// voteSet guarda o primeiro voto de cada validador num tipo e rodada
+type voteSet struct {
+	votes map[string]*ConsensusVote
+	power map[string]int // Hash do bloco (vazio = nil) -> poder
+	total int
+}
+
+func newVoteSet() *voteSet {
+	return &voteSet{votes: make(map[string]*ConsensusVote), power: make(map[string]int)}
+}
+
+// add retorna errEquivocation se o validador já votou em outro bloco
+func (s *voteSet) add(v *ConsensusVote, power int) (bool, error) {
+	if existing, voted := s.votes[v.Voter]; voted {
+		if existing.BlockHash != v.BlockHash {
+			return false, errEquivocation
+		}
+		return false, nil
+	}
+	s.votes[v.Voter] = v
+	s.power[v.BlockHash] += power
+	s.total += power
+	return true, nil
+}
+
+// === Máquina de estados ===
+
+// bftAction é uma ação pedida pela máquina; só um campo é preenchido
+type bftAction struct {
+	proposal *consensusProposal
+	vote     *ConsensusVote
+	timeout  *bftTimeoutEvent
+	commit   *Token // Bloco decidido, com o certificado em Commit
+	evidence *DoubleSignEvidence
+}
+
+type bftTimeoutEvent struct {
+	height int
+	round  int
+	step   bftStep
+	after  time.Duration
+}
+
+type bftEngine struct {
+	self     string
+	chainID  string
+	key      *rsa.PrivateKey
+	validate func(block *Token, height int) error // valid(v) do Tendermint
+	build    func(height int) *Token              // Bloco novo quando não há candidato
+
+	active      bool
+	height      int
+	round       int
+	step        bftStep
+	valSet      *validatorSet
+	candidate   *Token // Bloco pedido localmente (StartConsensusRound)
+	locked      *Token
+	lockedRound int
+	valid       *Token
+	validRound  int
+	proposals   map[int]*consensusProposal
+	prevotes    map[int]*voteSet
+	precommits  map[int]*voteSet
+	senders     map[int]map[string]bool // Validadores com mensagens em cada rodada
+	once        map[string]bool         // Regras "pela primeira vez" do algoritmo
+	validity    map[string]error        // valid(v) por hash, calculado uma vez
+	future      []bftMessage            // Mensagens de alturas à frente
+	actions     []bftAction
+}
+
+type bftMessage struct {
+	proposal *consensusProposal
+	vote     *ConsensusVote
+}
+
+func (m bftMessage) height() int {
+	if m.proposal != nil {
+		return m.proposal.Height
+	}
+	return m.vote.Height
+}
+
+func newBFTEngine(self string) *bftEngine {
+	return &bftEngine{self: self}
+}
+
+// takeActions devolve e limpa as ações acumuladas
+func (e *bftEngine) takeActions() []bftAction {
+	actions := e.actions
+	e.actions = nil
+	return actions
+}
+
+// startHeight começa a altura na rodada 0 com o conjunto de validadores
+// fixado para ela e processa as mensagens que chegaram antes
+func (e *bftEngine) startHeight(height int, set *validatorSet) {
+	e.active, e.height, e.valSet = true, height, set
+	e.locked, e.lockedRound = nil, -1
+	e.valid, e.validRound = nil, -1
+	e.proposals = make(map[int]*consensusProposal)
+	e.prevotes = make(map[int]*voteSet)
+	e.precommits = make(map[int]*voteSet)
+	e.senders = make(map[int]map[string]bool)
+	e.once = make(map[string]bool)
+	e.validity = make(map[string]error)
+	if e.candidate != nil && e.candidate.Index != height {
+		e.candidate = nil
+	}
+	e.startRound(0)
+
+	pending := e.future
+	e.future = nil
+	for _, m := range pending {
+		if !e.active {
+			e.buffer(m)
+			continue
+		}
+		switch {
+		case m.height() > height:
+			e.buffer(m)
+		case m.height() == height && m.proposal != nil:
+			e.receiveProposal(m.proposal)
+		case m.height() == height:
+			e.receiveVote(m.vote)
+		}
+	}
+}
+
+// stop abandona a altura (o bloco chegou por outro caminho)
+func (e *bftEngine) stop() {
+	e.active = false
+	e.candidate = nil
+}
+
+func (e *bftEngine) buffer(m bftMessage) {
+	if len(e.future) < bftMaxFutureMsgs {
+		e.future = append(e.future, m)
+	}
+}
+
+// hasFuture indica se há mensagens guardadas para a altura
+func (e *bftEngine) hasFuture(height int) bool {
+	for _, m := range e.future {
+		if m.height() == height {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *bftEngine) startRound(round int) {
+	e.round, e.step = round, stepPropose
+
+	if e.valSet.proposer(e.height, round) == e.self {
+		block := e.valid
+		if block == nil {
+			block = e.candidate
+		}
+		if block == nil {
+			block = e.build(e.height)
+		}
+		if block != nil {
+			proposal := &consensusProposal{
+				Height:   e.height,
+				Round:    round,
+				POLRound: e.validRound,
+				Block:    *block,
+				Proposer: e.self,
+			}
+			proposal.Block.Commit = nil
+			signature, err := signConsensus(e.key, proposalSignBytes(e.chainID, proposal))
+			if err != nil {
+				fmt.Printf("❌ [%s] Erro ao assinar proposta: %v\n", e.self, err)
+			} else {
+				proposal.Signature = signature
+				e.proposals[round] = proposal
+				e.markSender(round, e.self)
+				e.actions = append(e.actions, bftAction{proposal: proposal})
+			}
+		}
+	}
+	e.schedule(stepPropose)
+	e.process()
+}
+
+func (e *bftEngine) schedule(step bftStep) {
+	e.actions = append(e.actions, bftAction{timeout: &bftTimeoutEvent{
+		height: e.height,
+		round:  e.round,
+		step:   step,
+		after:  bftTimeout(step, e.round),
+	}})
+}
+
+func (e *bftEngine) markSender(round int, validator string) {
+	if e.senders[round] == nil {
+		e.senders[round] = make(map[string]bool)
+	}
+	e.senders[round][validator] = true
+}
+
+// receiveProposal registra uma proposta recebida. Retorna erro quando a
+// mensagem é inválida (assinatura, proponente errado ou equivocação).
+func (e *bftEngine) receiveProposal(p *consensusProposal) error {
+	if !e.active || p.Height > e.height {
+		e.buffer(bftMessage{proposal: p})
+		return nil
+	}
+	if p.Height < e.height || p.Round < 0 {
+		return nil
+	}
+	if expected := e.valSet.proposer(p.Height, p.Round); p.Proposer != expected {
+		return fmt.Errorf("proposta de %s na rodada %d, proponente é %s", p.Proposer, p.Round, expected)
+	}
+	validator, _ := e.valSet.get(p.Proposer)
+	if !verifyConsensus(validator.key, proposalSignBytes(e.chainID, p), p.Signature) {
+		return errBadConsensusSignature
+	}
+	if p.POLRound < -1 || p.POLRound >= p.Round || p.Block.Hash == "" {
+		return fmt.Errorf("proposta malformada (pol %d, rodada %d)", p.POLRound, p.Round)
+	}
+	// Bloco novo é do proponente; reproposta, de um proponente até a POL
+	if (p.POLRound == -1 && p.Block.Validator != p.Proposer) ||
+		(p.POLRound >= 0 && !e.valSet.proposedUpTo(p.Block.Validator, p.Height, p.POLRound)) {
+		return fmt.Errorf("bloco de %q proposto por %s na rodada %d", p.Block.Validator, p.Proposer, p.Round)
+	}
+	if existing, exists := e.proposals[p.Round]; exists {
+		if existing.Block.Hash != p.Block.Hash {
+			e.actions = append(e.actions, bftAction{evidence: &DoubleSignEvidence{ProposalA: existing, ProposalB: p}})
+			return errEquivocation
+		}
+		return nil
+	}
+
+	e.proposals[p.Round] = p
+	e.markSender(p.Round, p.Proposer)
+	e.process()
+	return nil
+}
+
+// receiveVote registra um voto recebido
+func (e *bftEngine) receiveVote(v *ConsensusVote) error {
+	if !e.active || v.Height > e.height {
+		e.buffer(bftMessage{vote: v})
+		return nil
+	}
+	if v.Height < e.height || v.Round < 0 {
+		return nil
+	}
+	validator, member := e.valSet.get(v.Voter)
+	if !member {
+		return fmt.Errorf("%s não é validador na altura %d", v.Voter, v.Height)
+	}
+	if v.Type != votePrevote && v.Type != votePrecommit {
+		return fmt.Errorf("tipo de voto desconhecido: %q", v.Type)
+	}
+	if !verifyConsensus(validator.key, voteSignBytes(e.chainID, v), v.Signature) {
+		return errBadConsensusSignature
+	}
+	if err := e.addVote(v, validator.Power); err != nil {
+		return err
+	}
+	e.process()
+	return nil
+}
+
+func (e *bftEngine) addVote(v *ConsensusVote, power int) error {
+	sets := e.prevotes
+	if v.Type == votePrecommit {
+		sets = e.precommits
+	}
+	if sets[v.Round] == nil {
+		sets[v.Round] = newVoteSet()
+	}
+	if _, err := sets[v.Round].add(v, power); err != nil {
+		if err == errEquivocation {
+			existing := sets[v.Round].votes[v.Voter]
+			e.actions = append(e.actions, bftAction{evidence: &DoubleSignEvidence{VoteA: existing, VoteB: v}})
+		}
+		return err
+	}
+	e.markSender(v.Round, v.Voter)
+	return nil
+}
+
+// vote assina e registra o próprio voto; nós fora do conjunto só observam
+func (e *bftEngine) vote(voteType, blockHash string) {
+	validator, member := e.valSet.get(e.self)
+	if !member {
+		return
+	}
+	v := &ConsensusVote{
+		Height:    e.height,
+		Round:     e.round,
+		Type:      voteType,
+		BlockHash: blockHash,
+		Voter:     e.self,
+	}
+	signature, err := signConsensus(e.key, voteSignBytes(e.chainID, v))
+	if err != nil {
+		fmt.Printf("❌ [%s] Erro ao assinar %s: %v\n", e.self, voteType, err)
+		return
+	}
+	v.Signature = signature
+	e.addVote(v, validator.Power)
+	e.actions = append(e.actions, bftAction{vote: v})
+}
+
+// onTimeout trata o prazo de uma etapa, se ela ainda estiver em curso
+func (e *bftEngine) onTimeout(t *bftTimeoutEvent) {
+	if !e.active || t.height != e.height || t.round != e.round {
+		return
+	}
+	switch t.step {
+	case stepPropose:
+		if e.step == stepPropose {
+			e.vote(votePrevote, "")
+			e.step = stepPrevote
+		}
+	case stepPrevote:
+		if e.step == stepPrevote {
+			e.vote(votePrecommit, "")
+			e.step = stepPrecommit
+		}
+	case stepPrecommit:
+		e.startRound(e.round + 1)
+		return
+	}
+	e.process()
+}
+
+func (e *bftEngine) isValid(block *Token) bool {
+	err, checked := e.validity[block.Hash]
+	if !checked {
+		err = e.validate(block, e.height)
+		e.validity[block.Hash] = err
+	}
+	return err == nil
+}
+
+func (e *bftEngine) firstTime(rule string, round int) bool {
+	key := fmt.Sprintf("%s/%d", rule, round)
+	if e.once[key] {
+		return false
+	}
+	e.once[key] = true
+	return true
+}
+
+// process aplica as regras do algoritmo até o estado parar de mudar
+func (e *bftEngine) process() {
+	for e.active {
+		height, round, step, actions := e.height, e.round, e.step, len(e.actions)
+		e.processOnce()
+		if e.height == height && e.round == round && e.step == step && len(e.actions) == actions {
+			return
+		}
+	}
+}
+
+func (e *bftEngine) processOnce() {
+	// Decisão: proposta de qualquer rodada com +2/3 de precommits nela
+	for round, p := range e.proposals {
+		precommits := e.precommits[round]
+		if precommits != nil && e.valSet.hasQuorum(precommits.power[p.Block.Hash]) && e.isValid(&p.Block) {
+			e.decide(round, p)
+			return
+		}
+	}
+
+	// Mais de 1/3 do poder já está numa rodada à frente: pula para a maior
+	skipTo := e.round
+	for round, senders := range e.senders {
+		if round <= skipTo {
+			continue
+		}
+		power := 0
+		for id := range senders {
+			if v, member := e.valSet.get(id); member {
+				power += v.Power
+			}
+		}
+		if e.valSet.exceedsThird(power) {
+			skipTo = round
+		}
+	}
+	if skipTo > e.round {
+		e.startRound(skipTo)
+		return
+	}
+
+	p := e.proposals[e.round]
+	prevotes := e.prevotes[e.round]
+	if prevotes == nil {
+		prevotes = newVoteSet()
+	}
+
+	if e.step == stepPropose && p != nil {
+		hash := p.Block.Hash
+		if p.POLRound == -1 {
+			if e.isValid(&p.Block) && (e.lockedRound == -1 || e.locked.Hash == hash) {
+				e.vote(votePrevote, hash)
+			} else {
+				e.vote(votePrevote, "")
+			}
+			e.step = stepPrevote
+		} else if pol := e.prevotes[p.POLRound]; pol != nil && e.valSet.hasQuorum(pol.power[hash]) {
+			// Reproposta justificada por uma polka anterior
+			if e.isValid(&p.Block) && (e.lockedRound <= p.POLRound || e.locked.Hash == hash) {
+				e.vote(votePrevote, hash)
+			} else {
+				e.vote(votePrevote, "")
+			}
+			e.step = stepPrevote
+		}
+	}
+
+	if e.step == stepPrevote && e.valSet.hasQuorum(prevotes.total) && e.firstTime("prevote-wait", e.round) {
+		e.schedule(stepPrevote)
+	}
+
+	if e.step >= stepPrevote && p != nil && e.valSet.hasQuorum(prevotes.power[p.Block.Hash]) &&
+		e.isValid(&p.Block) && e.firstTime("polka", e.round) {
+		block := p.Block
+		if e.step == stepPrevote {
+			e.locked, e.lockedRound = &block, e.round
+			e.vote(votePrecommit, block.Hash)
+			e.step = stepPrecommit
+		}
+		e.valid, e.validRound = &block, e.round
+	}
+
+	if e.step == stepPrevote && e.valSet.hasQuorum(prevotes.power[""]) {
+		e.vote(votePrecommit, "")
+		e.step = stepPrecommit
+	}
+
+	if precommits := e.precommits[e.round]; precommits != nil && e.valSet.hasQuorum(precommits.total) &&
+		e.firstTime("precommit-wait", e.round) {
+		e.schedule(stepPrecommit)
+	}
+}
+
+// decide monta o certificado e pede o commit do bloco
+func (e *bftEngine) decide(round int, p *consensusProposal) {
+	precommits := make([]ConsensusVote, 0, e.valSet.size())
+	for _, v := range e.precommits[round].votes {
+		if v.BlockHash == p.Block.Hash {
+			precommits = append(precommits, *v)
+		}
+	}
+	sort.Slice(precommits, func(i, j int) bool { return precommits[i].Voter < precommits[j].Voter })
+
+	block := p.Block
+	block.Commit = &CommitCertificate{
+		Height:     e.height,
+		Round:      round,
+		BlockHash:  block.Hash,
+		Precommits: precommits,
+	}
+	e.actions = append(e.actions, bftAction{commit: &block})
+	e.stop()
+}
+
+// checkCertificate compara os precommits de um certificado já conferido
+// com os recebidos nesta altura: quem assinou outro precommit na mesma
+// rodada equivocou, mesmo que cada versão tenha ido a um peer diferente
+func (e *bftEngine) checkCertificate(cert *CommitCertificate) {
+	if e.height != cert.Height || e.precommits[cert.Round] == nil {
+		return
+	}
+	received := e.precommits[cert.Round].votes
+	for i := range cert.Precommits {
+		v := cert.Precommits[i]
+		if existing := received[v.Voter]; existing != nil && existing.BlockHash != v.BlockHash {
+			e.actions = append(e.actions, bftAction{evidence: &DoubleSignEvidence{VoteA: existing, VoteB: &v}})
+		}
+	}
+}
+
+// verifyCommit confere o certificado de um bloco contra o conjunto de
+// validadores da altura
+func verifyCommit(chainID string, block *Token, set *validatorSet) error {
+	cert := block.Commit
+	if cert.Height != block.Index || cert.BlockHash != block.Hash {
+		return fmt.Errorf("certificado de outro bloco (%d %.16s)", cert.Height, cert.BlockHash)
+	}
+
+	power := 0
+	counted := make(map[string]bool)
+	for i := range cert.Precommits {
+		v := &cert.Precommits[i]
+		if v.Type != votePrecommit || v.Height != cert.Height || v.Round != cert.Round || v.BlockHash != cert.BlockHash {
+			return fmt.Errorf("precommit de %s não corresponde ao certificado", v.Voter)
+		}
+		validator, member := set.get(v.Voter)
+		if !member || counted[v.Voter] || validator.key == nil {
+			continue
+		}
+		if !verifyConsensus(validator.key, voteSignBytes(chainID, v), v.Signature) {
+			return fmt.Errorf("precommit de %s: %w", v.Voter, errBadConsensusSignature)
+		}
+		counted[v.Voter] = true
+		power += validator.Power
+	}
+	if !set.hasQuorum(power) {
+		return fmt.Errorf("certificado com %d de %d do poder de voto", power, set.total)
+	}
+	return nil
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"testing"
+)
+
+// bftHarness: máquina do validador A num conjunto A B C D de poder igual.
+// Com a semente harnessSeed, na altura 1 os proponentes das rodadas 0, 1, 2
+// e 3 são B, C, D e A.
+const harnessSeed = "harness-363"
+
+type bftHarness struct {
+	t      *testing.T
+	keys   map[string]*rsa.PrivateKey
+	set    *validatorSet
+	engine *bftEngine
+}
+
+func newBFTHarness(t *testing.T) *bftHarness {
+	t.Helper()
+	h := &bftHarness{t: t, keys: make(map[string]*rsa.PrivateKey)}
+	var validators []bftValidator
+	for _, id := range []string{"A", "B", "C", "D"} {
+		key, err := rsa.GenerateKey(rand.Reader, 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.keys[id] = key
+		validators = append(validators, bftValidator{ID: id, Power: 10, key: &key.PublicKey})
+	}
+	h.set = newValidatorSet(validators)
+	h.set.seed = harnessSeed
+
+	h.engine = newBFTEngine("A")
+	h.engine.key = h.keys["A"]
+	h.engine.chainID = "genesis"
+	h.engine.validate = func(block *Token, height int) error {
+		if block.Hash == "BAD" {
+			return fmt.Errorf("bloco inválido")
+		}
+		return nil
+	}
+	h.engine.build = func(height int) *Token {
+		block := testBlock(height, "")
+		block.Validator = "A"
+		return &block
+	}
+	h.engine.startHeight(1, h.set)
+	h.engine.takeActions()
+	return h
+}
+
+func (h *bftHarness) block(hash string) Token {
+	block := testBlock(1, "")
+	block.Hash = hash
+	return block
+}
+
+func (h *bftHarness) propose(round, polRound int, hash string) error {
+	h.t.Helper()
+	p := &consensusProposal{Height: 1, Round: round, POLRound: polRound, Block: h.block(hash), Proposer: h.set.proposer(1, round)}
+	p.Block.Validator = p.Proposer
+	if polRound >= 0 {
+		p.Block.Validator = h.set.proposer(1, polRound)
+	}
+	signature, err := signConsensus(h.keys[p.Proposer], proposalSignBytes("genesis", p))
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	p.Signature = signature
+	return h.engine.receiveProposal(p)
+}
+
+func (h *bftHarness) signedVote(voter, voteType string, round int, hash string) *ConsensusVote {
+	h.t.Helper()
+	v := &ConsensusVote{Height: 1, Round: round, Type: voteType, BlockHash: hash, Voter: voter}
+	signature, err := signConsensus(h.keys[voter], voteSignBytes("genesis", v))
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	v.Signature = signature
+	return v
+}
+
+func (h *bftHarness) vote(voteType string, round int, hash string, voters ...string) {
+	h.t.Helper()
+	for _, voter := range voters {
+		if err := h.engine.receiveVote(h.signedVote(voter, voteType, round, hash)); err != nil {
+			h.t.Fatalf("voto de %s: %v", voter, err)
+		}
+	}
+}
+
+// ownVote retorna o último voto do tipo emitido por A desde a última chamada
+func (h *bftHarness) ownVote(voteType string) *ConsensusVote {
+	h.t.Helper()
+	var last *ConsensusVote
+	for _, action := range h.engine.takeActions() {
+		if action.vote != nil && action.vote.Type == voteType {
+			last = action.vote
+		}
+	}
+	if last == nil {
+		h.t.Fatalf("A não emitiu %s", voteType)
+	}
+	return last
+}
+
+func TestBFTLockedValidatorRejectsOtherBlock(t *testing.T) {
+	h := newBFTHarness(t)
+
+	// Rodada 0: polka em X, A trava e faz precommit de X
+	if err := h.propose(0, -1, "BLOCK_X_000000000000"); err != nil {
+		t.Fatal(err)
+	}
+	if v := h.ownVote(votePrevote); v.BlockHash != "BLOCK_X_000000000000" {
+		t.Fatalf("prevote em %q", v.BlockHash)
+	}
+	h.vote(votePrevote, 0, "BLOCK_X_000000000000", "B", "C")
+	if v := h.ownVote(votePrecommit); v.BlockHash != "BLOCK_X_000000000000" {
+		t.Fatalf("precommit em %q", v.BlockHash)
+	}
+
+	// Sem +2/3 de precommits a rodada expira
+	h.vote(votePrecommit, 0, "", "B", "C")
+	h.engine.onTimeout(&bftTimeoutEvent{height: 1, round: 0, step: stepPrecommit})
+	if h.engine.round != 1 {
+		t.Fatalf("rodada %d após o timeout de precommit", h.engine.round)
+	}
+
+	// Rodada 1: Y sem polka anterior; A continua travado em X
+	if err := h.propose(1, -1, "BLOCK_Y_000000000000"); err != nil {
+		t.Fatal(err)
+	}
+	if v := h.ownVote(votePrevote); v.BlockHash != "" {
+		t.Fatalf("validador travado em X votou em %q", v.BlockHash)
+	}
+
+	// Uma polka mais recente em Y destrava
+	h.vote(votePrevote, 1, "BLOCK_Y_000000000000", "B", "C", "D")
+	if v := h.ownVote(votePrecommit); v.BlockHash != "BLOCK_Y_000000000000" || h.engine.lockedRound != 1 {
+		t.Fatalf("precommit em %q, trava na rodada %d", v.BlockHash, h.engine.lockedRound)
+	}
+}
+
+func TestBFTReproposalWithPOLRound(t *testing.T) {
+	h := newBFTHarness(t)
+
+	// A trava em X na rodada 0
+	h.propose(0, -1, "BLOCK_X_000000000000")
+	h.vote(votePrevote, 0, "BLOCK_X_000000000000", "B", "C")
+	h.engine.onTimeout(&bftTimeoutEvent{height: 1, round: 0, step: stepPrecommit})
+	h.engine.takeActions()
+
+	// Na rodada 1 D não recebeu nada, mas a polka da rodada 1 em Y é
+	// comprovada na reproposta da rodada 2
+	h.vote(votePrevote, 1, "BLOCK_Y_000000000000", "B", "C", "D")
+	h.engine.onTimeout(&bftTimeoutEvent{height: 1, round: 1, step: stepPropose})
+	h.engine.onTimeout(&bftTimeoutEvent{height: 1, round: 1, step: stepPrevote})
+	h.engine.onTimeout(&bftTimeoutEvent{height: 1, round: 1, step: stepPrecommit})
+	h.engine.takeActions()
+	if h.engine.round != 2 {
+		t.Fatalf("rodada %d", h.engine.round)
+	}
+
+	if err := h.propose(2, 1, "BLOCK_Y_000000000000"); err != nil {
+		t.Fatal(err)
+	}
+	if v := h.ownVote(votePrevote); v.BlockHash != "BLOCK_Y_000000000000" {
+		t.Fatalf("reproposta com POL mais recente que a trava recebeu prevote %q", v.BlockHash)
+	}
+}
+
+func TestBFTCommitCertificate(t *testing.T) {
+	h := newBFTHarness(t)
+
+	h.propose(0, -1, "BLOCK_X_000000000000")
+	h.vote(votePrevote, 0, "BLOCK_X_000000000000", "B", "C")
+	h.engine.takeActions()
+	h.vote(votePrecommit, 0, "BLOCK_X_000000000000", "B", "C")
+
+	var committed *Token
+	for _, action := range h.engine.takeActions() {
+		if action.commit != nil {
+			committed = action.commit
+		}
+	}
+	if committed == nil || h.engine.active {
+		t.Fatal("+2/3 de precommits não decidiram o bloco")
+	}
+	if err := verifyCommit("genesis", committed, h.set); err != nil {
+		t.Fatalf("certificado válido rejeitado: %v", err)
+	}
+	if err := verifyCommit("outra-rede", committed, h.set); err == nil {
+		t.Fatal("certificado aceito com outro chain ID")
+	}
+
+	short := *committed
+	cert := *committed.Commit
+	cert.Precommits = cert.Precommits[:2]
+	short.Commit = &cert
+	if err := verifyCommit("genesis", &short, h.set); err == nil {
+		t.Fatal("certificado com 2 de 4 validadores aceito")
+	}
+
+	other := *committed
+	other.Hash = "BLOCK_Z_000000000000"
+	if err := verifyCommit("genesis", &other, h.set); err == nil {
+		t.Fatal("certificado aceito para outro bloco")
+	}
+}
+
+func TestBFTInvalidProposalGetsNilPrevote(t *testing.T) {
+	h := newBFTHarness(t)
+	h.propose(0, -1, "BAD")
+	if v := h.ownVote(votePrevote); v.BlockHash != "" {
+		t.Fatalf("bloco inválido recebeu prevote")
+	}
+}
+
+func TestBFTRejectsEquivocationAndForgery(t *testing.T) {
+	h := newBFTHarness(t)
+
+	if err := h.propose(0, -1, "BLOCK_X_000000000000"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.propose(0, -1, "BLOCK_Y_000000000000"); err != errEquivocation {
+		t.Fatalf("segunda proposta da rodada: %v", err)
+	}
+
+	h.vote(votePrevote, 0, "BLOCK_X_000000000000", "B")
+	if err := h.engine.receiveVote(h.signedVote("B", votePrevote, 0, "BLOCK_Y_000000000000")); err != errEquivocation {
+		t.Fatalf("voto conflitante: %v", err)
+	}
+
+	forged := h.signedVote("C", votePrevote, 0, "BLOCK_X_000000000000")
+	forged.Voter = "D"
+	if err := h.engine.receiveVote(forged); err != errBadConsensusSignature {
+		t.Fatalf("voto com assinatura de outro validador: %v", err)
+	}
+
+	// O bloco novo precisa ser do próprio proponente, que recebe a recompensa
+	p := &consensusProposal{Height: 1, Round: 1, POLRound: -1, Block: h.block("BLOCK_V_000000000000"), Proposer: h.set.proposer(1, 1)}
+	p.Block.Validator = "D"
+	p.Signature, _ = signConsensus(h.keys[p.Proposer], proposalSignBytes("genesis", p))
+	if err := h.engine.receiveProposal(p); err == nil {
+		t.Fatal("proposta com bloco de outro autor aceita")
+	}
+
+	// Só o proponente da rodada pode propor
+	p = &consensusProposal{Height: 1, Round: 1, POLRound: -1, Block: h.block("BLOCK_W_000000000000"), Proposer: "D"}
+	p.Signature, _ = signConsensus(h.keys["D"], proposalSignBytes("genesis", p))
+	if err := h.engine.receiveProposal(p); err == nil {
+		t.Fatal("proposta de quem não é o proponente aceita")
+	}
+}
+
+func TestBFTSkipsToRoundWithOneThirdPower(t *testing.T) {
+	h := newBFTHarness(t)
+
+	h.vote(votePrevote, 5, "", "B")
+	if h.engine.round != 0 {
+		t.Fatal("um validador (1/4) não deveria mudar a rodada")
+	}
+	h.vote(votePrevote, 5, "", "C")
+	if h.engine.round != 5 {
+		t.Fatalf("rodada %d com metade do poder na rodada 5", h.engine.round)
+	}
+
+	// O timeout da nova rodada é maior que o da rodada 0
+	var propose *bftTimeoutEvent
+	for _, action := range h.engine.takeActions() {
+		if action.timeout != nil && action.timeout.step == stepPropose {
+			propose = action.timeout
+		}
+	}
+	if propose == nil || propose.round != 5 || propose.after <= bftTimeout(stepPropose, 0) {
+		t.Fatalf("timeout de proposta da rodada 5: %+v", propose)
+	}
+}
+
+func TestBFTBuffersFutureHeights(t *testing.T) {
+	h := newBFTHarness(t)
+
+	v := &ConsensusVote{Height: 2, Round: 0, Type: votePrevote, BlockHash: "BLOCK_2", Voter: "B"}
+	v.Signature, _ = signConsensus(h.keys["B"], voteSignBytes("genesis", v))
+	if err := h.engine.receiveVote(v); err != nil {
+		t.Fatal(err)
+	}
+	if !h.engine.hasFuture(2) {
+		t.Fatal("voto da altura seguinte descartado")
+	}
+
+	h.engine.startHeight(2, h.set)
+	if h.engine.hasFuture(2) || h.engine.prevotes[0].votes["B"] == nil {
+		t.Fatal("voto guardado não foi processado ao entrar na altura")
+	}
+}
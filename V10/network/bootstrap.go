@@ -4,31 +4,10 @@ import (
 	"fmt"
 	"math/rand"
 	"net"
-	"os"
 	"sync"
 	"time"
 )
 
-// Lista de nós bootstrap hardcoded
-var HardcodedBootstrapNodes = []struct {
-	IP   string
-	Port string
-}{
-	{"104.131.144.82", "8333"},
-	{"157.90.123.123", "8333"},
-	{"45.76.203.127", "8333"},
-	{"88.198.70.28", "8333"},
-	{"78.47.3.220", "8333"},
-	{"178.62.80.20", "8333"},
-	{"163.172.161.52", "8333"},
-	{"159.89.167.143", "8333"},
-	// ... mais nós hardcoded
-	{"127.0.0.1", "8333"}, // Local para desenvolvimento
-}
-
-// Lista de portas famosas para escanear na rede local
-var CommonPorts = []string{"8333", "8332", "8334", "18333", "18332"}
-
 // BootstrapManager gerencia o processo de bootstrap
 type BootstrapManager struct {
 	addrManager    *AddrManager
@@ -40,6 +19,14 @@ type BootstrapManager struct {
 	mutex          sync.RWMutex
 	connectTimeout time.Duration
 	connected      bool
+
+	// bootstrapPeers são os "host:porta" da configuração de rede (último recurso)
+	bootstrapPeers []string
+
+	// dhtDiscover faz a busca Kademlia do próprio ID (P2PNode.DHTDiscoverPeers)
+	dhtDiscover func() []*DHTNode
+	// lanDiscovery recebe os beacons multicast dos nós da rede local
+	lanDiscovery *LANDiscovery
 }
 
 // NewBootstrapManager cria um novo gerenciador de bootstrap
@@ -51,6 +38,7 @@ func NewBootstrapManager(addrManager *AddrManager, dnsSeeder *DNSSeeder) *Bootst
 		localNetworks:  []string{"192.168.0.0/16", "10.0.0.0/8", "172.16.0.0/12"},
 		maxConnections: 8,
 		connectTimeout: 5 * time.Second,
+		bootstrapPeers: DefaultNetworkConfig().BootstrapPeers,
 	}
 }
 
@@ -58,9 +46,11 @@ func NewBootstrapManager(addrManager *AddrManager, dnsSeeder *DNSSeeder) *Bootst
 func (bm *BootstrapManager) InitialConnection(connectionCallback func(ip, port string) bool) {
 	fmt.Println("🚀 Iniciando processo de bootstrap da rede...")
 
-	// Registra nós hardcoded no addr manager
-	for _, node := range HardcodedBootstrapNodes {
-		bm.addrManager.AddAddress(node.IP, node.Port, "hardcoded")
+	// Registra os peers de bootstrap da configuração no addr manager
+	for _, peer := range bm.bootstrapPeers {
+		if ip, port, err := net.SplitHostPort(peer); err == nil {
+			bm.addrManager.AddAddress(ip, port, "hardcoded")
+		}
 	}
 
 	// Tenta DNS seeds se tiver poucos ou nenhum peer conhecido
@@ -69,27 +59,36 @@ func (bm *BootstrapManager) InitialConnection(connectionCallback func(ip, port s
 
 		// Espera um pouco para as consultas DNS terminarem
 		time.Sleep(500 * time.Millisecond)
-
-		// Para desenvolvimento/teste, cria seeds locais simulados
-		if os.Getenv("PTW_DEV_MODE") == "1" {
-			bm.dnsSeeder.RegisterLocalSeeds()
-		}
 	}
 
+	// Fase 0: Âncoras da execução anterior, que não dependem da tabela
+	// de endereços (possivelmente envenenada enquanto o nó estava fora)
+	connected := bm.connectToAnchors(connectionCallback)
+
 	// Fase 1: Tenta conectar a nós com boa reputação
-	connected := bm.connectToGoodPeers(connectionCallback)
+	if bm.connectToGoodPeers(connectionCallback) {
+		connected = true
+	}
 
 	// Fase 2: Se não conectou, tenta qualquer nó conhecido
 	if !connected {
 		connected = bm.connectToAnyPeers(connectionCallback)
 	}
 
-	// Fase 3: Se ainda não conectou, tenta scan local
+	// Fase 3: Busca iterativa na DHT, a partir dos peers conectados ou dos
+	// contatos salvos em dht.json; os nós encontrados já ficam conectados
+	if bm.discoverViaDHT() > 0 {
+		connected = true
+	}
+
+	// Fase 4: Nós da rede local que enviaram beacons multicast
 	if !connected {
-		go bm.scanLocalNetwork()
+		connected = bm.connectToLANPeers(connectionCallback)
+	}
 
-		// Fase 4: Último recurso - tenta seed nodes diretamente
-		connected = bm.connectToHardcodedNodes(connectionCallback)
+	// Fase 5: Último recurso - tenta os peers de bootstrap diretamente
+	if !connected {
+		connected = bm.connectToBootstrapPeers(connectionCallback)
 	}
 
 	bm.connected = connected
@@ -215,101 +214,91 @@ func (bm *BootstrapManager) connectToAnyPeers(connectionCallback func(ip, port s
 	return <-resultChan
 }
 
-// Conecta aos nós hardcoded (último recurso)
-func (bm *BootstrapManager) connectToHardcodedNodes(connectionCallback func(ip, port string) bool) bool {
-	fmt.Println("🔄 Tentando nós hardcoded como último recurso...")
-
-	// Embaralha a lista para não tentar sempre na mesma ordem
-	nodes := make([]struct{ IP, Port string }, len(HardcodedBootstrapNodes))
-	copy(nodes, HardcodedBootstrapNodes)
-	rand.Shuffle(len(nodes), func(i, j int) {
-		nodes[i], nodes[j] = nodes[j], nodes[i]
-	})
-
-	for _, node := range nodes {
-		fmt.Printf("🔌 Tentando nó hardcoded %s:%s\n", node.IP, node.Port)
-		if connectionCallback(node.IP, node.Port) {
-			fmt.Printf("✅ Conexão estabelecida com %s:%s\n", node.IP, node.Port)
-			bm.addrManager.Attempt(node.IP, node.Port, true)
-			return true
+// connectToAnchors reconecta às âncoras gravadas em anchors.json
+func (bm *BootstrapManager) connectToAnchors(connectionCallback func(ip, port string) bool) bool {
+	connected := false
+	for _, anchor := range bm.addrManager.Anchors() {
+		ip, port, err := net.SplitHostPort(anchor)
+		if err != nil {
+			continue
+		}
+		fmt.Printf("⚓ Reconectando à âncora %s\n", anchor)
+		ok := connectionCallback(ip, port)
+		bm.addrManager.Attempt(ip, port, ok)
+		if ok {
+			bm.mutex.Lock()
+			bm.connectedPeers++
+			bm.mutex.Unlock()
+			connected = true
 		}
-
-		bm.addrManager.Attempt(node.IP, node.Port, false)
 	}
-
-	return false
+	return connected
 }
 
-// Faz scan da rede local em busca de peers
-func (bm *BootstrapManager) scanLocalNetwork() {
-	fmt.Println("🔎 Escaneando rede local em busca de peers...")
-
-	myIP, _ := getLocalIP()
-	if myIP == "" {
-		return
+// discoverViaDHT registra no AddrManager os nós achados pela DHT
+func (bm *BootstrapManager) discoverViaDHT() int {
+	if bm.dhtDiscover == nil {
+		return 0
 	}
 
-	// Extrai prefixo de rede
-	parts := net.ParseIP(myIP).To4()
-	if parts == nil {
-		return
+	nodes := bm.dhtDiscover()
+	for _, node := range nodes {
+		port := fmt.Sprintf("%d", node.Port)
+		bm.addrManager.AddAddress(node.Address, port, "dht")
+		bm.addrManager.Attempt(node.Address, port, true)
 	}
+	if len(nodes) > 0 {
+		fmt.Printf("🧭 DHT encontrou %d peers próximos\n", len(nodes))
+	}
+	return len(nodes)
+}
 
-	// Escaneia os 10 IPs vizinhos em ambas direções
-	baseIP := (uint32(parts[0]) << 24) | (uint32(parts[1]) << 16) |
-		(uint32(parts[2]) << 8) | uint32(parts[3])
-
-	var wg sync.WaitGroup
-
-	// Tenta IPs na vizinhança
-	for i := uint32(1); i <= 20; i++ {
-		offset := i / 2
-		if i%2 == 0 {
-			offset = -offset
-		}
+// connectToLANPeers tenta os nós anunciados por beacon, do mais recente
+func (bm *BootstrapManager) connectToLANPeers(connectionCallback func(ip, port string) bool) bool {
+	if bm.lanDiscovery == nil {
+		return false
+	}
 
-		newIP := baseIP + offset
-		if newIP == baseIP {
-			continue // Pula o próprio IP
+	for _, addr := range bm.lanDiscovery.Peers() {
+		ip, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			continue
 		}
-
-		// Converte de volta para string
-		ipStr := fmt.Sprintf("%d.%d.%d.%d",
-			(newIP>>24)&0xFF, (newIP>>16)&0xFF, (newIP>>8)&0xFF, newIP&0xFF)
-
-		// Testa em cada porta comum
-		for _, port := range CommonPorts {
-			wg.Add(1)
-			go func(ip, port string) {
-				defer wg.Done()
-
-				conn, err := net.DialTimeout("tcp", net.JoinHostPort(ip, port), 500*time.Millisecond)
-				if err == nil {
-					conn.Close()
-					fmt.Printf("🔍 Possível peer encontrado na rede local: %s:%s\n", ip, port)
-					bm.addrManager.AddAddress(ip, port, "local")
-				}
-			}(ipStr, port)
+		fmt.Printf("🔌 Tentando peer da rede local %s\n", addr)
+		connected := connectionCallback(ip, port)
+		bm.addrManager.Attempt(ip, port, connected)
+		if connected {
+			return true
 		}
 	}
-
-	wg.Wait()
+	return false
 }
 
-// Obtém IP local
-func getLocalIP() (string, error) {
-	addrs, err := net.InterfaceAddrs()
-	if err != nil {
-		return "", err
-	}
+// Conecta aos peers de bootstrap da configuração (último recurso)
+func (bm *BootstrapManager) connectToBootstrapPeers(connectionCallback func(ip, port string) bool) bool {
+	fmt.Println("🔄 Tentando peers de bootstrap como último recurso...")
 
-	for _, address := range addrs {
-		if ipnet, ok := address.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
-			if ipnet.IP.To4() != nil {
-				return ipnet.IP.String(), nil
-			}
+	// Embaralha a lista para não tentar sempre na mesma ordem
+	peers := make([]string, len(bm.bootstrapPeers))
+	copy(peers, bm.bootstrapPeers)
+	rand.Shuffle(len(peers), func(i, j int) {
+		peers[i], peers[j] = peers[j], peers[i]
+	})
+
+	for _, peer := range peers {
+		ip, port, err := net.SplitHostPort(peer)
+		if err != nil {
+			continue
+		}
+		fmt.Printf("🔌 Tentando peer de bootstrap %s\n", peer)
+		if connectionCallback(ip, port) {
+			fmt.Printf("✅ Conexão estabelecida com %s\n", peer)
+			bm.addrManager.Attempt(ip, port, true)
+			return true
 		}
+
+		bm.addrManager.Attempt(ip, port, false)
 	}
 
-	return "", fmt.Errorf("IP não encontrado")
+	return false
 }
@@ -0,0 +1,573 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// Estado derivado da cadeia: saldos, stake travado por validador e saques
+// em unbonding. Stake, unstake e withdraw (e a delegação, delegation.go, e o
+// beacon RANDAO, randao.go) são transações comuns incluídas
+// em blocos, então qualquer nó confere o stake de um validador reaplicando
+// a cadeia a partir do genesis. O conjunto de validadores de uma época é o
+// retrato do stake no último bloco da época anterior e não muda no meio
+// dela, mesmo que o stake mude nem que um validador seja preso. Cada
+// validador registra no estado a chave de consenso (no genesis ou no
+// primeiro stake), usada para conferir evidências de dupla assinatura
+// (evidence.go). O bloco que fecha a época anuncia o próximo conjunto, com
+// as chaves, para os clientes leves (light_client.go). Com um conjunto de
+// validadores configurado só entram blocos decididos pelo consenso, exceto
+// o gênese e as redes em modo PoW explícito ("consensus": "pow").
+
+const (
+	TX_STAKE    = "stake"    // From trava Amount no validador To
+	TX_UNSTAKE  = "unstake"  // From retira Amount do validador To (entra em unbonding)
+	TX_WITHDRAW = "withdraw" // From saca Amount já liberado do unbonding (To = From)
+
+	maxBlockReward = 10 // Recompensa máxima do bloco, paga ao proponente
+
+	defaultEpochLength     = 10 // Blocos por época
+	defaultUnbondingPeriod = 20 // Blocos até o stake retirado poder ser sacado
+
+	consensusBFT = "bft" // Padrão: blocos com certificado de commit
+	consensusPoW = "pow" // Legado: blocos minerados, sem certificado
+)
+
+// StakingGenesis é a seção "staking" do genesis.json
+type StakingGenesis struct {
+	Consensus       string           `json:"consensus,omitempty"` // "bft" (padrão) ou "pow"
+	EpochLength     int              `json:"epoch_length,omitempty"`
+	UnbondingPeriod int              `json:"unbonding_period,omitempty"`
+	Balances        map[string]int   `json:"balances,omitempty"`
+	Validators      []ValidatorStake `json:"validators,omitempty"`
+}
+
+// ValidatorStake é o stake travado num validador (ID do nó)
+type ValidatorStake struct {
+	ID     string `json:"id"`
+	Owner  string `json:"owner"` // Endereço que travou o stake
+	Amount int    `json:"amount"`
+	PubKey string `json:"pub_key,omitempty"` // Chave de consenso (genesis e conjunto anunciado)
+}
+
+// UnbondingEntry é stake retirado aguardando o fim do unbonding
+type UnbondingEntry struct {
+	Owner         string `json:"owner"`
+	Validator     string `json:"validator"`
+	Amount        int    `json:"amount"`
+	ReleaseHeight int    `json:"release_height"`
+}
+
+type ChainState struct {
+	Height          int                               `json:"height"`
+	ChainID         string                            `json:"chain_id,omitempty"`
+	GenesisHash     string                            `json:"genesis_hash,omitempty"` // Chain ID de quem não configurou um
+	Consensus       string                            `json:"consensus"`
+	EpochLength     int                               `json:"epoch_length"`
+	UnbondingPeriod int                               `json:"unbonding_period"`
+	Balances        map[string]int                    `json:"balances"`
+	Stakes          map[string]*ValidatorStake        `json:"stakes"`
+	Unbonding       []UnbondingEntry                  `json:"unbonding"`
+	Keys            map[string]string                 `json:"keys"`             // Validador -> chave de consenso
+	Jailed          map[string]bool                   `json:"jailed"`           // Validadores punidos por dupla assinatura
+	Nonces          map[string]int                    `json:"nonces"`           // Último nonce de transação assinada por endereço
+	Delegations     map[string]map[string]*Delegation `json:"delegations"`      // Validador -> delegador -> delegação
+	Commission      map[string]int                    `json:"commission"`       // Comissão definida pelo validador (%)
+	Beacon          string                            `json:"beacon"`           // Semente RANDAO da época em curso (randao.go)
+	RandaoCommits   map[string]string                 `json:"randao_commits"`   // Validador -> compromisso da época
+	RandaoReveals   map[string]string                 `json:"randao_reveals"`   // Validador -> segredo revelado na época
+	RevealProposers map[string]bool                   `json:"reveal_proposers"` // Autores dos blocos da fase de revelação
+	EpochValidators []ValidatorStake                  `json:"epoch_validators"` // Conjunto em vigor na época atual
+	EpochMembers    map[int][]string                  `json:"epoch_members"`    // Época -> IDs do conjunto, enquanto cabe evidência
+	Incidents       []validatorIncident               `json:"-"`                // Punições do último bloco, para a auditoria
+}
+
+func newChainState(genesis *StakingGenesis, chainID string) *ChainState {
+	s := &ChainState{
+		ChainID:         chainID,
+		Consensus:       consensusBFT,
+		EpochLength:     defaultEpochLength,
+		UnbondingPeriod: defaultUnbondingPeriod,
+		Balances:        make(map[string]int),
+		Stakes:          make(map[string]*ValidatorStake),
+		Keys:            make(map[string]string),
+		Jailed:          make(map[string]bool),
+		Nonces:          make(map[string]int),
+		Delegations:     make(map[string]map[string]*Delegation),
+		Commission:      make(map[string]int),
+		Beacon:          genesisBeacon(),
+		RandaoCommits:   make(map[string]string),
+		RandaoReveals:   make(map[string]string),
+		RevealProposers: make(map[string]bool),
+		EpochMembers:    make(map[int][]string),
+	}
+	if genesis != nil {
+		if genesis.Consensus != "" {
+			s.Consensus = genesis.Consensus
+		}
+		if genesis.EpochLength > 0 {
+			s.EpochLength = genesis.EpochLength
+		}
+		if genesis.UnbondingPeriod > 0 {
+			s.UnbondingPeriod = genesis.UnbondingPeriod
+		}
+		for address, amount := range genesis.Balances {
+			s.Balances[address] = amount
+		}
+		for _, v := range genesis.Validators {
+			if v.PubKey != "" {
+				s.Keys[v.ID] = v.PubKey
+			}
+			v.PubKey = ""
+			if stake, exists := s.Stakes[v.ID]; exists {
+				stake.Amount += v.Amount
+				continue
+			}
+			stake := v
+			s.Stakes[v.ID] = &stake
+		}
+	}
+	s.snapshotValidators()
+	return s
+}
+
+func (s *ChainState) clone() *ChainState {
+	c := *s
+	c.Balances = make(map[string]int, len(s.Balances))
+	for address, amount := range s.Balances {
+		c.Balances[address] = amount
+	}
+	c.Stakes = make(map[string]*ValidatorStake, len(s.Stakes))
+	for id, stake := range s.Stakes {
+		copied := *stake
+		c.Stakes[id] = &copied
+	}
+	c.Unbonding = append([]UnbondingEntry(nil), s.Unbonding...)
+	c.Keys = make(map[string]string, len(s.Keys))
+	for id, key := range s.Keys {
+		c.Keys[id] = key
+	}
+	c.Jailed = make(map[string]bool, len(s.Jailed))
+	for id := range s.Jailed {
+		c.Jailed[id] = true
+	}
+	c.Nonces = make(map[string]int, len(s.Nonces))
+	for address, nonce := range s.Nonces {
+		c.Nonces[address] = nonce
+	}
+	c.Delegations = make(map[string]map[string]*Delegation, len(s.Delegations))
+	for validator, delegations := range s.Delegations {
+		c.Delegations[validator] = make(map[string]*Delegation, len(delegations))
+		for delegator, d := range delegations {
+			copied := *d
+			c.Delegations[validator][delegator] = &copied
+		}
+	}
+	c.Commission = make(map[string]int, len(s.Commission))
+	for validator, commission := range s.Commission {
+		c.Commission[validator] = commission
+	}
+	c.RandaoCommits = make(map[string]string, len(s.RandaoCommits))
+	for id, commitment := range s.RandaoCommits {
+		c.RandaoCommits[id] = commitment
+	}
+	c.RandaoReveals = make(map[string]string, len(s.RandaoReveals))
+	for id, secret := range s.RandaoReveals {
+		c.RandaoReveals[id] = secret
+	}
+	c.RevealProposers = make(map[string]bool, len(s.RevealProposers))
+	for id := range s.RevealProposers {
+		c.RevealProposers[id] = true
+	}
+	c.EpochValidators = append([]ValidatorStake(nil), s.EpochValidators...)
+	c.EpochMembers = make(map[int][]string, len(s.EpochMembers))
+	for epoch, members := range s.EpochMembers {
+		c.EpochMembers[epoch] = members
+	}
+	c.Incidents = append([]validatorIncident(nil), s.Incidents...)
+	return &c
+}
+
+// isEpochBoundary: o bloco fecha uma época
+func (s *ChainState) isEpochBoundary(height int) bool {
+	return height%s.EpochLength == 0
+}
+
+// chainIDAt é o chain ID com que as mensagens de consenso da altura foram
+// assinadas (ver localChainID)
+func (s *ChainState) chainIDAt(height int) string {
+	if s.ChainID != "" || height <= 1 {
+		return s.ChainID
+	}
+	return s.GenesisHash
+}
+
+// snapshotValidators fixa o conjunto da próxima época: validadores com o
+// stake mínimo (próprio mais delegado) e fora da prisão, em ordem de ID. No
+// conjunto o Amount é o poder, com o delegado. Os IDs ficam em EpochMembers
+// até nenhuma altura da época caber mais no prazo de evidência.
+func (s *ChainState) snapshotValidators() {
+	var next []ValidatorStake
+	for _, stake := range s.Stakes {
+		power := stake.Amount + s.delegatedTo(stake.ID)
+		if power >= minValidatorStake && !s.Jailed[stake.ID] {
+			validator := *stake
+			validator.Amount = power
+			validator.PubKey = s.Keys[stake.ID]
+			next = append(next, validator)
+		}
+	}
+	sort.Slice(next, func(i, j int) bool { return next[i].ID < next[j].ID })
+	s.EpochValidators = next
+
+	members := make([]string, len(next))
+	for i, v := range next {
+		members[i] = v.ID
+	}
+	s.EpochMembers[s.epochOf(s.Height+1)] = members
+	for epoch := range s.EpochMembers {
+		if (epoch+1)*s.EpochLength+s.UnbondingPeriod < s.Height {
+			delete(s.EpochMembers, epoch)
+		}
+	}
+}
+
+// applyBlock aplica as transações do bloco; a recompensa é no máximo uma
+// por bloco e vai para o validador que o propôs. Em caso de erro o estado fica
+// inconsistente: aplique sobre um clone.
+func (s *ChainState) applyBlock(block *Token) error {
+	if block.Index != s.Height+1 {
+		return fmt.Errorf("bloco %d aplicado sobre o estado da altura %d", block.Index, s.Height)
+	}
+	s.Incidents = nil
+	rewarded := false
+	for i := range block.Transactions {
+		tx := &block.Transactions[i]
+		if tx.Type == "mining_reward" {
+			if rewarded || tx.To != block.Validator {
+				return fmt.Errorf("transação %s: recompensa extra ou fora do proponente %s", tx.ID, block.Validator)
+			}
+			rewarded = true
+		}
+		if err := s.applyTx(tx, block.Index); err != nil {
+			return fmt.Errorf("transação %s: %v", tx.ID, err)
+		}
+	}
+	s.advance(block)
+	return s.checkAnnouncement(block)
+}
+
+// requireCommit vale sobre o estado anterior ao bloco: com um conjunto de
+// validadores em vigor o bloco precisa do certificado de commit. Ficam de
+// fora o gênese (bloco 1 com o hash do chain ID configurado) e o modo PoW.
+func (s *ChainState) requireCommit(block *Token) error {
+	if block.Commit != nil || len(s.EpochValidators) == 0 || s.Consensus == consensusPoW {
+		return nil
+	}
+	if block.Index == 1 && s.ChainID != "" && block.Hash == s.ChainID {
+		return nil
+	}
+	return fmt.Errorf("bloco %d sem certificado de commit", block.Index)
+}
+
+// checkHeaderHash: o hash de um bloco do consenso é o do cabeçalho, então o
+// certificado de commit cobre o conteúdo inteiro
+func checkHeaderHash(block *Token) error {
+	if block.Hash != headerHash(block) {
+		return fmt.Errorf("hash do bloco %d não é o do cabeçalho", block.Index)
+	}
+	return nil
+}
+
+// checkAnnouncement confere o conjunto anunciado no bloco: só o bloco que
+// fecha a época o traz, e ele precisa ser o que o estado calculou
+func (s *ChainState) checkAnnouncement(block *Token) error {
+	if !s.isEpochBoundary(block.Index) {
+		if len(block.NextValidators) > 0 {
+			return fmt.Errorf("conjunto anunciado no bloco %d, fora do fim da época", block.Index)
+		}
+		return nil
+	}
+	if block.NextValidators != nil && !sameValidators(block.NextValidators, s.EpochValidators) {
+		return fmt.Errorf("conjunto anunciado no bloco %d difere do calculado", block.Index)
+	}
+	return nil
+}
+
+// requireAnnouncement vale sobre o estado já com o bloco aplicado, fora do
+// modo PoW: com validadores, o bloco que fecha a época traz o próximo
+// conjunto e tem como hash o do cabeçalho, então o certificado de commit
+// cobre o anúncio
+func (s *ChainState) requireAnnouncement(block *Token) error {
+	if !s.isEpochBoundary(block.Index) || s.Consensus == consensusPoW {
+		return nil
+	}
+	if len(block.NextValidators) == 0 && len(s.EpochValidators) > 0 {
+		return fmt.Errorf("bloco %d fecha a época sem anunciar o próximo conjunto", block.Index)
+	}
+	if len(block.NextValidators) > 0 {
+		return checkHeaderHash(block)
+	}
+	return nil
+}
+
+func sameValidators(a, b []ValidatorStake) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// advance fecha a altura (e a época, na fronteira: o beacon pune quem não
+// revelou antes do retrato do próximo conjunto)
+func (s *ChainState) advance(block *Token) {
+	height := block.Index
+	if height == 1 {
+		s.GenesisHash = block.Hash
+	}
+	s.Height = height
+	if block.Validator != "" && !s.isCommitPhase(height) {
+		s.RevealProposers[block.Validator] = true
+	}
+	if s.isEpochBoundary(height) {
+		s.closeBeacon()
+		s.snapshotValidators()
+	}
+}
+
+// applyTx confere a transação contra o estado e a aplica; só altera o
+// estado se ela for válida. Stake, unstake e withdraw precisam da
+// assinatura do dono e de um nonce acima do último dele.
+func (s *ChainState) applyTx(tx *Transaction, height int) error {
+	if requiresOwnerSignature(tx.Type) {
+		if err := verifyOwnerSignature(tx); err != nil {
+			return err
+		}
+		if tx.Nonce <= s.Nonces[tx.From] {
+			return fmt.Errorf("nonce %d de %s já usado (último %d)", tx.Nonce, tx.From, s.Nonces[tx.From])
+		}
+	}
+
+	switch tx.Type {
+	case "mining_reward":
+		if tx.From != "SYSTEM" || tx.Amount <= 0 || tx.Amount > maxBlockReward {
+			return fmt.Errorf("recompensa inválida: %d de %s", tx.Amount, tx.From)
+		}
+		s.distributeReward(tx.To, tx.Amount)
+
+	case "transfer":
+		if tx.Amount <= 0 || s.Balances[tx.From] < tx.Amount {
+			return fmt.Errorf("transferência de %d com saldo %d", tx.Amount, s.Balances[tx.From])
+		}
+		s.Balances[tx.From] -= tx.Amount
+		s.Balances[tx.To] += tx.Amount
+
+	case TX_STAKE:
+		if tx.Amount <= 0 || tx.To == "" {
+			return fmt.Errorf("stake inválido")
+		}
+		if s.Balances[tx.From] < tx.Amount {
+			return fmt.Errorf("saldo insuficiente para stake: %d < %d", s.Balances[tx.From], tx.Amount)
+		}
+		if s.Jailed[tx.To] {
+			return fmt.Errorf("validador %s está preso", tx.To)
+		}
+		stake, exists := s.Stakes[tx.To]
+		if exists && stake.Owner != tx.From {
+			return fmt.Errorf("validador %s pertence a %s", tx.To, stake.Owner)
+		}
+		if s.Keys[tx.To] == "" {
+			// Validador novo registra a chave de consenso
+			if _, err := parsePublicKey(tx.ValidatorKey); err != nil {
+				return fmt.Errorf("stake em validador sem chave registrada: %v", err)
+			}
+			s.Keys[tx.To] = tx.ValidatorKey
+		}
+		if !exists {
+			stake = &ValidatorStake{ID: tx.To, Owner: tx.From}
+			s.Stakes[tx.To] = stake
+		}
+		s.Balances[tx.From] -= tx.Amount
+		stake.Amount += tx.Amount
+
+	case TX_UNSTAKE:
+		stake, exists := s.Stakes[tx.To]
+		if !exists || stake.Owner != tx.From {
+			return fmt.Errorf("%s não tem stake no validador %s", tx.From, tx.To)
+		}
+		if tx.Amount <= 0 || tx.Amount > stake.Amount {
+			return fmt.Errorf("unstake de %d com %d travados", tx.Amount, stake.Amount)
+		}
+		stake.Amount -= tx.Amount
+		if stake.Amount == 0 {
+			delete(s.Stakes, tx.To)
+		}
+		s.Unbonding = append(s.Unbonding, UnbondingEntry{
+			Owner:         tx.From,
+			Validator:     tx.To,
+			Amount:        tx.Amount,
+			ReleaseHeight: height + s.UnbondingPeriod,
+		})
+
+	case TX_WITHDRAW:
+		available := s.Withdrawable(tx.From, height)
+		if tx.Amount <= 0 || tx.Amount > available {
+			return fmt.Errorf("saque de %d com %d liberados", tx.Amount, available)
+		}
+		remaining := tx.Amount
+		kept := s.Unbonding[:0]
+		for _, entry := range s.Unbonding {
+			if remaining > 0 && entry.Owner == tx.From && entry.ReleaseHeight <= height {
+				taken := min(entry.Amount, remaining)
+				entry.Amount -= taken
+				remaining -= taken
+			}
+			if entry.Amount > 0 {
+				kept = append(kept, entry)
+			}
+		}
+		s.Unbonding = kept
+		s.Balances[tx.From] += tx.Amount
+
+	case TX_DELEGATE:
+		if err := s.applyDelegate(tx); err != nil {
+			return err
+		}
+
+	case TX_UNDELEGATE:
+		if err := s.applyUndelegate(tx, height); err != nil {
+			return err
+		}
+
+	case TX_COMMISSION:
+		if err := s.applyCommission(tx); err != nil {
+			return err
+		}
+
+	case TX_RANDAO_COMMIT, TX_RANDAO_REVEAL:
+		return s.applyRandao(tx, height)
+
+	case TX_EVIDENCE:
+		return s.applyEvidence(tx.Evidence, height)
+	}
+	if requiresOwnerSignature(tx.Type) {
+		s.Nonces[tx.From] = tx.Nonce
+	}
+	return nil
+}
+
+// slash retira percent% do stake do validador, inclusive do que está em
+// unbonding a partir dele, e retorna o total retirado
+func (s *ChainState) slash(validator string, percent int) int {
+	cut := func(amount int) int {
+		slashed := amount * percent / 100
+		if slashed == 0 && amount > 0 {
+			slashed = 1
+		}
+		return slashed
+	}
+	total := 0
+	if stake, exists := s.Stakes[validator]; exists {
+		slashed := cut(stake.Amount)
+		stake.Amount -= slashed
+		total += slashed
+	}
+	for i := range s.Unbonding {
+		if s.Unbonding[i].Validator == validator {
+			slashed := cut(s.Unbonding[i].Amount)
+			s.Unbonding[i].Amount -= slashed
+			total += slashed
+		}
+	}
+	return total + s.slashDelegations(validator, cut)
+}
+
+// jail prende o validador; ele sai do conjunto no fim da época
+func (s *ChainState) jail(validator string) {
+	s.Jailed[validator] = true
+}
+
+// Withdrawable soma o stake do dono cujo unbonding termina até height
+func (s *ChainState) Withdrawable(owner string, height int) int {
+	total := 0
+	for _, entry := range s.Unbonding {
+		if entry.Owner == owner && entry.ReleaseHeight <= height {
+			total += entry.Amount
+		}
+	}
+	return total
+}
+
+// isStakingTx: transações conferidas contra o estado antes de entrar no mempool
+func isStakingTx(txType string) bool {
+	return requiresOwnerSignature(txType) || isRandaoTx(txType) || txType == TX_EVIDENCE
+}
+
+// === Integração com o nó ===
+
+// loadStakingGenesis lê a seção "staking" do genesis.json
+func loadStakingGenesis(dataDir string) (*StakingGenesis, error) {
+	var genesis GenesisConfig
+	if err := readJSONFile(filepath.Join(dataDir, "genesis.json"), &genesis); err != nil {
+		return nil, err
+	}
+	return genesis.Staking, nil
+}
+
+// chainStateLocked devolve uma cópia do estado no topo da cadeia, aplicando
+// os blocos ainda não processados. Requer node.mutex (leitura basta).
+func (node *P2PNode) chainStateLocked() *ChainState {
+	node.stateMtx.Lock()
+	defer node.stateMtx.Unlock()
+
+	if node.state == nil || node.state.Height > len(node.Blockchain) {
+		node.state = newChainState(node.stakingGenesis, node.ChainID)
+	}
+	for node.state.Height < len(node.Blockchain) {
+		block := &node.Blockchain[node.state.Height]
+		next := node.state.clone()
+		if err := next.applyBlock(block); err != nil {
+			// Bloco que não passou pelo addBlock: a altura avança sem as transações
+			fmt.Printf("⚠️ [%s] Estado ignora o bloco %d: %v\n", node.ID, block.Index, err)
+			next = node.state.clone()
+			next.advance(&Token{Index: node.state.Height + 1, Hash: block.Hash})
+		}
+		node.state = next
+	}
+	return node.state.clone()
+}
+
+// ChainState retorna o estado no topo da cadeia
+func (node *P2PNode) ChainState() *ChainState {
+	node.mutex.RLock()
+	defer node.mutex.RUnlock()
+	return node.chainStateLocked()
+}
+
+// sealBlock completa o bloco do consenso: todos passam a ter como hash o do
+// cabeçalho, e o que fecha a época anuncia o próximo conjunto (exceto se
+// tiver transações inválidas)
+func (node *P2PNode) sealBlock(block *Token) {
+	block.Hash = headerHash(block)
+	state := node.ChainState()
+	if block.Index != state.Height+1 || !state.isEpochBoundary(block.Index) {
+		return
+	}
+	if err := state.applyBlock(block); err != nil {
+		return
+	}
+	block.NextValidators = append([]ValidatorStake(nil), state.EpochValidators...)
+	block.Hash = headerHash(block)
+}
+
+// checkStakingTx confere uma transação de stake contra o estado atual
+func (node *P2PNode) checkStakingTx(tx *Transaction) error {
+	state := node.ChainState()
+	return state.applyTx(tx, state.Height+1)
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Carteiras de teste: uma chave RSA por nome, com o endereço derivado dela
+var (
+	testWalletMtx sync.Mutex
+	testWallets   = make(map[string]*rsa.PrivateKey)
+	testNonce     int
+)
+
+func walletKey(name string) *rsa.PrivateKey {
+	testWalletMtx.Lock()
+	defer testWalletMtx.Unlock()
+	key, exists := testWallets[name]
+	if !exists {
+		var err error
+		if key, err = rsa.GenerateKey(rand.Reader, 1024); err != nil {
+			panic(err)
+		}
+		testWallets[name] = key
+	}
+	return key
+}
+
+// addr é o endereço da carteira de teste do nome
+func addr(name string) string {
+	address, _ := addressOf(encodePublicKey(&walletKey(name).PublicKey))
+	return address
+}
+
+// signWith assina a transação com a carteira do nome e um nonce novo
+func signWith(name string, tx *Transaction) {
+	testWalletMtx.Lock()
+	testNonce++
+	tx.Nonce = testNonce
+	testWalletMtx.Unlock()
+	if err := signTx(walletKey(name), tx); err != nil {
+		panic(err)
+	}
+}
+
+// stakingTx monta a transação da carteira from, já assinada
+func stakingTx(id, txType, from, to string, amount int) Transaction {
+	tx := Transaction{ID: id, Type: txType, From: addr(from), To: to, Amount: amount, Timestamp: time.Now()}
+	signWith(from, &tx)
+	return tx
+}
+
+func testValidatorKey(t *testing.T) string {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encodePublicKey(&key.PublicKey)
+}
+
+func TestChainStateStakeUnbondingAndWithdraw(t *testing.T) {
+	state := newChainState(&StakingGenesis{UnbondingPeriod: 5, Balances: map[string]int{addr("alice"): 100}}, "")
+
+	stake := stakingTx("s1", TX_STAKE, "alice", "node-A", 60)
+	if err := state.applyTx(&stake, 1); err == nil {
+		t.Fatal("validador novo aceito sem chave de consenso")
+	}
+	stake.ValidatorKey = testValidatorKey(t)
+	signWith("alice", &stake)
+	if err := state.applyTx(&stake, 1); err != nil {
+		t.Fatal(err)
+	}
+	if state.Balances[addr("alice")] != 40 || state.Stakes["node-A"].Amount != 60 {
+		t.Fatalf("saldo %d, stake %d", state.Balances[addr("alice")], state.Stakes["node-A"].Amount)
+	}
+
+	// Saldo travado não pode ser travado de novo, nem o validador de outro dono
+	over := stakingTx("s2", TX_STAKE, "alice", "node-A", 50)
+	if err := state.applyTx(&over, 1); err == nil {
+		t.Fatal("stake acima do saldo aceito")
+	}
+	state.Balances[addr("bob")] = 10
+	foreign := stakingTx("s3", TX_STAKE, "bob", "node-A", 10)
+	if err := state.applyTx(&foreign, 1); err == nil {
+		t.Fatal("stake em validador de outro dono aceito")
+	}
+
+	unstake := stakingTx("u1", TX_UNSTAKE, "alice", "node-A", 60)
+	if err := state.applyTx(&unstake, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := state.Stakes["node-A"]; exists {
+		t.Fatal("validador sem stake continua registrado")
+	}
+
+	// O saque só vale depois do período de unbonding
+	withdraw := stakingTx("w1", TX_WITHDRAW, "alice", addr("alice"), 60)
+	if err := state.applyTx(&withdraw, 6); err == nil {
+		t.Fatal("saque aceito durante o unbonding")
+	}
+	partial := stakingTx("w2", TX_WITHDRAW, "alice", addr("alice"), 20)
+	if err := state.applyTx(&partial, 7); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.applyTx(&withdraw, 7); err == nil {
+		t.Fatal("saque acima do liberado aceito")
+	}
+	rest := stakingTx("w3", TX_WITHDRAW, "alice", addr("alice"), 40)
+	if err := state.applyTx(&rest, 8); err != nil {
+		t.Fatal(err)
+	}
+	if state.Balances[addr("alice")] != 100 || len(state.Unbonding) != 0 {
+		t.Fatalf("saldo %d, unbonding %v", state.Balances[addr("alice")], state.Unbonding)
+	}
+}
+
+func TestStakingTxNeedsOwnerSignature(t *testing.T) {
+	state := newChainState(&StakingGenesis{Validators: []ValidatorStake{{ID: "node-A", Owner: addr("alice"), Amount: 100}}}, "")
+
+	// Outra carteira assinando em nome do dono
+	forged := stakingTx("u1", TX_UNSTAKE, "mallory", "node-A", 100)
+	forged.From = addr("alice")
+	if err := state.applyTx(&forged, 1); err == nil {
+		t.Fatal("unstake assinado por outra carteira aceito")
+	}
+	// Conteúdo alterado depois da assinatura
+	tampered := stakingTx("u2", TX_UNSTAKE, "alice", "node-A", 10)
+	tampered.Amount = 100
+	if err := state.applyTx(&tampered, 1); err == nil {
+		t.Fatal("unstake alterado após a assinatura aceito")
+	}
+
+	unstake := stakingTx("u3", TX_UNSTAKE, "alice", "node-A", 10)
+	if err := state.applyTx(&unstake, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.applyTx(&unstake, 2); err == nil {
+		t.Fatal("unstake reaplicado com o mesmo nonce")
+	}
+	if !NewTransactionValidator().VerifySignature(&unstake) || NewTransactionValidator().VerifySignature(&forged) {
+		t.Fatal("VerifySignature não confere a assinatura do dono")
+	}
+}
+
+func TestTransferAndRewardRules(t *testing.T) {
+	state := newChainState(&StakingGenesis{Balances: map[string]int{addr("alice"): 10}}, "")
+
+	over := stakingTx("t1", "transfer", "alice", addr("bob"), 11)
+	if err := state.applyTx(&over, 1); err == nil {
+		t.Fatal("transferência acima do saldo aceita")
+	}
+	unsigned := Transaction{ID: "t2", Type: "transfer", From: addr("alice"), To: addr("mallory"), Amount: 10, Nonce: 1 << 30}
+	forged := stakingTx("t3", "transfer", "mallory", addr("mallory"), 10)
+	forged.From = addr("alice")
+	for name, tx := range map[string]Transaction{"sem assinatura": unsigned, "assinada por outro": forged} {
+		if err := state.clone().applyTx(&tx, 1); err == nil {
+			t.Fatalf("transferência %s aceita", name)
+		}
+	}
+	transfer := stakingTx("t4", "transfer", "alice", addr("bob"), 10)
+	if err := state.applyTx(&transfer, 1); err != nil {
+		t.Fatal(err)
+	}
+	state.Balances[addr("alice")] = 10
+	if err := state.applyTx(&transfer, 2); err == nil {
+		t.Fatal("transferência reaplicada com o mesmo nonce")
+	}
+
+	reward := func(id, to string, amount int) Transaction {
+		return Transaction{ID: id, Type: "mining_reward", From: "SYSTEM", To: to, Amount: amount}
+	}
+	cases := map[string][]Transaction{
+		"acima do limite":      {reward("r1", "node-A", maxBlockReward+1)},
+		"para outro validador": {reward("r1", "node-B", 5)},
+		"duas no mesmo bloco":  {reward("r1", "node-A", 5), reward("r2", "node-A", 5)},
+		"de fora do SYSTEM":    {{ID: "r1", Type: "mining_reward", From: "alice", To: "node-A", Amount: 5}},
+	}
+	for name, txs := range cases {
+		block := Token{Index: 1, Validator: "node-A", Transactions: txs}
+		if err := state.clone().applyBlock(&block); err == nil {
+			t.Errorf("recompensa %s aceita", name)
+		}
+	}
+	block := Token{Index: 1, Validator: "node-A", Transactions: []Transaction{reward("r1", "node-A", maxBlockReward)}}
+	if err := state.applyBlock(&block); err != nil || state.Balances["node-A"] != maxBlockReward {
+		t.Fatalf("recompensa do proponente: %v, saldo %d", err, state.Balances["node-A"])
+	}
+}
+
+// commitBlock sela o bloco e o certifica com o precommit do próprio nó,
+// que precisa ter +2/3 do poder da época; sem autor o bloco é do nó
+func commitBlock(t *testing.T, node *P2PNode, block *Token) {
+	t.Helper()
+	if block.Validator == "" {
+		block.Validator = node.ID
+	}
+	node.sealBlock(block)
+	vote := ConsensusVote{Height: block.Index, Type: votePrecommit, BlockHash: block.Hash, Voter: node.ID}
+	signature, err := signConsensus(node.identity.key, voteSignBytes(node.localChainID(), &vote))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vote.Signature = signature
+	block.Commit = &CommitCertificate{Height: block.Index, BlockHash: block.Hash, Precommits: []ConsensusVote{vote}}
+}
+
+func TestValidatorSetChangesAtEpochBoundary(t *testing.T) {
+	node := newTestNode(t, "node-A")
+	node.stakingGenesis = &StakingGenesis{
+		EpochLength: 3,
+		Balances:    map[string]int{addr("carol"): 50},
+		Validators:  []ValidatorStake{{ID: "node-A", Owner: addr("alice"), Amount: 100, PubKey: encodePublicKey(&node.identity.key.PublicKey)}},
+	}
+
+	addBlock := func(txs ...Transaction) bool {
+		block := testBlock(chainHeight(node)+1, node.getLastBlockHash())
+		block.Transactions = txs
+		commitBlock(t, node, &block)
+		return node.validateAndAddBlock(&block)
+	}
+	powers := func() string {
+		set, _ := node.currentValidatorSet(chainHeight(node) + 1)
+		out := ""
+		for _, v := range set.validators {
+			out += fmt.Sprintf("%s:%d ", v.ID, v.Power)
+		}
+		return out
+	}
+
+	if addBlock(stakingTx("bad", TX_STAKE, "carol", "node-C", 80)) {
+		t.Fatal("bloco com stake acima do saldo aceito")
+	}
+	stake := stakingTx("s1", TX_STAKE, "carol", "node-C", 50)
+	stake.ValidatorKey = testValidatorKey(t)
+	signWith("carol", &stake)
+	if !addBlock(stake) {
+		t.Fatal("bloco com stake válido rejeitado")
+	}
+	if got := powers(); got != "node-A:100 " {
+		t.Fatalf("conjunto mudou no meio da época: %s", got)
+	}
+	addBlock()
+	if got := powers(); got != "node-A:100 " {
+		t.Fatalf("conjunto mudou no meio da época: %s", got)
+	}
+
+	// O bloco 3 fecha a época: o stake de node-C vale a partir da altura 4
+	addBlock()
+	if got := powers(); got != "node-A:100 node-C:50 " {
+		t.Fatalf("conjunto da época 2: %s", got)
+	}
+
+	// Nó que reconstrói o estado do zero chega ao mesmo conjunto
+	node.stateMtx.Lock()
+	node.state = nil
+	node.stateMtx.Unlock()
+	if got := powers(); got != "node-A:100 node-C:50 " {
+		t.Fatalf("estado reconstruído: %s", got)
+	}
+}
+
+func TestConsensusUsesStateKeysAndNeverRestartsHeight(t *testing.T) {
+	node := newTestNode(t, "node-A")
+	node.IsValidator = true
+	node.stakingGenesis = &StakingGenesis{Validators: []ValidatorStake{
+		{ID: "node-A", Owner: addr("alice"), Amount: 100, PubKey: encodePublicKey(&node.identity.key.PublicKey)},
+		{ID: "node-B", Owner: addr("bob"), Amount: 100},
+	}}
+
+	// A chave de B não está no estado: sem +2/3 do poder com chave a altura
+	// nem começa, mesmo com a chave do próprio nó à mão
+	node.consensusMutex.Lock()
+	actions := node.enterHeightLocked(1)
+	active := node.bft.active
+	node.consensusMutex.Unlock()
+	if len(actions) != 0 || active {
+		t.Fatal("altura iniciada sem as chaves registradas de +2/3 do poder")
+	}
+
+	node.stakingGenesis.Validators = node.stakingGenesis.Validators[:1]
+	node.stateMtx.Lock()
+	node.state = nil
+	node.stateMtx.Unlock()
+	node.consensusMutex.Lock()
+	defer node.consensusMutex.Unlock()
+	if actions := node.enterHeightLocked(1); len(actions) == 0 {
+		t.Fatal("altura não iniciada com o conjunto completo")
+	}
+
+	// Decidida mas não gravada, a altura não recomeça e a trava fica
+	node.bft.locked, node.bft.lockedRound = node.bft.candidate, 0
+	node.bft.round = 2
+	node.bft.stop()
+	if actions := node.enterHeightLocked(1); len(actions) != 0 || node.bft.lockedRound != 0 || node.bft.round != 2 {
+		t.Fatalf("altura 1 reiniciada: trava na rodada %d, rodada %d", node.bft.lockedRound, node.bft.round)
+	}
+}
+
+func TestValidatorChainRequiresCommittedBlocks(t *testing.T) {
+	node := newTestNode(t, "node-A")
+	node.stakingGenesis = &StakingGenesis{
+		Validators: []ValidatorStake{{ID: "node-A", Owner: addr("alice"), Amount: 100, PubKey: encodePublicKey(&node.identity.key.PublicKey)}},
+	}
+
+	mined := testBlock(1, "")
+	if node.validateAndAddBlock(&mined) {
+		t.Fatal("bloco sem certificado aceito com validadores configurados")
+	}
+
+	// O certificado assina o hash; trocar o conteúdo depois invalida o bloco
+	block := testBlock(1, "")
+	commitBlock(t, node, &block)
+	forged := block
+	forged.Timestamp = "2000-01-01T00:00:00Z"
+	if node.validateAndAddBlock(&forged) {
+		t.Fatal("bloco com conteúdo diferente do hash certificado aceito")
+	}
+
+	// O autor do bloco recebe a recompensa: precisa ser o proponente sorteado
+	stolen := testBlock(1, "")
+	stolen.Validator = "node-X"
+	commitBlock(t, node, &stolen)
+	if node.validateAndAddBlock(&stolen) {
+		t.Fatal("bloco certificado de quem não foi proponente aceito")
+	}
+	if !node.validateAndAddBlock(&block) {
+		t.Fatal("bloco certificado rejeitado")
+	}
+
+	// Em modo PoW explícito os blocos minerados continuam valendo
+	node.stakingGenesis.Consensus = consensusPoW
+	node.stateMtx.Lock()
+	node.state = nil
+	node.stateMtx.Unlock()
+	mined = testBlock(2, block.Hash)
+	if !node.validateAndAddBlock(&mined) {
+		t.Fatal("bloco minerado rejeitado no modo PoW")
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import "time"
+
+// Clock é a fonte de tempo das rotinas do nó: o relógio real em produção
+// ou o relógio virtual do simulador, que só anda quando o cenário manda
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker é o equivalente de time.Ticker para um Clock
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) NewTicker(d time.Duration) Ticker       { return realTicker{time.NewTicker(d)} }
+
+type realTicker struct{ ticker *time.Ticker }
+
+func (t realTicker) C() <-chan time.Time { return t.ticker.C }
+func (t realTicker) Stop()               { t.ticker.Stop() }
+
+// sleep bloqueia pela duração d no relógio do nó
+func sleep(clock Clock, d time.Duration) {
+	<-clock.After(d)
+}
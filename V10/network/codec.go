@@ -0,0 +1,522 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Codificação das mensagens. O primeiro byte do payload identifica o
+// formato: wireMagic para o binário e '{' para o JSON (modo de depuração).
+// Quem recebe aceita os dois; quem envia usa o formato configurado no nó.
+const (
+	wireMagic   byte = 0xB7
+	wireVersion byte = 1 // Versão do envelope binário
+
+	maxWireFields           = 1 << 20 // Campos por mensagem (limita a memória da decodificação)
+	penaltyMalformedMessage = 20
+)
+
+// Campos do envelope binário. A assinatura é sempre o último campo e cobre
+// todos os bytes anteriores, inclusive campos que o destinatário não conhece.
+const (
+	envelopeType      = 1
+	envelopeFrom      = 2
+	envelopeTo        = 3
+	envelopeTimestamp = 4
+	envelopeData      = 5
+	envelopeSignature = 15
+)
+
+// Formatos de envio
+type wireFormat int
+
+const (
+	wireBinary wireFormat = iota
+	wireJSON
+)
+
+const wireFormatEnv = "PTW_WIRE_FORMAT" // "json" liga o modo de depuração
+
+func parseWireFormat(name string) (wireFormat, error) {
+	switch strings.ToLower(name) {
+	case "", "binary":
+		return wireBinary, nil
+	case "json":
+		return wireJSON, nil
+	}
+	return wireBinary, fmt.Errorf("formato de mensagem desconhecido: %q", name)
+}
+
+func (f wireFormat) String() string {
+	if f == wireJSON {
+		return "json"
+	}
+	return "binary"
+}
+
+// wirePayload é o corpo tipado de uma mensagem (esquemas em wire_schema.go)
+type wirePayload interface {
+	encodeWire(e *wireEncoder)
+	decodeWire(d *wireDecoder)
+}
+
+// malformedMessageError indica um frame que não pôde ser decodificado; o
+// frame já foi consumido e a conexão segue utilizável
+type malformedMessageError struct {
+	msgType string
+	reason  string
+}
+
+func (e *malformedMessageError) Error() string {
+	if e.msgType == "" {
+		return fmt.Sprintf("mensagem malformada: %s", e.reason)
+	}
+	return fmt.Sprintf("mensagem %s malformada: %s", e.msgType, e.reason)
+}
+
+// === Codificador ===
+
+// Tipos de campo: inteiro (varint) ou bytes com tamanho
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+// wireEncoder escreve campos numerados. Valores zero são omitidos (quem
+// decodifica assume zero), exceto em listas e mensagens aninhadas.
+type wireEncoder struct {
+	buf    []byte
+	fields int // Total de campos, inclusive aninhados
+	err    error
+}
+
+func (e *wireEncoder) tag(field, kind int) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(field)<<3|uint64(kind))
+	e.fields++
+}
+
+func (e *wireEncoder) uint(field int, v uint64) {
+	if v != 0 {
+		e.tag(field, wireVarint)
+		e.buf = binary.AppendUvarint(e.buf, v)
+	}
+}
+
+func (e *wireEncoder) int(field int, v int64) {
+	if v != 0 {
+		e.tag(field, wireVarint)
+		e.buf = binary.AppendVarint(e.buf, v)
+	}
+}
+
+func (e *wireEncoder) bool(field int, v bool) {
+	if v {
+		e.uint(field, 1)
+	}
+}
+
+func (e *wireEncoder) string(field int, s string) {
+	if s != "" {
+		e.bytes(field, []byte(s))
+	}
+}
+
+// bytes escreve o campo mesmo vazio
+func (e *wireEncoder) bytes(field int, b []byte) {
+	e.tag(field, wireBytes)
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *wireEncoder) strings(field int, list []string) {
+	for _, s := range list {
+		e.bytes(field, []byte(s))
+	}
+}
+
+func (e *wireEncoder) ints(field int, list []int) {
+	for _, v := range list {
+		e.tag(field, wireVarint)
+		e.buf = binary.AppendVarint(e.buf, int64(v))
+	}
+}
+
+// time guarda segundos, nanossegundos e o deslocamento do fuso, que
+// aparece no JSON usado em hashes (computeTxRoot). Só o deslocamento conta:
+// UTC e um fuso local +00:00 produzem os mesmos bytes, como no JSON.
+func (e *wireEncoder) time(field int, t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	_, offset := t.Zone()
+	sub := &wireEncoder{}
+	sub.int(1, t.Unix())
+	sub.int(2, int64(t.Nanosecond()))
+	sub.int(3, int64(offset))
+	e.bytes(field, sub.buf)
+	e.fields += sub.fields
+}
+
+func (e *wireEncoder) message(field int, p wirePayload) {
+	sub := encodePayload(p)
+	if sub.err != nil {
+		e.fail(sub.err)
+	}
+	e.bytes(field, sub.buf)
+	e.fields += sub.fields
+}
+
+func (e *wireEncoder) fail(err error) {
+	if e.err == nil {
+		e.err = err
+	}
+}
+
+func encodePayload(p wirePayload) *wireEncoder {
+	e := &wireEncoder{}
+	p.encodeWire(e)
+	return e
+}
+
+// === Decodificador ===
+
+// wireDecoder lê campos numerados. O primeiro erro interrompe a leitura
+// (next retorna false) e fica em err; campos desconhecidos são pulados.
+type wireDecoder struct {
+	data   []byte
+	pos    int
+	start  int // Início do campo atual (tag)
+	field  int
+	kind   int
+	budget *int // Campos restantes, compartilhado com os aninhados
+	err    error
+}
+
+func newWireDecoder(data []byte) *wireDecoder {
+	budget := maxWireFields
+	return &wireDecoder{data: data, budget: &budget}
+}
+
+func (d *wireDecoder) fail(format string, args ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf(format, args...)
+	}
+}
+
+func (d *wireDecoder) varint() uint64 {
+	v, n := binary.Uvarint(d.data[d.pos:])
+	if n <= 0 {
+		d.fail("varint inválido na posição %d", d.pos)
+		return 0
+	}
+	d.pos += n
+	return v
+}
+
+// next avança para o próximo campo
+func (d *wireDecoder) next() bool {
+	if d.err != nil || d.pos >= len(d.data) {
+		return false
+	}
+	if *d.budget--; *d.budget < 0 {
+		d.fail("mensagem com campos demais")
+		return false
+	}
+
+	d.start = d.pos
+	tag := d.varint()
+	field, kind := tag>>3, int(tag&7)
+	if d.err == nil && (field == 0 || field > math.MaxInt32 || (kind != wireVarint && kind != wireBytes)) {
+		d.fail("tag inválida %d na posição %d", tag, d.start)
+	}
+	d.field, d.kind = int(field), kind
+	return d.err == nil
+}
+
+func (d *wireDecoder) expect(kind int) bool {
+	if d.err == nil && d.kind != kind {
+		d.fail("campo %d com tipo %d, esperado %d", d.field, d.kind, kind)
+	}
+	return d.err == nil
+}
+
+func (d *wireDecoder) uint() uint64 {
+	if !d.expect(wireVarint) {
+		return 0
+	}
+	return d.varint()
+}
+
+func (d *wireDecoder) int64() int64 {
+	u := d.uint()
+	return int64(u>>1) ^ -int64(u&1) // zigzag, como binary.AppendVarint
+}
+
+func (d *wireDecoder) int() int {
+	v := d.int64()
+	if int64(int(v)) != v {
+		d.fail("campo %d fora do intervalo", d.field)
+		return 0
+	}
+	return int(v)
+}
+
+func (d *wireDecoder) bool() bool {
+	return d.uint() != 0
+}
+
+func (d *wireDecoder) bytes() []byte {
+	if !d.expect(wireBytes) {
+		return nil
+	}
+	size := d.varint()
+	if d.err == nil && size > uint64(len(d.data)-d.pos) {
+		d.fail("campo %d com %d bytes excede a mensagem", d.field, size)
+	}
+	if d.err != nil {
+		return nil
+	}
+	b := d.data[d.pos : d.pos+int(size)]
+	d.pos += int(size)
+	return b
+}
+
+func (d *wireDecoder) string() string {
+	return string(d.bytes())
+}
+
+func (d *wireDecoder) time() time.Time {
+	raw := d.bytes()
+	if d.err != nil {
+		return time.Time{}
+	}
+
+	var seconds, nanos, offset int64
+	sub := &wireDecoder{data: raw, budget: d.budget}
+	for sub.next() {
+		switch sub.field {
+		case 1:
+			seconds = sub.int64()
+		case 2:
+			nanos = sub.int64()
+		case 3:
+			offset = sub.int64()
+		default:
+			sub.skip()
+		}
+	}
+	if sub.err == nil && (nanos < 0 || nanos >= int64(time.Second) || offset <= -86400 || offset >= 86400) {
+		sub.fail("instante inválido")
+	}
+	t := time.Unix(seconds, nanos).In(time.FixedZone("", int(offset)))
+	if sub.err == nil && (t.Year() < 0 || t.Year() > 9999) { // Intervalo do RFC 3339 (JSON)
+		sub.fail("ano %d fora do intervalo", t.Year())
+	}
+	if sub.err != nil {
+		d.fail("campo %d: %v", d.field, sub.err)
+		return time.Time{}
+	}
+	if offset == 0 {
+		t = t.UTC()
+	}
+	return t
+}
+
+func (d *wireDecoder) message(p wirePayload) {
+	raw := d.bytes()
+	if d.err != nil {
+		return
+	}
+	sub := &wireDecoder{data: raw, budget: d.budget}
+	p.decodeWire(sub)
+	if sub.err != nil {
+		d.fail("campo %d: %v", d.field, sub.err)
+	}
+}
+
+// skip pula um campo desconhecido (adicionado por uma versão mais nova)
+func (d *wireDecoder) skip() {
+	if d.kind == wireVarint {
+		d.varint()
+	} else {
+		d.bytes()
+	}
+}
+
+func decodePayload(data []byte, p wirePayload) error {
+	d := newWireDecoder(data)
+	p.decodeWire(d)
+	return d.err
+}
+
+// === Envelope ===
+
+// encodeData serializa Data com o esquema do tipo. Tipos sem esquema levam
+// Data em JSON canônico (ida e volta por um mapa, como o destinatário o vê).
+func encodeData(msgType string, data interface{}) ([]byte, error) {
+	if newPayload, exists := messageSchemas[msgType]; exists {
+		payload, ok := data.(wirePayload)
+		if !ok || reflect.TypeOf(payload) != reflect.TypeOf(newPayload()) {
+			return nil, fmt.Errorf("dados %T incompatíveis com a mensagem %s", data, msgType)
+		}
+		e := encodePayload(payload)
+		return e.buf, e.err
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var canonical interface{}
+	if err := json.Unmarshal(raw, &canonical); err != nil {
+		return nil, err
+	}
+	return json.Marshal(canonical)
+}
+
+// signingBytes é o envelope binário sem a assinatura: o que é assinado,
+// qualquer que seja o formato de envio
+func signingBytes(msg *NetworkMessage) ([]byte, error) {
+	e := &wireEncoder{buf: []byte{wireMagic, wireVersion}}
+	e.string(envelopeType, msg.Type)
+	e.string(envelopeFrom, msg.From)
+	e.string(envelopeTo, msg.To)
+	e.time(envelopeTimestamp, msg.Timestamp)
+	if msg.Data != nil {
+		data, err := encodeData(msg.Type, msg.Data)
+		if err != nil {
+			return nil, err
+		}
+		e.bytes(envelopeData, data)
+	}
+	return e.buf, e.err
+}
+
+// encodeMessage serializa a mensagem assinada no formato escolhido
+func encodeMessage(msg *NetworkMessage, format wireFormat) ([]byte, error) {
+	if format == wireJSON {
+		return json.Marshal(msg)
+	}
+
+	payload, err := signingBytes(msg)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.StdEncoding.DecodeString(msg.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("assinatura inválida: %v", err)
+	}
+	e := &wireEncoder{buf: payload}
+	if len(signature) > 0 {
+		e.bytes(envelopeSignature, signature)
+	}
+	return e.buf, nil
+}
+
+// wireEnvelope é a mensagem recebida com Data ainda codificado
+type wireEnvelope struct {
+	msg    *NetworkMessage
+	data   []byte
+	isJSON bool
+}
+
+// parseEnvelope lê os campos do envelope sem decodificar Data, para que o
+// limite de tamanho do tipo seja conferido antes
+func parseEnvelope(payload []byte) (*wireEnvelope, error) {
+	if len(payload) == 0 {
+		return nil, &malformedMessageError{reason: "payload vazio"}
+	}
+	if payload[0] == '{' {
+		var envelope struct {
+			NetworkMessage
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(payload, &envelope); err != nil {
+			return nil, &malformedMessageError{reason: err.Error()}
+		}
+		msg := envelope.NetworkMessage
+		return &wireEnvelope{msg: &msg, data: envelope.Data, isJSON: true}, nil
+	}
+
+	if payload[0] != wireMagic || len(payload) < 2 {
+		return nil, &malformedMessageError{reason: fmt.Sprintf("formato desconhecido (0x%02x)", payload[0])}
+	}
+	if payload[1] != wireVersion {
+		return nil, &malformedMessageError{reason: fmt.Sprintf("versão %d do envelope binário não suportada", payload[1])}
+	}
+
+	msg := &NetworkMessage{}
+	envelope := &wireEnvelope{msg: msg}
+	d := newWireDecoder(payload[2:])
+	for d.next() {
+		switch d.field {
+		case envelopeType:
+			msg.Type = d.string()
+		case envelopeFrom:
+			msg.From = d.string()
+		case envelopeTo:
+			msg.To = d.string()
+		case envelopeTimestamp:
+			msg.Timestamp = d.time()
+		case envelopeData:
+			envelope.data = d.bytes()
+		case envelopeSignature:
+			signed := payload[:2+d.start]
+			msg.Signature = base64.StdEncoding.EncodeToString(d.bytes())
+			if d.err == nil && d.pos != len(d.data) {
+				d.fail("campos depois da assinatura")
+			}
+			msg.signed = signed
+		default:
+			d.skip()
+		}
+	}
+	if d.err != nil {
+		return nil, &malformedMessageError{msgType: msg.Type, reason: d.err.Error()}
+	}
+	return envelope, nil
+}
+
+// open decodifica Data no tipo registrado para a mensagem
+func (envelope *wireEnvelope) open() (*NetworkMessage, error) {
+	msg := envelope.msg
+	if envelope.isJSON && (len(envelope.data) == 0 || string(envelope.data) == "null") {
+		return msg, nil
+	}
+	if !envelope.isJSON && envelope.data == nil {
+		return msg, nil
+	}
+
+	var err error
+	if newPayload, exists := messageSchemas[msg.Type]; exists {
+		payload := newPayload()
+		if envelope.isJSON {
+			err = json.Unmarshal(envelope.data, payload)
+		} else {
+			err = decodePayload(envelope.data, payload)
+		}
+		msg.Data = payload
+	} else {
+		err = json.Unmarshal(envelope.data, &msg.Data)
+	}
+	if err != nil {
+		msg.Data = nil
+		return nil, &malformedMessageError{msgType: msg.Type, reason: err.Error()}
+	}
+	return msg, nil
+}
+
+// decodeMessage decodifica uma mensagem completa em qualquer formato
+func decodeMessage(payload []byte) (*NetworkMessage, error) {
+	envelope, err := parseEnvelope(payload)
+	if err != nil {
+		return nil, err
+	}
+	return envelope.open()
+}
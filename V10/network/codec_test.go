@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var codecTime = time.Date(2025, time.March, 4, 5, 6, 7, 890, time.UTC)
+
+func sampleTransaction(id string) Transaction {
+	return Transaction{
+		ID: id, Type: "transfer", From: "alice", To: "bob", Amount: -3,
+		Timestamp: codecTime.In(time.FixedZone("", -3*3600)), PublicKey: "PUBKEY", Nonce: 9, Signature: "SIGNATURE_OK_123",
+	}
+}
+
+func sampleBlock(index int) Token {
+	block := testBlock(index, "PREV")
+	block.Nonce = 1 << 40
+	block.HashParts = []string{"a", "", "c"}
+	block.MinerID = "miner"
+	block.Transactions = []Transaction{sampleTransaction("tx-1"), sampleTransaction("tx-2")}
+	return block
+}
+
+// sampleMessages tem um corpo preenchido para cada tipo com esquema
+func sampleMessages() []*NetworkMessage {
+	block := sampleBlock(3)
+	header := block
+	header.Transactions = nil
+	precommit := ConsensusVote{Height: 1, Round: 2, Type: votePrecommit, BlockHash: block.Hash, Voter: "node-B", Signature: "SIG"}
+	committed := block
+	committed.Commit = &CommitCertificate{Height: 1, Round: 2, BlockHash: block.Hash, Precommits: []ConsensusVote{precommit}}
+	committed.NextValidators = []ValidatorStake{{ID: "node-B", Owner: "bob", Amount: 100, PubKey: "KEY"}}
+	evidence := sampleTransaction("tx-ev")
+	evidence.Type, evidence.To, evidence.ValidatorKey = TX_EVIDENCE, "node-B", "KEY"
+	twin := precommit
+	twin.BlockHash += "-twin"
+	evidence.Evidence = &DoubleSignEvidence{VoteA: &precommit, VoteB: &twin}
+	data := map[string]wirePayload{
+		MSG_INTRODUCTION:      &VersionInfo{ProtocolVersion: ProtocolVersion, ChainID: "genesis", BestHeight: 3, Services: SERVICE_FULL_NODE | SERVICE_MINER, NodeID: "node-A", Port: 8333, Timestamp: codecTime.Unix()},
+		MSG_REJECT:            &rejectMessage{Reason: "chain ID incompatível"},
+		MSG_HEARTBEAT:         &heartbeatMessage{Height: 42},
+		MSG_SYNC_REQUEST:      &syncRequest{CurrentHeight: 7},
+		MSG_SYNC_RESPONSE:     &syncResponse{Blocks: []Token{sampleBlock(1), sampleBlock(2)}, Height: 9},
+		MSG_ADDR_REQUEST:      &addrRequest{MaxAddresses: 20},
+		MSG_ADDR_RESPONSE:     &addrResponse{Addresses: []addrEntry{{IP: "10.0.0.1", Port: "8333"}, {IP: "::1", Port: "1"}}},
+		MSG_PEER_LIST:         &peerList{Peers: []peerListEntry{{ID: "node-B", Address: "10.0.0.2", Port: 8333}}},
+		MSG_NEW_BLOCK:         &committed,
+		MSG_NEW_TRANSACTION:   &evidence,
+		MSG_TX_REJECTED:       &txStatus{TxID: "tx-1", Reason: "invalid_signature"},
+		MSG_CONSENSUS_REQUEST: &consensusProposal{Height: 1, Round: 2, POLRound: -1, Block: block, Proposer: "node-A", Signature: "SIG"},
+		MSG_CONSENSUS_VOTE:    &precommit,
+		MSG_CONSENSUS_START:   &consensusStart{Height: 1},
+		MSG_INV:               &invMessage{Items: []InvItem{{Type: INV_BLOCK, Hash: block.Hash}, {Type: INV_TX, Hash: "tx-1"}}},
+		MSG_CMPCT_BLOCK: &CompactBlock{
+			Header: header, Salt: 1<<64 - 1, TxCount: 2, ShortIDs: []string{"0a0b0c0d0e0f"},
+			Prefilled: []PrefilledTx{{Index: 0, Tx: block.Transactions[0]}}, TxRoot: computeTxRoot(block.Transactions),
+		},
+		MSG_GET_BLOCK_TXN:  &getBlockTxn{BlockHash: block.Hash, Indexes: []int{0, 5, 0}},
+		MSG_BLOCK_TXN:      &blockTxn{BlockHash: block.Hash, Txs: []PrefilledTx{{Index: 1, Tx: block.Transactions[1]}}},
+		MSG_DHT_FIND_VALUE: &dhtRequest{RPCID: "rpc", Target: "ff00", Value: "v"},
+		MSG_DHT_NODES:      &dhtReply{RPCID: "rpc", Nodes: []*DHTNode{{ID: "n1", Address: "10.0.0.3", Port: 1, LastSeen: codecTime}}, Found: true, Error: "e"},
+		MSG_LAN_BEACON:     &lanBeacon{Port: 8333, ChainID: "genesis", ProtocolVersion: ProtocolVersion, PublicKey: "KEY"},
+	}
+
+	messages := make([]*NetworkMessage, 0, len(data))
+	for msgType, payload := range data {
+		messages = append(messages, &NetworkMessage{
+			Type: msgType, From: "node-A", To: "node-B", Data: payload, Timestamp: codecTime,
+			Signature: base64.StdEncoding.EncodeToString([]byte("assinatura")),
+		})
+	}
+	return messages
+}
+
+func TestMessagesRoundTripInBothFormats(t *testing.T) {
+	for _, msg := range sampleMessages() {
+		for _, format := range []wireFormat{wireBinary, wireJSON} {
+			raw, err := encodeMessage(msg, format)
+			if err != nil {
+				t.Fatalf("%s em %s: %v", msg.Type, format, err)
+			}
+			got, err := decodeMessage(raw)
+			if err != nil {
+				t.Fatalf("%s em %s: %v", msg.Type, format, err)
+			}
+			if !reflect.DeepEqual(got.Data, msg.Data) || got.From != msg.From || got.Signature != msg.Signature ||
+				!got.Timestamp.Equal(msg.Timestamp) {
+				t.Fatalf("%s em %s mudou na ida e volta:\n%+v\n%+v", msg.Type, format, got.Data, msg.Data)
+			}
+		}
+	}
+}
+
+func TestBinaryIsSmallerThanJSON(t *testing.T) {
+	block := sampleBlock(1)
+	msg := &NetworkMessage{Type: MSG_NEW_BLOCK, From: "node-A", Data: &block, Timestamp: codecTime}
+	binaryRaw, _ := encodeMessage(msg, wireBinary)
+	jsonRaw, _ := encodeMessage(msg, wireJSON)
+	if len(binaryRaw)*2 > len(jsonRaw) {
+		t.Fatalf("binário com %d bytes, JSON com %d", len(binaryRaw), len(jsonRaw))
+	}
+}
+
+func TestEncodeRejectsMismatchedData(t *testing.T) {
+	msg := &NetworkMessage{Type: MSG_HEARTBEAT, Data: map[string]interface{}{"blockchain_height": 3}}
+	if _, err := encodeMessage(msg, wireBinary); err == nil {
+		t.Fatal("mapa aceito como corpo de heartbeat")
+	}
+	if _, err := signingBytes(msg); err == nil {
+		t.Fatal("mensagem com corpo incompatível não deveria ser assinável")
+	}
+
+	// Tipos sem esquema levam Data em JSON dentro do envelope binário
+	msg = &NetworkMessage{Type: MSG_DIFFICULTY_UPDATE, Data: map[string]interface{}{"difficulty": 4.0}}
+	raw, err := encodeMessage(msg, wireBinary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := decodeMessage(raw)
+	if err != nil || !reflect.DeepEqual(got.Data, msg.Data) {
+		t.Fatalf("tipo sem esquema não preservado: %v %+v", err, got)
+	}
+}
+
+// appendField acrescenta ao payload um campo que esta versão não conhece
+func appendField(payload []byte, field int, value []byte) []byte {
+	payload = binary.AppendUvarint(payload, uint64(field)<<3|wireBytes)
+	payload = binary.AppendUvarint(payload, uint64(len(value)))
+	return append(payload, value...)
+}
+
+func TestUnknownFieldsFromNewerPeersAreSkipped(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Versão futura: campo 13 no voto e campo 6 no envelope
+	vote := &ConsensusVote{Height: 1, Type: votePrevote, BlockHash: "HASH", Voter: "node-A"}
+	body := appendField(encodePayload(vote).buf, 13, []byte("peso"))
+	e := &wireEncoder{buf: []byte{wireMagic, wireVersion}}
+	e.string(envelopeType, MSG_CONSENSUS_VOTE)
+	e.string(envelopeFrom, "node-A")
+	e.bytes(envelopeData, body)
+	signed := appendField(e.buf, 6, []byte("extensão"))
+
+	hash := sha256.Sum256(signed)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := appendField(signed, envelopeSignature, signature)
+
+	msg, err := decodeMessage(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(msg.Data, vote) {
+		t.Fatalf("voto decodificado incorreto: %+v", msg.Data)
+	}
+	// A assinatura cobre os campos desconhecidos, que não foram decodificados
+	if !NewSecurityManager(nil).VerifyMessage(msg, &key.PublicKey) {
+		t.Fatal("assinatura sobre campos desconhecidos rejeitada")
+	}
+}
+
+func TestMalformedPayloadsAreRejected(t *testing.T) {
+	// Mensagem fixa: a ordem de sampleMessages vem de um mapa
+	block := sampleBlock(3)
+	valid, err := encodeMessage(&NetworkMessage{Type: MSG_NEW_BLOCK, From: "node-A", Data: &block, Timestamp: codecTime}, wireBinary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	heartbeat := func(body []byte) []byte {
+		e := &wireEncoder{buf: []byte{wireMagic, wireVersion}}
+		e.string(envelopeType, MSG_HEARTBEAT)
+		e.bytes(envelopeData, body)
+		return e.buf
+	}
+
+	cases := map[string][]byte{
+		"vazio":                  {},
+		"formato desconhecido":   {0x00, 0x01},
+		"versão futura":          {wireMagic, wireVersion + 1},
+		"truncado":               valid[:len(valid)/2],
+		"varint sem fim":         {wireMagic, wireVersion, 0x80, 0x80, 0x80},
+		"campo zero":             {wireMagic, wireVersion, 0x02, 0x00},
+		"tipo de campo inválido": {wireMagic, wireVersion, 0x0d, 0x00},
+		"tamanho além do fim":    {wireMagic, wireVersion, 0x0a, 0x7f, 'x'},
+		"campo após assinatura":  appendField(appendField([]byte{wireMagic, wireVersion}, envelopeSignature, []byte("sig")), 6, nil),
+		"tipo de campo trocado":  heartbeat(appendField(nil, 1, []byte("42"))),
+		"nanossegundos demais":   appendField([]byte{wireMagic, wireVersion}, envelopeTimestamp, binary.AppendVarint([]byte{0x10}, 2e9)),
+		"JSON truncado":          []byte(`{"type":"heartbeat","data":{"blockchain_height":`),
+		"JSON com tipo errado":   []byte(`{"type":"heartbeat","data":{"blockchain_height":"alto"}}`),
+	}
+	for name, payload := range cases {
+		_, err := decodeMessage(payload)
+		var malformed *malformedMessageError
+		if !errors.As(err, &malformed) {
+			t.Errorf("%s: esperado erro de mensagem malformada, obtido %v", name, err)
+		}
+	}
+}
+
+func TestJSONDebugNodeInteroperatesWithBinaryNode(t *testing.T) {
+	t.Setenv(wireFormatEnv, "json")
+	debug := newTestNode(t, "node-A")
+	t.Setenv(wireFormatEnv, "")
+	regular := newTestNode(t, "node-B")
+	if debug.wireFormat != wireJSON || regular.wireFormat != wireBinary {
+		t.Fatalf("formatos incorretos: %s %s", debug.wireFormat, regular.wireFormat)
+	}
+
+	genesis := testBlock(1, "")
+	debug.Blockchain = []Token{genesis}
+	regular.ChainID = genesis.Hash
+	if !regular.ConnectToAddress("127.0.0.1", strconv.Itoa(debug.Port)) {
+		t.Fatal("nó binário não conectou ao nó JSON")
+	}
+	if !waitFor(t, defaultWait, func() bool { return chainHeight(regular) == 1 }) {
+		t.Fatal("sync em JSON não chegou ao nó binário")
+	}
+
+	second := testBlock(2, genesis.Hash)
+	regular.validateAndAddBlock(&second)
+	regular.AnnounceBlock(&second, "")
+	if !waitFor(t, defaultWait, func() bool { return chainHeight(debug) == 2 }) {
+		t.Fatal("bloco binário não chegou ao nó JSON")
+	}
+}
+
+func FuzzDecodeMessage(f *testing.F) {
+	for _, msg := range sampleMessages() {
+		for _, format := range []wireFormat{wireBinary, wireJSON} {
+			raw, _ := encodeMessage(msg, format)
+			f.Add(raw)
+		}
+	}
+	f.Add([]byte{wireMagic, wireVersion, 0x0a, 0xff, 0xff, 0xff, 0xff, 0x0f})
+
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		msg, err := decodeMessage(payload)
+		if err != nil {
+			var malformed *malformedMessageError
+			if !errors.As(err, &malformed) {
+				t.Fatalf("erro fora do tipo esperado: %v", err)
+			}
+			return
+		}
+
+		// O que foi aceito precisa ser recodificável e estável
+		msg.Signature = ""
+		raw, err := encodeMessage(msg, wireBinary)
+		if err != nil {
+			t.Fatalf("mensagem decodificada não pôde ser recodificada: %v", err)
+		}
+		again, err := decodeMessage(raw)
+		if err != nil {
+			t.Fatalf("recodificação ilegível: %v", err)
+		}
+		if rawAgain, _ := encodeMessage(again, wireBinary); !bytes.Equal(raw, rawAgain) {
+			t.Fatalf("codificação instável:\n%x\n%x", raw, rawAgain)
+		}
+	})
+}
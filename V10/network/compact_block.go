@@ -0,0 +1,380 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// Mensagens de blocos compactos
+const (
+	MSG_CMPCT_BLOCK   = "cmpctblock"
+	MSG_GET_BLOCK_TXN = "getblocktxn"
+	MSG_BLOCK_TXN     = "blocktxn"
+)
+
+// Parâmetros dos blocos compactos
+const (
+	compactBlocksVersion = 3                // Versão de protocolo que entende cmpctblock
+	shortIDBytes         = 6                // Tamanho do ID curto (48 bits)
+	maxPartialBlocks     = 16               // Blocos aguardando transações faltantes
+	partialBlockTimeout  = 30 * time.Second // Depois disso o bloco parcial é descartado
+)
+
+// PrefilledTx é uma transação enviada por completo dentro do bloco compacto
+type PrefilledTx struct {
+	Index int         `json:"index"`
+	Tx    Transaction `json:"tx"`
+}
+
+// CompactBlock leva o cabeçalho, IDs curtos das transações que o peer
+// provavelmente já tem e as transações que ele não deve ter (prefilled)
+type CompactBlock struct {
+	Header    Token         `json:"header"`      // Bloco sem as transações
+	Salt      uint64        `json:"salt,string"` // String no modo JSON: leitores genéricos usam float64 e perderiam precisão
+	TxCount   int           `json:"tx_count"`
+	ShortIDs  []string      `json:"short_ids"` // Na ordem do bloco, sem as prefilled
+	Prefilled []PrefilledTx `json:"prefilled"`
+	TxRoot    string        `json:"tx_root"` // Hash da lista completa para conferir a reconstrução
+}
+
+// getBlockTxn pede as transações de um bloco compacto pelos índices
+type getBlockTxn struct {
+	BlockHash string `json:"block_hash"`
+	Indexes   []int  `json:"indexes"`
+}
+
+// blockTxn responde getBlockTxn com as transações pedidas
+type blockTxn struct {
+	BlockHash string        `json:"block_hash"`
+	Txs       []PrefilledTx `json:"txs"`
+}
+
+// partialBlock é um bloco compacto aguardando blocktxn
+type partialBlock struct {
+	compact   *CompactBlock
+	txs       []*Transaction
+	missing   []int
+	peerID    string
+	createdAt time.Time
+}
+
+// compactState guarda os blocos parciais em reconstrução
+type compactState struct {
+	mtx      sync.Mutex
+	partials map[string]*partialBlock // Por hash do bloco
+}
+
+// shortTxID deriva o ID curto da transação com sal por bloco,
+// para que colisões não possam ser preparadas com antecedência
+func shortTxID(blockHash string, salt uint64, txID string) string {
+	var saltBytes [8]byte
+	binary.BigEndian.PutUint64(saltBytes[:], salt)
+
+	h := sha256.New()
+	h.Write([]byte(blockHash))
+	h.Write(saltBytes[:])
+	h.Write([]byte(txID))
+	return hex.EncodeToString(h.Sum(nil)[:shortIDBytes])
+}
+
+// computeTxRoot resume a lista de transações para conferir a reconstrução
+func computeTxRoot(txs []Transaction) string {
+	if len(txs) == 0 {
+		txs = []Transaction{}
+	}
+	raw, _ := json.Marshal(txs)
+	hash := sha256.Sum256(raw)
+	return hex.EncodeToString(hash[:])
+}
+
+// buildCompactBlock monta o bloco compacto. Recompensas de mineração e
+// transações que nunca passaram pelo nosso mempool vão por completo.
+func (node *P2PNode) buildCompactBlock(block *Token) *CompactBlock {
+	salt, _ := rand.Int(rand.Reader, new(big.Int).SetUint64(1<<63))
+	header := *block
+	header.Transactions = nil
+
+	compact := &CompactBlock{
+		Header:    header,
+		Salt:      salt.Uint64(),
+		TxCount:   len(block.Transactions),
+		ShortIDs:  make([]string, 0, len(block.Transactions)),
+		Prefilled: make([]PrefilledTx, 0),
+		TxRoot:    computeTxRoot(block.Transactions),
+	}
+
+	for i, tx := range block.Transactions {
+		relayed := node.seenInv.Has(InvItem{Type: INV_TX, Hash: tx.ID}.key())
+		if tx.Type == "mining_reward" || tx.From == "SYSTEM" || !relayed {
+			compact.Prefilled = append(compact.Prefilled, PrefilledTx{Index: i, Tx: tx})
+			continue
+		}
+		compact.ShortIDs = append(compact.ShortIDs, shortTxID(block.Hash, compact.Salt, tx.ID))
+	}
+	return compact
+}
+
+// sendCompactBlock envia o bloco compacto diretamente, sem inv antes
+func (node *P2PNode) sendCompactBlock(peerID string, block *Token) {
+	msg := &NetworkMessage{
+		Type:      MSG_CMPCT_BLOCK,
+		Data:      node.buildCompactBlock(block),
+		Timestamp: time.Now(),
+	}
+	if err := node.sendToPeer(peerID, msg); err != nil {
+		fmt.Printf("⚠️ [%s] Falha ao enviar bloco compacto para %s: %v\n", node.ID, peerID, err)
+		return
+	}
+	node.markPeerKnows(peerID, InvItem{Type: INV_BLOCK, Hash: block.Hash})
+	node.countRelay("cmpct_sent", 1)
+}
+
+// supportsCompactBlocks informa se o peer negociou versão com cmpctblock
+func (node *P2PNode) supportsCompactBlocks(peerID string) bool {
+	node.mutex.RLock()
+	defer node.mutex.RUnlock()
+
+	peer, exists := node.Peers[peerID]
+	return exists && peer.ProtocolVersion >= compactBlocksVersion
+}
+
+func decodeCompactBlock(msg *NetworkMessage) (*CompactBlock, error) {
+	compact, ok := msg.Data.(*CompactBlock)
+	if !ok {
+		return nil, fmt.Errorf("bloco compacto com dados %T", msg.Data)
+	}
+	if compact.Header.Hash == "" || compact.TxCount < 0 ||
+		len(compact.ShortIDs)+len(compact.Prefilled) != compact.TxCount {
+		return nil, fmt.Errorf("bloco compacto malformado")
+	}
+	seen := make(map[int]bool, len(compact.Prefilled))
+	for _, prefilled := range compact.Prefilled {
+		if prefilled.Index < 0 || prefilled.Index >= compact.TxCount || seen[prefilled.Index] {
+			return nil, fmt.Errorf("índice de transação prefilled inválido: %d", prefilled.Index)
+		}
+		seen[prefilled.Index] = true
+	}
+	return compact, nil
+}
+
+// Reconstrói o bloco a partir do mempool e pede só as transações que faltam
+func (node *P2PNode) handleCompactBlock(msg *NetworkMessage) *NetworkMessage {
+	compact, err := decodeCompactBlock(msg)
+	if err != nil {
+		node.penalizePeer(msg.From, penaltyBehavior, err.Error())
+		return nil
+	}
+
+	item := InvItem{Type: INV_BLOCK, Hash: compact.Header.Hash}
+	node.markPeerKnows(msg.From, item)
+	node.countRelay("cmpct_received", 1)
+	if node.hasInventory(item) {
+		return nil
+	}
+
+	// Sem o bloco anterior não há como validar: sincroniza com o peer
+	node.mutex.RLock()
+	expected := len(node.Blockchain) + 1
+	node.mutex.RUnlock()
+	if compact.Header.Index != expected {
+		node.spawn(func() { node.requestSpecificPeerSync(msg.From) })
+		return nil
+	}
+
+	partial := node.fillFromMempool(compact, msg.From)
+	if len(partial.missing) == 0 {
+		node.countRelay("cmpct_reconstructed", 1)
+		return node.completeCompactBlock(partial)
+	}
+
+	node.storePartialBlock(partial)
+	node.countRelay("cmpct_missing_txs", len(partial.missing))
+	fmt.Printf("🧩 [%s] Bloco %.16s: %d de %d transações faltando, pedindo a %s\n",
+		node.ID, compact.Header.Hash, len(partial.missing), compact.TxCount, msg.From)
+
+	return &NetworkMessage{
+		Type:      MSG_GET_BLOCK_TXN,
+		From:      node.ID,
+		To:        msg.From,
+		Data:      &getBlockTxn{BlockHash: compact.Header.Hash, Indexes: partial.missing},
+		Timestamp: time.Now(),
+	}
+}
+
+// fillFromMempool preenche as posições do bloco com as prefilled e com as
+// transações do PendingTxs cujo ID curto coincide
+func (node *P2PNode) fillFromMempool(compact *CompactBlock, peerID string) *partialBlock {
+	partial := &partialBlock{
+		compact:   compact,
+		txs:       make([]*Transaction, compact.TxCount),
+		peerID:    peerID,
+		createdAt: node.clock.Now(),
+	}
+	for i := range compact.Prefilled {
+		partial.txs[compact.Prefilled[i].Index] = &compact.Prefilled[i].Tx
+	}
+
+	// IDs curtos repetidos no mempool ficam ambíguos e são pedidos ao peer
+	mempool := make(map[string]*Transaction)
+	ambiguous := make(map[string]bool)
+	node.mutex.RLock()
+	for i := range node.PendingTxs {
+		tx := node.PendingTxs[i]
+		id := shortTxID(compact.Header.Hash, compact.Salt, tx.ID)
+		if _, exists := mempool[id]; exists {
+			ambiguous[id] = true
+		}
+		mempool[id] = &tx
+	}
+	node.mutex.RUnlock()
+
+	next := 0
+	for i := range partial.txs {
+		if partial.txs[i] != nil {
+			continue
+		}
+		id := compact.ShortIDs[next]
+		next++
+		if tx, ok := mempool[id]; ok && !ambiguous[id] {
+			partial.txs[i] = tx
+		} else {
+			partial.missing = append(partial.missing, i)
+		}
+	}
+	return partial
+}
+
+// completeCompactBlock confere a reconstrução e adiciona o bloco.
+// Se a lista não bater com o TxRoot, pede o bloco completo (getdata).
+func (node *P2PNode) completeCompactBlock(partial *partialBlock) *NetworkMessage {
+	compact := partial.compact
+	block := compact.Header
+	block.Transactions = make([]Transaction, len(partial.txs))
+	for i, tx := range partial.txs {
+		if tx == nil {
+			return node.requestFullBlock(partial, "transação ausente")
+		}
+		block.Transactions[i] = *tx
+	}
+
+	if computeTxRoot(block.Transactions) != compact.TxRoot {
+		return node.requestFullBlock(partial, "lista de transações não confere")
+	}
+	if err := checkBlockSanity(&block); err != nil {
+		node.penalizePeer(partial.peerID, penaltyInvalidBlock, fmt.Sprintf("bloco compacto inválido: %v", err))
+		return nil
+	}
+
+	if node.validateAndAddBlock(&block) {
+		fmt.Printf("📦 [%s] Bloco compacto reconstruído: %.16s (%d transações)\n",
+			node.ID, block.Hash, compact.TxCount)
+		node.spawn(func() { node.AnnounceBlock(&block, partial.peerID) })
+	}
+	return nil
+}
+
+// requestFullBlock recorre ao bloco completo via getdata
+func (node *P2PNode) requestFullBlock(partial *partialBlock, reason string) *NetworkMessage {
+	fmt.Printf("⚠️ [%s] Reconstrução do bloco %.16s falhou (%s); pedindo bloco completo\n",
+		node.ID, partial.compact.Header.Hash, reason)
+	node.countRelay("cmpct_fallbacks", 1)
+
+	item := InvItem{Type: INV_BLOCK, Hash: partial.compact.Header.Hash}
+	node.requestedInv.Add(item.key())
+	return &NetworkMessage{
+		Type:      MSG_GET_DATA,
+		From:      node.ID,
+		To:        partial.peerID,
+		Data:      &invMessage{Items: []InvItem{item}},
+		Timestamp: time.Now(),
+	}
+}
+
+func (node *P2PNode) storePartialBlock(partial *partialBlock) {
+	node.compact.mtx.Lock()
+	defer node.compact.mtx.Unlock()
+
+	for hash, existing := range node.compact.partials {
+		if node.clock.Now().Sub(existing.createdAt) > partialBlockTimeout || len(node.compact.partials) >= maxPartialBlocks {
+			delete(node.compact.partials, hash)
+		}
+	}
+	node.compact.partials[partial.compact.Header.Hash] = partial
+}
+
+func (node *P2PNode) takePartialBlock(hash, peerID string) *partialBlock {
+	node.compact.mtx.Lock()
+	defer node.compact.mtx.Unlock()
+
+	partial, exists := node.compact.partials[hash]
+	if !exists || partial.peerID != peerID {
+		return nil
+	}
+	delete(node.compact.partials, hash)
+	return partial
+}
+
+// Responde com as transações pedidas de um bloco que enviamos compacto
+func (node *P2PNode) handleGetBlockTxn(msg *NetworkMessage) *NetworkMessage {
+	request, ok := msg.Data.(*getBlockTxn)
+	if !ok {
+		return nil
+	}
+
+	block := node.findBlock(request.BlockHash)
+	if block == nil {
+		return &NetworkMessage{
+			Type:      MSG_NOT_FOUND,
+			From:      node.ID,
+			To:        msg.From,
+			Data:      &invMessage{Items: []InvItem{{Type: INV_BLOCK, Hash: request.BlockHash}}},
+			Timestamp: time.Now(),
+		}
+	}
+
+	txs := make([]PrefilledTx, 0, len(request.Indexes))
+	for _, index := range request.Indexes {
+		if index < 0 || index >= len(block.Transactions) {
+			node.penalizePeer(msg.From, penaltyBehavior, "getblocktxn com índice inválido")
+			return nil
+		}
+		txs = append(txs, PrefilledTx{Index: index, Tx: block.Transactions[index]})
+	}
+
+	return &NetworkMessage{
+		Type:      MSG_BLOCK_TXN,
+		From:      node.ID,
+		To:        msg.From,
+		Data:      &blockTxn{BlockHash: request.BlockHash, Txs: txs},
+		Timestamp: time.Now(),
+	}
+}
+
+// Completa o bloco parcial com as transações recebidas
+func (node *P2PNode) handleBlockTxn(msg *NetworkMessage) *NetworkMessage {
+	response, ok := msg.Data.(*blockTxn)
+	if !ok {
+		return nil
+	}
+
+	partial := node.takePartialBlock(response.BlockHash, msg.From)
+	if partial == nil {
+		node.penalizePeer(msg.From, penaltyUnsolicited, "blocktxn não solicitado")
+		return nil
+	}
+
+	for i := range response.Txs {
+		index := response.Txs[i].Index
+		if index >= 0 && index < len(partial.txs) {
+			partial.txs[index] = &response.Txs[i].Tx
+		}
+	}
+	return node.completeCompactBlock(partial)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// compactPair cria remetente e receptor com o mesmo gênese e um bloco com
+// recompensa mais n transações já retransmitidas pelo remetente
+func compactPair(t *testing.T, n int) (*P2PNode, *P2PNode, Token) {
+	t.Helper()
+	sender := NewP2PNode("node-A", "127.0.0.1", 0)
+	receiver := NewP2PNode("node-B", "127.0.0.1", 0)
+
+	genesis := testBlock(1, "")
+	for _, node := range []*P2PNode{sender, receiver} {
+		node.Blockchain = []Token{genesis}
+		node.stakingGenesis = &StakingGenesis{Balances: map[string]int{addr("alice"): 1000}}
+	}
+
+	block := testBlock(2, genesis.Hash)
+	block.Validator = "miner"
+	block.Transactions = []Transaction{{
+		ID: "reward-2", Type: "mining_reward", From: "SYSTEM", To: "miner",
+		Amount: maxBlockReward, Timestamp: time.Now(), Signature: "SYSTEM_SIGNATURE",
+	}}
+	for i := 0; i < n; i++ {
+		tx := stakingTx(fmt.Sprintf("tx-%d", i), "transfer", "alice", addr("bob"), 10+i)
+		block.Transactions = append(block.Transactions, tx)
+		sender.seenInv.Add(InvItem{Type: INV_TX, Hash: tx.ID}.key())
+		receiver.PendingTxs = append(receiver.PendingTxs, tx)
+	}
+	if !sender.validateAndAddBlock(&block) {
+		t.Fatal("remetente rejeitou o próprio bloco")
+	}
+	return sender, receiver, block
+}
+
+// overWire simula a serialização binária da rede
+func overWire(t *testing.T, msg *NetworkMessage, from string) *NetworkMessage {
+	t.Helper()
+	raw, err := encodeMessage(msg, wireBinary)
+	if err != nil {
+		t.Fatalf("erro ao serializar %s: %v", msg.Type, err)
+	}
+	received, err := decodeMessage(raw)
+	if err != nil {
+		t.Fatalf("erro ao decodificar %s: %v", msg.Type, err)
+	}
+	received.From = from
+	return received
+}
+
+func compactMessage(compact *CompactBlock) *NetworkMessage {
+	return &NetworkMessage{Type: MSG_CMPCT_BLOCK, Data: compact, Timestamp: time.Now()}
+}
+
+func TestCompactBlockRebuiltFromMempool(t *testing.T) {
+	sender, receiver, block := compactPair(t, 5)
+
+	compact := sender.buildCompactBlock(&block)
+	if len(compact.Prefilled) != 1 || len(compact.ShortIDs) != 5 {
+		t.Fatalf("só a recompensa deveria ir completa: %d prefilled, %d IDs curtos", len(compact.Prefilled), len(compact.ShortIDs))
+	}
+
+	if reply := receiver.handleCompactBlock(overWire(t, compactMessage(compact), sender.ID)); reply != nil {
+		t.Fatalf("reconstrução completa não deveria gerar %s", reply.Type)
+	}
+	if chainHeight(receiver) != 2 {
+		t.Fatal("bloco não foi reconstruído")
+	}
+	stats := receiver.GetRelayStats()
+	if stats["cmpct_reconstructed"] != 1 || stats["cmpct_missing_txs"] != 0 {
+		t.Fatalf("estatísticas incorretas: %v", stats)
+	}
+}
+
+func TestCompactBlockFetchesMissingTransactions(t *testing.T) {
+	sender, receiver, block := compactPair(t, 5)
+	receiver.PendingTxs = receiver.PendingTxs[1:] // tx-0 não chegou ao receptor
+
+	request := receiver.handleCompactBlock(overWire(t, compactMessage(sender.buildCompactBlock(&block)), sender.ID))
+	if request == nil || request.Type != MSG_GET_BLOCK_TXN {
+		t.Fatalf("deveria pedir a transação faltante, resposta: %v", request)
+	}
+
+	response := sender.handleGetBlockTxn(overWire(t, request, receiver.ID))
+	if response == nil || response.Type != MSG_BLOCK_TXN {
+		t.Fatalf("remetente deveria responder com blocktxn, resposta: %v", response)
+	}
+	if reply := receiver.handleBlockTxn(overWire(t, response, sender.ID)); reply != nil {
+		t.Fatalf("bloco completo não deveria gerar %s", reply.Type)
+	}
+
+	if chainHeight(receiver) != 2 {
+		t.Fatal("bloco não foi completado com a transação recebida")
+	}
+	if got := receiver.GetRelayStats()["cmpct_missing_txs"]; got != 1 {
+		t.Fatalf("esperada 1 transação faltante, houve %d", got)
+	}
+}
+
+func TestCompactBlockFallsBackToFullBlock(t *testing.T) {
+	sender, receiver, block := compactPair(t, 3)
+
+	compact := sender.buildCompactBlock(&block)
+	compact.TxRoot = computeTxRoot(nil)
+
+	reply := receiver.handleCompactBlock(overWire(t, compactMessage(compact), sender.ID))
+	if reply == nil || reply.Type != MSG_GET_DATA {
+		t.Fatalf("reconstrução inconsistente deveria pedir o bloco completo, resposta: %v", reply)
+	}
+	if chainHeight(receiver) != 1 {
+		t.Fatal("bloco com lista de transações divergente não deveria ser aceito")
+	}
+	if got := receiver.GetRelayStats()["cmpct_fallbacks"]; got != 1 {
+		t.Fatalf("esperado 1 fallback, houve %d", got)
+	}
+}
+
+func TestMalformedCompactBlockIsRejected(t *testing.T) {
+	sender, receiver, block := compactPair(t, 2)
+
+	compact := sender.buildCompactBlock(&block)
+	compact.Prefilled = append(compact.Prefilled, compact.Prefilled[0])
+	compact.ShortIDs = compact.ShortIDs[1:]
+
+	if reply := receiver.handleCompactBlock(overWire(t, compactMessage(compact), sender.ID)); reply != nil {
+		t.Fatalf("bloco malformado não deveria gerar %s", reply.Type)
+	}
+	receiver.security.mtx.Lock()
+	score := receiver.security.misbehavior[sender.ID]
+	receiver.security.mtx.Unlock()
+	if score != penaltyBehavior {
+		t.Fatalf("pontuação de mau comportamento %d, esperado %d", score, penaltyBehavior)
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Ligação entre o P2PNode e a máquina BFT (bft.go). As entradas chegam sob
+// consensusMutex; as ações resultantes (difundir propostas e votos, agendar
+// timeouts, gravar o bloco decidido) são executadas depois de soltar o lock.
+// Validadores trocam mensagens de consenso diretamente, sem retransmissão.
+
+func (node *P2PNode) newConsensusEngine() *bftEngine {
+	engine := newBFTEngine(node.ID)
+	engine.build = node.buildProposalBlock
+	engine.validate = node.validateProposedBlock
+	return engine
+}
+
+// StartConsensusRound pede a decisão da próxima altura. O bloco é proposto
+// quando este nó for o proponente da rodada; os demais validadores entram na
+// altura ao receber o consensus_start.
+func (node *P2PNode) StartConsensusRound(block *Token) {
+	if !node.IsValidator || node.identity == nil {
+		return
+	}
+	height := chainHeight(node) + 1
+	if block != nil && block.Index == height {
+		// O candidato é deste nó, o hash passa a ser o do cabeçalho e o
+		// que fecha a época anuncia o próximo conjunto
+		sealed := *block
+		sealed.Validator = node.ID
+		node.sealBlock(&sealed)
+		block = &sealed
+	}
+
+	node.consensusMutex.Lock()
+	if block != nil && block.Index == height {
+		node.bft.candidate = block
+	}
+	actions := node.enterHeightLocked(height)
+	node.consensusMutex.Unlock()
+
+	fmt.Printf("🗳️ [%s] Iniciando consenso BFT da altura %d\n", node.ID, height)
+	node.BroadcastToNetwork(MSG_CONSENSUS_START, &consensusStart{Height: height}, "")
+	node.runConsensusActions(actions)
+}
+
+// enterHeightLocked inicia a altura se ela é a próxima da cadeia e a
+// máquina nunca entrou nela. Uma altura já iniciada não recomeça na rodada
+// 0: a trava e o valor válido se perderiam e o proponente assinaria outra
+// proposta para a mesma rodada. Requer consensusMutex.
+func (node *P2PNode) enterHeightLocked(height int) []bftAction {
+	engine := node.bft
+	if engine.height >= height || height != chainHeight(node)+1 {
+		return nil
+	}
+	set, chainID := node.currentValidatorSet(height)
+	if set.size() == 0 || !set.hasQuorum(set.keyedPower()) {
+		return nil
+	}
+	engine.key = node.identity.key
+	engine.chainID = chainID
+	engine.startHeight(height, set)
+	return engine.takeActions()
+}
+
+// currentValidatorSet: o conjunto da época da próxima altura e o chain ID
+// que os votos assinam, os mesmos com que verifyBlockCommit confere o
+// certificado. Poder e chaves vêm só do estado da cadeia.
+func (node *P2PNode) currentValidatorSet(height int) (*validatorSet, string) {
+	node.mutex.RLock()
+	defer node.mutex.RUnlock()
+
+	state := node.chainStateLocked()
+	return state.consensusSet(), state.chainIDAt(height)
+}
+
+// consensusSet é o conjunto que decide e certifica a próxima altura: poder
+// e chaves do retrato da época, com a semente do beacon
+func (s *ChainState) consensusSet() *validatorSet {
+	set := validatorSetOf(s.EpochValidators)
+	set.seed = s.Beacon
+	return set
+}
+
+// buildProposalBlock monta um bloco com a recompensa deste nó, cunhada
+// aqui, e as transações pendentes que valem contra o estado da cadeia;
+// recompensas do mempool nunca entram
+func (node *P2PNode) buildProposalBlock(height int) *Token {
+	reward := Transaction{
+		ID:        fmt.Sprintf("reward_%d_%s", height, node.ID),
+		Type:      "mining_reward",
+		From:      "SYSTEM",
+		To:        node.ID,
+		Amount:    maxBlockReward,
+		Timestamp: node.clock.Now(),
+		PublicKey: encodePublicKey(&node.identity.key.PublicKey),
+	}
+	reward.Signature, _ = signConsensus(node.identity.key, txSignBytes(&reward))
+
+	node.mutex.RLock()
+	state := node.chainStateLocked()
+	var txs []Transaction
+	if state.applyTx(&reward, height) == nil {
+		txs = append(txs, reward)
+	}
+	for _, tx := range node.PendingTxs {
+		if tx.Type != "mining_reward" && state.applyTx(&tx, height) == nil {
+			txs = append(txs, tx)
+		}
+	}
+	node.mutex.RUnlock()
+
+	block := &Token{
+		Index:        height,
+		Timestamp:    node.clock.Now().Format(time.RFC3339),
+		ContainsSyra: true,
+		Validator:    node.ID,
+		PrevHash:     node.getLastBlockHash(),
+		Transactions: txs,
+	}
+	node.sealBlock(block)
+	return block
+}
+
+// validateProposedBlock confere se o bloco pode ser a altura informada
+func (node *P2PNode) validateProposedBlock(block *Token, height int) error {
+	if err := checkBlockSanity(block); err != nil {
+		return err
+	}
+	if block.Index != height {
+		return fmt.Errorf("índice %d na altura %d", block.Index, height)
+	}
+	if err := checkHeaderHash(block); err != nil {
+		return err
+	}
+	if last := node.getLastBlockHash(); block.PrevHash != last {
+		return fmt.Errorf("prev_hash %.16s não é o topo %.16s", block.PrevHash, last)
+	}
+	node.mutex.RLock()
+	state := node.chainStateLocked()
+	node.mutex.RUnlock()
+	if err := state.applyBlock(block); err != nil {
+		return err
+	}
+	return state.requireAnnouncement(block)
+}
+
+// handleConsensusStart entra na altura pedida por outro validador
+func (node *P2PNode) handleConsensusStart(msg *NetworkMessage) *NetworkMessage {
+	start, ok := msg.Data.(*consensusStart)
+	if !ok || !node.IsValidator || node.identity == nil {
+		return nil
+	}
+	node.consensusMutex.Lock()
+	actions := node.enterHeightLocked(start.Height)
+	node.consensusMutex.Unlock()
+	node.runConsensusActions(actions)
+	return nil
+}
+
+// handleConsensusRequest recebe a proposta de uma rodada
+func (node *P2PNode) handleConsensusRequest(msg *NetworkMessage) *NetworkMessage {
+	proposal, ok := msg.Data.(*consensusProposal)
+	if !ok || !node.IsValidator || node.identity == nil || proposal.Proposer != msg.From {
+		return nil
+	}
+	node.consensusMutex.Lock()
+	actions := node.enterHeightLocked(proposal.Height)
+	err := node.bft.receiveProposal(proposal)
+	actions = append(actions, node.bft.takeActions()...)
+	node.consensusMutex.Unlock()
+
+	if err != nil {
+		node.rejectConsensusMessage(msg.From, "proposta", err)
+	}
+	node.runConsensusActions(actions)
+	return nil
+}
+
+// handleConsensusVote recebe um prevote ou precommit
+func (node *P2PNode) handleConsensusVote(msg *NetworkMessage) *NetworkMessage {
+	vote, ok := msg.Data.(*ConsensusVote)
+	if !ok || !node.IsValidator || node.identity == nil || vote.Voter != msg.From {
+		return nil
+	}
+	node.consensusMutex.Lock()
+	actions := node.enterHeightLocked(vote.Height)
+	err := node.bft.receiveVote(vote)
+	actions = append(actions, node.bft.takeActions()...)
+	node.consensusMutex.Unlock()
+
+	if err != nil {
+		node.rejectConsensusMessage(msg.From, vote.Type, err)
+	}
+	node.runConsensusActions(actions)
+	return nil
+}
+
+func (node *P2PNode) rejectConsensusMessage(peerID, kind string, err error) {
+	fmt.Printf("⚠️ [%s] %s de %s rejeitado: %v\n", node.ID, kind, peerID, err)
+	if err == errBadConsensusSignature {
+		node.penalizePeer(peerID, penaltyInvalidSignature, err.Error())
+	}
+}
+
+// runConsensusActions executa o que a máquina pediu, fora dos locks
+func (node *P2PNode) runConsensusActions(actions []bftAction) {
+	for _, action := range actions {
+		switch {
+		case action.proposal != nil:
+			p := action.proposal
+			fmt.Printf("📣 [%s] Proposta %.16s (altura %d, rodada %d)\n", node.ID, p.Block.Hash, p.Height, p.Round)
+			node.BroadcastToNetwork(MSG_CONSENSUS_REQUEST, p, "")
+		case action.vote != nil:
+			node.BroadcastToNetwork(MSG_CONSENSUS_VOTE, action.vote, "")
+		case action.timeout != nil:
+			timeout := action.timeout
+			node.spawn(func() {
+				if node.wait(timeout.after) {
+					node.consensusTimeout(timeout)
+				}
+			})
+		case action.commit != nil:
+			block := action.commit
+			if node.validateAndAddBlock(block) {
+				fmt.Printf("✅ [%s] Bloco %.16s decidido na altura %d (rodada %d, %d precommits)\n",
+					node.ID, block.Hash, block.Index, block.Commit.Round, len(block.Commit.Precommits))
+				node.AnnounceBlock(block, "")
+			}
+		case action.evidence != nil:
+			node.reportEquivocation(action.evidence)
+		}
+	}
+}
+
+func (node *P2PNode) consensusTimeout(timeout *bftTimeoutEvent) {
+	node.consensusMutex.Lock()
+	node.bft.onTimeout(timeout)
+	actions := node.bft.takeActions()
+	node.consensusMutex.Unlock()
+	node.runConsensusActions(actions)
+}
+
+// consensusBlockAdded é chamado para todo bloco novo na cadeia: o nó
+// publica a sua parte do beacon, a altura em curso fica obsoleta e, se
+// outros validadores já estão na seguinte, este nó entra nela
+func (node *P2PNode) consensusBlockAdded(index int) {
+	if !node.IsValidator || node.identity == nil {
+		return
+	}
+	node.participateInBeacon()
+	node.consensusMutex.Lock()
+	if node.bft.active && node.bft.height <= index {
+		node.bft.stop()
+	}
+	var actions []bftAction
+	if node.bft.hasFuture(index + 1) {
+		actions = node.enterHeightLocked(index + 1)
+	}
+	node.consensusMutex.Unlock()
+	node.runConsensusActions(actions)
+}
+
+// verifyBlockCommit confere o certificado com o conjunto da época do bloco
+// e as chaves registradas no estado da cadeia; sem as chaves de +2/3 do
+// poder o bloco é recusado, assim como o bloco cujo autor (quem recebe a
+// recompensa) não foi sorteado proponente até a rodada do certificado. Depois procura no certificado precommits
+// conflitantes com os que este nó recebeu.
+func (node *P2PNode) verifyBlockCommit(block *Token) error {
+	state := node.ChainState()
+	if block.Index != state.Height+1 {
+		return fmt.Errorf("certificado do bloco %d sobre o estado da altura %d", block.Index, state.Height)
+	}
+	set := state.consensusSet()
+	if set.size() == 0 || !set.hasQuorum(set.keyedPower()) {
+		return fmt.Errorf("certificado do bloco %d sem chaves registradas de +2/3 do poder", block.Index)
+	}
+	if err := verifyCommit(state.chainIDAt(block.Index), block, set); err != nil {
+		return err
+	}
+	if !set.proposedUpTo(block.Validator, block.Index, block.Commit.Round) {
+		return fmt.Errorf("bloco %d de %q, que não foi proponente até a rodada %d", block.Index, block.Validator, block.Commit.Round)
+	}
+
+	node.consensusMutex.Lock()
+	node.bft.checkCertificate(block.Commit)
+	actions := node.bft.takeActions()
+	node.consensusMutex.Unlock()
+	node.runConsensusActions(actions)
+	return nil
+}
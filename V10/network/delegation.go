@@ -0,0 +1,262 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Delegação de stake na cadeia. Quem não alcança o stake mínimo sozinho
+// delega saldo a um validador com uma transação "delegate": o valor sai do
+// saldo, fica travado e soma ao poder do validador a partir da próxima
+// época. O "undelegate" devolve o valor pela mesma fila de unbonding do
+// unstake (sacado depois com "withdraw") e o slashing por dupla assinatura
+// corta a mesma fração de cada delegação, inclusive da que está em
+// unbonding. A recompensa do bloco paga primeiro a comissão do validador
+// ("commission", definida pelo dono) e o resto é dividido na proporção do
+// stake próprio e de cada delegação; a parte de cada delegador fica
+// pendente e vai para o saldo quando ele retira toda a delegação.
+
+const (
+	TX_DELEGATE   = "delegate"   // From delega Amount do saldo ao validador To
+	TX_UNDELEGATE = "undelegate" // From retira Amount delegado a To (entra em unbonding)
+	TX_COMMISSION = "commission" // O dono do validador To define a comissão (Amount, em %)
+
+	defaultCommission = 10 // Comissão padrão do validador (%)
+	maxCommission     = 100
+)
+
+// Delegation é o stake de um delegador num validador
+type Delegation struct {
+	Delegator string `json:"delegator"`
+	Amount    int    `json:"amount"`
+	Rewards   int    `json:"rewards"` // Recompensas pendentes
+}
+
+// delegatedTo soma o stake delegado ao validador
+func (s *ChainState) delegatedTo(validator string) int {
+	total := 0
+	for _, d := range s.Delegations[validator] {
+		total += d.Amount
+	}
+	return total
+}
+
+// commissionOf é a comissão do validador, com o padrão para quem não definiu
+func (s *ChainState) commissionOf(validator string) int {
+	if commission, exists := s.Commission[validator]; exists {
+		return commission
+	}
+	return defaultCommission
+}
+
+// Delegators lista as delegações do validador em ordem de delegador
+func (s *ChainState) Delegators(validator string) []Delegation {
+	list := make([]Delegation, 0, len(s.Delegations[validator]))
+	for _, d := range s.Delegations[validator] {
+		list = append(list, *d)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Delegator < list[j].Delegator })
+	return list
+}
+
+func (s *ChainState) applyDelegate(tx *Transaction) error {
+	stake, exists := s.Stakes[tx.To]
+	if !exists {
+		return fmt.Errorf("%s não é validador", tx.To)
+	}
+	if tx.Amount <= 0 {
+		return fmt.Errorf("valor de delegação inválido: %d", tx.Amount)
+	}
+	if stake.Owner == tx.From {
+		return fmt.Errorf("o dono do validador %s usa stake, não delegação", tx.To)
+	}
+	if s.Jailed[tx.To] {
+		return fmt.Errorf("validador %s está preso", tx.To)
+	}
+	if s.Balances[tx.From] < tx.Amount {
+		return fmt.Errorf("saldo insuficiente para delegar: %d < %d", s.Balances[tx.From], tx.Amount)
+	}
+	delegations := s.Delegations[tx.To]
+	if delegations == nil {
+		delegations = make(map[string]*Delegation)
+		s.Delegations[tx.To] = delegations
+	}
+	d, exists := delegations[tx.From]
+	if !exists {
+		d = &Delegation{Delegator: tx.From}
+		delegations[tx.From] = d
+	}
+	s.Balances[tx.From] -= tx.Amount
+	d.Amount += tx.Amount
+	return nil
+}
+
+// applyUndelegate põe o valor retirado em unbonding; ao sair por completo o
+// delegador recebe as recompensas pendentes
+func (s *ChainState) applyUndelegate(tx *Transaction, height int) error {
+	d, exists := s.Delegations[tx.To][tx.From]
+	if !exists {
+		return fmt.Errorf("%s não delegou a %s", tx.From, tx.To)
+	}
+	if tx.Amount <= 0 || tx.Amount > d.Amount {
+		return fmt.Errorf("retirada de %d com %d delegados", tx.Amount, d.Amount)
+	}
+	d.Amount -= tx.Amount
+	if d.Amount == 0 {
+		s.removeDelegation(tx.To, tx.From)
+	}
+	s.Unbonding = append(s.Unbonding, UnbondingEntry{
+		Owner:         tx.From,
+		Validator:     tx.To,
+		Amount:        tx.Amount,
+		ReleaseHeight: height + s.UnbondingPeriod,
+	})
+	return nil
+}
+
+// removeDelegation apaga a delegação zerada e paga as recompensas pendentes
+func (s *ChainState) removeDelegation(validator, delegator string) {
+	d := s.Delegations[validator][delegator]
+	s.Balances[delegator] += d.Rewards
+	delete(s.Delegations[validator], delegator)
+	if len(s.Delegations[validator]) == 0 {
+		delete(s.Delegations, validator)
+	}
+}
+
+func (s *ChainState) applyCommission(tx *Transaction) error {
+	stake, exists := s.Stakes[tx.To]
+	if !exists || stake.Owner != tx.From {
+		return fmt.Errorf("%s não é dono do validador %s", tx.From, tx.To)
+	}
+	if tx.Amount < 0 || tx.Amount > maxCommission {
+		return fmt.Errorf("comissão deve estar entre 0 e %d%%", maxCommission)
+	}
+	s.Commission[tx.To] = tx.Amount
+	return nil
+}
+
+// distributeReward paga a recompensa do bloco: a comissão e a parte do
+// stake próprio vão para o saldo do dono do validador (a carteira que assina
+// as transações dele), a de cada delegador fica pendente; o arredondamento
+// fica com o dono. Sem stake registrado (cadeia PoW) o saldo é do próprio ID.
+func (s *ChainState) distributeReward(validator string, reward int) {
+	total := s.delegatedTo(validator)
+	recipient := validator
+	if stake, exists := s.Stakes[validator]; exists {
+		total += stake.Amount
+		if stake.Owner != "" {
+			recipient = stake.Owner
+		}
+	}
+	paid := 0
+	if total > 0 {
+		shared := reward - reward*s.commissionOf(validator)/100
+		for _, d := range s.Delegations[validator] {
+			share := shared * d.Amount / total
+			d.Rewards += share
+			paid += share
+		}
+	}
+	s.Balances[recipient] += reward - paid
+}
+
+// slashDelegations corta cada delegação ao validador e retorna o total
+func (s *ChainState) slashDelegations(validator string, cut func(int) int) int {
+	total := 0
+	for _, d := range s.Delegators(validator) {
+		slashed := cut(d.Amount)
+		s.Delegations[validator][d.Delegator].Amount -= slashed
+		total += slashed
+		if d.Amount == slashed {
+			s.removeDelegation(validator, d.Delegator)
+		}
+	}
+	return total
+}
+
+// === Integração com o nó ===
+
+// WalletAddress é o endereço da carteira do nó, derivado da chave de
+// identidade, usado nas transações assinadas pelo console
+func (node *P2PNode) WalletAddress() string {
+	if node.identity == nil {
+		return ""
+	}
+	address, _ := addressOf(encodePublicKey(&node.identity.key.PublicKey))
+	return address
+}
+
+// SubmitOwnerTx assina com a carteira do nó uma transação de transferência,
+// stake ou delegação, com o nonce seguinte ao da cadeia e ao das pendentes, e a
+// coloca no mempool
+func (node *P2PNode) SubmitOwnerTx(txType, to string, amount int) (*Transaction, error) {
+	from := node.WalletAddress()
+	if from == "" {
+		return nil, fmt.Errorf("nó sem identidade")
+	}
+	nonce := node.ChainState().Nonces[from]
+	node.mutex.RLock()
+	for _, pending := range node.PendingTxs {
+		if pending.From == from && pending.Nonce > nonce {
+			nonce = pending.Nonce
+		}
+	}
+	node.mutex.RUnlock()
+
+	tx := Transaction{Type: txType, From: from, To: to, Amount: amount, Timestamp: node.clock.Now(), Nonce: nonce + 1}
+	sum := sha256.Sum256(txSignBytes(&tx))
+	tx.ID = strings.ToUpper(txType) + "_" + hex.EncodeToString(sum[:16])
+	if err := signTx(node.identity.key, &tx); err != nil {
+		return nil, err
+	}
+	if err := node.checkStakingTx(&tx); err != nil {
+		return nil, err
+	}
+	node.mutex.Lock()
+	node.PendingTxs = append(node.PendingTxs, tx)
+	node.mutex.Unlock()
+	node.AnnounceTransaction(&tx, "")
+	return &tx, nil
+}
+
+// runDelegationCommand executa os comandos de delegação do console
+func (node *P2PNode) runDelegationCommand(args []string) (string, error) {
+	switch args[0] {
+	case "wallet":
+		address := node.WalletAddress()
+		return fmt.Sprintf("%s saldo %d", address, node.ChainState().Balances[address]), nil
+
+	case "delegators":
+		if len(args) != 2 {
+			return "", fmt.Errorf("uso: delegators <validador>")
+		}
+		state := node.ChainState()
+		own := 0
+		if stake, exists := state.Stakes[args[1]]; exists {
+			own = stake.Amount
+		}
+		var out strings.Builder
+		fmt.Fprintf(&out, "%s próprio %d, delegado %d, comissão %d%%", args[1], own, state.delegatedTo(args[1]), state.commissionOf(args[1]))
+		for _, d := range state.Delegators(args[1]) {
+			fmt.Fprintf(&out, "\n%s delegado %d, recompensas pendentes %d", d.Delegator, d.Amount, d.Rewards)
+		}
+		return out.String(), nil
+	}
+
+	if len(args) != 3 {
+		return "", fmt.Errorf("uso: %s <validador> <valor>", args[0])
+	}
+	var amount int
+	if _, err := fmt.Sscanf(args[2], "%d", &amount); err != nil {
+		return "", fmt.Errorf("valor inválido: %s", args[2])
+	}
+	tx, err := node.SubmitOwnerTx(args[0], args[1], amount)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s %s enviada (nonce %d)", tx.Type, tx.ID, tx.Nonce), nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDelegationLocksBalanceAndCountsTowardsPower(t *testing.T) {
+	state := newChainState(&StakingGenesis{
+		UnbondingPeriod: 5,
+		Balances:        map[string]int{addr("bia"): 20, addr("alice"): 20},
+		Validators:      []ValidatorStake{{ID: "node-A", Owner: addr("alice"), Amount: 5}},
+	}, "")
+	if len(state.EpochValidators) != 0 {
+		t.Fatal("validador abaixo do mínimo no conjunto")
+	}
+
+	for name, tx := range map[string]Transaction{
+		"do dono":           stakingTx("d1", TX_DELEGATE, "alice", "node-A", 5),
+		"acima do saldo":    stakingTx("d2", TX_DELEGATE, "bia", "node-A", 21),
+		"a quem não valida": stakingTx("d3", TX_DELEGATE, "bia", "node-X", 5),
+	} {
+		if err := state.applyTx(&tx, 1); err == nil {
+			t.Fatalf("delegação %s aceita", name)
+		}
+	}
+	delegate := stakingTx("d4", TX_DELEGATE, "bia", "node-A", 10)
+	if err := state.applyTx(&delegate, 1); err != nil {
+		t.Fatal(err)
+	}
+	if state.Balances[addr("bia")] != 10 {
+		t.Fatalf("saldo não travado: %d", state.Balances[addr("bia")])
+	}
+
+	// O delegado soma ao poder a partir do retrato do fim da época
+	state.snapshotValidators()
+	if len(state.EpochValidators) != 1 || state.EpochValidators[0].Amount != 15 {
+		t.Fatalf("conjunto com a delegação: %+v", state.EpochValidators)
+	}
+
+	// A retirada passa pelo unbonding, como o unstake
+	undelegate := stakingTx("u1", TX_UNDELEGATE, "bia", "node-A", 10)
+	if err := state.applyTx(&undelegate, 2); err != nil {
+		t.Fatal(err)
+	}
+	if state.Balances[addr("bia")] != 10 || len(state.Delegators("node-A")) != 0 {
+		t.Fatalf("saldo %d, delegações %v", state.Balances[addr("bia")], state.Delegators("node-A"))
+	}
+	early := stakingTx("w1", TX_WITHDRAW, "bia", addr("bia"), 10)
+	if err := state.applyTx(&early, 6); err == nil {
+		t.Fatal("saque da delegação antes do fim do unbonding aceito")
+	}
+	withdraw := stakingTx("w2", TX_WITHDRAW, "bia", addr("bia"), 10)
+	if err := state.applyTx(&withdraw, 7); err != nil || state.Balances[addr("bia")] != 20 {
+		t.Fatalf("saque da delegação: %v, saldo %d", err, state.Balances[addr("bia")])
+	}
+}
+
+func TestRewardsAndSlashingAreSharedWithDelegators(t *testing.T) {
+	state := newChainState(&StakingGenesis{
+		Balances:   map[string]int{addr("ana"): 40, addr("bia"): 20},
+		Validators: []ValidatorStake{{ID: "node-A", Owner: addr("alice"), Amount: 40}},
+	}, "")
+	foreign := stakingTx("c1", TX_COMMISSION, "ana", "node-A", 0)
+	if err := state.applyTx(&foreign, 1); err == nil {
+		t.Fatal("comissão definida por quem não é dono aceita")
+	}
+	commission := stakingTx("c2", TX_COMMISSION, "alice", "node-A", 20)
+	if err := state.applyTx(&commission, 1); err != nil {
+		t.Fatal(err)
+	}
+	for _, tx := range []Transaction{stakingTx("d1", TX_DELEGATE, "ana", "node-A", 40), stakingTx("d2", TX_DELEGATE, "bia", "node-A", 20)} {
+		if err := state.applyTx(&tx, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 100 de recompensa: 20 de comissão, 80 divididos por 40/40/20 do stake de 100
+	state.distributeReward("node-A", 100)
+	ana, bia := state.Delegations["node-A"][addr("ana")], state.Delegations["node-A"][addr("bia")]
+	if state.Balances[addr("alice")] != 20+32 || state.Balances["node-A"] != 0 || ana.Rewards != 32 || bia.Rewards != 16 {
+		t.Fatalf("dono %d, ana %d, bia %d", state.Balances[addr("alice")], ana.Rewards, bia.Rewards)
+	}
+
+	// O slashing corta a mesma fração do stake próprio e de cada delegação
+	if slashed := state.slash("node-A", 10); slashed != 10 {
+		t.Fatalf("corte de %d", slashed)
+	}
+	if state.Stakes["node-A"].Amount != 36 || ana.Amount != 36 || bia.Amount != 18 {
+		t.Fatalf("após o corte: próprio %d, ana %d, bia %d", state.Stakes["node-A"].Amount, ana.Amount, bia.Amount)
+	}
+
+	// Ao sair por completo o delegador recebe as recompensas pendentes
+	undelegate := stakingTx("u1", TX_UNDELEGATE, "ana", "node-A", 36)
+	if err := state.applyTx(&undelegate, 2); err != nil || state.Balances[addr("ana")] != 32 {
+		t.Fatalf("recompensas pagas %d de 32: %v", state.Balances[addr("ana")], err)
+	}
+}
+
+func TestConsoleDelegatesWithNodeWallet(t *testing.T) {
+	node := newTestNode(t, "node-A")
+	node.stakingGenesis = &StakingGenesis{
+		Balances:   map[string]int{node.WalletAddress(): 50},
+		Validators: []ValidatorStake{{ID: "node-A", Owner: addr("alice"), Amount: 100, PubKey: encodePublicKey(&node.identity.key.PublicKey)}},
+	}
+
+	if _, err := node.RunAdminCommand("delegate node-A 60"); err == nil {
+		t.Fatal("delegação acima do saldo enviada")
+	}
+	if _, err := node.RunAdminCommand("delegate node-A 20"); err != nil {
+		t.Fatal(err)
+	}
+	node.mutex.RLock()
+	pending := append([]Transaction(nil), node.PendingTxs...)
+	node.mutex.RUnlock()
+	if len(pending) != 1 || !NewTransactionValidator().VerifySignature(&pending[0]) {
+		t.Fatalf("transação assinada não entrou no mempool: %+v", pending)
+	}
+
+	block := testBlock(1, "")
+	block.Transactions = pending
+	commitBlock(t, node, &block)
+	if !node.validateAndAddBlock(&block) {
+		t.Fatal("bloco com a delegação rejeitado")
+	}
+	out, err := node.RunAdminCommand("delegators node-A")
+	if err != nil || !strings.Contains(out, node.WalletAddress()+" delegado 20") {
+		t.Fatalf("delegators: %q, %v", out, err)
+	}
+}
+
+func TestProposerMintsRewardToValidatorOwner(t *testing.T) {
+	node := newTestNode(t, "node-A")
+	node.stakingGenesis = &StakingGenesis{
+		Validators: []ValidatorStake{{ID: "node-A", Owner: node.WalletAddress(), Amount: 100, PubKey: encodePublicKey(&node.identity.key.PublicKey)}},
+	}
+	node.mutex.Lock()
+	node.PendingTxs = append(node.PendingTxs, Transaction{ID: "r-mempool", Type: "mining_reward", From: "SYSTEM", To: "node-A", Amount: 1, Signature: "SYSTEM_SIGNATURE"})
+	node.mutex.Unlock()
+
+	block := node.buildProposalBlock(1)
+	if len(block.Transactions) != 1 || block.Transactions[0].ID != "reward_1_node-A" {
+		t.Fatalf("transações do bloco proposto: %+v", block.Transactions)
+	}
+	commitBlock(t, node, block)
+	if !node.validateAndAddBlock(block) {
+		t.Fatal("bloco com a recompensa cunhada rejeitado")
+	}
+
+	// A carteira do nó recebe a recompensa e pode gastá-la
+	if got := node.ChainState().Balances[node.WalletAddress()]; got != maxBlockReward {
+		t.Fatalf("saldo da carteira do dono: %d", got)
+	}
+	if _, err := node.SubmitOwnerTx("transfer", addr("bob"), maxBlockReward); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPoolAcceptsDelegationAndBeaconTypes(t *testing.T) {
+	pool := NewTransactionPool()
+	beacon := Transaction{ID: "rc", Type: TX_RANDAO_COMMIT, From: "node-A", To: "node-A", Timestamp: time.Now(), Randao: randaoCommitment("node-A", "s", 0)}
+	if err := signTx(walletKey("node-A"), &beacon); err != nil {
+		t.Fatal(err)
+	}
+	for _, tx := range []Transaction{
+		stakingTx("pd", TX_DELEGATE, "bia", "node-A", 10),
+		stakingTx("pu", TX_UNDELEGATE, "bia", "node-A", 10),
+		stakingTx("pc", TX_COMMISSION, "alice", "node-A", 0),
+		beacon,
+	} {
+		tx := tx
+		if err := pool.AddTransaction(&tx); err != nil {
+			t.Fatalf("%s recusada: %v", tx.Type, err)
+		}
+	}
+	over := stakingTx("px", TX_COMMISSION, "alice", "node-A", maxCommission+1)
+	if err := pool.AddTransaction(&over); err == nil {
+		t.Fatal("comissão acima de 100% aceita")
+	}
+}
+
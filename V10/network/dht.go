@@ -1,10 +1,13 @@
 package main
 
 import (
+	"bytes"
+	"crypto/rand"
 	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"net"
+	"math/bits"
 	"os"
 	"path/filepath"
 	"sort"
@@ -12,20 +15,115 @@ import (
 	"time"
 )
 
+// Parâmetros Kademlia
+const (
+	dhtIDBytes         = sha1.Size // IDs de 160 bits
+	dhtIDBits          = dhtIDBytes * 8
+	dhtBucketSize      = 20             // k: contatos por bucket
+	dhtAlpha           = 3              // Consultas paralelas por rodada de busca
+	dhtRefreshInterval = time.Hour      // Buckets sem atividade são atualizados com uma busca
+	dhtContactTTL      = 24 * time.Hour // Contatos sem resposta por mais tempo são removidos
+	dhtValueTTL        = 24 * time.Hour // Validade dos valores recebidos via STORE
+	dhtMaxValueSize    = 1024           // Bytes por valor
+	dhtMaxValues       = 10000          // Valores guardados por nó
+)
+
+// dhtID é a posição de 160 bits de um nó ou chave no espaço Kademlia
+type dhtID [dhtIDBytes]byte
+
+// dhtKey deriva o ID Kademlia de um ID de nó ou chave
+func dhtKey(s string) dhtID {
+	return dhtID(sha1.Sum([]byte(s)))
+}
+
+func (id dhtID) xor(other dhtID) dhtID {
+	var d dhtID
+	for i := range id {
+		d[i] = id[i] ^ other[i]
+	}
+	return d
+}
+
+func (id dhtID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func parseDHTID(s string) (dhtID, error) {
+	var id dhtID
+	raw, err := hex.DecodeString(s)
+	if err != nil || len(raw) != dhtIDBytes {
+		return id, fmt.Errorf("ID de DHT inválido: %q", s)
+	}
+	copy(id[:], raw)
+	return id, nil
+}
+
+// bucketIndex retorna o bucket do contato: a posição do bit mais
+// significativo da distância XOR (bucket i guarda distâncias em [2^i, 2^(i+1)))
+func bucketIndex(self, other dhtID) int {
+	d := self.xor(other)
+	for i, b := range d {
+		if b != 0 {
+			return dhtIDBits - 1 - (i*8 + bits.LeadingZeros8(b))
+		}
+	}
+	return -1 // O próprio nó
+}
+
+// closerTo informa se a está mais perto do alvo que b
+func closerTo(target, a, b dhtID) bool {
+	da, db := target.xor(a), target.xor(b)
+	return bytes.Compare(da[:], db[:]) < 0
+}
+
+// randomIDInBucket sorteia um ID que cairia no bucket i, para a atualização do bucket
+func randomIDInBucket(self dhtID, i int) dhtID {
+	var d dhtID
+	rand.Read(d[:])
+
+	byteIndex := dhtIDBytes - 1 - i/8
+	bit := uint(i % 8)
+	for j := 0; j < byteIndex; j++ {
+		d[j] = 0
+	}
+	d[byteIndex] &= byte(1<<bit) - 1
+	d[byteIndex] |= 1 << bit
+	return self.xor(d)
+}
+
 // DHTNode representa um peer na DHT
 type DHTNode struct {
 	ID       string    `json:"id"`
 	Address  string    `json:"address"`
 	Port     int       `json:"port"`
 	LastSeen time.Time `json:"last_seen"`
+
+	key dhtID
+}
+
+// kBucket guarda até k contatos, do visto há mais tempo (início) ao mais recente (fim)
+type kBucket struct {
+	nodes       []*DHTNode
+	lastChanged time.Time
+	pinging     bool // Ping de despejo em andamento
+}
+
+type dhtValue struct {
+	Value   string    `json:"value"`
+	Expires time.Time `json:"expires"`
 }
 
-// DHTTable é a tabela distribuída de peers
+// DHTTable é a tabela de roteamento Kademlia do nó
 type DHTTable struct {
-	mtx   sync.RWMutex
-	nodes map[string]*DHTNode // key = nodeID
-	self  *DHTNode
-	file  string
+	mtx     sync.RWMutex
+	self    *DHTNode
+	buckets [dhtIDBits]*kBucket
+	values  map[dhtID]dhtValue
+	file    string
+
+	// pinger verifica se o contato mais antigo de um bucket cheio ainda
+	// responde antes de trocá-lo por um novo (ver P2PNode.dhtPing)
+	pinger func(*DHTNode) bool
 }
 
 // Novo DHTTable
@@ -35,124 +133,251 @@ func NewDHTTable(selfID, address string, port int, dataDir string) *DHTTable {
 		Address:  address,
 		Port:     port,
 		LastSeen: time.Now(),
+		key:      dhtKey(selfID),
 	}
 	dht := &DHTTable{
-		nodes: make(map[string]*DHTNode),
-		self:  self,
-		file:  filepath.Join(dataDir, "dht.json"),
+		self:   self,
+		values: make(map[dhtID]dhtValue),
+		file:   filepath.Join(dataDir, "dht.json"),
+	}
+	for i := range dht.buckets {
+		dht.buckets[i] = &kBucket{lastChanged: time.Now()}
 	}
-	dht.nodes[selfID] = self
 	dht.load()
 	return dht
 }
 
-// Salva DHT em disco
+// Salva os contatos da DHT em disco
 func (dht *DHTTable) save() {
 	dht.mtx.RLock()
-	defer dht.mtx.RUnlock()
-	nodes := make([]*DHTNode, 0, len(dht.nodes))
-	for _, n := range dht.nodes {
-		nodes = append(nodes, n)
+	nodes := make([]*DHTNode, 0)
+	for _, bucket := range dht.buckets {
+		nodes = append(nodes, bucket.nodes...)
 	}
-	file, err := os.Create(dht.file)
-	if err == nil {
-		defer file.Close()
-		json.NewEncoder(file).Encode(nodes)
+	data, err := json.MarshalIndent(nodes, "", "  ")
+	dht.mtx.RUnlock()
+	if err != nil {
+		return
+	}
+
+	tempFile := dht.file + ".tmp"
+	if err := os.WriteFile(tempFile, data, 0600); err != nil {
+		return
 	}
+	os.Rename(tempFile, dht.file)
 }
 
-// Carrega DHT do disco
+// Carrega os contatos salvos; a ordem LRU é refeita pelo LastSeen
 func (dht *DHTTable) load() {
-	file, err := os.Open(dht.file)
+	data, err := os.ReadFile(dht.file)
 	if err != nil {
 		return
 	}
-	defer file.Close()
 	var nodes []*DHTNode
-	if err := json.NewDecoder(file).Decode(&nodes); err == nil {
-		for _, n := range nodes {
-			dht.nodes[n.ID] = n
+	if err := json.Unmarshal(data, &nodes); err != nil {
+		return
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].LastSeen.Before(nodes[j].LastSeen) })
+
+	for _, n := range nodes {
+		n.key = dhtKey(n.ID)
+		index := bucketIndex(dht.self.key, n.key)
+		if index < 0 || n.Port <= 0 {
+			continue
+		}
+		bucket := dht.buckets[index]
+		if len(bucket.nodes) < dhtBucketSize {
+			bucket.nodes = append(bucket.nodes, n)
 		}
 	}
 }
 
-// Adiciona/atualiza peer na DHT
-func (dht *DHTTable) AddOrUpdate(node *DHTNode) {
+// Update registra um contato que acabou de se comunicar conosco. Com o
+// bucket cheio, o contato mais antigo é pingado: se responder, fica e o novo
+// é descartado; se não, é despejado em favor do novo.
+func (dht *DHTTable) Update(contact *DHTNode) {
+	if contact.ID == "" || contact.Port <= 0 {
+		return
+	}
+	contact.key = dhtKey(contact.ID)
+	index := bucketIndex(dht.self.key, contact.key)
+	if index < 0 {
+		return
+	}
+
 	dht.mtx.Lock()
-	defer dht.mtx.Unlock()
-	node.LastSeen = time.Now()
-	dht.nodes[node.ID] = node
-	dht.save()
+	bucket := dht.buckets[index]
+	bucket.lastChanged = time.Now()
+
+	for i, n := range bucket.nodes {
+		if n.ID == contact.ID {
+			n.Address, n.Port, n.LastSeen = contact.Address, contact.Port, time.Now()
+			bucket.nodes = append(append(bucket.nodes[:i:i], bucket.nodes[i+1:]...), n)
+			dht.mtx.Unlock()
+			return
+		}
+	}
+
+	entry := &DHTNode{ID: contact.ID, Address: contact.Address, Port: contact.Port, LastSeen: time.Now(), key: contact.key}
+	if len(bucket.nodes) < dhtBucketSize {
+		bucket.nodes = append(bucket.nodes, entry)
+		dht.mtx.Unlock()
+		return
+	}
+
+	// Bucket cheio: sem pinger (ou já pingando) prefere os contatos antigos
+	if dht.pinger == nil || bucket.pinging {
+		dht.mtx.Unlock()
+		return
+	}
+	bucket.pinging = true
+	oldest := bucket.nodes[0]
+	dht.mtx.Unlock()
+
+	go dht.evictIfDead(index, oldest, entry)
 }
 
-// Remove peer inativo
-func (dht *DHTTable) Cleanup() {
+// evictIfDead pinga o contato mais antigo e o troca pelo candidato se não responder
+func (dht *DHTTable) evictIfDead(index int, oldest, candidate *DHTNode) {
+	alive := dht.pinger(oldest)
+
 	dht.mtx.Lock()
 	defer dht.mtx.Unlock()
-	now := time.Now()
-	for id, n := range dht.nodes {
-		if id == dht.self.ID {
+
+	bucket := dht.buckets[index]
+	bucket.pinging = false
+	for i, n := range bucket.nodes {
+		if n != oldest {
 			continue
 		}
-		if now.Sub(n.LastSeen) > 24*time.Hour {
-			delete(dht.nodes, id)
+		bucket.nodes = append(bucket.nodes[:i:i], bucket.nodes[i+1:]...)
+		if alive {
+			oldest.LastSeen = time.Now()
+			bucket.nodes = append(bucket.nodes, oldest)
+		} else {
+			fmt.Printf("🗑️ DHT: contato %s não respondeu, substituído por %s\n", oldest.ID, candidate.ID)
+			bucket.nodes = append(bucket.nodes, candidate)
 		}
+		bucket.lastChanged = time.Now()
+		return
 	}
-	dht.save()
 }
 
-// Busca peers próximos (Kademlia XOR distance)
-func (dht *DHTTable) FindClosest(targetID string, max int) []*DHTNode {
+// Remove retira um contato que falhou em responder
+func (dht *DHTTable) Remove(nodeID string) {
+	index := bucketIndex(dht.self.key, dhtKey(nodeID))
+	if index < 0 {
+		return
+	}
+
+	dht.mtx.Lock()
+	defer dht.mtx.Unlock()
+
+	bucket := dht.buckets[index]
+	for i, n := range bucket.nodes {
+		if n.ID == nodeID {
+			bucket.nodes = append(bucket.nodes[:i:i], bucket.nodes[i+1:]...)
+			return
+		}
+	}
+}
+
+// Len retorna o número de contatos na tabela
+func (dht *DHTTable) Len() int {
 	dht.mtx.RLock()
 	defer dht.mtx.RUnlock()
-	type distNode struct {
-		dist uint64
-		node *DHTNode
+
+	total := 0
+	for _, bucket := range dht.buckets {
+		total += len(bucket.nodes)
 	}
-	var list []distNode
-	target := sha1.Sum([]byte(targetID))
-	for _, n := range dht.nodes {
-		idHash := sha1.Sum([]byte(n.ID))
-		dist := xorDistance(target[:], idHash[:])
-		list = append(list, distNode{dist, n})
+	return total
+}
+
+// Remove contatos inativos e valores expirados
+func (dht *DHTTable) Cleanup() {
+	dht.mtx.Lock()
+	now := time.Now()
+	for _, bucket := range dht.buckets {
+		alive := bucket.nodes[:0]
+		for _, n := range bucket.nodes {
+			if now.Sub(n.LastSeen) <= dhtContactTTL {
+				alive = append(alive, n)
+			}
+		}
+		bucket.nodes = alive
 	}
-	// Ordena por distância
-	sort.Slice(list, func(i, j int) bool { return list[i].dist < list[j].dist })
-	result := make([]*DHTNode, 0, max)
-	for i := 0; i < len(list) && i < max; i++ {
-		result = append(result, list[i].node)
+	for key, value := range dht.values {
+		if now.After(value.Expires) {
+			delete(dht.values, key)
+		}
 	}
-	return result
+	dht.mtx.Unlock()
+
+	dht.save()
 }
 
-func xorDistance(a, b []byte) uint64 {
-	var d uint64
-	for i := 0; i < len(a) && i < 8; i++ {
-		d = (d << 8) | uint64(a[i]^b[i])
+// closest retorna até max contatos ordenados pela distância XOR ao alvo
+func (dht *DHTTable) closest(target dhtID, max int) []*DHTNode {
+	dht.mtx.RLock()
+	defer dht.mtx.RUnlock()
+
+	var list []*DHTNode
+	for _, bucket := range dht.buckets {
+		for _, n := range bucket.nodes {
+			copied := *n
+			list = append(list, &copied)
+		}
 	}
-	return d
+	sort.Slice(list, func(i, j int) bool { return closerTo(target, list[i].key, list[j].key) })
+	if len(list) > max {
+		list = list[:max]
+	}
+	return list
 }
 
-// Broadcast presence to DHT peers
-func (dht *DHTTable) Announce(node *P2PNode) {
-	peers := dht.FindClosest(dht.self.ID, 8)
-	for _, peer := range peers {
-		if peer.ID == dht.self.ID {
-			continue
+// Busca peers próximos (Kademlia XOR distance)
+func (dht *DHTTable) FindClosest(targetID string, max int) []*DHTNode {
+	return dht.closest(dhtKey(targetID), max)
+}
+
+// staleBuckets lista os buckets com contatos e sem atividade há mais de dhtRefreshInterval
+func (dht *DHTTable) staleBuckets() []int {
+	dht.mtx.RLock()
+	defer dht.mtx.RUnlock()
+
+	var stale []int
+	for i, bucket := range dht.buckets {
+		if len(bucket.nodes) > 0 && time.Since(bucket.lastChanged) > dhtRefreshInterval {
+			stale = append(stale, i)
 		}
-		go sendDHTAnnounce(peer, dht.self)
 	}
+	return stale
 }
 
-func sendDHTAnnounce(peer *DHTNode, self *DHTNode) {
-	conn, err := net.DialTimeout("tcp", net.JoinHostPort(peer.Address, fmt.Sprintf("%d", peer.Port)), 2*time.Second)
-	if err != nil {
-		return
+// storeValue guarda um valor recebido via STORE
+func (dht *DHTTable) storeValue(key dhtID, value string) error {
+	if len(value) > dhtMaxValueSize {
+		return fmt.Errorf("valor com %d bytes excede o limite de %d", len(value), dhtMaxValueSize)
+	}
+
+	dht.mtx.Lock()
+	defer dht.mtx.Unlock()
+
+	if _, exists := dht.values[key]; !exists && len(dht.values) >= dhtMaxValues {
+		return fmt.Errorf("armazenamento da DHT cheio")
 	}
-	defer conn.Close()
-	msg := map[string]interface{}{
-		"type": "dht_announce",
-		"node": self,
+	dht.values[key] = dhtValue{Value: value, Expires: time.Now().Add(dhtValueTTL)}
+	return nil
+}
+
+func (dht *DHTTable) lookupValue(key dhtID) (string, bool) {
+	dht.mtx.RLock()
+	defer dht.mtx.RUnlock()
+
+	value, exists := dht.values[key]
+	if !exists || time.Now().After(value.Expires) {
+		return "", false
 	}
-	json.NewEncoder(conn).Encode(msg)
+	return value.Value, true
 }
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Mensagens Kademlia sobre o transporte P2P
+const (
+	MSG_DHT_PING       = "dht_ping"
+	MSG_DHT_PONG       = "dht_pong"
+	MSG_DHT_FIND_NODE  = "dht_find_node"
+	MSG_DHT_FIND_VALUE = "dht_find_value"
+	MSG_DHT_NODES      = "dht_nodes" // Resposta a FIND_NODE e FIND_VALUE
+	MSG_DHT_STORE      = "dht_store"
+	MSG_DHT_STORED     = "dht_stored"
+)
+
+const (
+	dhtRPCTimeout          = 5 * time.Second
+	dhtMaintenanceInterval = 10 * time.Minute
+)
+
+// dhtRequest é o corpo das requisições DHT
+type dhtRequest struct {
+	RPCID  string `json:"rpc_id"`
+	Target string `json:"target,omitempty"` // ID de 160 bits em hex (FIND_NODE/FIND_VALUE/STORE)
+	Value  string `json:"value,omitempty"`  // STORE
+}
+
+// dhtReply é o corpo das respostas DHT
+type dhtReply struct {
+	RPCID string     `json:"rpc_id"`
+	Nodes []*DHTNode `json:"nodes,omitempty"`
+	Value string     `json:"value,omitempty"`
+	Found bool       `json:"found,omitempty"`
+	Error string     `json:"error,omitempty"`
+}
+
+// dhtState correlaciona respostas às requisições em andamento
+type dhtState struct {
+	mtx     sync.Mutex
+	pending map[string]chan *dhtReply
+}
+
+func newRPCID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// dhtContactFromPeer converte um peer conectado em contato da DHT
+func (node *P2PNode) dhtContactFromPeer(peerID string) *DHTNode {
+	node.mutex.RLock()
+	defer node.mutex.RUnlock()
+
+	peer, exists := node.Peers[peerID]
+	if !exists || peer.Port <= 0 {
+		return nil
+	}
+	return &DHTNode{ID: peer.ID, Address: peer.Address, Port: peer.Port}
+}
+
+// dhtSeen atualiza a tabela com o peer que acabou de falar conosco
+func (node *P2PNode) dhtSeen(peerID string) {
+	if node.dht == nil {
+		return
+	}
+	if contact := node.dhtContactFromPeer(peerID); contact != nil {
+		node.dht.Update(contact)
+	}
+}
+
+// ensureDHTConnection conecta ao contato se ainda não houver conexão
+func (node *P2PNode) ensureDHTConnection(contact *DHTNode) error {
+	connected := func() bool {
+		node.mutex.RLock()
+		defer node.mutex.RUnlock()
+		peer, exists := node.Peers[contact.ID]
+		return exists && peer.conn != nil
+	}
+	if connected() {
+		return nil
+	}
+
+	err := node.connectToPeer(&Peer{ID: contact.ID, Address: contact.Address, Port: contact.Port})
+	if err != nil && !connected() {
+		return err
+	}
+	return nil
+}
+
+// dhtCall envia uma requisição ao contato e aguarda a resposta
+func (node *P2PNode) dhtCall(contact *DHTNode, msgType string, request dhtRequest) (*dhtReply, error) {
+	if err := node.ensureDHTConnection(contact); err != nil {
+		return nil, err
+	}
+
+	request.RPCID = newRPCID()
+	replies := make(chan *dhtReply, 1)
+	node.dhtRPC.mtx.Lock()
+	node.dhtRPC.pending[request.RPCID] = replies
+	node.dhtRPC.mtx.Unlock()
+	defer func() {
+		node.dhtRPC.mtx.Lock()
+		delete(node.dhtRPC.pending, request.RPCID)
+		node.dhtRPC.mtx.Unlock()
+	}()
+
+	msg := &NetworkMessage{Type: msgType, Data: &request, Timestamp: time.Now()}
+	if err := node.sendToPeer(contact.ID, msg); err != nil {
+		return nil, err
+	}
+
+	select {
+	case reply := <-replies:
+		if reply.Error != "" {
+			return nil, fmt.Errorf("%s", reply.Error)
+		}
+		return reply, nil
+	case <-node.clock.After(dhtRPCTimeout):
+		return nil, fmt.Errorf("%s sem resposta de %s", msgType, contact.ID)
+	case <-node.ctx.Done():
+		return nil, errNodeStopping
+	}
+}
+
+// dhtPing é o pinger da tabela: confirma se o contato ainda responde
+func (node *P2PNode) dhtPing(contact *DHTNode) bool {
+	_, err := node.dhtCall(contact, MSG_DHT_PING, dhtRequest{})
+	return err == nil
+}
+
+// handleDHTRequest responde PING, FIND_NODE, FIND_VALUE e STORE
+func (node *P2PNode) handleDHTRequest(msg *NetworkMessage) *NetworkMessage {
+	if node.dht == nil {
+		return nil
+	}
+	request, ok := msg.Data.(*dhtRequest)
+	if !ok || request.RPCID == "" {
+		node.penalizePeer(msg.From, penaltyBehavior, "requisição DHT malformada")
+		return nil
+	}
+	node.dhtSeen(msg.From)
+
+	reply := dhtReply{RPCID: request.RPCID}
+	replyType := MSG_DHT_NODES
+
+	switch msg.Type {
+	case MSG_DHT_PING:
+		replyType = MSG_DHT_PONG
+
+	case MSG_DHT_FIND_NODE, MSG_DHT_FIND_VALUE, MSG_DHT_STORE:
+		target, err := parseDHTID(request.Target)
+		if err != nil {
+			node.penalizePeer(msg.From, penaltyBehavior, err.Error())
+			return nil
+		}
+
+		switch msg.Type {
+		case MSG_DHT_STORE:
+			replyType = MSG_DHT_STORED
+			if err := node.dht.storeValue(target, request.Value); err != nil {
+				reply.Error = err.Error()
+			}
+		case MSG_DHT_FIND_VALUE:
+			if value, found := node.dht.lookupValue(target); found {
+				reply.Value, reply.Found = value, true
+				break
+			}
+			fallthrough
+		default:
+			reply.Nodes = node.dht.closest(target, dhtBucketSize)
+		}
+	}
+
+	return &NetworkMessage{
+		Type:      replyType,
+		From:      node.ID,
+		To:        msg.From,
+		Data:      &reply,
+		Timestamp: time.Now(),
+	}
+}
+
+// handleDHTReply entrega a resposta à chamada que a aguarda
+func (node *P2PNode) handleDHTReply(msg *NetworkMessage) *NetworkMessage {
+	reply, ok := msg.Data.(*dhtReply)
+	if !ok {
+		return nil
+	}
+	node.dhtSeen(msg.From)
+
+	node.dhtRPC.mtx.Lock()
+	replies, exists := node.dhtRPC.pending[reply.RPCID]
+	node.dhtRPC.mtx.Unlock()
+	if !exists {
+		node.penalizePeer(msg.From, penaltyUnsolicited, "resposta DHT não solicitada")
+		return nil
+	}
+
+	select {
+	case replies <- reply:
+	default:
+	}
+	return nil
+}
+
+// dhtLookup faz a busca iterativa Kademlia: consulta até alpha contatos por
+// rodada, sempre os mais próximos ainda não consultados, até que os k mais
+// próximos conhecidos tenham respondido. Com findValue, para ao achar o valor.
+func (node *P2PNode) dhtLookup(target dhtID, findValue bool) ([]*DHTNode, string, bool) {
+	shortlist := node.dht.closest(target, dhtBucketSize)
+	known := map[string]bool{node.ID: true}
+	for _, n := range shortlist {
+		known[n.ID] = true
+	}
+	queried := map[string]bool{}
+	responded := map[string]bool{}
+
+	msgType := MSG_DHT_FIND_NODE
+	if findValue {
+		msgType = MSG_DHT_FIND_VALUE
+	}
+
+	type result struct {
+		contact *DHTNode
+		reply   *dhtReply
+		err     error
+	}
+
+	for {
+		var round []*DHTNode
+		for _, n := range shortlist {
+			if !queried[n.ID] {
+				round = append(round, n)
+				if len(round) == dhtAlpha {
+					break
+				}
+			}
+		}
+		if len(round) == 0 {
+			break
+		}
+
+		results := make(chan result, len(round))
+		for _, contact := range round {
+			queried[contact.ID] = true
+			go func(contact *DHTNode) {
+				reply, err := node.dhtCall(contact, msgType, dhtRequest{Target: target.String()})
+				results <- result{contact, reply, err}
+			}(contact)
+		}
+
+		for range round {
+			r := <-results
+			if r.err != nil {
+				node.dht.Remove(r.contact.ID)
+				continue
+			}
+			responded[r.contact.ID] = true
+			if r.reply.Found {
+				return nil, r.reply.Value, true
+			}
+			for _, n := range r.reply.Nodes {
+				if n == nil || known[n.ID] || n.Port <= 0 {
+					continue
+				}
+				known[n.ID] = true
+				n.key = dhtKey(n.ID)
+				shortlist = append(shortlist, n)
+			}
+		}
+
+		// Mantém só os k mais próximos que não falharam
+		alive := shortlist[:0]
+		for _, n := range shortlist {
+			if !queried[n.ID] || responded[n.ID] {
+				alive = append(alive, n)
+			}
+		}
+		shortlist = alive
+		sort.Slice(shortlist, func(i, j int) bool { return closerTo(target, shortlist[i].key, shortlist[j].key) })
+		if len(shortlist) > dhtBucketSize {
+			shortlist = shortlist[:dhtBucketSize]
+		}
+	}
+	return shortlist, "", false
+}
+
+// DHTLookup retorna os nós mais próximos do ID informado
+func (node *P2PNode) DHTLookup(targetID string) []*DHTNode {
+	if node.dht == nil {
+		return nil
+	}
+	nodes, _, _ := node.dhtLookup(dhtKey(targetID), false)
+	return nodes
+}
+
+// DHTDiscoverPeers busca o próprio ID: além de achar os vizinhos,
+// anuncia o nó a todos que estão no caminho (entrada na rede Kademlia)
+func (node *P2PNode) DHTDiscoverPeers() []*DHTNode {
+	return node.DHTLookup(node.ID)
+}
+
+// DHTStore grava o valor nos k nós mais próximos da chave.
+// Retorna quantos nós confirmaram.
+func (node *P2PNode) DHTStore(key, value string) int {
+	if node.dht == nil {
+		return 0
+	}
+	target := dhtKey(key)
+	stored := 0
+	if node.dht.storeValue(target, value) == nil {
+		stored++
+	}
+
+	nodes, _, _ := node.dhtLookup(target, false)
+	for _, contact := range nodes {
+		if _, err := node.dhtCall(contact, MSG_DHT_STORE, dhtRequest{Target: target.String(), Value: value}); err == nil {
+			stored++
+		}
+	}
+	return stored
+}
+
+// DHTFindValue procura a chave localmente e depois na rede
+func (node *P2PNode) DHTFindValue(key string) (string, bool) {
+	if node.dht == nil {
+		return "", false
+	}
+	target := dhtKey(key)
+	if value, found := node.dht.lookupValue(target); found {
+		return value, true
+	}
+	_, value, found := node.dhtLookup(target, true)
+	return value, found
+}
+
+// refreshBuckets faz uma busca por um ID aleatório em cada bucket parado
+func (node *P2PNode) refreshBuckets() {
+	for _, index := range node.dht.staleBuckets() {
+		node.dhtLookup(randomIDInBucket(node.dht.self.key, index), false)
+	}
+}
+
+// dhtMaintenanceRoutine atualiza buckets parados e remove contatos e valores expirados
+func (node *P2PNode) dhtMaintenanceRoutine() {
+	ticker := node.clock.NewTicker(dhtMaintenanceInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-node.ctx.Done():
+			return
+		case <-ticker.C():
+			node.refreshBuckets()
+			node.dht.Cleanup()
+		}
+	}
+}
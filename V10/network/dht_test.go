@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// contactsInBucket gera n contatos que caem no bucket indicado
+func contactsInBucket(self dhtID, index, n int) []*DHTNode {
+	var contacts []*DHTNode
+	for i := 0; len(contacts) < n; i++ {
+		id := fmt.Sprintf("peer-%d", i)
+		if bucketIndex(self, dhtKey(id)) == index {
+			contacts = append(contacts, &DHTNode{ID: id, Address: "127.0.0.1", Port: 9000 + i})
+		}
+	}
+	return contacts
+}
+
+func bucketIDs(dht *DHTTable, index int) []string {
+	dht.mtx.RLock()
+	defer dht.mtx.RUnlock()
+
+	var ids []string
+	for _, n := range dht.buckets[index].nodes {
+		ids = append(ids, n.ID)
+	}
+	return ids
+}
+
+func TestBucketIndexAndRandomIDs(t *testing.T) {
+	self := dhtKey("self")
+	for _, index := range []int{0, 7, 8, 100, dhtIDBits - 1} {
+		for i := 0; i < 20; i++ {
+			if got := bucketIndex(self, randomIDInBucket(self, index)); got != index {
+				t.Fatalf("ID aleatório do bucket %d caiu no bucket %d", index, got)
+			}
+		}
+	}
+	if bucketIndex(self, self) != -1 {
+		t.Fatal("o próprio ID não pertence a nenhum bucket")
+	}
+}
+
+func TestFindClosestUsesFull160BitDistance(t *testing.T) {
+	dht := NewDHTTable("self", "127.0.0.1", 8000, t.TempDir())
+	for i := 0; i < 200; i++ {
+		dht.Update(&DHTNode{ID: fmt.Sprintf("peer-%d", i), Address: "127.0.0.1", Port: 9000 + i})
+	}
+
+	target := dhtKey("alvo")
+	closest := dht.closest(target, dhtBucketSize)
+	if len(closest) != dhtBucketSize {
+		t.Fatalf("esperados %d contatos, obtidos %d", dhtBucketSize, len(closest))
+	}
+	for i := 1; i < len(closest); i++ {
+		prev, cur := target.xor(dhtKey(closest[i-1].ID)), target.xor(dhtKey(closest[i].ID))
+		if bytes.Compare(prev[:], cur[:]) > 0 {
+			t.Fatalf("contatos fora de ordem nas posições %d e %d", i-1, i)
+		}
+	}
+}
+
+func TestFullBucketKeepsLiveOldestContact(t *testing.T) {
+	dht := NewDHTTable("self", "127.0.0.1", 8000, t.TempDir())
+	index := dhtIDBits - 1
+	contacts := contactsInBucket(dht.self.key, index, dhtBucketSize+2)
+	for _, c := range contacts[:dhtBucketSize] {
+		dht.Update(c)
+	}
+
+	pinged := make(chan string, 2)
+	dht.pinger = func(n *DHTNode) bool {
+		pinged <- n.ID
+		return true
+	}
+	dht.Update(contacts[dhtBucketSize])
+
+	if id := <-pinged; id != contacts[0].ID {
+		t.Fatalf("deveria pingar o contato mais antigo, pingou %s", id)
+	}
+	waitFor(t, defaultWait, func() bool { return bucketIDs(dht, index)[dhtBucketSize-1] == contacts[0].ID })
+
+	ids := bucketIDs(dht, index)
+	if len(ids) != dhtBucketSize || ids[dhtBucketSize-1] != contacts[0].ID {
+		t.Fatalf("contato vivo deveria ir para o fim do bucket: %v", ids)
+	}
+	for _, id := range ids {
+		if id == contacts[dhtBucketSize].ID {
+			t.Fatal("novo contato não deveria substituir um contato vivo")
+		}
+	}
+
+	// Contato antigo que não responde é despejado
+	dht.pinger = func(n *DHTNode) bool { return false }
+	dht.Update(contacts[dhtBucketSize+1])
+	if !waitFor(t, defaultWait, func() bool {
+		ids := bucketIDs(dht, index)
+		return ids[len(ids)-1] == contacts[dhtBucketSize+1].ID
+	}) {
+		t.Fatalf("contato morto deveria ser despejado: %v", bucketIDs(dht, index))
+	}
+	if ids := bucketIDs(dht, index); len(ids) != dhtBucketSize || ids[0] == contacts[1].ID {
+		t.Fatalf("bucket após despejo incorreto: %v", ids)
+	}
+}
+
+func TestRoutingTableSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	dht := NewDHTTable("self", "127.0.0.1", 8000, dir)
+	for i := 0; i < 30; i++ {
+		dht.Update(&DHTNode{ID: fmt.Sprintf("peer-%d", i), Address: "127.0.0.1", Port: 9000 + i})
+	}
+	dht.Cleanup()
+
+	reloaded := NewDHTTable("self", "127.0.0.1", 8000, dir)
+	if reloaded.Len() != dht.Len() {
+		t.Fatalf("tabela recarregada com %d contatos, esperado %d", reloaded.Len(), dht.Len())
+	}
+}
+
+// dhtChain conecta os nós em linha: cada um conhece apenas o anterior
+func dhtChain(t *testing.T, n int) []*P2PNode {
+	t.Helper()
+	nodes := make([]*P2PNode, n)
+	for i := range nodes {
+		nodes[i] = newTestNode(t, fmt.Sprintf("node-%d", i))
+		if i == 0 {
+			continue
+		}
+		if !nodes[i].ConnectToAddress("127.0.0.1", fmt.Sprintf("%d", nodes[i-1].Port)) {
+			t.Fatalf("node-%d não conectou em node-%d", i, i-1)
+		}
+	}
+	for _, node := range nodes {
+		node := node
+		waitFor(t, defaultWait, func() bool { return node.dht.Len() == len(node.connectedPeerIDs()) })
+	}
+	return nodes
+}
+
+func TestIterativeLookupFindsDistantNode(t *testing.T) {
+	nodes := dhtChain(t, 5)
+	first, last := nodes[0], nodes[len(nodes)-1]
+
+	found := first.DHTLookup(last.ID)
+	if len(found) == 0 || found[0].ID != last.ID {
+		t.Fatalf("busca deveria terminar em %s: %v", last.ID, found)
+	}
+	if found[0].Port != last.Port {
+		t.Fatalf("porta anunciada incorreta: %d, esperado %d", found[0].Port, last.Port)
+	}
+	if first.dht.Len() != len(nodes)-1 {
+		t.Fatalf("tabela de %s deveria conhecer os outros %d nós, conhece %d", first.ID, len(nodes)-1, first.dht.Len())
+	}
+}
+
+func TestStoreAndFindValueAcrossNetwork(t *testing.T) {
+	nodes := dhtChain(t, 4)
+
+	if stored := nodes[0].DHTStore("servico:seed", "127.0.0.1:8333"); stored < 2 {
+		t.Fatalf("valor deveria ser gravado em vários nós, gravado em %d", stored)
+	}
+	value, found := nodes[3].DHTFindValue("servico:seed")
+	if !found || value != "127.0.0.1:8333" {
+		t.Fatalf("valor não encontrado pela rede: %q", value)
+	}
+	if _, found := nodes[3].DHTFindValue("inexistente"); found {
+		t.Fatal("chave inexistente não deveria ser encontrada")
+	}
+}
+
+func TestBootstrapRegistersDHTPeers(t *testing.T) {
+	nodes := dhtChain(t, 3)
+	first := nodes[0]
+
+	bm := NewBootstrapManager(first.addrManager, nil)
+	bm.dhtDiscover = first.DHTDiscoverPeers
+	if found := bm.discoverViaDHT(); found != 2 {
+		t.Fatalf("DHT deveria achar 2 peers, achou %d", found)
+	}
+
+	first.addrManager.mtx.RLock()
+	defer first.addrManager.mtx.RUnlock()
+	addr := first.addrManager.knownAddresses[fmt.Sprintf("127.0.0.1:%d", nodes[2].Port)]
+	if addr == nil || addr.ConnectSuccess == 0 {
+		t.Fatalf("peer achado pela DHT não registrado: %+v", addr)
+	}
+}
+
+func TestUnsolicitedDHTReplyIsPenalized(t *testing.T) {
+	node := NewP2PNode("node-A", "127.0.0.1", 0)
+	node.handleDHTReply(&NetworkMessage{
+		Type:      MSG_DHT_NODES,
+		From:      "intruso",
+		Data:      &dhtReply{RPCID: "nunca-pedido"},
+		Timestamp: time.Now(),
+	})
+	if score := node.security.MisbehaviorScores()["intruso"]; score != penaltyUnsolicited {
+		t.Fatalf("pontuação %d, esperado %d", score, penaltyUnsolicited)
+	}
+}
@@ -1,40 +1,66 @@
 package main
 
 import (
+    "context"
     "fmt"
     "net"
+    "sort"
+    "strconv"
+    "strings"
     "sync"
     "time"
 )
 
-// Lista de DNS seeds para PTW blockchain
-var DNSSeeds = []string{
-    // Em um sistema real, isso seriam domínios reais
-    // Nesta implementação, usamos IPs diretamente como exemplo 
-    "ptw-seed.example.com",
-    "seed.ptw-network.org",
-    "dns-seed.ptw-chain.net",
-    "ptw-seeder.blockchain.info",
+// Serviço consultado nos registros SRV dos seeds (_ptw._tcp.<seed>)
+const (
+    seedSRVService    = "ptw"
+    seedLookupTimeout = 10 * time.Second
+)
+
+// seedResolver são as consultas DNS usadas pelo seeder (*net.Resolver)
+type seedResolver interface {
+    LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+    LookupTXT(ctx context.Context, name string) ([]string, error)
+    LookupHost(ctx context.Context, host string) ([]string, error)
 }
 
 // Implementação do DNS Seeder - resolve DNS seeds para IPs
 type DNSSeeder struct {
     seeds        []string
+    defaultPort  int
+    resolver     seedResolver
     addrManager  *AddrManager
     lastAttempt  time.Time
     seedInterval time.Duration
     mutex        sync.Mutex
 }
 
-// NewDNSSeeder cria um novo seeder
-func NewDNSSeeder(addrManager *AddrManager) *DNSSeeder {
+// NewDNSSeeder cria um novo seeder com os seeds da configuração de rede
+func NewDNSSeeder(addrManager *AddrManager, config *NetworkConfig) *DNSSeeder {
     return &DNSSeeder{
-        seeds:        DNSSeeds,
+        seeds:        config.DNSSeeds,
+        defaultPort:  config.DefaultPort,
+        resolver:     newSeedResolver(config.DNSResolver),
         addrManager:  addrManager,
         seedInterval: 12 * time.Hour, // Tenta DNS seeds a cada 12 horas
     }
 }
 
+// newSeedResolver usa o resolvedor do sistema ou, se configurado, um
+// servidor DNS específico (ex.: o seed server de um consórcio)
+func newSeedResolver(server string) seedResolver {
+    if server == "" {
+        return net.DefaultResolver
+    }
+    return &net.Resolver{
+        PreferGo: true,
+        Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+            var dialer net.Dialer
+            return dialer.DialContext(ctx, network, server)
+        },
+    }
+}
+
 // TrySeedNodes tenta resolver os DNS seeds e adicionar ao addr manager
 func (ds *DNSSeeder) TrySeedNodes() {
     ds.mutex.Lock()
@@ -50,39 +76,88 @@ func (ds *DNSSeeder) TrySeedNodes() {
     
     // Para cada DNS seed
     for _, seed := range ds.seeds {
-        addrs, err := net.LookupHost(seed)
+        addrs, err := ds.resolveSeed(seed)
         if err != nil {
             fmt.Printf("❌ Não foi possível resolver DNS seed %s: %v\n", seed, err)
             continue
         }
         
         for _, addr := range addrs {
-            // Verifica se é um IP válido
-            if net.ParseIP(addr) != nil {
-                // Adiciona com porta padrão
-                ds.addrManager.AddAddress(addr, "8333", "dns")
-            }
+            ip, port, _ := net.SplitHostPort(addr)
+            ds.addrManager.AddAddress(ip, port, "dns")
         }
         
-        fmt.Printf("🌱 Obtidos %d IPs do DNS seed %s\n", len(addrs), seed)
+        fmt.Printf("🌱 Obtidos %d endereços do DNS seed %s\n", len(addrs), seed)
     }
 }
 
-// Registrar IPs localmente para simular DNS seeds (para desenvolvimento)
-func (ds *DNSSeeder) RegisterLocalSeeds() {
-    // IPs que serão tratados como vindos dos DNS seeds
-    hardcodedIPs := []string{
-        "45.33.97.22", "134.209.101.19", "157.90.232.203",
-        "168.119.99.128", "178.128.223.164", "193.135.10.186",
-        "46.101.11.195", "5.9.121.164", "18.188.14.142",
-        "104.248.139.211", "157.245.172.150", "167.99.174.238",
+// resolveSeed junta os endereços "ip:porta" de um seed. Registros SRV
+// (_ptw._tcp) e TXT ("ip:porta" separados por espaço ou vírgula) trazem a
+// porta; A/AAAA usam a porta da entrada ou a padrão da rede.
+func (ds *DNSSeeder) resolveSeed(seed string) ([]string, error) {
+    host, port, err := splitHostPortDefault(seed, ds.defaultPort)
+    if err != nil {
+        return nil, err
     }
     
-    for _, ip := range hardcodedIPs {
-        ds.addrManager.AddAddress(ip, "8333", "dns")
+    ctx, cancel := context.WithTimeout(context.Background(), seedLookupTimeout)
+    defer cancel()
+    
+    found := make(map[string]bool)
+    result := make([]string, 0)
+    add := func(ip, port string) {
+        if net.ParseIP(ip) == nil {
+            return
+        }
+        addr := net.JoinHostPort(ip, port)
+        if !found[addr] {
+            found[addr] = true
+            result = append(result, addr)
+        }
     }
     
-    fmt.Printf("🌱 Registrados %d IPs simulando DNS seeds\n", len(hardcodedIPs))
+    var lastErr error
+    if _, srvs, err := ds.resolver.LookupSRV(ctx, seedSRVService, "tcp", host); err == nil {
+        for _, srv := range srvs {
+            ips, err := ds.resolver.LookupHost(ctx, srv.Target)
+            if err != nil {
+                continue
+            }
+            for _, ip := range ips {
+                add(ip, strconv.Itoa(int(srv.Port)))
+            }
+        }
+    } else {
+        lastErr = err
+    }
+    
+    if records, err := ds.resolver.LookupTXT(ctx, host); err == nil {
+        for _, record := range records {
+            for _, entry := range strings.FieldsFunc(record, func(r rune) bool {
+                return r == ' ' || r == ','
+            }) {
+                if ip, entryPort, err := net.SplitHostPort(entry); err == nil {
+                    add(ip, entryPort)
+                }
+            }
+        }
+    } else {
+        lastErr = err
+    }
+    
+    if ips, err := ds.resolver.LookupHost(ctx, host); err == nil {
+        for _, ip := range ips {
+            add(ip, port)
+        }
+    } else {
+        lastErr = err
+    }
+    
+    if len(result) == 0 && lastErr != nil {
+        return nil, lastErr
+    }
+    sort.Strings(result)
+    return result, nil
 }
 
 // SeedFromDNS executa a descoberta de seeds DNS se necessário
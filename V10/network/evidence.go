@@ -0,0 +1,190 @@
+package main
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// Evidência de dupla assinatura. Quando a máquina BFT recebe de um mesmo
+// validador duas propostas ou dois votos assinados e conflitantes (mesma
+// altura, rodada e tipo, blocos diferentes), o nó cria uma transação
+// "evidence" com as duas mensagens. Ela circula como qualquer transação e,
+// ao entrar num bloco, cada nó confere que o acusado estava no conjunto da
+// época da infração, que ela não é mais antiga que o período de unbonding
+// (depois dele o stake já pode ter sido sacado), confere as assinaturas com
+// a chave do validador registrada no estado e aplica a punição: perda de uma fração do
+// stake (inclusive o que está em unbonding) e prisão (jail) definitiva, que
+// o tira do conjunto de validadores a partir da próxima época.
+
+const (
+	TX_EVIDENCE = "evidence" // From denuncia o validador To
+
+	doubleSignSlashPercent = 10 // Stake perdido por dupla assinatura
+)
+
+// DoubleSignEvidence leva dois votos ou duas propostas conflitantes
+type DoubleSignEvidence struct {
+	VoteA     *ConsensusVote     `json:"vote_a,omitempty"`
+	VoteB     *ConsensusVote     `json:"vote_b,omitempty"`
+	ProposalA *consensusProposal `json:"proposal_a,omitempty"`
+	ProposalB *consensusProposal `json:"proposal_b,omitempty"`
+}
+
+// offense confere a forma da evidência e retorna o validador, a altura e a
+// rodada da infração
+func (ev *DoubleSignEvidence) offense() (string, int, int, error) {
+	switch {
+	case ev.VoteA != nil && ev.VoteB != nil && ev.ProposalA == nil && ev.ProposalB == nil:
+		a, b := ev.VoteA, ev.VoteB
+		if a.Voter != b.Voter || a.Height != b.Height || a.Round != b.Round || a.Type != b.Type {
+			return "", 0, 0, fmt.Errorf("votos de validadores, alturas, rodadas ou tipos diferentes")
+		}
+		if a.BlockHash == b.BlockHash {
+			return "", 0, 0, fmt.Errorf("votos não conflitam")
+		}
+		return a.Voter, a.Height, a.Round, nil
+
+	case ev.ProposalA != nil && ev.ProposalB != nil && ev.VoteA == nil && ev.VoteB == nil:
+		a, b := ev.ProposalA, ev.ProposalB
+		if a.Proposer != b.Proposer || a.Height != b.Height || a.Round != b.Round {
+			return "", 0, 0, fmt.Errorf("propostas de proponentes, alturas ou rodadas diferentes")
+		}
+		if a.Block.Hash == b.Block.Hash {
+			return "", 0, 0, fmt.Errorf("propostas não conflitam")
+		}
+		return a.Proposer, a.Height, a.Round, nil
+	}
+	return "", 0, 0, fmt.Errorf("evidência deve ter dois votos ou duas propostas")
+}
+
+// verify confere as duas assinaturas com a chave do validador
+func (ev *DoubleSignEvidence) verify(chainID string, key *rsa.PublicKey) error {
+	if _, _, _, err := ev.offense(); err != nil {
+		return err
+	}
+	if ev.VoteA != nil {
+		if !verifyConsensus(key, voteSignBytes(chainID, ev.VoteA), ev.VoteA.Signature) ||
+			!verifyConsensus(key, voteSignBytes(chainID, ev.VoteB), ev.VoteB.Signature) {
+			return errBadConsensusSignature
+		}
+		return nil
+	}
+	if !verifyConsensus(key, proposalSignBytes(chainID, ev.ProposalA), ev.ProposalA.Signature) ||
+		!verifyConsensus(key, proposalSignBytes(chainID, ev.ProposalB), ev.ProposalB.Signature) {
+		return errBadConsensusSignature
+	}
+	return nil
+}
+
+// id identifica a infração independentemente de quem a denunciou e da ordem
+// das mensagens; duas denúncias do mesmo par viram a mesma transação
+func (ev *DoubleSignEvidence) id() string {
+	validator, height, round, _ := ev.offense()
+	kind, first, second := "proposal", "", ""
+	if ev.VoteA != nil {
+		kind, first, second = ev.VoteA.Type, ev.VoteA.BlockHash, ev.VoteB.BlockHash
+	} else if ev.ProposalA != nil {
+		first, second = ev.ProposalA.Block.Hash, ev.ProposalB.Block.Hash
+	}
+	if second < first {
+		first, second = second, first
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s|%d|%d|%s|%s|%s", validator, height, round, kind, first, second)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// applyEvidence confere a evidência contra o estado e pune o validador
+func (s *ChainState) applyEvidence(ev *DoubleSignEvidence, height int) error {
+	if ev == nil {
+		return fmt.Errorf("transação de evidência sem evidência")
+	}
+	validator, offenseHeight, round, err := ev.offense()
+	if err != nil {
+		return err
+	}
+	if offenseHeight < 1 || offenseHeight > height {
+		return fmt.Errorf("evidência da altura %d num bloco da altura %d", offenseHeight, height)
+	}
+	if height-offenseHeight > s.UnbondingPeriod {
+		return fmt.Errorf("evidência da altura %d expirada", offenseHeight)
+	}
+	if !s.memberAt(validator, offenseHeight) {
+		return fmt.Errorf("%s fora do conjunto de validadores da altura %d", validator, offenseHeight)
+	}
+	if s.Jailed[validator] {
+		return fmt.Errorf("validador %s já foi punido", validator)
+	}
+	key, err := parsePublicKey(s.Keys[validator])
+	if err != nil {
+		return fmt.Errorf("validador %s sem chave registrada", validator)
+	}
+	if err := ev.verify(s.chainIDAt(offenseHeight), key); err != nil {
+		return err
+	}
+	slashed := s.slash(validator, doubleSignSlashPercent)
+	if slashed == 0 {
+		return fmt.Errorf("validador %s sem stake", validator)
+	}
+	s.jail(validator)
+	s.Incidents = append(s.Incidents,
+		validatorIncident{"DOUBLE_SIGN", validator, fmt.Sprintf("dupla assinatura na altura %d, rodada %d", offenseHeight, round), "CRITICAL"},
+		validatorIncident{"VALIDATOR_SLASHED", validator, fmt.Sprintf("%d de stake retirados (%d%%) por dupla assinatura", slashed, doubleSignSlashPercent), "HIGH"},
+		validatorIncident{"VALIDATOR_JAILED", validator, "preso por dupla assinatura", "HIGH"})
+	return nil
+}
+
+// memberAt: o validador estava no conjunto que decidia a altura
+func (s *ChainState) memberAt(validator string, height int) bool {
+	for _, id := range s.EpochMembers[s.epochOf(height)] {
+		if id == validator {
+			return true
+		}
+	}
+	return false
+}
+
+// === Integração com o nó ===
+
+// reportEquivocation transforma a equivocação detectada pelo consenso em
+// transação de evidência e a difunde
+func (node *P2PNode) reportEquivocation(ev *DoubleSignEvidence) {
+	if node.identity == nil {
+		return
+	}
+	validator, height, round, err := ev.offense()
+	if err != nil {
+		return
+	}
+	tx := Transaction{
+		ID:        "EVIDENCE_" + ev.id()[:32],
+		Type:      TX_EVIDENCE,
+		From:      node.ID,
+		To:        validator,
+		Timestamp: node.clock.Now(),
+		PublicKey: encodePublicKey(&node.identity.key.PublicKey),
+		Evidence:  ev,
+	}
+	if err := signTx(node.identity.key, &tx); err != nil {
+		return
+	}
+
+	if err := node.checkStakingTx(&tx); err != nil {
+		fmt.Printf("⚠️ [%s] Evidência contra %s descartada: %v\n", node.ID, validator, err)
+		return
+	}
+	node.mutex.Lock()
+	for _, pending := range node.PendingTxs {
+		if pending.ID == tx.ID {
+			node.mutex.Unlock()
+			return
+		}
+	}
+	node.PendingTxs = append(node.PendingTxs, tx)
+	node.mutex.Unlock()
+
+	fmt.Printf("🚨 [%s] Dupla assinatura de %s (altura %d, rodada %d): evidência %s\n", node.ID, validator, height, round, tx.ID)
+	node.AnnounceTransaction(&tx, "")
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"testing"
+)
+
+// evidenceState: A, B, C e D com stake 100 e as chaves do bftHarness
+func evidenceState(h *bftHarness) *ChainState {
+	genesis := &StakingGenesis{UnbondingPeriod: 5}
+	for id, key := range h.keys {
+		genesis.Validators = append(genesis.Validators, ValidatorStake{ID: id, Owner: addr(id), Amount: 100, PubKey: encodePublicKey(&key.PublicKey)})
+	}
+	return newChainState(genesis, "genesis")
+}
+
+func TestEvidenceSlashesAndJailsDoubleSigner(t *testing.T) {
+	h := newBFTHarness(t)
+	state := evidenceState(h)
+
+	// Stake em unbonding também responde pela infração
+	unstake := stakingTx("u1", TX_UNSTAKE, "B", "B", 50)
+	if err := state.applyTx(&unstake, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	ev := &DoubleSignEvidence{
+		VoteA: h.signedVote("B", votePrevote, 0, "BLOCK_X_000000000000"),
+		VoteB: h.signedVote("B", votePrevote, 0, "BLOCK_Y_000000000000"),
+	}
+	if err := state.applyEvidence(ev, 2); err != nil {
+		t.Fatal(err)
+	}
+	if state.Stakes["B"].Amount != 45 || state.Unbonding[0].Amount != 45 || !state.Jailed["B"] {
+		t.Fatalf("stake %d, unbonding %d, preso %v", state.Stakes["B"].Amount, state.Unbonding[0].Amount, state.Jailed["B"])
+	}
+	// O conjunto da época não muda; B sai no retrato do fim da época
+	if len(state.EpochValidators) != 4 {
+		t.Fatalf("conjunto mudou no meio da época: %v", state.EpochValidators)
+	}
+	state.snapshotValidators()
+	for _, v := range state.EpochValidators {
+		if v.ID == "B" {
+			t.Fatal("validador preso continua no conjunto da próxima época")
+		}
+	}
+	if err := state.applyEvidence(ev, 3); err == nil {
+		t.Fatal("mesma infração punida duas vezes")
+	}
+	restake := stakingTx("s1", TX_STAKE, "B", "B", 1)
+	state.Balances[addr("B")] = 1
+	if err := state.applyTx(&restake, 3); err == nil {
+		t.Fatal("stake em validador preso aceito")
+	}
+}
+
+func TestEvidenceIsVerified(t *testing.T) {
+	h := newBFTHarness(t)
+	state := evidenceState(h)
+
+	cases := map[string]*DoubleSignEvidence{
+		"votos iguais": {
+			VoteA: h.signedVote("C", votePrevote, 0, "BLOCK_X_000000000000"),
+			VoteB: h.signedVote("C", votePrevote, 0, "BLOCK_X_000000000000"),
+		},
+		"rodadas diferentes": {
+			VoteA: h.signedVote("C", votePrevote, 0, "BLOCK_X_000000000000"),
+			VoteB: h.signedVote("C", votePrevote, 1, "BLOCK_Y_000000000000"),
+		},
+		"tipos diferentes": {
+			VoteA: h.signedVote("C", votePrevote, 0, "BLOCK_X_000000000000"),
+			VoteB: h.signedVote("C", votePrecommit, 0, "BLOCK_Y_000000000000"),
+		},
+		"assinatura de outro validador": {
+			VoteA: h.signedVote("C", votePrevote, 0, "BLOCK_X_000000000000"),
+			VoteB: func() *ConsensusVote {
+				v := h.signedVote("D", votePrevote, 0, "BLOCK_Y_000000000000")
+				v.Voter = "C"
+				return v
+			}(),
+		},
+		"vazia": {},
+	}
+	for name, ev := range cases {
+		if err := state.clone().applyEvidence(ev, 2); err == nil {
+			t.Fatalf("evidência inválida aceita: %s", name)
+		}
+	}
+
+	valid := &DoubleSignEvidence{
+		VoteA: h.signedVote("C", votePrecommit, 0, "BLOCK_X_000000000000"),
+		VoteB: h.signedVote("C", votePrecommit, 0, "BLOCK_Y_000000000000"),
+	}
+	if err := state.clone().applyEvidence(valid, 1+state.UnbondingPeriod+1); err == nil {
+		t.Fatal("evidência mais antiga que o unbonding aceita")
+	}
+	if err := state.clone().applyEvidence(valid, 1); err != nil {
+		t.Fatalf("evidência da própria altura: %v", err)
+	}
+
+	// Chave registrada não basta: C precisa estar no conjunto da época
+	outsider := state.clone()
+	delete(outsider.Stakes, "C")
+	outsider.snapshotValidators()
+	if err := outsider.applyEvidence(valid, 1); err == nil {
+		t.Fatal("evidência contra quem não era validador na altura aceita")
+	}
+
+	// A assinatura do denunciante cobre a infração: trocar a evidência a invalida
+	report := Transaction{ID: "EVIDENCE_1", Type: TX_EVIDENCE, From: "A", To: "C", Evidence: valid}
+	if err := signTx(h.keys["A"], &report); err != nil {
+		t.Fatal(err)
+	}
+	if !NewTransactionValidator().VerifySignature(&report) {
+		t.Fatal("denúncia assinada recusada")
+	}
+	report.Evidence = &DoubleSignEvidence{
+		VoteA: h.signedVote("D", votePrecommit, 0, "BLOCK_X_000000000000"),
+		VoteB: h.signedVote("D", votePrecommit, 0, "BLOCK_Y_000000000000"),
+	}
+	if NewTransactionValidator().VerifySignature(&report) {
+		t.Fatal("evidência trocada manteve a assinatura válida")
+	}
+
+	// A ordem das mensagens não muda a identidade da infração
+	swapped := &DoubleSignEvidence{VoteA: valid.VoteB, VoteB: valid.VoteA}
+	if valid.id() != swapped.id() {
+		t.Fatal("id depende da ordem dos votos")
+	}
+}
+
+func TestBFTEmitsEvidenceOnEquivocation(t *testing.T) {
+	h := newBFTHarness(t)
+	evidence := func() []*DoubleSignEvidence {
+		var found []*DoubleSignEvidence
+		for _, action := range h.engine.takeActions() {
+			if action.evidence != nil {
+				found = append(found, action.evidence)
+			}
+		}
+		return found
+	}
+
+	h.propose(0, -1, "BLOCK_X_000000000000")
+	h.propose(0, -1, "BLOCK_Y_000000000000")
+	if found := evidence(); len(found) != 1 || found[0].ProposalA == nil {
+		t.Fatalf("propostas conflitantes: %+v", found)
+	}
+
+	h.vote(votePrecommit, 0, "", "C")
+	h.engine.receiveVote(h.signedVote("C", votePrecommit, 0, "BLOCK_X_000000000000"))
+	if found := evidence(); len(found) != 1 || found[0].VoteA.Voter != "C" {
+		t.Fatalf("votos conflitantes: %+v", found)
+	}
+
+	// Precommit conflitante que só aparece no certificado de outro nó
+	h.vote(votePrecommit, 0, "BLOCK_Y_000000000000", "D")
+	cert := &CommitCertificate{Height: 1, Round: 0, BlockHash: "BLOCK_X_000000000000",
+		Precommits: []ConsensusVote{*h.signedVote("D", votePrecommit, 0, "BLOCK_X_000000000000")}}
+	h.engine.checkCertificate(cert)
+	found := evidence()
+	if len(found) != 1 || found[0].VoteB.BlockHash != "BLOCK_X_000000000000" {
+		t.Fatalf("conflito com o certificado: %+v", found)
+	}
+	if err := evidenceState(h).applyEvidence(found[0], 2); err != nil {
+		t.Fatalf("evidência do certificado rejeitada: %v", err)
+	}
+}
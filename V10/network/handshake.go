@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Versão do protocolo de rede. A 6 muda regras de consenso: todo bloco do
+// consenso tem o hash do cabeçalho e o que fecha a época anuncia o próximo
+// conjunto. Blocos e propostas de um nó da versão 5 seriam recusados por
+// essas regras, então o corte é no handshake, antes de trocar blocos.
+const (
+	ProtocolVersion    = 6 // 3: blocos compactos (cmpctblock); 4: mensagens binárias; 5: consenso BFT; 6: troca de conjunto por época
+	MinProtocolVersion = 6 // Regra de consenso da versão 6 (ver acima)
+	UserAgent          = "/ptw:10.0/"
+)
+
+// Serviços anunciados no handshake (bit flags)
+const (
+	SERVICE_FULL_NODE    uint64 = 1 << 0
+	SERVICE_VALIDATOR    uint64 = 1 << 1
+	SERVICE_LIGHT_SERVER uint64 = 1 << 2
+	SERVICE_MINER        uint64 = 1 << 3
+)
+
+// Mensagem enviada antes de encerrar uma conexão incompatível
+const MSG_REJECT = "reject"
+
+type rejectMessage struct {
+	Reason string `json:"reason"`
+}
+
+// VersionInfo é o conteúdo de MSG_INTRODUCTION / MSG_INTRODUCTION_ACK
+type VersionInfo struct {
+	ProtocolVersion int    `json:"protocol_version"`
+	ChainID         string `json:"chain_id"` // Hash do bloco gênese
+	BestHeight      int    `json:"best_height"`
+	BestHash        string `json:"best_hash"`
+	Services        uint64 `json:"services"`
+	UserAgent       string `json:"user_agent"`
+	NodeID          string `json:"node_id"`
+	Address         string `json:"address"`
+	Port            int    `json:"port"`
+	Stake           int    `json:"stake"`
+	Timestamp       int64  `json:"timestamp"`
+}
+
+// Nomes legíveis dos serviços
+func servicesString(services uint64) string {
+	names := []string{}
+	if services&SERVICE_FULL_NODE != 0 {
+		names = append(names, "full-node")
+	}
+	if services&SERVICE_VALIDATOR != 0 {
+		names = append(names, "validator")
+	}
+	if services&SERVICE_LIGHT_SERVER != 0 {
+		names = append(names, "light-server")
+	}
+	if services&SERVICE_MINER != 0 {
+		names = append(names, "miner")
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ",")
+}
+
+// localServices retorna os serviços oferecidos por este nó
+func (node *P2PNode) localServices() uint64 {
+	services := node.Services | SERVICE_FULL_NODE
+	if node.IsValidator {
+		services |= SERVICE_VALIDATOR
+	}
+	return services
+}
+
+// localChainID retorna o hash gênese (configurado ou da cadeia local)
+func (node *P2PNode) localChainID() string {
+	if node.ChainID != "" {
+		return node.ChainID
+	}
+	if len(node.Blockchain) > 0 {
+		return node.Blockchain[0].Hash
+	}
+	return ""
+}
+
+// versionInfo monta o anúncio de versão deste nó
+func (node *P2PNode) versionInfo() *VersionInfo {
+	node.mutex.RLock()
+	defer node.mutex.RUnlock()
+
+	info := &VersionInfo{
+		ProtocolVersion: ProtocolVersion,
+		ChainID:         node.localChainID(),
+		BestHeight:      len(node.Blockchain),
+		Services:        node.localServices(),
+		UserAgent:       UserAgent,
+		NodeID:          node.ID,
+		Address:         node.Address,
+		Port:            node.Port,
+		Stake:           node.Stake,
+		Timestamp:       time.Now().Unix(),
+	}
+	if len(node.Blockchain) > 0 {
+		info.BestHash = node.Blockchain[len(node.Blockchain)-1].Hash
+	}
+	return info
+}
+
+// decodeVersionInfo extrai o VersionInfo de uma mensagem de handshake
+func decodeVersionInfo(msg *NetworkMessage) (*VersionInfo, error) {
+	info, ok := msg.Data.(*VersionInfo)
+	if !ok {
+		return nil, fmt.Errorf("handshake malformado: dados %T", msg.Data)
+	}
+	if info.NodeID == "" {
+		return nil, fmt.Errorf("handshake sem ID do nó")
+	}
+	return info, nil
+}
+
+// checkCompatibility valida se o peer pode participar da mesma rede
+func (node *P2PNode) checkCompatibility(info *VersionInfo) error {
+	if info.NodeID == node.ID {
+		return fmt.Errorf("conexão consigo mesmo")
+	}
+	if node.isBanned(info.NodeID, info.Address, info.Port) {
+		return fmt.Errorf("peer %s está banido", info.NodeID)
+	}
+	if info.ProtocolVersion < MinProtocolVersion {
+		return fmt.Errorf("versão de protocolo %d não suportada (mínimo %d)", info.ProtocolVersion, MinProtocolVersion)
+	}
+	if info.Services&SERVICE_FULL_NODE == 0 && info.Services&SERVICE_LIGHT_SERVER == 0 {
+		return fmt.Errorf("peer não oferece serviços úteis (%s)", servicesString(info.Services))
+	}
+
+	node.mutex.RLock()
+	ourChain := node.localChainID()
+	node.mutex.RUnlock()
+
+	// Nós sem cadeia ainda aceitam qualquer gênese; do contrário devem
+	// coincidir, e o peer sem chain ID não prova estar na mesma rede
+	if ourChain != "" && info.ChainID == "" {
+		return fmt.Errorf("peer sem chain ID (esperado %.16s)", ourChain)
+	}
+	if ourChain != "" && ourChain != info.ChainID {
+		return fmt.Errorf("chain ID incompatível: %.16s != %.16s", info.ChainID, ourChain)
+	}
+	return nil
+}
+
+// peerFromVersion cria o Peer com os dados negociados no handshake
+func peerFromVersion(info *VersionInfo, conn net.Conn) *Peer {
+	address := info.Address
+	if host, _, err := net.SplitHostPort(conn.RemoteAddr().String()); err == nil {
+		// Usa o IP observado quando o peer anuncia um endereço genérico
+		if address == "" || address == "0.0.0.0" || address == "::" {
+			address = host
+		}
+	}
+
+	return &Peer{
+		ID:              info.NodeID,
+		Address:         address,
+		Port:            info.Port,
+		LastSeen:        time.Now(),
+		IsActive:        true,
+		Stake:           info.Stake,
+		Height:          info.BestHeight,
+		BestHash:        info.BestHash,
+		ChainID:         info.ChainID,
+		ProtocolVersion: info.ProtocolVersion,
+		Services:        info.Services,
+		UserAgent:       info.UserAgent,
+	}
+}
+
+// rejectPeer informa o motivo da recusa e encerra a conexão
+func (node *P2PNode) rejectPeer(pc *peerConn, peerID string, reason error) {
+	fmt.Printf("⛔ [%s] Handshake recusado com %s: %v\n", node.ID, peerID, reason)
+	msg := &NetworkMessage{
+		Type: MSG_REJECT,
+		To:   peerID,
+		Data: &rejectMessage{Reason: reason.Error()},
+	}
+	if err := node.signOutbound(msg); err == nil {
+		pc.writeDirect(msg)
+	}
+	pc.close()
+}
+
+// recordPeerVersion registra no AddrManager os dados negociados
+func (node *P2PNode) recordPeerVersion(peer *Peer) {
+	if node.addrManager == nil || peer.Port <= 0 || net.ParseIP(peer.Address) == nil {
+		return
+	}
+	port := strconv.Itoa(peer.Port)
+	node.addrManager.AddAddress(peer.Address, port, "peer")
+	node.addrManager.SetServices(peer.Address, port, peer.Services)
+}
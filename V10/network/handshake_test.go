@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHandshakeRecordsPeerVersion(t *testing.T) {
+	nodeA := newTestNode(t, "node-A")
+	nodeA.IsValidator = true
+	nodeA.Services = SERVICE_MINER
+	nodeA.Blockchain = []Token{testBlock(1, "")}
+
+	nodeB := newTestNode(t, "node-B")
+	nodeB.ChainID = nodeA.Blockchain[0].Hash
+	if !nodeB.ConnectToAddress("127.0.0.1", fmt.Sprintf("%d", nodeA.Port)) {
+		t.Fatal("B não conseguiu conectar em A")
+	}
+
+	nodeB.mutex.RLock()
+	peer := nodeB.Peers["node-A"]
+	nodeB.mutex.RUnlock()
+	if peer == nil {
+		t.Fatal("peer A não registrado em B")
+	}
+	if peer.ProtocolVersion != ProtocolVersion || peer.UserAgent != UserAgent {
+		t.Errorf("versão negociada incorreta: %d %q", peer.ProtocolVersion, peer.UserAgent)
+	}
+	wantServices := SERVICE_FULL_NODE | SERVICE_VALIDATOR | SERVICE_MINER
+	if peer.Services != wantServices {
+		t.Errorf("serviços = %s, esperado %s", servicesString(peer.Services), servicesString(wantServices))
+	}
+	if peer.ChainID != nodeA.Blockchain[0].Hash || peer.Height != 1 {
+		t.Errorf("chain ID/altura incorretos: %q %d", peer.ChainID, peer.Height)
+	}
+
+	// Serviços também ficam registrados no AddrManager
+	key := net.JoinHostPort("127.0.0.1", strconv.Itoa(nodeA.Port))
+	nodeB.addrManager.mtx.RLock()
+	addr := nodeB.addrManager.knownAddresses[key]
+	nodeB.addrManager.mtx.RUnlock()
+	if addr == nil || addr.Services != wantServices {
+		t.Fatalf("AddrManager sem serviços do peer: %+v", addr)
+	}
+}
+
+func TestHandshakeRejectsDifferentChain(t *testing.T) {
+	nodeA := newTestNode(t, "node-A")
+	nodeA.ChainID = "GENESIS_A"
+
+	nodeB := newTestNode(t, "node-B")
+	nodeB.ChainID = "GENESIS_B"
+
+	if nodeB.ConnectToAddress("127.0.0.1", fmt.Sprintf("%d", nodeA.Port)) {
+		t.Fatal("conexão entre cadeias diferentes deveria falhar")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if len(nodeA.connectedPeerIDs()) != 0 || len(nodeB.connectedPeerIDs()) != 0 {
+		t.Fatal("nenhum dos nós deveria manter o peer incompatível")
+	}
+}
+
+func TestCheckCompatibilityRejectsOldProtocol(t *testing.T) {
+	node := NewP2PNode("node-A", "127.0.0.1", 0)
+	info := &VersionInfo{NodeID: "old", ProtocolVersion: MinProtocolVersion - 1, Services: SERVICE_FULL_NODE}
+	if err := node.checkCompatibility(info); err == nil {
+		t.Fatal("protocolo antigo deveria ser recusado")
+	}
+}
+
+func TestCheckCompatibilityRequiresChainIDOnceChainExists(t *testing.T) {
+	node := NewP2PNode("node-A", "127.0.0.1", 0)
+	info := &VersionInfo{NodeID: "novo", ProtocolVersion: ProtocolVersion, Services: SERVICE_FULL_NODE}
+	if err := node.checkCompatibility(info); err != nil {
+		t.Fatalf("nó sem cadeia deveria aceitar peer sem chain ID: %v", err)
+	}
+
+	node.Blockchain = []Token{testBlock(1, "")}
+	if err := node.checkCompatibility(info); err == nil {
+		t.Fatal("peer sem chain ID aceito por nó com cadeia")
+	}
+	info.ChainID = node.Blockchain[0].Hash
+	if err := node.checkCompatibility(info); err != nil {
+		t.Fatalf("peer da mesma cadeia recusado: %v", err)
+	}
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Mensagens de inventário: anúncio por hash e pedido do conteúdo
+const (
+	MSG_INV       = "inv"
+	MSG_GET_DATA  = "getdata"
+	MSG_NOT_FOUND = "notfound"
+)
+
+// Tipos de item de inventário
+const (
+	INV_BLOCK = "block"
+	INV_TX    = "tx"
+)
+
+// Parâmetros do gossip
+const (
+	maxInvPerMessage    = 1000             // Itens por inv/getdata
+	knownInvSize        = 5000             // Itens lembrados por peer
+	seenInvSize         = 50000            // Itens já processados pelo nó
+	inventoryTTL        = 10 * time.Minute // Validade do seen-cache e dos conjuntos por peer
+	getDataTimeout      = 20 * time.Second // Depois disso o item pode ser pedido a outro peer
+	trickleInterval     = 2 * time.Second  // Intervalo médio entre lotes de transações
+	maxTxPerTrickle     = 100
+	penaltyOversizedInv = 20
+)
+
+// InvItem identifica um bloco (hash) ou uma transação (ID)
+type InvItem struct {
+	Type string `json:"type"`
+	Hash string `json:"hash"`
+}
+
+// invMessage é o corpo de inv, getdata e notfound
+type invMessage struct {
+	Items []InvItem `json:"items"`
+}
+
+func (item InvItem) key() string {
+	return item.Type + ":" + item.Hash
+}
+
+// inventoryCache é um conjunto limitado cujas entradas expiram
+type inventoryCache struct {
+	mtx   sync.Mutex
+	items map[string]time.Time
+	max   int
+	ttl   time.Duration
+	clock Clock
+}
+
+func newInventoryCache(max int, ttl time.Duration) *inventoryCache {
+	return &inventoryCache{
+		items: make(map[string]time.Time),
+		max:   max,
+		ttl:   ttl,
+		clock: realClock{},
+	}
+}
+
+// Add registra a chave e retorna false se ela já estava presente
+func (c *inventoryCache) Add(key string) bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	now := c.clock.Now()
+	if added, ok := c.items[key]; ok && now.Sub(added) < c.ttl {
+		return false
+	}
+	if len(c.items) >= c.max {
+		c.pruneLocked(now)
+	}
+	c.items[key] = now
+	return true
+}
+
+func (c *inventoryCache) Has(key string) bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	added, ok := c.items[key]
+	return ok && c.clock.Now().Sub(added) < c.ttl
+}
+
+func (c *inventoryCache) Remove(key string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	delete(c.items, key)
+}
+
+func (c *inventoryCache) Len() int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return len(c.items)
+}
+
+// pruneLocked remove as entradas expiradas; se o conjunto continuar cheio,
+// descarta entradas arbitrárias até 3/4 da capacidade
+func (c *inventoryCache) pruneLocked(now time.Time) {
+	for key, added := range c.items {
+		if now.Sub(added) >= c.ttl {
+			delete(c.items, key)
+		}
+	}
+	for key := range c.items {
+		if len(c.items) < c.max*3/4 {
+			break
+		}
+		delete(c.items, key)
+	}
+}
+
+// Contadores do gossip (GetRelayStats)
+func (node *P2PNode) countRelay(name string, n int) {
+	node.relayMtx.Lock()
+	node.relayStats[name] += n
+	node.relayMtx.Unlock()
+}
+
+// GetRelayStats retorna os contadores de anúncios, pedidos e itens recebidos
+func (node *P2PNode) GetRelayStats() map[string]int {
+	node.relayMtx.Lock()
+	defer node.relayMtx.Unlock()
+
+	stats := make(map[string]int, len(node.relayStats)+1)
+	for name, value := range node.relayStats {
+		stats[name] = value
+	}
+	pending := 0
+	for _, queue := range node.txRelayQueue {
+		pending += len(queue)
+	}
+	stats["tx_relay_pending"] = pending
+	return stats
+}
+
+// markPeerKnows registra que o peer já tem o item (anunciou, enviou ou recebeu)
+func (node *P2PNode) markPeerKnows(peerID string, item InvItem) {
+	node.mutex.RLock()
+	peer, exists := node.Peers[peerID]
+	node.mutex.RUnlock()
+
+	if exists && peer.knownInv != nil {
+		peer.knownInv.Add(item.key())
+	}
+}
+
+func (node *P2PNode) peerKnows(peerID string, item InvItem) bool {
+	node.mutex.RLock()
+	peer, exists := node.Peers[peerID]
+	node.mutex.RUnlock()
+
+	return exists && peer.knownInv != nil && peer.knownInv.Has(item.key())
+}
+
+// peersWithout lista os peers conectados que ainda não conhecem o item
+func (node *P2PNode) peersWithout(item InvItem, exceptPeerID string) []string {
+	node.mutex.RLock()
+	defer node.mutex.RUnlock()
+
+	ids := make([]string, 0, len(node.Peers))
+	for id, peer := range node.Peers {
+		if id == exceptPeerID || !peer.IsActive || peer.conn == nil || peer.knownInv == nil {
+			continue
+		}
+		if !peer.knownInv.Has(item.key()) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// hasInventory verifica se o nó já possui ou já processou o item
+func (node *P2PNode) hasInventory(item InvItem) bool {
+	if node.seenInv.Has(item.key()) {
+		return true
+	}
+	switch item.Type {
+	case INV_BLOCK:
+		return node.findBlock(item.Hash) != nil
+	case INV_TX:
+		return node.findPendingTx(item.Hash) != nil
+	}
+	return false
+}
+
+func (node *P2PNode) findBlock(hash string) *Token {
+	node.mutex.RLock()
+	defer node.mutex.RUnlock()
+
+	for i := len(node.Blockchain) - 1; i >= 0; i-- {
+		if node.Blockchain[i].Hash == hash {
+			block := node.Blockchain[i]
+			return &block
+		}
+	}
+	return nil
+}
+
+func (node *P2PNode) findPendingTx(id string) *Transaction {
+	node.mutex.RLock()
+	defer node.mutex.RUnlock()
+
+	for i := range node.PendingTxs {
+		if node.PendingTxs[i].ID == id {
+			tx := node.PendingTxs[i]
+			return &tx
+		}
+	}
+	return nil
+}
+
+// AnnounceBlock anuncia o bloco imediatamente aos peers que ainda não o conhecem.
+// Peers com suporte recebem o bloco compacto direto; os demais, um inv.
+func (node *P2PNode) AnnounceBlock(block *Token, exceptPeerID string) {
+	item := InvItem{Type: INV_BLOCK, Hash: block.Hash}
+	node.seenInv.Add(item.key())
+
+	for _, peerID := range node.peersWithout(item, exceptPeerID) {
+		if node.supportsCompactBlocks(peerID) {
+			node.sendCompactBlock(peerID, block)
+		} else {
+			node.sendInv(peerID, []InvItem{item})
+		}
+	}
+}
+
+// AnnounceTransaction agenda o anúncio da transação para o próximo lote (trickle)
+func (node *P2PNode) AnnounceTransaction(tx *Transaction, exceptPeerID string) {
+	item := InvItem{Type: INV_TX, Hash: tx.ID}
+	node.seenInv.Add(item.key())
+	peers := node.peersWithout(item, exceptPeerID)
+
+	node.relayMtx.Lock()
+	for _, peerID := range peers {
+		node.txRelayQueue[peerID] = append(node.txRelayQueue[peerID], tx.ID)
+	}
+	node.relayMtx.Unlock()
+}
+
+func (node *P2PNode) sendInv(peerID string, items []InvItem) {
+	msg := &NetworkMessage{
+		Type:      MSG_INV,
+		Data:      &invMessage{Items: items},
+		Timestamp: time.Now(),
+	}
+	if err := node.sendToPeer(peerID, msg); err != nil {
+		fmt.Printf("⚠️ [%s] Falha ao anunciar inventário para %s: %v\n", node.ID, peerID, err)
+		return
+	}
+
+	for _, item := range items {
+		node.markPeerKnows(peerID, item)
+	}
+	node.countRelay("inv_messages", 1)
+	node.countRelay("inv_sent", len(items))
+}
+
+// trickleRoutine envia as transações pendentes em lotes com intervalo aleatório.
+// O custo cresce com o número de transações novas, e o momento do anúncio não
+// revela de qual peer a transação veio.
+func (node *P2PNode) trickleRoutine() {
+	for {
+		delay := trickleInterval/2 + time.Duration(rand.Int63n(int64(trickleInterval)))
+		if !node.wait(delay) {
+			return
+		}
+		node.flushTxRelay()
+	}
+}
+
+// flushTxRelay envia a cada peer um lote embaralhado das transações na fila
+func (node *P2PNode) flushTxRelay() {
+	node.relayMtx.Lock()
+	queues := node.txRelayQueue
+	node.txRelayQueue = make(map[string][]string)
+	node.relayMtx.Unlock()
+
+	for peerID, txIDs := range queues {
+		rand.Shuffle(len(txIDs), func(i, j int) { txIDs[i], txIDs[j] = txIDs[j], txIDs[i] })
+
+		// O excedente volta para a fila do próximo lote
+		if len(txIDs) > maxTxPerTrickle {
+			node.relayMtx.Lock()
+			node.txRelayQueue[peerID] = append(node.txRelayQueue[peerID], txIDs[maxTxPerTrickle:]...)
+			node.relayMtx.Unlock()
+			txIDs = txIDs[:maxTxPerTrickle]
+		}
+
+		items := make([]InvItem, 0, len(txIDs))
+		for _, id := range txIDs {
+			item := InvItem{Type: INV_TX, Hash: id}
+			if !node.peerKnows(peerID, item) {
+				items = append(items, item)
+			}
+		}
+		if len(items) > 0 {
+			node.sendInv(peerID, items)
+		}
+	}
+}
+
+// decodeInvItems extrai a lista de itens de inv/getdata/notfound
+func decodeInvItems(msg *NetworkMessage) ([]InvItem, error) {
+	data, ok := msg.Data.(*invMessage)
+	if !ok {
+		return nil, fmt.Errorf("%s com dados %T", msg.Type, msg.Data)
+	}
+	return data.Items, nil
+}
+
+// Pede (getdata) apenas os itens anunciados que o nó ainda não tem
+func (node *P2PNode) handleInv(msg *NetworkMessage) *NetworkMessage {
+	items, err := decodeInvItems(msg)
+	if err != nil {
+		return nil
+	}
+	if len(items) > maxInvPerMessage {
+		node.penalizePeer(msg.From, penaltyOversizedInv, fmt.Sprintf("inv com %d itens", len(items)))
+		return nil
+	}
+
+	wanted := make([]InvItem, 0, len(items))
+	for _, item := range items {
+		if item.Type != INV_BLOCK && item.Type != INV_TX {
+			continue
+		}
+		node.markPeerKnows(msg.From, item)
+		if node.hasInventory(item) {
+			continue
+		}
+		// Já pedido a outro peer dentro do prazo
+		if !node.requestedInv.Add(item.key()) {
+			continue
+		}
+		wanted = append(wanted, item)
+	}
+
+	if len(wanted) == 0 {
+		return nil
+	}
+	node.countRelay("getdata_sent", len(wanted))
+
+	return &NetworkMessage{
+		Type:      MSG_GET_DATA,
+		From:      node.ID,
+		To:        msg.From,
+		Data:      &invMessage{Items: wanted},
+		Timestamp: time.Now(),
+	}
+}
+
+// Envia o conteúdo dos itens pedidos; os que não existem voltam em notfound
+func (node *P2PNode) handleGetData(msg *NetworkMessage) *NetworkMessage {
+	items, err := decodeInvItems(msg)
+	if err != nil {
+		return nil
+	}
+	if len(items) > maxInvPerMessage {
+		node.penalizePeer(msg.From, penaltyOversizedInv, fmt.Sprintf("getdata com %d itens", len(items)))
+		return nil
+	}
+
+	notFound := make([]InvItem, 0)
+	for _, item := range items {
+		var reply *NetworkMessage
+		switch item.Type {
+		case INV_BLOCK:
+			if block := node.findBlock(item.Hash); block != nil {
+				reply = &NetworkMessage{Type: MSG_NEW_BLOCK, Data: block, Timestamp: time.Now()}
+				node.countRelay("blocks_served", 1)
+			}
+		case INV_TX:
+			if tx := node.findPendingTx(item.Hash); tx != nil {
+				reply = &NetworkMessage{Type: MSG_NEW_TRANSACTION, Data: tx, Timestamp: time.Now()}
+				node.countRelay("txs_served", 1)
+			}
+		}
+
+		if reply == nil {
+			notFound = append(notFound, item)
+			continue
+		}
+		node.markPeerKnows(msg.From, item)
+		node.sendToPeer(msg.From, reply)
+	}
+
+	if len(notFound) == 0 {
+		return nil
+	}
+	return &NetworkMessage{
+		Type:      MSG_NOT_FOUND,
+		From:      node.ID,
+		To:        msg.From,
+		Data:      &invMessage{Items: notFound},
+		Timestamp: time.Now(),
+	}
+}
+
+// Libera os itens para serem pedidos a outro peer que os anunciar
+func (node *P2PNode) handleNotFound(msg *NetworkMessage) *NetworkMessage {
+	items, err := decodeInvItems(msg)
+	if err != nil {
+		return nil
+	}
+	for _, item := range items {
+		node.requestedInv.Remove(item.key())
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// connectTriangle conecta três nós entre si e aguarda os handshakes
+func connectTriangle(t *testing.T) (*P2PNode, *P2PNode, *P2PNode) {
+	t.Helper()
+	nodeA := newTestNode(t, "node-A")
+	nodeB := newTestNode(t, "node-B")
+	nodeC := newTestNode(t, "node-C")
+
+	genesis := testBlock(1, "")
+	for _, node := range []*P2PNode{nodeA, nodeB, nodeC} {
+		node.Blockchain = []Token{genesis}
+		node.stakingGenesis = &StakingGenesis{Balances: map[string]int{addr("alice"): 1000}}
+	}
+
+	links := [][2]*P2PNode{{nodeB, nodeA}, {nodeC, nodeA}, {nodeC, nodeB}}
+	for _, link := range links {
+		if !link[0].ConnectToAddress("127.0.0.1", fmt.Sprintf("%d", link[1].Port)) {
+			t.Fatalf("%s não conseguiu conectar em %s", link[0].ID, link[1].ID)
+		}
+	}
+	for _, node := range []*P2PNode{nodeA, nodeB, nodeC} {
+		node := node
+		if !waitFor(t, defaultWait, func() bool { return len(node.connectedPeerIDs()) == 2 }) {
+			t.Fatalf("%s não completou as conexões", node.ID)
+		}
+	}
+	return nodeA, nodeB, nodeC
+}
+
+func pendingCount(node *P2PNode) int {
+	node.mutex.RLock()
+	defer node.mutex.RUnlock()
+	return len(node.PendingTxs)
+}
+
+func TestInventoryCacheExpiresAndIsBounded(t *testing.T) {
+	cache := newInventoryCache(100, 50*time.Millisecond)
+	if !cache.Add("block:a") || cache.Add("block:a") {
+		t.Fatal("segunda inserção do mesmo item deveria retornar false")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if cache.Has("block:a") {
+		t.Fatal("item deveria expirar")
+	}
+	if !cache.Add("block:a") {
+		t.Fatal("item expirado deveria poder ser inserido de novo")
+	}
+
+	for i := 0; i < 1000; i++ {
+		cache.Add(fmt.Sprintf("tx:%d", i))
+	}
+	if cache.Len() > 100 {
+		t.Fatalf("cache excedeu o limite: %d itens", cache.Len())
+	}
+}
+
+func TestBlockGossipDeliversEachBlockOnce(t *testing.T) {
+	nodeA, nodeB, nodeC := connectTriangle(t)
+
+	// Peers sem blocos compactos recebem inv e pedem o bloco via getdata
+	for _, node := range []*P2PNode{nodeA, nodeB, nodeC} {
+		node.mutex.Lock()
+		for _, peer := range node.Peers {
+			peer.ProtocolVersion = compactBlocksVersion - 1
+		}
+		node.mutex.Unlock()
+	}
+
+	block := testBlock(2, nodeA.Blockchain[0].Hash)
+	if !nodeA.validateAndAddBlock(&block) {
+		t.Fatal("A rejeitou o próprio bloco")
+	}
+	nodeA.AnnounceBlock(&block, "")
+
+	for _, node := range []*P2PNode{nodeB, nodeC} {
+		node := node
+		if !waitFor(t, defaultWait, func() bool { return chainHeight(node) == 2 }) {
+			t.Fatalf("%s não recebeu o bloco", node.ID)
+		}
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	// Cada nó recebe o conteúdo uma única vez; ninguém devolve o bloco para A
+	for _, node := range []*P2PNode{nodeB, nodeC} {
+		if got := node.GetRelayStats()["blocks_received"]; got != 1 {
+			t.Fatalf("%s recebeu o bloco %d vezes", node.ID, got)
+		}
+	}
+	if got := nodeA.GetRelayStats()["blocks_received"]; got != 0 {
+		t.Fatalf("A recebeu o próprio bloco de volta %d vezes", got)
+	}
+}
+
+func TestTransactionsAreTrickledOnce(t *testing.T) {
+	nodeA, nodeB, nodeC := connectTriangle(t)
+
+	const total = 5
+	for i := 0; i < total; i++ {
+		tx := stakingTx(fmt.Sprintf("tx-%d", i), "transfer", "alice", addr("bob"), 10+i)
+		nodeA.handleNewTransaction(&NetworkMessage{
+			Type: MSG_NEW_TRANSACTION,
+			From: "client",
+			Data: &tx,
+		})
+	}
+	if got := nodeA.GetRelayStats()["tx_relay_pending"]; got != 2*total {
+		t.Fatalf("transações deveriam aguardar o trickle: %d na fila", got)
+	}
+
+	for _, node := range []*P2PNode{nodeB, nodeC} {
+		node := node
+		if !waitFor(t, 3*trickleInterval, func() bool { return pendingCount(node) == total }) {
+			t.Fatalf("%s recebeu %d de %d transações", node.ID, pendingCount(node), total)
+		}
+	}
+	time.Sleep(2 * trickleInterval)
+
+	for _, node := range []*P2PNode{nodeB, nodeC} {
+		stats := node.GetRelayStats()
+		if stats["txs_received"] != total || stats["duplicates"] != 0 {
+			t.Fatalf("%s: cada transação deveria chegar uma vez: %v", node.ID, stats)
+		}
+	}
+	if got := nodeA.GetRelayStats()["txs_received"]; got != total {
+		t.Fatalf("transações ecoaram de volta para A: %d recebidas", got)
+	}
+}
+
+func TestOversizedInvIsPenalized(t *testing.T) {
+	node := NewP2PNode("node-A", "127.0.0.1", 0)
+
+	items := make([]InvItem, maxInvPerMessage+1)
+	for i := range items {
+		items[i] = InvItem{Type: INV_TX, Hash: fmt.Sprintf("tx-%d", i)}
+	}
+	reply := node.handleInv(&NetworkMessage{Type: MSG_INV, From: "spammer", Data: &invMessage{Items: items}})
+
+	if reply != nil {
+		t.Fatal("inv acima do limite não deveria gerar getdata")
+	}
+	node.security.mtx.Lock()
+	score := node.security.misbehavior["spammer"]
+	node.security.mtx.Unlock()
+	if score != penaltyOversizedInv {
+		t.Fatalf("pontuação de mau comportamento %d, esperado %d", score, penaltyOversizedInv)
+	}
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	mrand "math/rand"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Descoberta na rede local por beacons UDP multicast assinados
+const (
+	MSG_LAN_BEACON = "lan_beacon"
+
+	lanMulticastGroup     = "239.255.42.99:9999" // Escopo administrativo (não sai da organização)
+	lanBeaconInterval     = 30 * time.Second
+	lanBeaconMaxSkew      = 2 * time.Minute  // Beacons mais velhos ou adiantados são descartados
+	lanSourceMinInterval  = 10 * time.Second // Um beacon por IP de origem nesse intervalo
+	lanMaxBeaconsPerMin   = 60               // Beacons verificados por minuto, somando todas as origens
+	lanMaxBeaconSize      = 1400
+	lanPeerTTL            = 10 * time.Minute
+	lanDisableEnv         = "PTW_LAN_DISCOVERY" // "0" desliga a descoberta local
+	lanExcludedInterfaces = "PTW_LAN_EXCLUDE"   // Interfaces sem beacons, separadas por vírgula
+)
+
+// lanBeacon é o corpo do beacon; a assinatura é a da NetworkMessage
+type lanBeacon struct {
+	Port            int    `json:"port"`
+	ChainID         string `json:"chain_id,omitempty"`
+	ProtocolVersion int    `json:"protocol_version"`
+	PublicKey       string `json:"public_key"` // Chave de identidade (PKIX DER em base64)
+}
+
+// lanInterface é uma interface multicast com suas redes IPv4
+type lanInterface struct {
+	iface net.Interface
+	nets  []*net.IPNet
+}
+
+// LANDiscovery anuncia o nó e escuta anúncios de outros nós da rede local
+type LANDiscovery struct {
+	node     *P2PNode
+	group    *net.UDPAddr
+	enabled  bool
+	excluded map[string]bool // Interfaces em que o nó não anuncia nem escuta
+
+	mtx         sync.Mutex
+	lastSource  map[string]time.Time // Último beacon aceito para verificação por IP
+	windowStart time.Time
+	windowCount int
+	peers       map[string]time.Time // "ip:porta" -> último beacon válido
+
+	// listInterfaces permite simular interfaces nos testes
+	listInterfaces func() []lanInterface
+}
+
+func NewLANDiscovery(node *P2PNode) *LANDiscovery {
+	group, _ := net.ResolveUDPAddr("udp4", lanMulticastGroup)
+	ld := &LANDiscovery{
+		node:           node,
+		group:          group,
+		enabled:        os.Getenv(lanDisableEnv) != "0",
+		excluded:       make(map[string]bool),
+		lastSource:     make(map[string]time.Time),
+		peers:          make(map[string]time.Time),
+		listInterfaces: multicastInterfaces,
+	}
+	for _, name := range strings.Split(os.Getenv(lanExcludedInterfaces), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			ld.excluded[name] = true
+		}
+	}
+	return ld
+}
+
+// ExcludeInterface desliga os beacons em uma interface (ex.: docker0, VPN)
+func (ld *LANDiscovery) ExcludeInterface(name string) {
+	ld.mtx.Lock()
+	defer ld.mtx.Unlock()
+	ld.excluded[name] = true
+}
+
+// multicastInterfaces lista as interfaces ativas com multicast e IPv4
+func multicastInterfaces() []lanInterface {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+
+	var result []lanInterface
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagMulticast == 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		entry := lanInterface{iface: iface}
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() != nil {
+				entry.nets = append(entry.nets, ipnet)
+			}
+		}
+		if len(entry.nets) > 0 {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// interfaces retorna as interfaces multicast que não foram excluídas
+func (ld *LANDiscovery) interfaces() []lanInterface {
+	ld.mtx.Lock()
+	defer ld.mtx.Unlock()
+
+	var result []lanInterface
+	for _, entry := range ld.listInterfaces() {
+		if !ld.excluded[entry.iface.Name] {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// Start escuta o grupo em cada interface habilitada e envia beacons
+// periódicos até o nó encerrar
+func (ld *LANDiscovery) Start() {
+	if !ld.enabled || ld.group == nil {
+		fmt.Printf("📴 [%s] Descoberta na rede local desativada\n", ld.node.ID)
+		return
+	}
+
+	ifaces := ld.interfaces()
+	var conns []*net.UDPConn
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+	for _, entry := range ifaces {
+		iface := entry.iface
+		conn, err := net.ListenMulticastUDP("udp4", &iface, ld.group)
+		if err != nil {
+			fmt.Printf("⚠️ [%s] Multicast indisponível em %s: %v\n", ld.node.ID, iface.Name, err)
+			continue
+		}
+		conn.SetReadBuffer(64 * 1024)
+		conns = append(conns, conn)
+		ld.node.spawn(func() { ld.listen(conn) })
+	}
+	fmt.Printf("📡 [%s] Beacons na rede local em %d interface(s)\n", ld.node.ID, len(ifaces))
+
+	for {
+		ld.sendBeacons()
+		// Jitter evita que nós iniciados juntos anunciem em sincronia
+		jitter := time.Duration(mrand.Int63n(int64(lanBeaconInterval / 5)))
+		select {
+		case <-ld.node.ctx.Done():
+			return
+		case <-time.After(lanBeaconInterval - lanBeaconInterval/10 + jitter):
+		}
+	}
+}
+
+func (ld *LANDiscovery) listen(conn *net.UDPConn) {
+	defer conn.Close()
+	buffer := make([]byte, 2*lanMaxBeaconSize)
+	for {
+		n, src, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			fmt.Printf("🛑 [%s] Escuta multicast encerrada: %v\n", ld.node.ID, err)
+			return
+		}
+		ld.handleBeacon(buffer[:n], src)
+	}
+}
+
+// buildBeacon cria o beacon assinado com a chave de identidade do nó
+func (ld *LANDiscovery) buildBeacon() ([]byte, error) {
+	if ld.node.identity == nil {
+		return nil, fmt.Errorf("nó sem identidade")
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(&ld.node.identity.key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	ld.node.mutex.RLock()
+	chainID := ld.node.localChainID()
+	ld.node.mutex.RUnlock()
+
+	msg := &NetworkMessage{
+		Type: MSG_LAN_BEACON,
+		Data: &lanBeacon{
+			Port:            ld.node.Port,
+			ChainID:         chainID,
+			ProtocolVersion: ProtocolVersion,
+			PublicKey:       base64.StdEncoding.EncodeToString(publicKey),
+		},
+	}
+	if err := ld.node.signOutbound(msg); err != nil {
+		return nil, err
+	}
+	return encodeMessage(msg, ld.node.wireFormat)
+}
+
+// sendBeacons envia o beacon por cada interface habilitada, usando um IP
+// da interface como origem para que o kernel escolha a interface de saída
+func (ld *LANDiscovery) sendBeacons() {
+	payload, err := ld.buildBeacon()
+	if err != nil {
+		fmt.Printf("⚠️ [%s] Erro ao montar beacon: %v\n", ld.node.ID, err)
+		return
+	}
+
+	for _, entry := range ld.interfaces() {
+		conn, err := net.DialUDP("udp4", &net.UDPAddr{IP: entry.nets[0].IP}, ld.group)
+		if err != nil {
+			continue
+		}
+		conn.Write(payload)
+		conn.Close()
+	}
+}
+
+// allowSource aplica o limite por IP de origem e o limite global,
+// antes da verificação de assinatura (que é cara)
+func (ld *LANDiscovery) allowSource(ip string) bool {
+	ld.mtx.Lock()
+	defer ld.mtx.Unlock()
+
+	now := time.Now()
+	if last, exists := ld.lastSource[ip]; exists && now.Sub(last) < lanSourceMinInterval {
+		return false
+	}
+	if now.Sub(ld.windowStart) >= time.Minute {
+		ld.windowStart = now
+		ld.windowCount = 0
+		for source, last := range ld.lastSource {
+			if now.Sub(last) >= lanSourceMinInterval {
+				delete(ld.lastSource, source)
+			}
+		}
+	}
+	if ld.windowCount >= lanMaxBeaconsPerMin {
+		return false
+	}
+	ld.windowCount++
+	ld.lastSource[ip] = now
+	return true
+}
+
+// fromEnabledInterface confere se a origem está na rede de uma interface habilitada
+func (ld *LANDiscovery) fromEnabledInterface(ip net.IP) bool {
+	for _, entry := range ld.interfaces() {
+		for _, ipnet := range entry.nets {
+			if ipnet.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// handleBeacon valida o beacon e registra o nó no AddrManager como "local"
+func (ld *LANDiscovery) handleBeacon(data []byte, src *net.UDPAddr) error {
+	if len(data) > lanMaxBeaconSize {
+		return fmt.Errorf("beacon com %d bytes", len(data))
+	}
+	if src == nil || src.IP.To4() == nil || !ld.fromEnabledInterface(src.IP) {
+		return fmt.Errorf("beacon de interface desabilitada ou desconhecida")
+	}
+	if !ld.allowSource(src.IP.String()) {
+		return fmt.Errorf("limite de beacons excedido para %s", src.IP)
+	}
+
+	msg, err := decodeMessage(data)
+	if err != nil || msg.Type != MSG_LAN_BEACON {
+		return fmt.Errorf("beacon malformado")
+	}
+	if msg.From == ld.node.ID {
+		return fmt.Errorf("beacon do próprio nó")
+	}
+	if skew := time.Since(msg.Timestamp); skew > lanBeaconMaxSkew || skew < -lanBeaconMaxSkew {
+		return fmt.Errorf("beacon fora da janela de tempo")
+	}
+
+	beacon, ok := msg.Data.(*lanBeacon)
+	if !ok || beacon.Port <= 0 || beacon.Port > 65535 {
+		return fmt.Errorf("beacon malformado")
+	}
+
+	publicKey, err := parsePublicKey(beacon.PublicKey)
+	if err != nil {
+		return err
+	}
+	if !ld.node.security.VerifyMessage(msg, publicKey) {
+		return fmt.Errorf("assinatura do beacon inválida")
+	}
+
+	ld.node.mutex.RLock()
+	ourChain := ld.node.localChainID()
+	ld.node.mutex.RUnlock()
+	if ourChain != "" && beacon.ChainID != "" && beacon.ChainID != ourChain {
+		return fmt.Errorf("beacon de outra cadeia")
+	}
+	if beacon.ProtocolVersion < MinProtocolVersion {
+		return fmt.Errorf("beacon com protocolo %d", beacon.ProtocolVersion)
+	}
+
+	ip := src.IP.String()
+	port := strconv.Itoa(beacon.Port)
+	if ld.node.addrManager != nil {
+		// A chave precisa coincidir com a fixada para o ID, se houver
+		fingerprint, _ := keyFingerprint(publicKey)
+		if pin := ld.node.addrManager.PinnedKey(msg.From); pin != "" && pin != fingerprint {
+			return fmt.Errorf("chave do beacon difere da fixada para %s", msg.From)
+		}
+		if ld.node.isBanned(msg.From, ip, beacon.Port) {
+			return fmt.Errorf("beacon de peer banido")
+		}
+		ld.node.addrManager.AddAddress(ip, port, "local")
+	}
+
+	ld.mtx.Lock()
+	_, known := ld.peers[net.JoinHostPort(ip, port)]
+	ld.peers[net.JoinHostPort(ip, port)] = time.Now()
+	ld.mtx.Unlock()
+	if !known {
+		fmt.Printf("🔍 [%s] Peer na rede local: %s (%s:%s)\n", ld.node.ID, msg.From, ip, port)
+	}
+	return nil
+}
+
+// parsePublicKey decodifica uma chave RSA em base64 (DER PKIX), o formato
+// usado nos beacons e nas chaves de validador do estado
+func parsePublicKey(encoded string) (*rsa.PublicKey, error) {
+	der, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("chave pública inválida")
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("chave pública inválida")
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("chave pública não é RSA")
+	}
+	return rsaKey, nil
+}
+
+// encodePublicKey é o inverso de parsePublicKey
+func encodePublicKey(key *rsa.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(der)
+}
+
+// Peers lista os nós locais com beacon recente, do mais recente ao mais antigo
+func (ld *LANDiscovery) Peers() []string {
+	ld.mtx.Lock()
+	defer ld.mtx.Unlock()
+
+	var result []string
+	for addr, last := range ld.peers {
+		if time.Since(last) > lanPeerTTL {
+			delete(ld.peers, addr)
+			continue
+		}
+		result = append(result, addr)
+	}
+	sort.Slice(result, func(i, j int) bool { return ld.peers[result[i]].After(ld.peers[result[j]]) })
+	return result
+}
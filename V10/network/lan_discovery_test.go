@@ -0,0 +1,134 @@
+package main
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fakeInterfaces simula eth0 (10.0.0.0/24) e docker0 (172.17.0.0/16)
+func fakeInterfaces() []lanInterface {
+	_, lan, _ := net.ParseCIDR("10.0.0.1/24")
+	_, docker, _ := net.ParseCIDR("172.17.0.1/16")
+	return []lanInterface{
+		{iface: net.Interface{Name: "eth0"}, nets: []*net.IPNet{lan}},
+		{iface: net.Interface{Name: "docker0"}, nets: []*net.IPNet{docker}},
+	}
+}
+
+func newLANPair(t *testing.T) (*P2PNode, *LANDiscovery) {
+	t.Helper()
+	sender := newTestNode(t, "node-A")
+	receiver := newTestNode(t, "node-B")
+	receiver.lanDiscovery.listInterfaces = fakeInterfaces
+	return sender, receiver.lanDiscovery
+}
+
+func beaconFrom(t *testing.T, node *P2PNode) []byte {
+	t.Helper()
+	payload, err := node.lanDiscovery.buildBeacon()
+	if err != nil {
+		t.Fatalf("erro ao montar beacon: %v", err)
+	}
+	return payload
+}
+
+func udpFrom(ip string) *net.UDPAddr {
+	return &net.UDPAddr{IP: net.ParseIP(ip), Port: 9999}
+}
+
+func TestSignedBeaconFeedsAddrManager(t *testing.T) {
+	sender, ld := newLANPair(t)
+
+	if err := ld.handleBeacon(beaconFrom(t, sender), udpFrom("10.0.0.7")); err != nil {
+		t.Fatalf("beacon válido recusado: %v", err)
+	}
+
+	key := net.JoinHostPort("10.0.0.7", strconv.Itoa(sender.Port))
+	am := ld.node.addrManager
+	am.mtx.RLock()
+	addr := am.knownAddresses[key]
+	am.mtx.RUnlock()
+	if addr == nil || addr.Source != "local" {
+		t.Fatalf("endereço local não registrado: %+v", addr)
+	}
+	if peers := ld.Peers(); len(peers) != 1 || peers[0] != key {
+		t.Fatalf("beacon deveria anunciar a porta do listener: %v", peers)
+	}
+}
+
+func TestTamperedOrForeignBeaconsAreRejected(t *testing.T) {
+	sender, ld := newLANPair(t)
+
+	msg, _ := decodeMessage(beaconFrom(t, sender))
+	msg.Data.(*lanBeacon).Port = 1
+	tampered, _ := encodeMessage(msg, wireBinary)
+	if err := ld.handleBeacon(tampered, udpFrom("10.0.0.7")); err == nil {
+		t.Fatal("beacon adulterado aceito")
+	}
+
+	sender.ChainID = "outra-cadeia"
+	ld.node.ChainID = "nossa-cadeia"
+	if err := ld.handleBeacon(beaconFrom(t, sender), udpFrom("10.0.0.8")); err == nil {
+		t.Fatal("beacon de outra cadeia aceito")
+	}
+	if len(ld.Peers()) != 0 {
+		t.Fatalf("nenhum peer deveria ser registrado: %v", ld.Peers())
+	}
+}
+
+func TestBeaconsAreRateLimitedPerSource(t *testing.T) {
+	sender, ld := newLANPair(t)
+	payload := beaconFrom(t, sender)
+
+	if err := ld.handleBeacon(payload, udpFrom("10.0.0.7")); err != nil {
+		t.Fatalf("primeiro beacon recusado: %v", err)
+	}
+	if err := ld.handleBeacon(payload, udpFrom("10.0.0.7")); err == nil {
+		t.Fatal("beacon repetido da mesma origem deveria ser limitado")
+	}
+
+	// Limite global: origens diferentes também esgotam a janela
+	ld.mtx.Lock()
+	ld.windowCount = lanMaxBeaconsPerMin
+	ld.mtx.Unlock()
+	if err := ld.handleBeacon(payload, udpFrom("10.0.0.9")); err == nil {
+		t.Fatal("limite global de beacons deveria valer para novas origens")
+	}
+}
+
+func TestExcludedInterfaceIgnoresBeacons(t *testing.T) {
+	sender, ld := newLANPair(t)
+	ld.ExcludeInterface("docker0")
+
+	if err := ld.handleBeacon(beaconFrom(t, sender), udpFrom("172.17.0.5")); err == nil {
+		t.Fatal("beacon vindo de interface excluída aceito")
+	}
+	if err := ld.handleBeacon(beaconFrom(t, sender), udpFrom("192.168.1.20")); err == nil {
+		t.Fatal("beacon de rede sem interface local aceito")
+	}
+	for _, entry := range ld.interfaces() {
+		if entry.iface.Name == "docker0" {
+			t.Fatal("interface excluída não deveria enviar beacons")
+		}
+	}
+	if err := ld.handleBeacon(beaconFrom(t, sender), udpFrom("10.0.0.7")); err != nil {
+		t.Fatalf("beacon de interface habilitada recusado: %v", err)
+	}
+}
+
+func TestStaleBeaconIsRejected(t *testing.T) {
+	sender, ld := newLANPair(t)
+
+	fresh, _ := decodeMessage(beaconFrom(t, sender))
+	msg := &NetworkMessage{Type: MSG_LAN_BEACON, Data: fresh.Data, Timestamp: time.Now().Add(-2 * lanBeaconMaxSkew)}
+	if err := sender.signOutbound(msg); err != nil {
+		t.Fatal(err)
+	}
+	payload, _ := encodeMessage(msg, wireBinary)
+
+	if err := ld.handleBeacon(payload, udpFrom("10.0.0.7")); err == nil {
+		t.Fatal("beacon antigo (replay) aceito")
+	}
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	ossignal "os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// Ciclo de vida do nó. Start inicia as rotinas sob um contexto; Stop (ou o
+// cancelamento desse contexto) para de aceitar conexões, esvazia as filas
+// de envio dos peers, espera todas as rotinas terminarem e só então grava
+// endereços, âncoras, DHT, mempool e a cadeia. A cadeia também é gravada a
+// cada bloco novo; o estado (saldos, stake, delegações, slashing, beacon) é
+// reconstruído dela na próxima execução.
+const (
+	shutdownDrainTimeout = 5 * time.Second  // Prazo para esvaziar as filas quando ctx não tem prazo
+	shutdownTimeout      = 15 * time.Second // Prazo total do RunUntilSignal
+	mempoolFileName      = "mempool.json"
+	chainFileName        = "blockchain.json"
+)
+
+var errNodeStopping = errors.New("nó encerrando")
+
+// Start inicia o nó; cancelar ctx tem o mesmo efeito de chamar Stop
+func (node *P2PNode) Start(ctx context.Context) error {
+	if err := node.StartNode(); err != nil {
+		return err
+	}
+	node.stopParent = context.AfterFunc(ctx, func() {
+		node.Stop(context.Background())
+	})
+	return nil
+}
+
+// Stop encerra o nó de forma ordenada. O prazo de ctx limita a espera pelas
+// filas de envio e pelas rotinas; chamadas seguintes retornam o mesmo erro.
+func (node *P2PNode) Stop(ctx context.Context) error {
+	node.stopOnce.Do(func() {
+		node.stopErr = node.shutdown(ctx)
+		close(node.terminated)
+	})
+	return node.stopErr
+}
+
+// Done é fechado quando o Stop termina
+func (node *P2PNode) Done() <-chan struct{} {
+	return node.terminated
+}
+
+// RunUntilSignal inicia o nó e o encerra ao receber SIGINT ou SIGTERM
+func (node *P2PNode) RunUntilSignal(ctx context.Context) error {
+	ctx, stopSignals := ossignal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stopSignals()
+
+	if err := node.Start(ctx); err != nil {
+		return err
+	}
+	<-ctx.Done()
+	fmt.Printf("🛑 [%s] Sinal recebido, encerrando...\n", node.ID)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return node.Stop(shutdownCtx)
+}
+
+func (node *P2PNode) shutdown(ctx context.Context) error {
+	if _, hasDeadline := ctx.Deadline(); !hasDeadline {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, shutdownDrainTimeout)
+		defer cancel()
+	}
+	fmt.Printf("🛑 [%s] Encerrando nó...\n", node.ID)
+
+	// Daqui em diante nenhuma conexão nova é registrada
+	node.mutex.Lock()
+	node.cancel()
+	peers := make([]*peerConn, 0, len(node.Peers))
+	for _, peer := range node.Peers {
+		if peer.conn != nil {
+			peers = append(peers, peer.conn)
+		}
+	}
+	node.mutex.Unlock()
+	if node.stopParent != nil {
+		node.stopParent()
+	}
+
+	if node.listener != nil {
+		node.listener.Close()
+	}
+	if node.seedServer != nil {
+		node.seedServer.Close()
+	}
+
+	// As âncoras são as saídas ativas agora, antes de as conexões caírem
+	node.updateAnchors()
+	node.drainPeers(ctx, peers)
+
+	// Sem novas rotinas a partir daqui: o WaitGroup pode ser esperado
+	node.lifeMtx.Lock()
+	node.stopped = true
+	node.lifeMtx.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		node.routines.Wait()
+		close(finished)
+	}()
+	var err error
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		err = fmt.Errorf("rotinas do nó não encerraram a tempo: %v", ctx.Err())
+	}
+
+	// Grava o estado com as rotinas paradas
+	if node.addrManager != nil {
+		node.addrManager.Stop()
+	}
+	if node.dht != nil {
+		node.dht.save()
+	}
+	if saveErr := node.saveMempool(); saveErr != nil && err == nil {
+		err = saveErr
+	}
+	if saveErr := node.saveChain(); saveErr != nil && err == nil {
+		err = saveErr
+	}
+
+	fmt.Printf("👋 [%s] Nó encerrado\n", node.ID)
+	return err
+}
+
+// abortStart desfaz um StartNode que falhou no meio, como o shutdown:
+// cancela o contexto, fecha listener e seed server, espera as rotinas já
+// iniciadas e para o AddrManager
+func (node *P2PNode) abortStart() {
+	node.cancel()
+	if node.listener != nil {
+		node.listener.Close()
+	}
+	if node.seedServer != nil {
+		node.seedServer.Close()
+	}
+	node.lifeMtx.Lock()
+	node.stopped = true
+	node.lifeMtx.Unlock()
+	node.routines.Wait()
+	node.addrManager.Stop()
+	fmt.Printf("🛑 [%s] Inicialização abortada\n", node.ID)
+}
+
+// drainPeers espera cada peer enviar o que já está na fila; ao fim do
+// prazo as conexões restantes são fechadas
+func (node *P2PNode) drainPeers(ctx context.Context, peers []*peerConn) {
+	for _, pc := range peers {
+		pc.drain()
+	}
+	for _, pc := range peers {
+		select {
+		case <-pc.closed:
+		case <-ctx.Done():
+			pc.close()
+		}
+	}
+}
+
+// spawn executa fn em um goroutine acompanhado pelo Stop; depois do
+// encerramento fn não é executada
+func (node *P2PNode) spawn(fn func()) {
+	node.lifeMtx.Lock()
+	defer node.lifeMtx.Unlock()
+	if node.stopped {
+		return
+	}
+	node.routines.Add(1)
+	go func() {
+		defer node.routines.Done()
+		fn()
+	}()
+}
+
+// wait dorme d no relógio do nó; false se o nó começou a encerrar
+func (node *P2PNode) wait(d time.Duration) bool {
+	select {
+	case <-node.ctx.Done():
+		return false
+	case <-node.clock.After(d):
+		return true
+	}
+}
+
+// === Cadeia ===
+
+// saveChain grava a cadeia inteira de forma atômica (arquivo temporário e
+// rename), como o mempool
+func (node *P2PNode) saveChain() error {
+	node.chainFile.Lock()
+	defer node.chainFile.Unlock()
+
+	// Blocos gravados não mudam: basta copiar a lista sob o lock
+	node.mutex.RLock()
+	blocks := append([]Token(nil), node.Blockchain...)
+	node.mutex.RUnlock()
+	data, err := json.Marshal(blocks)
+	if err != nil {
+		return fmt.Errorf("erro ao serializar a cadeia: %v", err)
+	}
+
+	path := filepath.Join(node.dataDir, chainFileName)
+	tempFile := path + ".tmp"
+	if err := os.WriteFile(tempFile, data, 0600); err != nil {
+		return fmt.Errorf("erro ao gravar a cadeia: %v", err)
+	}
+	if err := os.Rename(tempFile, path); err != nil {
+		os.Remove(tempFile)
+		return fmt.Errorf("erro ao substituir a cadeia: %v", err)
+	}
+	return nil
+}
+
+// saveBlockchainToFile agenda a gravação da cadeia depois de um bloco
+// novo. Os blocos que chegam antes de ela começar entram na mesma gravação,
+// então uma sincronização longa não regrava a cadeia a cada bloco.
+func (node *P2PNode) saveBlockchainToFile() {
+	node.saveMtx.Lock()
+	defer node.saveMtx.Unlock()
+	if node.saveQueued {
+		return
+	}
+	node.saveQueued = true
+	node.spawn(func() {
+		node.chainFile.Lock()
+		node.saveMtx.Lock()
+		node.saveQueued = false
+		node.saveMtx.Unlock()
+		node.chainFile.Unlock()
+		if err := node.saveChain(); err != nil {
+			fmt.Printf("⚠️ [%s] %v\n", node.ID, err)
+		}
+	})
+}
+
+// loadBlockchainFromFile recupera a cadeia gravada até o primeiro bloco
+// fora de sequência; o estado é reconstruído dela sob demanda
+func (node *P2PNode) loadBlockchainFromFile() {
+	data, err := os.ReadFile(filepath.Join(node.dataDir, chainFileName))
+	if err != nil {
+		return
+	}
+	var blocks []Token
+	if err := json.Unmarshal(data, &blocks); err != nil {
+		fmt.Printf("⚠️ [%s] Cadeia gravada ilegível: %v\n", node.ID, err)
+		return
+	}
+	for i := range blocks {
+		if blocks[i].Index != i+1 || (i > 0 && blocks[i].PrevHash != blocks[i-1].Hash) {
+			fmt.Printf("⚠️ [%s] Cadeia gravada interrompida no bloco %d\n", node.ID, i+1)
+			blocks = blocks[:i]
+			break
+		}
+	}
+
+	node.mutex.Lock()
+	node.Blockchain = blocks
+	node.mutex.Unlock()
+	if len(blocks) > 0 {
+		fmt.Printf("📦 [%s] %d blocos restaurados\n", node.ID, len(blocks))
+	}
+}
+
+// === Mempool ===
+
+// saveMempool grava as transações pendentes para a próxima execução
+func (node *P2PNode) saveMempool() error {
+	node.mutex.RLock()
+	data, err := json.MarshalIndent(node.PendingTxs, "", "  ")
+	node.mutex.RUnlock()
+	if err != nil {
+		return fmt.Errorf("erro ao serializar mempool: %v", err)
+	}
+
+	path := filepath.Join(node.dataDir, mempoolFileName)
+	tempFile := path + ".tmp"
+	if err := os.WriteFile(tempFile, data, 0600); err != nil {
+		return fmt.Errorf("erro ao gravar mempool: %v", err)
+	}
+	if err := os.Rename(tempFile, path); err != nil {
+		os.Remove(tempFile)
+		return fmt.Errorf("erro ao substituir mempool: %v", err)
+	}
+	return nil
+}
+
+// loadMempool recupera as transações pendentes gravadas no último Stop,
+// revalidando cada uma e descartando as que já estão na cadeia
+func (node *P2PNode) loadMempool() {
+	data, err := os.ReadFile(filepath.Join(node.dataDir, mempoolFileName))
+	if err != nil {
+		return
+	}
+	var txs []Transaction
+	if err := json.Unmarshal(data, &txs); err != nil {
+		fmt.Printf("⚠️ [%s] Mempool gravado ilegível: %v\n", node.ID, err)
+		return
+	}
+
+	valid := txs[:0]
+	for i := range txs {
+		if node.validateTransaction(&txs[i]) {
+			valid = append(valid, txs[i])
+		}
+	}
+
+	node.mutex.Lock()
+	defer node.mutex.Unlock()
+
+	confirmed := make(map[string]bool)
+	for _, block := range node.Blockchain {
+		for _, tx := range block.Transactions {
+			confirmed[tx.ID] = true
+		}
+	}
+	for _, tx := range node.PendingTxs {
+		confirmed[tx.ID] = true
+	}
+	restored := 0
+	for i := range valid {
+		if confirmed[valid[i].ID] {
+			continue
+		}
+		confirmed[valid[i].ID] = true
+		node.PendingTxs = append(node.PendingTxs, valid[i])
+		restored++
+	}
+	if restored > 0 {
+		fmt.Printf("📦 [%s] %d transações pendentes restauradas\n", node.ID, restored)
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// packageGoroutines retorna a pilha dos goroutines que executam código do
+// pacote, indexada pelo cabeçalho "goroutine N"
+func packageGoroutines() map[string]string {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	// Nos testes o pacote main aparece pelo caminho de importação
+	self := runtime.FuncForPC(reflect.ValueOf(packageGoroutines).Pointer()).Name()
+	prefix := "\n" + self[:strings.LastIndexByte(self, '.')+1]
+
+	stacks := make(map[string]string)
+	for i, block := range strings.Split(string(buf), "\n\n") {
+		if i == 0 || !strings.Contains(block, prefix) {
+			continue // O primeiro é o próprio teste
+		}
+		header := block[:strings.IndexByte(block, '[')]
+		stacks[header] = block
+	}
+	return stacks
+}
+
+func TestStopLeavesNoGoroutines(t *testing.T) {
+	t.Setenv(lanDisableEnv, "0")
+	before := packageGoroutines()
+
+	// O bloco 1 é o gênese (hash = chain ID) e entra sem certificado; as
+	// chaves dos validadores vêm das identidades criadas antes do Start
+	nodes := make([]*P2PNode, 2)
+	validators := make([]string, 2)
+	for i, id := range []string{"node-A", "node-B"} {
+		nodes[i] = NewP2PNode(id, "127.0.0.1", 0)
+		nodes[i].dataDir = t.TempDir()
+		nodes[i].IsValidator, nodes[i].Stake = true, 10
+		identity, err := loadOrCreateIdentity(id, nodes[i].dataDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		validators[i] = fmt.Sprintf(`{"id": %q, "owner": %q, "amount": 10, "pub_key": %q}`, id, id, encodePublicKey(&identity.key.PublicKey))
+	}
+	genesis := `{"chain_id": "TEST_BLOCK_0001_xxxxxxxxxxxxxxxx", "staking": {"validators": [` + strings.Join(validators, ", ") + `]}}`
+	for _, node := range nodes {
+		if err := os.WriteFile(filepath.Join(node.dataDir, "genesis.json"), []byte(genesis), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := node.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	nodeA, nodeB := nodes[0], nodes[1]
+	if err := nodeA.connectToPeer(&Peer{Address: "127.0.0.1", Port: nodeB.Port}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Exercita as rotinas: heartbeat, anúncio de bloco e timers de consenso
+	nodeA.sendHeartbeat()
+	block := testBlock(1, "")
+	nodeA.mutex.Lock()
+	nodeA.Blockchain = append(nodeA.Blockchain, block)
+	nodeA.mutex.Unlock()
+	nodeA.AnnounceBlock(&block, "")
+	proposal := testBlock(2, block.Hash)
+	nodeA.StartConsensusRound(&proposal)
+	if !waitFor(t, defaultWait, func() bool { return chainHeight(nodeA) == 2 && chainHeight(nodeB) == 2 }) {
+		t.Fatal("B não recebeu o bloco ou a altura 2 não foi decidida")
+	}
+
+	for _, node := range nodes {
+		if err := node.Stop(context.Background()); err != nil {
+			t.Fatalf("Stop de %s: %v", node.ID, err)
+		}
+	}
+
+	var leaked []string
+	waitFor(t, defaultWait, func() bool {
+		leaked = leaked[:0]
+		for header, stack := range packageGoroutines() {
+			if _, existed := before[header]; !existed {
+				leaked = append(leaked, stack)
+			}
+		}
+		return len(leaked) == 0
+	})
+	if len(leaked) > 0 {
+		t.Fatalf("%d goroutines continuam rodando após o Stop:\n\n%s", len(leaked), strings.Join(leaked, "\n\n"))
+	}
+}
+
+func TestFailedStartLeavesNoGoroutines(t *testing.T) {
+	t.Setenv(lanDisableEnv, "0")
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	before := packageGoroutines()
+
+	// A porta ocupada faz o listener falhar depois do AddrManager e da
+	// rotação do certificado já estarem rodando
+	node := NewP2PNode("node-A", "127.0.0.1", busy.Addr().(*net.TCPAddr).Port)
+	node.dataDir = t.TempDir()
+	if err := node.Start(context.Background()); err == nil {
+		node.Stop(context.Background())
+		t.Fatal("nó iniciado numa porta ocupada")
+	}
+
+	var leaked []string
+	waitFor(t, defaultWait, func() bool {
+		leaked = leaked[:0]
+		for header, stack := range packageGoroutines() {
+			if _, existed := before[header]; !existed {
+				leaked = append(leaked, stack)
+			}
+		}
+		return len(leaked) == 0
+	})
+	if len(leaked) > 0 {
+		t.Fatalf("%d goroutines continuam rodando após a falha no Start:\n\n%s", len(leaked), strings.Join(leaked, "\n\n"))
+	}
+}
+
+func TestStopDrainsQueuedMessages(t *testing.T) {
+	nodeA := newTestNode(t, "node-A")
+	nodeB := newTestNode(t, "node-B")
+	if err := nodeA.connectToPeer(&Peer{Address: "127.0.0.1", Port: nodeB.Port}); err != nil {
+		t.Fatal(err)
+	}
+	if !waitFor(t, defaultWait, func() bool { return len(nodeB.connectedPeerIDs()) == 1 }) {
+		t.Fatal("B não registrou A")
+	}
+
+	// Enfileirado imediatamente antes do Stop: precisa chegar mesmo assim
+	msg := &NetworkMessage{Type: MSG_HEARTBEAT, Data: &heartbeatMessage{Height: 77}}
+	if err := nodeA.sendToPeer("node-B", msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := nodeA.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	delivered := waitFor(t, defaultWait, func() bool {
+		nodeB.mutex.RLock()
+		defer nodeB.mutex.RUnlock()
+		peer := nodeB.Peers["node-A"]
+		return peer != nil && peer.Height == 77
+	})
+	if !delivered {
+		t.Fatal("mensagem enfileirada perdida no encerramento")
+	}
+	if !waitFor(t, defaultWait, func() bool { return len(nodeB.connectedPeerIDs()) == 0 }) {
+		t.Fatal("conexão não foi fechada após esvaziar a fila")
+	}
+	if err := nodeA.connectToPeer(&Peer{Address: "127.0.0.1", Port: nodeB.Port}); err != errNodeStopping {
+		t.Fatalf("nó encerrado não deveria discar: %v", err)
+	}
+}
+
+func TestStopPersistsStateForNextRun(t *testing.T) {
+	nodeB := newTestNode(t, "node-B")
+	nodeA := newTestNode(t, "node-A")
+	if err := nodeA.connectToPeer(&Peer{Address: "127.0.0.1", Port: nodeB.Port}); err != nil {
+		t.Fatal(err)
+	}
+
+	// O bloco gravado gasta 4 do saldo do genesis; o mempool restaurado é
+	// revalidado contra o estado reconstruído da cadeia
+	genesis := fmt.Sprintf(`{"staking": {"balances": {%q: 10}}}`, addr("alice"))
+	if err := os.WriteFile(filepath.Join(nodeA.dataDir, "genesis.json"), []byte(genesis), 0644); err != nil {
+		t.Fatal(err)
+	}
+	nodeA.stakingGenesis = &StakingGenesis{Balances: map[string]int{addr("alice"): 10}}
+	block := testBlock(1, "")
+	block.Transactions = []Transaction{stakingTx("tx-gravada", "transfer", "alice", addr("bob"), 4)}
+	if !nodeA.validateAndAddBlock(&block) {
+		t.Fatal("bloco rejeitado")
+	}
+	tx := stakingTx("tx-pendente", "transfer", "alice", addr("bob"), 5)
+	tooMuch := stakingTx("tx-sem-saldo", "transfer", "alice", addr("bob"), 7)
+	nodeA.mutex.Lock()
+	nodeA.PendingTxs = append(nodeA.PendingTxs, tx, tooMuch)
+	nodeA.mutex.Unlock()
+
+	if err := nodeA.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"peers.json", "anchors.json", mempoolFileName, chainFileName} {
+		if _, err := os.Stat(filepath.Join(nodeA.dataDir, name)); err != nil {
+			t.Fatalf("%s não gravado no Stop: %v", name, err)
+		}
+	}
+
+	// Próxima execução: cadeia e mempool restaurados e âncora com B mantida
+	restarted := NewP2PNode("node-A", "127.0.0.1", 0)
+	restarted.dataDir = nodeA.dataDir
+	if err := restarted.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { restarted.Stop(context.Background()) })
+
+	restarted.mutex.RLock()
+	pending := restarted.PendingTxs
+	restarted.mutex.RUnlock()
+	if len(pending) != 1 || pending[0].ID != tx.ID {
+		t.Fatalf("mempool não restaurado: %+v", pending)
+	}
+	if chainHeight(restarted) != 1 || restarted.ChainState().Balances[addr("bob")] != 4 {
+		t.Fatalf("cadeia não restaurada: altura %d, saldo %d", chainHeight(restarted), restarted.ChainState().Balances[addr("bob")])
+	}
+	anchors := restarted.addrManager.Anchors()
+	if len(anchors) != 1 || !strings.HasSuffix(anchors[0], ":"+strconv.Itoa(nodeB.Port)) {
+		t.Fatalf("âncora perdida no encerramento: %v", anchors)
+	}
+}
+
+func TestCancellingStartContextStopsNode(t *testing.T) {
+	t.Setenv(lanDisableEnv, "0")
+	node := NewP2PNode("node-C", "127.0.0.1", 0)
+	node.dataDir = t.TempDir()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := node.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	select {
+	case <-node.Done():
+	case <-time.After(defaultWait):
+		t.Fatal("cancelar o contexto não encerrou o nó")
+	}
+	if err := node.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop após o cancelamento: %v", err)
+	}
+	if _, err := node.transport.Dial(node.listener.Addr().String(), node.tlsConfig, time.Second); err == nil {
+		t.Fatal("listener continua aceitando conexões")
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// Cliente leve. Acompanha a cadeia só pelos cabeçalhos assinados, sem
+// executar transações: cada cabeçalho vem com o certificado de commit
+// (+2/3 dos precommits do conjunto da época). O conjunto é fixo durante a
+// época e o bloco que a fecha anuncia o próximo. Como o hash de todo bloco
+// do consenso é o do cabeçalho (headerHash), o certificado cobre o conteúdo
+// do cabeçalho, inclusive o anúncio, e o cliente passa a confiar no novo
+// conjunto. Basta um cabeçalho por época para chegar ao topo.
+
+// BlockHeader é o bloco sem as transações, resumidas em TxRoot
+type BlockHeader struct {
+	Index          int              `json:"index"`
+	Hash           string           `json:"hash"`
+	PrevHash       string           `json:"prev_hash"`
+	Timestamp      string           `json:"timestamp"`
+	Validator      string           `json:"validator"`
+	TxRoot         string           `json:"tx_root"`
+	NextValidators []ValidatorStake `json:"next_validators,omitempty"`
+}
+
+// SignedHeader é o cabeçalho com o certificado que o decidiu
+type SignedHeader struct {
+	Header BlockHeader        `json:"header"`
+	Commit *CommitCertificate `json:"commit"`
+}
+
+func headerOf(block *Token) BlockHeader {
+	return BlockHeader{
+		Index:          block.Index,
+		Hash:           block.Hash,
+		PrevHash:       block.PrevHash,
+		Timestamp:      block.Timestamp,
+		Validator:      block.Validator,
+		TxRoot:         computeTxRoot(block.Transactions),
+		NextValidators: block.NextValidators,
+	}
+}
+
+// digest resume o cabeçalho, exceto o próprio hash
+func (h *BlockHeader) digest() string {
+	e := &wireEncoder{}
+	e.string(1, "header")
+	e.int(2, int64(h.Index))
+	e.string(3, h.PrevHash)
+	e.string(4, h.Timestamp)
+	e.string(5, h.Validator)
+	e.string(6, h.TxRoot)
+	for i := range h.NextValidators {
+		e.message(7, &h.NextValidators[i])
+	}
+	sum := sha256.Sum256(e.buf)
+	return hex.EncodeToString(sum[:])
+}
+
+// headerHash é o hash exigido de todo bloco do consenso
+func headerHash(block *Token) string {
+	header := headerOf(block)
+	return header.digest()
+}
+
+// LightClient guarda o último cabeçalho aceito e o conjunto da época dele
+type LightClient struct {
+	ChainID     string // Vazio: o hash do bloco 1, como em localChainID
+	EpochLength int
+	Height      int
+	Hash        string
+	GenesisHash string
+	Validators  []ValidatorStake // Conjunto da época em curso, com as chaves
+}
+
+// NewLightClient parte do conjunto do genesis
+func NewLightClient(genesis *StakingGenesis, chainID string) *LightClient {
+	state := newChainState(genesis, chainID)
+	return &LightClient{
+		ChainID:     chainID,
+		EpochLength: state.EpochLength,
+		Validators:  state.EpochValidators,
+	}
+}
+
+// epochEnd é a altura que fecha a época da altura informada
+func (lc *LightClient) epochEnd(height int) int {
+	return (height + lc.EpochLength - 1) / lc.EpochLength * lc.EpochLength
+}
+
+// validatorSetOf monta o conjunto de votação com as chaves anunciadas (ou
+// registradas no estado); validador sem chave válida fica sem chave
+func validatorSetOf(stakes []ValidatorStake) *validatorSet {
+	validators := make([]bftValidator, 0, len(stakes))
+	for _, v := range stakes {
+		validator := bftValidator{ID: v.ID, Power: v.Amount}
+		if key, err := parsePublicKey(v.PubKey); err == nil {
+			validator.key = key
+		}
+		validators = append(validators, validator)
+	}
+	return newValidatorSet(validators)
+}
+
+func (lc *LightClient) validatorSet() (*validatorSet, error) {
+	set := validatorSetOf(lc.Validators)
+	if set.size() == 0 || !set.hasQuorum(set.keyedPower()) {
+		return nil, fmt.Errorf("conjunto da época sem chaves de +2/3 do poder")
+	}
+	return set, nil
+}
+
+// Update aceita um cabeçalho da época em curso (no máximo o que a fecha) e,
+// se ele fechar a época, passa ao conjunto anunciado
+func (lc *LightClient) Update(sh *SignedHeader) error {
+	h := &sh.Header
+	if h.Index <= lc.Height {
+		return fmt.Errorf("cabeçalho %d não avança o cliente (altura %d)", h.Index, lc.Height)
+	}
+	end := lc.epochEnd(lc.Height + 1)
+	if h.Index > end {
+		return fmt.Errorf("cabeçalho %d além do fim da época (%d)", h.Index, end)
+	}
+	if lc.Height > 0 && h.Index == lc.Height+1 && h.PrevHash != lc.Hash {
+		return fmt.Errorf("cabeçalho %d não liga ao %d", h.Index, lc.Height)
+	}
+	if sh.Commit == nil {
+		return fmt.Errorf("cabeçalho %d sem certificado de commit", h.Index)
+	}
+	// O certificado assina o hash; o conteúdo só vale se o hash for o dele
+	if h.digest() != h.Hash {
+		return fmt.Errorf("cabeçalho %d: hash não corresponde ao conteúdo", h.Index)
+	}
+
+	chainID := lc.ChainID
+	if chainID == "" && h.Index > 1 {
+		if lc.GenesisHash == "" {
+			return fmt.Errorf("chain ID desconhecido: falta o cabeçalho 1")
+		}
+		chainID = lc.GenesisHash
+	}
+	set, err := lc.validatorSet()
+	if err != nil {
+		return err
+	}
+	if err := verifyCommit(chainID, &Token{Index: h.Index, Hash: h.Hash, Commit: sh.Commit}, set); err != nil {
+		return fmt.Errorf("cabeçalho %d: %v", h.Index, err)
+	}
+
+	if h.Index == end {
+		if len(h.NextValidators) == 0 {
+			return fmt.Errorf("cabeçalho %d fecha a época sem o próximo conjunto", h.Index)
+		}
+		lc.Validators = append([]ValidatorStake(nil), h.NextValidators...)
+		fmt.Printf("🔁 Cliente leve: conjunto da época seguinte à altura %d com %d validadores\n", h.Index, len(lc.Validators))
+	}
+	if h.Index == 1 {
+		lc.GenesisHash = h.Hash
+	}
+	lc.Height, lc.Hash = h.Index, h.Hash
+	return nil
+}
+
+// Sync leva o cliente até a altura tip: o cabeçalho 1 quando o chain ID
+// vem dele, um por fim de época e o do topo
+func (lc *LightClient) Sync(fetch func(height int) (*SignedHeader, error), tip int) error {
+	for lc.Height < tip {
+		next := lc.epochEnd(lc.Height + 1)
+		if lc.Height == 0 && lc.ChainID == "" {
+			next = 1
+		}
+		if next > tip {
+			next = tip
+		}
+		sh, err := fetch(next)
+		if err != nil {
+			return err
+		}
+		if err := lc.Update(sh); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// === Integração com o nó ===
+
+// SignedHeader serve o cabeçalho de um bloco decidido pelo consenso
+func (node *P2PNode) SignedHeader(height int) (*SignedHeader, error) {
+	node.mutex.RLock()
+	defer node.mutex.RUnlock()
+
+	if height < 1 || height > len(node.Blockchain) {
+		return nil, fmt.Errorf("bloco %d desconhecido", height)
+	}
+	block := &node.Blockchain[height-1]
+	if block.Commit == nil {
+		return nil, fmt.Errorf("bloco %d sem certificado de commit", height)
+	}
+	return &SignedHeader{Header: headerOf(block), Commit: block.Commit}, nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// lightChain monta uma cadeia de cabeçalhos assinados sobre o estado real,
+// com épocas de 2 blocos; D retira todo o stake no bloco 1 e sai do
+// conjunto na troca da altura 2
+func lightChain(t *testing.T, h *bftHarness, signers [][]string) (*StakingGenesis, []*SignedHeader) {
+	t.Helper()
+	genesis := &StakingGenesis{EpochLength: 2}
+	for _, id := range []string{"A", "B", "C", "D"} {
+		genesis.Validators = append(genesis.Validators, ValidatorStake{ID: id, Owner: addr(id), Amount: 100, PubKey: encodePublicKey(&h.keys[id].PublicKey)})
+	}
+	state := newChainState(genesis, "genesis")
+
+	var headers []*SignedHeader
+	prev := ""
+	for i, voters := range signers {
+		block := testBlock(i+1, prev)
+		if block.Index == 1 {
+			block.Transactions = []Transaction{stakingTx("u1", TX_UNSTAKE, "D", "D", 100)}
+		}
+		next := state.clone()
+		if err := next.applyBlock(&block); err != nil {
+			t.Fatal(err)
+		}
+		if next.isEpochBoundary(block.Index) {
+			block.NextValidators = next.EpochValidators
+		}
+		block.Hash = headerHash(&block)
+		if err := next.requireAnnouncement(&block); err != nil {
+			t.Fatal(err)
+		}
+		state = next
+
+		cert := &CommitCertificate{Height: block.Index, BlockHash: block.Hash}
+		for _, voter := range voters {
+			v := ConsensusVote{Height: block.Index, Type: votePrecommit, BlockHash: block.Hash, Voter: voter}
+			signature, err := signConsensus(h.keys[voter], voteSignBytes("genesis", &v))
+			if err != nil {
+				t.Fatal(err)
+			}
+			v.Signature = signature
+			cert.Precommits = append(cert.Precommits, v)
+		}
+		headers = append(headers, &SignedHeader{Header: headerOf(&block), Commit: cert})
+		prev = block.Hash
+	}
+	return genesis, headers
+}
+
+func TestLightClientFollowsValidatorSetHandover(t *testing.T) {
+	h := newBFTHarness(t)
+	genesis, headers := lightChain(t, h, [][]string{{"A", "B", "C"}, {"B", "C", "D"}, {"A", "C"}, {"A", "B", "C"}})
+	fetch := func(height int) (*SignedHeader, error) {
+		if height < 1 || height > len(headers) {
+			return nil, fmt.Errorf("cabeçalho %d desconhecido", height)
+		}
+		return headers[height-1], nil
+	}
+
+	// O bloco 2 anuncia A, B e C; na época 2, A e C somam só 2/3
+	client := NewLightClient(genesis, "genesis")
+	if err := client.Sync(fetch, 3); err == nil || !strings.Contains(err.Error(), "poder") {
+		t.Fatalf("certificado sem +2/3 do novo conjunto aceito: %v", err)
+	}
+	if client.Height != 2 || len(client.Validators) != 3 {
+		t.Fatalf("altura %d, conjunto %v", client.Height, client.Validators)
+	}
+	if err := client.Update(headers[3]); err != nil {
+		t.Fatal(err)
+	}
+	if client.Height != 4 || client.Hash != headers[3].Header.Hash {
+		t.Fatalf("cliente na altura %d (%s)", client.Height, client.Hash)
+	}
+
+	// Sem o cabeçalho do fim da época o cliente não pula para a seguinte
+	fresh := NewLightClient(genesis, "genesis")
+	if err := fresh.Update(headers[3]); err == nil {
+		t.Fatal("cabeçalho de outra época aceito sem a troca de conjunto")
+	}
+
+	// Conteúdo trocado depois da assinatura não confere com o hash, inclusive
+	// no meio da época
+	middle := *headers[0]
+	middle.Header.Timestamp = "2000-01-01T00:00:00Z"
+	if err := fresh.Update(&middle); err == nil || !strings.Contains(err.Error(), "conteúdo") {
+		t.Fatalf("cabeçalho adulterado no meio da época aceito: %v", err)
+	}
+	forged := *headers[1]
+	forged.Header.NextValidators = append([]ValidatorStake(nil), forged.Header.NextValidators...)
+	forged.Header.NextValidators[0].PubKey = encodePublicKey(&h.keys["D"].PublicKey)
+	if err := fresh.Update(&forged); err == nil || !strings.Contains(err.Error(), "conteúdo") {
+		t.Fatalf("anúncio adulterado aceito: %v", err)
+	}
+}
+
+func TestAnnouncementIsCheckedAgainstState(t *testing.T) {
+	h := newBFTHarness(t)
+	genesis, _ := lightChain(t, h, nil)
+	state := newChainState(genesis, "genesis")
+
+	first := testBlock(1, "")
+	first.NextValidators = state.EpochValidators
+	if err := state.clone().applyBlock(&first); err == nil {
+		t.Fatal("conjunto anunciado no meio da época aceito")
+	}
+	first.NextValidators = nil
+	if err := state.applyBlock(&first); err != nil {
+		t.Fatal(err)
+	}
+
+	// O bloco 2 fecha a época: o conjunto anunciado precisa ser o calculado
+	second := testBlock(2, first.Hash)
+	second.NextValidators = state.EpochValidators[:3]
+	if err := state.clone().applyBlock(&second); err == nil {
+		t.Fatal("conjunto diferente do calculado aceito")
+	}
+	second.NextValidators = nil
+	next := state.clone()
+	if err := next.applyBlock(&second); err != nil {
+		t.Fatal(err)
+	}
+	if err := next.requireAnnouncement(&second); err == nil {
+		t.Fatal("bloco do consenso fechou a época sem anunciar o conjunto")
+	}
+}
+
+// O anúncio é exigido também de blocos sem certificado: aqui o primeiro
+// stake cria o conjunto no bloco que fecha a época
+func TestBoundaryBlockWithoutCommitMustAnnounce(t *testing.T) {
+	node := newTestNode(t, "node-A")
+	node.stakingGenesis = &StakingGenesis{EpochLength: 1, Balances: map[string]int{addr("carol"): 50}}
+	stake := stakingTx("s1", TX_STAKE, "carol", "node-C", 50)
+	stake.ValidatorKey = testValidatorKey(t)
+	signWith("carol", &stake)
+
+	block := testBlock(1, "")
+	block.Transactions = []Transaction{stake}
+	if node.validateAndAddBlock(&block) {
+		t.Fatal("bloco sem certificado fechou a época sem anunciar o conjunto")
+	}
+	node.sealBlock(&block)
+	if len(block.NextValidators) != 1 || !node.validateAndAddBlock(&block) {
+		t.Fatalf("bloco com o anúncio rejeitado: %+v", block.NextValidators)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Porta P2P assumida para seeds e peers anunciados sem porta
+const defaultP2PPort = 8333
+
+// NetworkConfig reúne seeds, peers de bootstrap e portas da rede. Vem de
+// três camadas, cada uma sobrescrevendo a anterior: os padrões da rede
+// pública, a seção "network" do genesis.json (comum a todos os nós de uma
+// rede, ex.: um consórcio privado) e o network.json do próprio nó.
+type NetworkConfig struct {
+	DefaultPort    int               `json:"default_port,omitempty"`
+	DNSSeeds       []string          `json:"dns_seeds"`              // "dominio" ou "dominio:porta" (SRV, TXT, A/AAAA)
+	DNSResolver    string            `json:"dns_resolver,omitempty"` // Servidor DNS "ip:porta" para os seeds
+	BootstrapPeers []string          `json:"bootstrap_peers"`        // "host:porta" tentados em último caso
+	SeedServer     *SeedServerConfig `json:"seed_server,omitempty"`  // Responde consultas DNS com bons peers
+	WireFormat     string            `json:"wire_format,omitempty"`  // "binary" (padrão) ou "json" (depuração)
+}
+
+// SeedServerConfig liga o modo seed server do nó
+type SeedServerConfig struct {
+	Listen string `json:"listen"` // Endereço UDP, ex.: ":5353"
+	Zone   string `json:"zone"`   // Domínio servido, ex.: "seed.consorcio.local"
+}
+
+// GenesisConfig é a parte do genesis.json lida pela camada de rede
+type GenesisConfig struct {
+	ChainID string          `json:"chain_id,omitempty"`
+	Network *NetworkConfig  `json:"network,omitempty"`
+	Staking *StakingGenesis `json:"staking,omitempty"` // Saldos e stake iniciais (chain_state.go)
+}
+
+// DefaultNetworkConfig retorna os seeds e peers da rede pública PTW
+func DefaultNetworkConfig() *NetworkConfig {
+	return &NetworkConfig{
+		DefaultPort: defaultP2PPort,
+		DNSSeeds: []string{
+			"ptw-seed.example.com",
+			"seed.ptw-network.org",
+			"dns-seed.ptw-chain.net",
+			"ptw-seeder.blockchain.info",
+		},
+		BootstrapPeers: []string{
+			"104.131.144.82:8333",
+			"157.90.123.123:8333",
+			"45.76.203.127:8333",
+			"88.198.70.28:8333",
+			"78.47.3.220:8333",
+			"178.62.80.20:8333",
+			"163.172.161.52:8333",
+			"159.89.167.143:8333",
+			"127.0.0.1:8333", // Local para desenvolvimento
+		},
+	}
+}
+
+// LoadNetworkConfig monta a configuração de rede a partir do diretório de
+// dados e retorna também o chain ID do genesis.json, se houver
+func LoadNetworkConfig(dataDir string) (*NetworkConfig, string, error) {
+	config := DefaultNetworkConfig()
+
+	var genesis GenesisConfig
+	if err := readJSONFile(filepath.Join(dataDir, "genesis.json"), &genesis); err != nil {
+		return nil, "", err
+	}
+	config.merge(genesis.Network)
+
+	var local NetworkConfig
+	if err := readJSONFile(filepath.Join(dataDir, "network.json"), &local); err != nil {
+		return nil, "", err
+	}
+	config.merge(&local)
+	if format := os.Getenv(wireFormatEnv); format != "" {
+		config.WireFormat = format
+	}
+
+	if err := config.normalize(); err != nil {
+		return nil, "", err
+	}
+	return config, genesis.ChainID, nil
+}
+
+// readJSONFile decodifica o arquivo, se ele existir
+func readJSONFile(path string, target interface{}) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, target); err != nil {
+		return fmt.Errorf("%s inválido: %v", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// merge sobrescreve os campos presentes em other. Listas presentes, mesmo
+// vazias, substituem as anteriores: "dns_seeds": [] desliga os seeds públicos.
+func (c *NetworkConfig) merge(other *NetworkConfig) {
+	if other == nil {
+		return
+	}
+	if other.DefaultPort != 0 {
+		c.DefaultPort = other.DefaultPort
+	}
+	if other.DNSSeeds != nil {
+		c.DNSSeeds = other.DNSSeeds
+	}
+	if other.DNSResolver != "" {
+		c.DNSResolver = other.DNSResolver
+	}
+	if other.BootstrapPeers != nil {
+		c.BootstrapPeers = other.BootstrapPeers
+	}
+	if other.SeedServer != nil {
+		c.SeedServer = other.SeedServer
+	}
+	if other.WireFormat != "" {
+		c.WireFormat = other.WireFormat
+	}
+}
+
+// normalize valida a configuração e completa com a porta padrão os peers
+// de bootstrap informados sem porta
+func (c *NetworkConfig) normalize() error {
+	if c.DefaultPort <= 0 || c.DefaultPort > 65535 {
+		return fmt.Errorf("default_port inválida: %d", c.DefaultPort)
+	}
+
+	peers := make([]string, 0, len(c.BootstrapPeers))
+	for _, peer := range c.BootstrapPeers {
+		host, port, err := splitHostPortDefault(peer, c.DefaultPort)
+		if err != nil {
+			return fmt.Errorf("bootstrap_peers: %v", err)
+		}
+		peers = append(peers, net.JoinHostPort(host, port))
+	}
+	c.BootstrapPeers = peers
+
+	if c.DNSResolver != "" {
+		if _, _, err := net.SplitHostPort(c.DNSResolver); err != nil {
+			return fmt.Errorf("dns_resolver deve ser \"ip:porta\": %v", err)
+		}
+	}
+	if c.SeedServer != nil && (c.SeedServer.Listen == "" || c.SeedServer.Zone == "") {
+		return fmt.Errorf("seed_server precisa de listen e zone")
+	}
+	if _, err := parseWireFormat(c.WireFormat); err != nil {
+		return fmt.Errorf("wire_format: %v", err)
+	}
+	return nil
+}
+
+// splitHostPortDefault separa "host:porta", usando defaultPort se faltar a porta
+func splitHostPortDefault(addr string, defaultPort int) (string, string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		// Sem porta (inclusive IPv6 sem colchetes)
+		host, port = addr, strconv.Itoa(defaultPort)
+	}
+	if host == "" {
+		return "", "", fmt.Errorf("endereço sem host: %q", addr)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+		return "", "", fmt.Errorf("porta inválida em %q", addr)
+	}
+	return host, port, nil
+}
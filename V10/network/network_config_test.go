@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNetworkConfigDefaults(t *testing.T) {
+	config, chainID, err := LoadNetworkConfig(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chainID != "" {
+		t.Fatalf("sem genesis.json não deveria haver chain ID: %s", chainID)
+	}
+	if !reflect.DeepEqual(config, DefaultNetworkConfig()) {
+		t.Fatalf("configuração padrão inesperada: %+v", config)
+	}
+}
+
+func TestNetworkConfigLayers(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "genesis.json", `{
+		"chain_id": "consorcio-genesis",
+		"network": {
+			"default_port": 9333,
+			"dns_seeds": ["seed.consorcio.local"],
+			"bootstrap_peers": ["10.0.0.1", "10.0.0.2:9000"]
+		}
+	}`)
+	writeTestFile(t, dir, "network.json", `{"bootstrap_peers": ["10.0.0.9"], "dns_seeds": []}`)
+
+	config, chainID, err := LoadNetworkConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chainID != "consorcio-genesis" {
+		t.Fatalf("chain ID do genesis não lido: %q", chainID)
+	}
+	if config.DefaultPort != 9333 {
+		t.Fatalf("porta do genesis não aplicada: %d", config.DefaultPort)
+	}
+	// network.json do nó sobrescreve o genesis; lista vazia desliga os seeds
+	if len(config.DNSSeeds) != 0 {
+		t.Fatalf("seeds deveriam estar desligados: %v", config.DNSSeeds)
+	}
+	if !reflect.DeepEqual(config.BootstrapPeers, []string{"10.0.0.9:9333"}) {
+		t.Fatalf("peers de bootstrap inesperados: %v", config.BootstrapPeers)
+	}
+}
+
+func TestNetworkConfigRejectsInvalid(t *testing.T) {
+	cases := map[string]string{
+		"json":        `{"bootstrap_peers": [`,
+		"porta":       `{"bootstrap_peers": ["10.0.0.1:99999"]}`,
+		"seed server": `{"seed_server": {"listen": ":5353"}}`,
+		"resolvedor":  `{"dns_resolver": "10.0.0.1"}`,
+	}
+	for name, content := range cases {
+		dir := t.TempDir()
+		writeTestFile(t, dir, "network.json", content)
+		if _, _, err := LoadNetworkConfig(dir); err == nil {
+			t.Errorf("%s: configuração inválida aceita", name)
+		}
+	}
+}
+
+func TestStartNodeUsesGenesisConfig(t *testing.T) {
+	t.Setenv(lanDisableEnv, "0")
+
+	node := NewP2PNode("node-G", "127.0.0.1", 0)
+	node.dataDir = t.TempDir()
+	writeTestFile(t, node.dataDir, "genesis.json", `{
+		"chain_id": "consorcio-genesis",
+		"network": {
+			"bootstrap_peers": ["10.0.0.1:9000"],
+			"seed_server": {"listen": "127.0.0.1:0", "zone": "seed.consorcio.local"}
+		}
+	}`)
+	if err := node.StartNode(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { node.Stop(context.Background()) })
+
+	if node.ChainID != "consorcio-genesis" {
+		t.Fatalf("chain ID do genesis não aplicado: %q", node.ChainID)
+	}
+	if !reflect.DeepEqual(node.bootstrapManager.bootstrapPeers, []string{"10.0.0.1:9000"}) {
+		t.Fatalf("peers de bootstrap inesperados: %v", node.bootstrapManager.bootstrapPeers)
+	}
+	if node.seedServer == nil || node.seedServer.zone != "seed.consorcio.local" {
+		t.Fatal("modo seed server não iniciado")
+	}
+}
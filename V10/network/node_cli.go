@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Ponto de entrada do nó de rede:
+//
+//	go run . start <node_id> [porta]   inicia o nó até SIGINT/SIGTERM
+//	go run . pool-demo                 exemplo do pool de transações
+//
+// Com o nó rodando, cada linha digitada no terminal é um comando
+// administrativo (bans, scores, ban, unban).
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Println("Uso: go run . <comando>")
+		fmt.Println("Comandos:")
+		fmt.Println("  start <node_id> [porta] - Inicia o nó; aceita bans/scores/ban/unban pelo terminal")
+		fmt.Println("  pool-demo               - Exemplo do pool de transações")
+		return
+	}
+
+	switch os.Args[1] {
+	case "start":
+		if len(os.Args) < 3 {
+			fmt.Println("Erro: informe o node_id")
+			os.Exit(1)
+		}
+		if err := runNode(os.Args[2], os.Args[3:]); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+	case "pool-demo":
+		runPoolDemo()
+	default:
+		fmt.Printf("Comando desconhecido: %s\n", os.Args[1])
+		os.Exit(1)
+	}
+}
+
+// runNode inicia o nó e atende comandos administrativos pela entrada padrão
+// até receber SIGINT ou SIGTERM
+func runNode(nodeID string, args []string) error {
+	port := 0
+	if len(args) > 0 {
+		p, err := strconv.Atoi(args[0])
+		if err != nil || p <= 0 || p > 65535 {
+			return fmt.Errorf("porta inválida: %s", args[0])
+		}
+		port = p
+	} else {
+		config, _, err := LoadNetworkConfig(filepath.Join(".", "ptw_data"))
+		if err != nil {
+			return fmt.Errorf("erro ao carregar configuração de rede: %v", err)
+		}
+		port = config.DefaultPort
+	}
+
+	node := NewP2PNode(nodeID, "0.0.0.0", port)
+	go adminConsole(node, bufio.NewScanner(os.Stdin))
+	return node.RunUntilSignal(context.Background())
+}
+
+// adminConsole executa cada linha lida como comando de RunAdminCommand
+func adminConsole(node *P2PNode, input *bufio.Scanner) {
+	for input.Scan() {
+		if len(input.Bytes()) == 0 {
+			continue
+		}
+		out, err := node.RunAdminCommand(input.Text())
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			continue
+		}
+		fmt.Println(out)
+	}
+}
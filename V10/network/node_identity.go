@@ -0,0 +1,296 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Parâmetros dos certificados do nó
+const (
+	certValidity      = 30 * 24 * time.Hour // Validade de cada certificado
+	certRenewBefore   = 7 * 24 * time.Hour  // Renova quando faltar menos que isso
+	certCheckInterval = 12 * time.Hour
+)
+
+// NodeIdentity guarda a chave de identidade do nó e o certificado atual.
+// O certificado pode ser rotacionado, mas a chave (identidade) é sempre a mesma.
+type NodeIdentity struct {
+	nodeID      string
+	key         *rsa.PrivateKey
+	fingerprint string
+	keyFile     string
+	certFile    string
+	mtx         sync.RWMutex
+	cert        *tls.Certificate
+	notAfter    time.Time
+}
+
+// keyFingerprint é o SHA-256 da chave pública (SubjectPublicKeyInfo)
+func keyFingerprint(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(der)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// loadOrCreateIdentity carrega a chave do nó do disco ou gera uma nova
+func loadOrCreateIdentity(nodeID, dataDir string) (*NodeIdentity, error) {
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return nil, err
+	}
+
+	id := &NodeIdentity{
+		nodeID:   nodeID,
+		keyFile:  filepath.Join(dataDir, "node_key.pem"),
+		certFile: filepath.Join(dataDir, "node.crt"),
+	}
+
+	if data, err := os.ReadFile(id.keyFile); err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("falha ao decodificar chave do nó")
+		}
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		rsaKey, ok := parsed.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("chave do nó não é RSA")
+		}
+		id.key = rsaKey
+	} else {
+		// Gera par de chaves RSA 2048 bits (mesmo padrão de crypto/keypair.go)
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(id.keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+			return nil, err
+		}
+		id.key = key
+		fmt.Printf("🔑 [%s] Nova chave de identidade gerada\n", nodeID)
+	}
+
+	fingerprint, err := keyFingerprint(&id.key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	id.fingerprint = fingerprint
+	return id, nil
+}
+
+// ensureCertificate carrega o certificado ou emite um novo com a mesma chave
+func (id *NodeIdentity) ensureCertificate() error {
+	if data, err := os.ReadFile(id.certFile); err == nil {
+		if block, _ := pem.Decode(data); block != nil {
+			if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+				fp, _ := keyFingerprint(cert.PublicKey)
+				if fp == id.fingerprint && time.Until(cert.NotAfter) > certRenewBefore {
+					id.setCertificate(block.Bytes, cert.NotAfter)
+					return nil
+				}
+			}
+		}
+	}
+	return id.RotateCertificate()
+}
+
+// RotateCertificate emite um novo certificado self-signed com a chave de identidade
+func (id *NodeIdentity) RotateCertificate() error {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	notBefore := time.Now().Add(-time.Hour)
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: id.nodeID},
+		NotBefore:    notBefore,
+		NotAfter:     notBefore.Add(certValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &id.key.PublicKey, id.key)
+	if err != nil {
+		return err
+	}
+
+	// Grava de forma atômica para não deixar certificado parcial no disco
+	tempFile := id.certFile + ".tmp"
+	if err := os.WriteFile(tempFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tempFile, id.certFile); err != nil {
+		os.Remove(tempFile)
+		return err
+	}
+
+	id.setCertificate(der, template.NotAfter)
+	fmt.Printf("📜 [%s] Certificado emitido (válido até %s)\n", id.nodeID, template.NotAfter.Format(time.RFC3339))
+	return nil
+}
+
+func (id *NodeIdentity) setCertificate(der []byte, notAfter time.Time) {
+	id.mtx.Lock()
+	defer id.mtx.Unlock()
+
+	id.cert = &tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  id.key,
+	}
+	id.notAfter = notAfter
+}
+
+func (id *NodeIdentity) currentCertificate() *tls.Certificate {
+	id.mtx.RLock()
+	defer id.mtx.RUnlock()
+	return id.cert
+}
+
+// rotationRoutine renova o certificado antes de expirar, até done fechar
+func (id *NodeIdentity) rotationRoutine(done <-chan struct{}) {
+	ticker := time.NewTicker(certCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		id.mtx.RLock()
+		expiring := time.Until(id.notAfter) < certRenewBefore
+		id.mtx.RUnlock()
+
+		if expiring {
+			if err := id.RotateCertificate(); err != nil {
+				fmt.Printf("❌ [%s] Erro ao rotacionar certificado: %v\n", id.nodeID, err)
+			}
+		}
+	}
+}
+
+// verifySelfSignedCert aceita apenas certificados self-signed válidos.
+// A confiança vem do pin da chave por ID do nó, não de uma CA.
+func verifySelfSignedCert(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	if len(rawCerts) == 0 {
+		return fmt.Errorf("peer não apresentou certificado")
+	}
+
+	cert, err := x509.ParseCertificate(rawCerts[0])
+	if err != nil {
+		return err
+	}
+	if err := cert.CheckSignatureFrom(cert); err != nil {
+		return fmt.Errorf("certificado não é self-signed: %v", err)
+	}
+
+	now := time.Now()
+	if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return fmt.Errorf("certificado fora da validade")
+	}
+	return nil
+}
+
+// tlsConfig monta a configuração de TLS mútuo do nó
+func (id *NodeIdentity) tlsConfig() *tls.Config {
+	return &tls.Config{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return id.currentCertificate(), nil
+		},
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return id.currentCertificate(), nil
+		},
+		ClientAuth: tls.RequireAnyClientCert,
+		// A verificação por cadeia de CA é substituída por verifySelfSignedCert + pin
+		InsecureSkipVerify:    true,
+		VerifyPeerCertificate: verifySelfSignedCert,
+		MinVersion:            tls.VersionTLS12,
+	}
+}
+
+// peerCertificate retorna o certificado apresentado pelo peer na conexão TLS
+func peerCertificate(conn net.Conn) (*x509.Certificate, error) {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil, fmt.Errorf("conexão não é TLS")
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, err
+	}
+
+	state := tlsConn.ConnectionState()
+	if len(state.PeerCertificates) == 0 {
+		return nil, fmt.Errorf("peer não apresentou certificado")
+	}
+	return state.PeerCertificates[0], nil
+}
+
+// verifyPeerIdentity confere se a chave do certificado pertence ao ID anunciado.
+// Na primeira conexão a chave é fixada (TOFU); depois precisa coincidir com o pin.
+func (node *P2PNode) verifyPeerIdentity(conn net.Conn, peer *Peer) error {
+	cert, err := peerCertificate(conn)
+	if err != nil {
+		return err
+	}
+	if cert.Subject.CommonName != peer.ID {
+		return fmt.Errorf("certificado emitido para %q, mas o peer se anuncia como %q", cert.Subject.CommonName, peer.ID)
+	}
+
+	rsaKey, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("chave do certificado não é RSA")
+	}
+	fingerprint, err := keyFingerprint(rsaKey)
+	if err != nil {
+		return err
+	}
+	peer.KeyFingerprint = fingerprint
+	peer.publicKey = rsaKey
+
+	if node.addrManager == nil {
+		return nil
+	}
+	return node.addrManager.PinNodeKey(peer.ID, peer.Address, fmt.Sprintf("%d", peer.Port), fingerprint)
+}
+
+// ensureTLSCertificates prepara a identidade do nó e o certificado atual
+func (node *P2PNode) ensureTLSCertificates() error {
+	identity, err := loadOrCreateIdentity(node.ID, node.dataDir)
+	if err != nil {
+		return err
+	}
+	if err := identity.ensureCertificate(); err != nil {
+		return err
+	}
+
+	node.identity = identity
+	node.tlsConfig = identity.tlsConfig()
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMutualTLSPinsNodeKey(t *testing.T) {
+	nodeA := newTestNode(t, "node-A")
+	nodeB := newTestNode(t, "node-B")
+
+	if !nodeB.ConnectToAddress("127.0.0.1", fmt.Sprintf("%d", nodeA.Port)) {
+		t.Fatal("B não conseguiu conectar em A")
+	}
+	if !waitFor(t, defaultWait, func() bool { return len(nodeA.connectedPeerIDs()) == 1 }) {
+		t.Fatal("A não registrou B")
+	}
+
+	// Ambos os lados verificaram o certificado do outro (TLS mútuo)
+	nodeA.mutex.RLock()
+	fpB := nodeA.Peers["node-B"].KeyFingerprint
+	nodeA.mutex.RUnlock()
+	if fpB != nodeB.identity.fingerprint {
+		t.Fatalf("A fixou chave errada para B: %s", fpB)
+	}
+
+	// Outro nó usando o ID "node-B" com uma chave diferente é recusado
+	impostor := newTestNode(t, "node-B")
+	if impostor.ConnectToAddress("127.0.0.1", fmt.Sprintf("%d", nodeA.Port)) {
+		t.Fatal("impostor com chave diferente não deveria conectar")
+	}
+}
+
+func TestCertificateRotationKeepsIdentity(t *testing.T) {
+	nodeA := newTestNode(t, "node-A")
+	nodeB := newTestNode(t, "node-B")
+
+	if !nodeB.ConnectToAddress("127.0.0.1", fmt.Sprintf("%d", nodeA.Port)) {
+		t.Fatal("B não conseguiu conectar em A")
+	}
+
+	oldCert := nodeB.identity.currentCertificate()
+	if err := nodeB.identity.RotateCertificate(); err != nil {
+		t.Fatal(err)
+	}
+	if nodeB.identity.currentCertificate() == oldCert {
+		t.Fatal("certificado não foi rotacionado")
+	}
+
+	// Nova conexão com o certificado rotacionado continua aceita pelo pin
+	nodeB.mutex.Lock()
+	nodeB.Peers["node-A"].conn.close()
+	nodeB.mutex.Unlock()
+	waitFor(t, defaultWait, func() bool { return len(nodeA.connectedPeerIDs()) == 0 })
+
+	if !nodeB.ConnectToAddress("127.0.0.1", fmt.Sprintf("%d", nodeA.Port)) {
+		t.Fatal("reconexão após rotação deveria ser aceita")
+	}
+}
+
+func TestIdentityReloadedFromDisk(t *testing.T) {
+	dir := t.TempDir()
+	first, err := loadOrCreateIdentity("node-A", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := loadOrCreateIdentity("node-A", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.fingerprint != second.fingerprint {
+		t.Fatal("identidade mudou ao recarregar do disco")
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+)
+
+// Conexões de saída por grupo de rede (/16 no IPv4): um atacante com uma
+// faixa de IPs não ocupa todas as saídas do nó. Loopback e redes privadas
+// ficam fora do limite.
+const maxOutboundPerNetgroup = 1
+
+// outboundInGroup conta as conexões de saída no grupo do IP (chamar com node.mutex)
+func (node *P2PNode) outboundInGroup(ip string) int {
+	group := netGroup(ip)
+	if group == localNetGroup {
+		return 0
+	}
+
+	count := 0
+	for _, peer := range node.Peers {
+		if peer.conn != nil && !peer.conn.inbound && netGroup(peer.Address) == group {
+			count++
+		}
+	}
+	return count
+}
+
+// checkOutboundNetgroup recusa discar para um grupo que já atingiu o limite
+func (node *P2PNode) checkOutboundNetgroup(ip string) error {
+	node.mutex.RLock()
+	defer node.mutex.RUnlock()
+
+	if node.outboundInGroup(ip) >= maxOutboundPerNetgroup {
+		return fmt.Errorf("limite de conexões de saída para o grupo %s", netGroup(ip))
+	}
+	return nil
+}
+
+// updateAnchors grava as conexões de saída mais antigas como âncoras.
+// Sem nenhuma saída ativa as âncoras anteriores são mantidas, para que uma
+// queda de rede não apague os peers aos quais o nó deve voltar.
+func (node *P2PNode) updateAnchors() {
+	if node.addrManager == nil {
+		return
+	}
+
+	node.mutex.RLock()
+	outbound := make([]*Peer, 0)
+	for _, peer := range node.Peers {
+		if peer.conn != nil && !peer.conn.inbound {
+			outbound = append(outbound, peer)
+		}
+	}
+	sort.Slice(outbound, func(i, j int) bool {
+		return outbound[i].conn.openedAt.Before(outbound[j].conn.openedAt)
+	})
+	anchors := make([]string, 0, maxAnchors)
+	for _, peer := range outbound {
+		if len(anchors) == maxAnchors {
+			break
+		}
+		anchors = append(anchors, net.JoinHostPort(peer.Address, fmt.Sprintf("%d", peer.Port)))
+	}
+	node.mutex.RUnlock()
+
+	if len(anchors) > 0 {
+		node.addrManager.SaveAnchors(anchors)
+	}
+}
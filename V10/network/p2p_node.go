@@ -1,8 +1,9 @@
 package main
 
 import (
+	"context"
+	"crypto/rsa"
 	"crypto/tls"
-	"encoding/json"
 	"fmt"
 	"net"
 	"path/filepath"
@@ -24,6 +25,11 @@ type Token struct {
 	WalletSignature string        `json:"wallet_signature,omitempty"`
 	MinerID         string        `json:"miner_id,omitempty"`
 	Transactions    []Transaction `json:"transactions,omitempty"`
+
+	Commit *CommitCertificate `json:"commit,omitempty"` // Precommits que decidiram o bloco (bft.go)
+
+	// Só no bloco que fecha a época: conjunto de validadores da próxima (chain_state.go)
+	NextValidators []ValidatorStake `json:"next_validators,omitempty"`
 }
 
 type P2PNode struct {
@@ -35,14 +41,66 @@ type P2PNode struct {
 	PendingTxs  []Transaction    `json:"pending_transactions"`
 	IsValidator bool             `json:"is_validator"`
 	Stake       int              `json:"stake"`
+	ChainID     string           `json:"chain_id,omitempty"` // Hash gênese esperado
+	Services    uint64           `json:"services"`           // Serviços extras (light-server, miner)
 	mutex       sync.RWMutex
 	listener    net.Listener
+	dataDir     string
+	tlsConfig   *tls.Config
+	identity    *NodeIdentity
+	security    *SecurityManager
 
 	// Bitcoin-style discovery
 	addrManager      *AddrManager
 	dnsSeeder        *DNSSeeder
 	bootstrapManager *BootstrapManager
 	dht              *DHTTable
+	lanDiscovery     *LANDiscovery
+	netConfig        *NetworkConfig
+	seedServer       *SeedServer
+
+	// Gossip por inventário (inv/getdata)
+	seenInv      *inventoryCache     // Itens já recebidos ou processados
+	requestedInv *inventoryCache     // Itens pedidos via getdata aguardando resposta
+	relayMtx     sync.Mutex          // Protege txRelayQueue e relayStats
+	txRelayQueue map[string][]string // Transações a anunciar por peer (trickle)
+	relayStats   map[string]int
+	compact      compactState // Blocos compactos em reconstrução
+
+	trafficMtx   sync.Mutex
+	trafficStats map[string]int // Mensagens descartadas ou atrasadas (GetTrafficStats)
+
+	dhtRPC dhtState // Requisições Kademlia aguardando resposta
+
+	// Consenso BFT (bft.go, consensus.go)
+	bft            *bftEngine
+	consensusMutex sync.Mutex // Protege bft; tomado antes de mutex
+
+	// Estado da cadeia (chain_state.go): saldos, stake e unbonding
+	stakingGenesis *StakingGenesis
+	state          *ChainState // Cache até state.Height; reconstruído sob demanda
+	stateMtx       sync.Mutex  // Protege state; tomado depois de mutex
+
+	wireFormat wireFormat // Binário; JSON no modo de depuração
+
+	// Ciclo de vida (lifecycle.go): ctx é cancelado no Stop
+	ctx        context.Context
+	cancel     context.CancelFunc
+	routines   sync.WaitGroup // Goroutines iniciadas por spawn
+	lifeMtx    sync.Mutex     // Protege stopped contra spawn concorrente
+	stopped    bool
+	stopOnce   sync.Once
+	stopErr    error
+	stopParent func() bool // Desfaz o vínculo com o contexto do Start
+	terminated chan struct{}
+	chainFile  sync.Mutex // Serializa as gravações de blockchain.json
+	saveMtx    sync.Mutex // Protege saveQueued
+	saveQueued bool       // Gravação da cadeia agendada e ainda não iniciada
+
+	// Relógio e transporte (reais por padrão; virtuais no simulador)
+	clock        Clock
+	transport    Transport
+	outboundHook func(peerID string, msg *NetworkMessage) *NetworkMessage // Simulador: altera ou descarta (nil) mensagens já assinadas
 }
 
 type Peer struct {
@@ -52,6 +110,19 @@ type Peer struct {
 	LastSeen time.Time `json:"last_seen"`
 	IsActive bool      `json:"is_active"`
 	Stake    int       `json:"stake"`
+	Height   int       `json:"height"`
+
+	// Dados negociados no handshake de versão
+	BestHash        string `json:"best_hash,omitempty"`
+	ChainID         string `json:"chain_id,omitempty"`
+	ProtocolVersion int    `json:"protocol_version"`
+	Services        uint64 `json:"services"`
+	UserAgent       string `json:"user_agent,omitempty"`
+	KeyFingerprint  string `json:"key_fingerprint,omitempty"` // SHA-256 da chave do certificado
+
+	conn      *peerConn
+	publicKey *rsa.PublicKey
+	knownInv  *inventoryCache // Itens que o peer já conhece
 }
 
 type NetworkMessage struct {
@@ -61,11 +132,8 @@ type NetworkMessage struct {
 	Data      interface{} `json:"data"`
 	Timestamp time.Time   `json:"timestamp"`
 	Signature string      `json:"signature"`
-}
 
-type BootstrapNode struct {
-	Address string `json:"address"`
-	Port    int    `json:"port"`
+	signed []byte // Bytes assinados como recebidos (envelope binário)
 }
 
 // Constantes
@@ -75,6 +143,7 @@ const (
 	MSG_NEW_TRANSACTION   = "new_transaction"
 	MSG_CONSENSUS_REQUEST = "consensus_request"
 	MSG_CONSENSUS_VOTE    = "consensus_vote"
+	MSG_CONSENSUS_START   = "consensus_start"
 	MSG_SYNC_REQUEST      = "sync_request"
 	MSG_SYNC_RESPONSE     = "sync_response"
 	MSG_HEARTBEAT         = "heartbeat"
@@ -84,17 +153,59 @@ const (
 	MSG_INTRODUCTION_ACK  = "introduction_ack"
 	MSG_DIFFICULTY_UPDATE = "difficulty_update"
 	MSG_DIFFICULTY_ACK    = "difficulty_ack"
+	MSG_PEER_LIST         = "peer_list"
+	MSG_TX_ACCEPTED       = "transaction_accepted"
+	MSG_TX_REJECTED       = "transaction_rejected"
 )
 
-var DefaultBootstrapNodes = []BootstrapNode{
-	{"127.0.0.1", 8080}, // Local para desenvolvimento
-	{"127.0.0.1", 8081},
-	{"127.0.0.1", 8082},
+// Corpos das mensagens (esquemas binários em wire_schema.go)
+type heartbeatMessage struct {
+	Height int `json:"blockchain_height"`
+}
+
+type syncRequest struct {
+	CurrentHeight int `json:"current_height"`
+}
+
+type syncResponse struct {
+	Blocks []Token `json:"blocks"`
+	Height int     `json:"height"` // Altura do remetente, para pedir a próxima página
+}
+
+type addrRequest struct {
+	MaxAddresses int `json:"max_addresses"`
+}
+
+type addrResponse struct {
+	Addresses []addrEntry `json:"addresses"`
+}
+
+type addrEntry struct {
+	IP   string `json:"ip"`
+	Port string `json:"port"`
+}
+
+type peerList struct {
+	Peers []peerListEntry `json:"peers"`
+}
+
+type peerListEntry struct {
+	ID      string `json:"id"`
+	Address string `json:"address"`
+	Port    int    `json:"port"`
+}
+
+// txStatus responde a new_transaction (aceita ou rejeitada)
+type txStatus struct {
+	TxID      string `json:"tx_id"`
+	Status    string `json:"status,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	Validated bool   `json:"validated,omitempty"`
 }
 
 // Construtor
 func NewP2PNode(id, address string, port int) *P2PNode {
-	return &P2PNode{
+	node := &P2PNode{
 		ID:          id,
 		Address:     address,
 		Port:        port,
@@ -103,80 +214,135 @@ func NewP2PNode(id, address string, port int) *P2PNode {
 		PendingTxs:  []Transaction{},
 		IsValidator: false,
 		Stake:       0,
+		dataDir:     filepath.Join(".", "ptw_data"),
+
+		seenInv:      newInventoryCache(seenInvSize, inventoryTTL),
+		requestedInv: newInventoryCache(seenInvSize, getDataTimeout),
+		txRelayQueue: make(map[string][]string),
+		relayStats:   make(map[string]int),
+		trafficStats: make(map[string]int),
+		compact:      compactState{partials: make(map[string]*partialBlock)},
+		dhtRPC:       dhtState{pending: make(map[string]chan *dhtReply)},
+
+		clock:      realClock{},
+		transport:  tcpTransport{},
+		terminated: make(chan struct{}),
 	}
+	node.bft = node.newConsensusEngine()
+	node.ctx, node.cancel = context.WithCancel(context.Background())
+	node.security = NewSecurityManager(node)
+	return node
+}
+
+// useClock troca o relógio do nó e dos caches de inventário
+func (node *P2PNode) useClock(clock Clock) {
+	node.clock = clock
+	node.seenInv.clock = clock
+	node.requestedInv.clock = clock
 }
 
-// Inicialização do nó
-func (node *P2PNode) StartNode() error {
+// Inicialização do nó (Start com contexto próprio em lifecycle.go). Se um
+// passo falha, abortStart desfaz os anteriores.
+func (node *P2PNode) StartNode() (err error) {
+	// Seeds, peers de bootstrap e portas vêm do genesis.json e do network.json
+	dataDir := node.dataDir
+	config, genesisChainID, err := LoadNetworkConfig(dataDir)
+	if err != nil {
+		return fmt.Errorf("erro ao carregar configuração de rede: %v", err)
+	}
+	node.netConfig = config
+	if node.wireFormat, err = parseWireFormat(config.WireFormat); err != nil {
+		return err
+	}
+	if node.ChainID == "" {
+		node.ChainID = genesisChainID
+	}
+	if node.stakingGenesis, err = loadStakingGenesis(dataDir); err != nil {
+		return fmt.Errorf("erro ao carregar genesis de staking: %v", err)
+	}
+
 	// Inicializa o sistema de gerenciamento de endereços
-	dataDir := filepath.Join(".", "ptw_data")
 	node.addrManager = NewAddrManager(dataDir)
 	node.addrManager.Start()
 
 	// Inicializa o sistema DNS
-	node.dnsSeeder = NewDNSSeeder(node.addrManager)
+	node.dnsSeeder = NewDNSSeeder(node.addrManager, config)
 
 	// Inicializa o gerenciador de bootstrap
 	node.bootstrapManager = NewBootstrapManager(node.addrManager, node.dnsSeeder)
+	node.bootstrapManager.bootstrapPeers = config.BootstrapPeers
+	node.bootstrapManager.dhtDiscover = node.DHTDiscoverPeers
 
-	node.dht = NewDHTTable(node.ID, node.Address, node.Port, "./ptw_data")
-
-	// Cria certificados TLS self-signed se não existirem
-	node.ensureTLSCertificates()
-
-	// Inicia servidor TCP seguro
-	cert, err := tls.LoadX509KeyPair("server.crt", "server.key")
-	if err != nil {
-		return fmt.Errorf("erro ao carregar certificados: %v", err)
-	}
-
-	config := &tls.Config{
-		Certificates:       []tls.Certificate{cert},
-		InsecureSkipVerify: true, // Para desenvolvimento local
+	// Carrega a identidade do nó e emite o certificado TLS (mútuo)
+	if err := node.ensureTLSCertificates(); err != nil {
+		return fmt.Errorf("erro ao preparar certificados: %v", err)
 	}
+	defer func() {
+		if err != nil {
+			node.abortStart()
+		}
+	}()
+	node.spawn(func() { node.identity.rotationRoutine(node.ctx.Done()) })
 
+	// Inicia servidor TCP seguro
 	listenAddr := net.JoinHostPort(node.Address, fmt.Sprintf("%d", node.Port))
-	listener, err := tls.Listen("tcp", listenAddr, config)
+	listener, err := node.transport.Listen(listenAddr, node.tlsConfig)
 	if err != nil {
 		return fmt.Errorf("erro ao iniciar listener: %v", err)
 	}
 
 	node.listener = listener
+	if tcpAddr, ok := listener.Addr().(*net.TCPAddr); ok {
+		node.Port = tcpAddr.Port
+		listenAddr = tcpAddr.String()
+	}
 	fmt.Printf("🌐 Nó P2P iniciado: %s\n", listenAddr)
 
-	// Carrega blockchain existente
-	node.loadBlockchainFromFile()
+	// A DHT precisa da porta real do listener
+	node.dht = NewDHTTable(node.ID, node.Address, node.Port, dataDir)
+	node.dht.pinger = node.dhtPing
 
-	// Goroutines para diferentes funções
-	go node.handleConnections()
-	go node.syncBlockchain()
-	go node.heartbeatRoutine()
-	go node.consensusRoutine()
+	// Modo seed server: responde consultas DNS com bons peers
+	if config.SeedServer != nil {
+		node.seedServer = NewSeedServer(config.SeedServer.Zone, config.DefaultPort, node.addrManager)
+		if err := node.seedServer.Start(config.SeedServer.Listen); err != nil {
+			return err
+		}
+	}
 
-	// Iniciar descoberta descentralizada
-	go node.BitcoinStyleDiscovery()
+	// Beacons multicast para achar nós na rede local (só na rede real)
+	node.lanDiscovery = NewLANDiscovery(node)
+	if _, simulated := node.transport.(*simTransport); simulated {
+		node.lanDiscovery.enabled = false
+	}
+	node.bootstrapManager.lanDiscovery = node.lanDiscovery
 
-	go func() {
-		time.Sleep(2 * time.Second)
-		node.requestPeerAddresses()
-	}()
+	// Carrega blockchain existente e as transações pendentes do último Stop
+	node.loadBlockchainFromFile()
+	node.loadMempool()
 
-	return nil
-}
+	// Goroutines para diferentes funções (encerradas pelo Stop)
+	node.spawn(node.handleConnections)
+	node.spawn(node.syncBlockchain)
+	node.spawn(node.heartbeatRoutine)
+	node.spawn(node.consensusRoutine)
+	node.spawn(node.trickleRoutine)
+	node.spawn(node.dhtMaintenanceRoutine)
+	node.spawn(node.lanDiscovery.Start)
 
-// Stub for ensureTLSCertificates
-func (node *P2PNode) ensureTLSCertificates() {
-	// TODO: Implement certificate generation if needed
-}
+	// Volta primeiro às conexões de saída da execução anterior
+	node.spawn(func() { node.bootstrapManager.connectToAnchors(node.ConnectToAddress) })
 
-// Stub for loadBlockchainFromFile
-func (node *P2PNode) loadBlockchainFromFile() {
-	// TODO: Implement blockchain loading from file
-}
+	// Iniciar descoberta descentralizada
+	node.spawn(node.BitcoinStyleDiscovery)
 
-// Stub for saveBlockchainToFile
-func (node *P2PNode) saveBlockchainToFile() {
-	// TODO: Implement blockchain saving to file
+	node.spawn(func() {
+		if node.wait(2 * time.Second) {
+			node.requestPeerAddresses()
+		}
+	})
+
+	return nil
 }
 
 // Stub for BitcoinStyleDiscovery
@@ -184,71 +350,50 @@ func (node *P2PNode) BitcoinStyleDiscovery() {
 	// TODO: Implement Bitcoin-style peer discovery
 }
 
-// Stub for syncBlockchain
-// Simula envio de mensagem
-// Stub for syncBlockchain
+// Solicita os blocos que faltam a todos os peers conectados
 func (node *P2PNode) syncBlockchain() {
-	node.mutex.RLock()
-	var peers []*Peer
-	for _, peer := range node.Peers {
-		if peer.IsActive {
-			peers = append(peers, peer)
-		}
-	}
-	node.mutex.RUnlock()
-
-	if len(peers) == 0 {
+	peerIDs := node.connectedPeerIDs()
+	if len(peerIDs) == 0 {
 		fmt.Printf("⚠️ [%s] Nenhum peer ativo para sincronização\n", node.ID)
 		return
 	}
 
-	// Solicita blockchain de peers aleatórios
-	for _, peer := range peers {
-		go func(p *Peer) {
-			msg := &NetworkMessage{
-				Type:      MSG_SYNC_REQUEST,
-				From:      node.ID,
-				To:        p.ID,
-				Data:      map[string]interface{}{"current_height": len(node.Blockchain)},
-				Timestamp: time.Now(),
-			}
-
-			// Simula envio de mensagem
-			fmt.Printf("📡 [%s] Solicitando sync do peer %s (msg: %s)\n", node.ID, p.ID, msg.Type)
-		}(peer)
+	for _, peerID := range peerIDs {
+		node.requestSpecificPeerSync(peerID)
 	}
 }
 
-// Stub for heartbeatRoutine
-// Stub for heartbeatRoutine
+// Envia heartbeat periodicamente para manter as conexões vivas
 func (node *P2PNode) heartbeatRoutine() {
-	ticker := time.NewTicker(30 * time.Second)
+	ticker := node.clock.NewTicker(30 * time.Second)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		node.sendHeartbeat()
+	for {
+		select {
+		case <-node.ctx.Done():
+			return
+		case <-ticker.C():
+			node.sendHeartbeat()
+		}
 	}
 }
+
 func (node *P2PNode) sendHeartbeat() {
 	node.mutex.RLock()
+	height := len(node.Blockchain)
+	node.mutex.RUnlock()
+
 	activePeers := 0
-	for _, peer := range node.Peers {
-		if peer.IsActive {
+	for _, peerID := range node.connectedPeerIDs() {
+		msg := &NetworkMessage{
+			Type:      MSG_HEARTBEAT,
+			Data:      &heartbeatMessage{Height: height},
+			Timestamp: time.Now(),
+		}
+		if err := node.sendToPeer(peerID, msg); err == nil {
 			activePeers++
-			// Envia heartbeat
-			msg := &NetworkMessage{
-				Type:      MSG_HEARTBEAT,
-				From:      node.ID,
-				To:        peer.ID,
-				Data:      map[string]interface{}{"blockchain_height": len(node.Blockchain)},
-				Timestamp: time.Now(),
-			}
-
-			// Simula envio
-			fmt.Printf("💓 [%s] Heartbeat para %s (msg: %s)\n", node.ID, peer.ID, msg.Type)
 		}
 	}
-	node.mutex.RUnlock()
 
 	if activePeers > 0 {
 		fmt.Printf("💓 [%s] Heartbeat enviado para %d peers\n", node.ID, activePeers)
@@ -257,56 +402,40 @@ func (node *P2PNode) sendHeartbeat() {
 
 // Stub for consensusRoutine
 func (node *P2PNode) consensusRoutine() {
-	ticker := time.NewTicker(2 * time.Minute)
+	ticker := node.clock.NewTicker(2 * time.Minute)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		if node.IsValidator && len(node.PendingTxs) > 0 {
-			node.initiateConsensus()
+	for {
+		select {
+		case <-node.ctx.Done():
+			return
+		case <-ticker.C():
+			node.mutex.RLock()
+			pending := len(node.PendingTxs)
+			node.mutex.RUnlock()
+			if node.IsValidator && pending > 0 {
+				node.initiateConsensus()
+			}
 		}
 	}
 }
 
 func (node *P2PNode) initiateConsensus() {
-	// Cria bloco com transações pendentes
-	newBlock := &Token{
-		Index:        len(node.Blockchain) + 1,
-		Hash:         fmt.Sprintf("BLOCK_%d_%d", len(node.Blockchain)+1, time.Now().UnixNano()),
-		Timestamp:    time.Now().Format(time.RFC3339),
-		ContainsSyra: true,
-		Validator:    node.ID,
-		PrevHash:     node.getLastBlockHash(),
-		Transactions: node.PendingTxs,
-	}
-
-	// Inicia consenso distribuído
-	node.StartConsensusRound(newBlock)
+	// Cria bloco com transações pendentes e inicia o consenso distribuído
+	node.StartConsensusRound(node.buildProposalBlock(chainHeight(node) + 1))
 }
 
-// Stub for requestPeerAddresses
+// Solicita endereços conhecidos aos peers conectados
 func (node *P2PNode) requestPeerAddresses() {
-	node.mutex.RLock()
-	var peers []*Peer
-	for _, peer := range node.Peers {
-		if peer.IsActive {
-			peers = append(peers, peer)
+	for _, peerID := range node.connectedPeerIDs() {
+		msg := &NetworkMessage{
+			Type:      MSG_ADDR_REQUEST,
+			Data:      &addrRequest{MaxAddresses: 20},
+			Timestamp: time.Now(),
+		}
+		if err := node.sendToPeer(peerID, msg); err != nil {
+			fmt.Printf("❌ [%s] Erro ao solicitar endereços de %s: %v\n", node.ID, peerID, err)
 		}
-	}
-	node.mutex.RUnlock()
-
-	for _, peer := range peers {
-		go func(p *Peer) {
-			msg := &NetworkMessage{
-				Type:      MSG_ADDR_REQUEST,
-				From:      node.ID,
-				To:        p.ID,
-				Data:      map[string]interface{}{"max_addresses": 20},
-				Timestamp: time.Now(),
-			}
-
-			fmt.Printf("📋 [%s] Solicitando endereços do peer %s (msg: %s)\n", node.ID, p.ID, msg.Type)
-			// Simula envio da mensagem
-		}(peer)
 	}
 }
 
@@ -315,19 +444,20 @@ func (node *P2PNode) cleanupInactivePeers() {
 	// TODO: Implement cleanup logic
 }
 
-// Stub for requestSpecificPeerSync
+// Solicita a um peer os blocos a partir da nossa altura atual
 func (node *P2PNode) requestSpecificPeerSync(peerID string) {
 	node.mutex.RLock()
-	peer, exists := node.Peers[peerID]
+	height := len(node.Blockchain)
 	node.mutex.RUnlock()
 
-	if !exists {
-		fmt.Printf("❌ [%s] Peer %s não encontrado para sync\n", node.ID, peerID)
-		return
+	msg := &NetworkMessage{
+		Type:      MSG_SYNC_REQUEST,
+		Data:      &syncRequest{CurrentHeight: height},
+		Timestamp: time.Now(),
+	}
+	if err := node.sendToPeer(peerID, msg); err != nil {
+		fmt.Printf("❌ [%s] Erro ao solicitar sync de %s: %v\n", node.ID, peerID, err)
 	}
-
-	// Simula envio da mensagem
-	fmt.Printf("🔄 [%s] Solicitando sincronização específica do peer %s (endereço: %s:%d)\n", node.ID, peerID, peer.Address, peer.Port)
 }
 
 func (node *P2PNode) getLastBlockHash() string {
@@ -340,112 +470,383 @@ func (node *P2PNode) getLastBlockHash() string {
 	return ""
 }
 
+// Disca para o peer, troca introduções e inicia os loops da conexão
 func (node *P2PNode) connectToPeer(peer *Peer) error {
-	// Envia mensagem de introdução
+	if node.ctx.Err() != nil {
+		return errNodeStopping
+	}
+	if node.isBanned(peer.ID, peer.Address, peer.Port) {
+		return fmt.Errorf("endereço banido")
+	}
+	if err := node.checkOutboundNetgroup(peer.Address); err != nil {
+		return err
+	}
+	address := net.JoinHostPort(peer.Address, fmt.Sprintf("%d", peer.Port))
+
+	conn, err := node.transport.Dial(address, node.tlsConfig, dialTimeout)
+	if err != nil {
+		return err
+	}
+	// O handshake é interrompido se o nó encerrar
+	stopHandshake := context.AfterFunc(node.ctx, func() { conn.Close() })
+	defer stopHandshake()
+
+	pc := newPeerConn(conn, false, node.wireFormat)
 	introMsg := &NetworkMessage{
 		Type: MSG_INTRODUCTION,
-		From: node.ID,
 		To:   peer.ID,
-		Data: map[string]interface{}{
-			"id":      node.ID,
-			"address": node.Address,
-			"port":    node.Port,
-		},
-		Timestamp: time.Now(),
+		Data: node.versionInfo(),
+	}
+	if err := node.signOutbound(introMsg); err != nil {
+		pc.close()
+		return err
+	}
+	if err := pc.writeDirect(introMsg); err != nil {
+		pc.close()
+		return err
+	}
+
+	ack, err := pc.readDirect(handshakeTimeout)
+	if err != nil {
+		pc.close()
+		return err
+	}
+	if ack.Type == MSG_REJECT {
+		pc.close()
+		reason := ""
+		if reject, ok := ack.Data.(*rejectMessage); ok {
+			reason = reject.Reason
+		}
+		return fmt.Errorf("handshake recusado pelo peer: %s", reason)
+	}
+	if ack.Type != MSG_INTRODUCTION_ACK {
+		pc.close()
+		return fmt.Errorf("resposta inesperada ao handshake: %s", ack.Type)
+	}
+
+	info, err := decodeVersionInfo(ack)
+	if err != nil {
+		pc.close()
+		return err
+	}
+	if err := node.checkCompatibility(info); err != nil {
+		node.rejectPeer(pc, info.NodeID, err)
+		return err
+	}
+
+	remote := peerFromVersion(info, conn)
+	remote.Address = peer.Address
+	remote.Port = peer.Port
+	if err := node.verifyPeerIdentity(conn, remote); err != nil {
+		node.rejectPeer(pc, remote.ID, err)
+		return err
+	}
+	if ack.From != remote.ID || !node.security.VerifyMessage(ack, remote.publicKey) {
+		err := fmt.Errorf("assinatura do handshake inválida")
+		node.rejectPeer(pc, remote.ID, err)
+		return err
+	}
+
+	if err := node.registerPeerConn(remote, pc); err != nil {
+		pc.close()
+		return err
 	}
-	// Simula envio de mensagem de introdução
-	fmt.Printf("✅ [%s] Conectado ao peer %s (msg: %s)\n", node.ID, peer.ID, introMsg.Type)
 	return nil
 }
 
-// Simula servidor de conexões
+// Aceita conexões TLS de entrada
 func (node *P2PNode) handleConnections() {
-	go func() {
-		for {
-			// Simula nova conexão
-			time.Sleep(30 * time.Second)
-
-			// Processa conexão simulada
-			node.handleIncomingConnection()
+	for {
+		conn, err := node.listener.Accept()
+		if err != nil {
+			fmt.Printf("🛑 [%s] Listener encerrado: %v\n", node.ID, err)
+			return
 		}
-	}()
+		node.spawn(func() { node.handleIncomingConnection(conn) })
+	}
 }
 
-func (node *P2PNode) handleIncomingConnection() {
-	// Simula processamento de conexão de entrada
-	fmt.Printf("📥 [%s] Nova conexão de entrada\n", node.ID)
+// Processa o handshake de uma conexão de entrada
+func (node *P2PNode) handleIncomingConnection(conn net.Conn) {
+	fmt.Printf("📥 [%s] Nova conexão de entrada de %s\n", node.ID, conn.RemoteAddr())
+	stopHandshake := context.AfterFunc(node.ctx, func() { conn.Close() })
+	defer stopHandshake()
+
+	pc := newPeerConn(conn, true, node.wireFormat)
+	intro, err := pc.readDirect(handshakeTimeout)
+	if err != nil || intro.Type != MSG_INTRODUCTION {
+		pc.close()
+		return
+	}
+
+	info, err := decodeVersionInfo(intro)
+	if err != nil {
+		fmt.Printf("❌ [%s] Introdução inválida: %v\n", node.ID, err)
+		pc.close()
+		return
+	}
+	if err := node.checkCompatibility(info); err != nil {
+		node.rejectPeer(pc, info.NodeID, err)
+		return
+	}
+
+	peer := peerFromVersion(info, conn)
+	if err := node.verifyPeerIdentity(conn, peer); err != nil {
+		node.rejectPeer(pc, peer.ID, err)
+		return
+	}
+	if intro.From != peer.ID || !node.security.VerifyMessage(intro, peer.publicKey) {
+		node.rejectPeer(pc, peer.ID, fmt.Errorf("assinatura do handshake inválida"))
+		return
+	}
+
+	ack := &NetworkMessage{
+		Type: MSG_INTRODUCTION_ACK,
+		To:   peer.ID,
+		Data: node.versionInfo(),
+	}
+	if err := node.signOutbound(ack); err != nil {
+		pc.close()
+		return
+	}
+	if err := pc.writeDirect(ack); err != nil {
+		pc.close()
+		return
+	}
+
+	if err := node.registerPeerConn(peer, pc); err != nil {
+		fmt.Printf("⚠️ [%s] %v\n", node.ID, err)
+		pc.close()
+	}
 }
 
-// Adicione a struct ConsensusVote (faltava)
-type ConsensusVote struct {
-	RoundID   string `json:"round_id"`
-	BlockHash string `json:"block_hash"`
-	Voter     string `json:"voter"`
-	Vote      bool   `json:"vote"`
+// === IMPLEMENTAÇÕES DOS HANDLERS ===
+
+// dispatchMessage encaminha uma mensagem recebida ao handler do seu tipo
+func (node *P2PNode) dispatchMessage(msg *NetworkMessage) *NetworkMessage {
+	switch msg.Type {
+	case MSG_PEER_DISCOVERY:
+		return node.handlePeerDiscovery(msg)
+	case MSG_NEW_BLOCK:
+		return node.handleNewBlock(msg)
+	case MSG_NEW_TRANSACTION:
+		return node.handleNewTransaction(msg)
+	case MSG_CONSENSUS_REQUEST:
+		return node.handleConsensusRequest(msg)
+	case MSG_CONSENSUS_VOTE:
+		return node.handleConsensusVote(msg)
+	case MSG_CONSENSUS_START:
+		return node.handleConsensusStart(msg)
+	case MSG_SYNC_REQUEST:
+		return node.handleSyncRequest(msg)
+	case MSG_SYNC_RESPONSE:
+		return node.handleSyncResponse(msg)
+	case MSG_HEARTBEAT:
+		return node.handleHeartbeat(msg)
+	case MSG_ADDR_REQUEST:
+		return node.handleAddrRequest(msg)
+	case MSG_ADDR_RESPONSE:
+		return node.handleAddrResponse(msg)
+	case MSG_INV:
+		return node.handleInv(msg)
+	case MSG_GET_DATA:
+		return node.handleGetData(msg)
+	case MSG_NOT_FOUND:
+		return node.handleNotFound(msg)
+	case MSG_CMPCT_BLOCK:
+		return node.handleCompactBlock(msg)
+	case MSG_GET_BLOCK_TXN:
+		return node.handleGetBlockTxn(msg)
+	case MSG_BLOCK_TXN:
+		return node.handleBlockTxn(msg)
+	case MSG_DHT_PING, MSG_DHT_FIND_NODE, MSG_DHT_FIND_VALUE, MSG_DHT_STORE:
+		return node.handleDHTRequest(msg)
+	case MSG_DHT_PONG, MSG_DHT_NODES, MSG_DHT_STORED:
+		return node.handleDHTReply(msg)
+	case MSG_PEER_LIST, MSG_TX_ACCEPTED, MSG_TX_REJECTED:
+		// Respostas informativas, nada a fazer
+		return nil
+	default:
+		fmt.Printf("⚠️ [%s] Tipo de mensagem desconhecido de %s: %s\n", node.ID, msg.From, msg.Type)
+		return nil
+	}
 }
 
-// ConsensusRound structure (deixe só UMA definição)
-type ConsensusRound struct {
-	RoundID       string          `json:"round_id"`
-	Block         *Token          `json:"block"`
-	Proposer      string          `json:"proposer"`
-	Validators    []string        `json:"validators"`
-	Votes         map[string]bool `json:"votes"`
-	RequiredVotes int             `json:"required_votes"`
-	Status        string          `json:"status"` // PENDING, APPROVED, REJECTED
-	StartTime     time.Time       `json:"start_time"`
-	EndTime       time.Time       `json:"end_time"`
+// Atualiza a altura conhecida do peer
+func (node *P2PNode) handleHeartbeat(msg *NetworkMessage) *NetworkMessage {
+	data, ok := msg.Data.(*heartbeatMessage)
+	if !ok {
+		return nil
+	}
+
+	node.mutex.Lock()
+	if peer, exists := node.Peers[msg.From]; exists {
+		peer.Height = data.Height
+		peer.LastSeen = time.Now()
+	}
+	ourHeight := len(node.Blockchain)
+	node.mutex.Unlock()
+
+	// Peer está à frente: pede os blocos que faltam
+	if data.Height > ourHeight {
+		node.spawn(func() { node.requestSpecificPeerSync(msg.From) })
+	}
+	return nil
 }
 
-var consensusRounds = make(map[string]*ConsensusRound)
+// Responde com os blocos a partir da altura informada pelo peer
+func (node *P2PNode) handleSyncRequest(msg *NetworkMessage) *NetworkMessage {
+	data, ok := msg.Data.(*syncRequest)
+	if !ok {
+		return nil
+	}
 
-// === IMPLEMENTAÇÕES DOS HANDLERS ===
+	node.mutex.RLock()
+	start := data.CurrentHeight
+	if start < 0 || start > len(node.Blockchain) {
+		start = len(node.Blockchain)
+	}
+	// Resposta paginada: o peer pede o restante ao aplicar o lote
+	blocks := make([]Token, 0)
+	size, fields := 0, 0
+	for i := range node.Blockchain[start:] {
+		block := &node.Blockchain[start+i]
+		encoded := encodePayload(block)
+		if len(blocks) == maxSyncBlocks || (len(blocks) > 0 &&
+			(size+len(encoded.buf) > syncResponseBudget || fields+encoded.fields > syncResponseFields)) {
+			break
+		}
+		size += len(encoded.buf)
+		fields += encoded.fields
+		blocks = append(blocks, *block)
+	}
+	height := len(node.Blockchain)
+	node.mutex.RUnlock()
+
+	return &NetworkMessage{
+		Type:      MSG_SYNC_RESPONSE,
+		From:      node.ID,
+		To:        msg.From,
+		Data:      &syncResponse{Blocks: blocks, Height: height},
+		Timestamp: time.Now(),
+	}
+}
+
+// Aplica em ordem os blocos recebidos de um peer
+func (node *P2PNode) handleSyncResponse(msg *NetworkMessage) *NetworkMessage {
+	data, ok := msg.Data.(*syncResponse)
+	if !ok {
+		return nil
+	}
+
+	blocks := data.Blocks
+	added := 0
+	for i := range blocks {
+		if !node.validateAndAddBlock(&blocks[i]) {
+			break
+		}
+		added++
+	}
+
+	if added > 0 {
+		fmt.Printf("📥 [%s] %d blocos sincronizados de %s\n", node.ID, added, msg.From)
+	}
+
+	// Lote completo e o peer ainda tem mais: pede a próxima página
+	if added > 0 && added == len(blocks) && chainHeight(node) < data.Height {
+		node.spawn(func() { node.requestSpecificPeerSync(msg.From) })
+	}
+	return nil
+}
+
+// Responde com endereços de peers com boa reputação
+func (node *P2PNode) handleAddrRequest(msg *NetworkMessage) *NetworkMessage {
+	max := 20
+	if data, ok := msg.Data.(*addrRequest); ok && data.MaxAddresses > 0 && data.MaxAddresses < 1000 {
+		max = data.MaxAddresses
+	}
+
+	addresses := make([]addrEntry, 0)
+	if node.addrManager != nil {
+		for _, addr := range node.addrManager.GetGoodAddresses(max) {
+			addresses = append(addresses, addrEntry{IP: addr.IP, Port: addr.Port})
+		}
+	}
+
+	return &NetworkMessage{
+		Type:      MSG_ADDR_RESPONSE,
+		From:      node.ID,
+		To:        msg.From,
+		Data:      &addrResponse{Addresses: addresses},
+		Timestamp: time.Now(),
+	}
+}
+
+// Registra no AddrManager os endereços recebidos de um peer
+func (node *P2PNode) handleAddrResponse(msg *NetworkMessage) *NetworkMessage {
+	data, ok := msg.Data.(*addrResponse)
+	if !ok || node.addrManager == nil {
+		return nil
+	}
+
+	// O grupo de rede de quem anunciou define os buckets que a lista alcança
+	node.mutex.RLock()
+	var sourceIP string
+	if peer, exists := node.Peers[msg.From]; exists {
+		sourceIP = peer.Address
+	}
+	node.mutex.RUnlock()
+
+	for _, entry := range data.Addresses {
+		if net.ParseIP(entry.IP) != nil && entry.Port != "" {
+			node.addrManager.AddAddressFrom(entry.IP, entry.Port, "peer", sourceIP)
+		}
+	}
+	return nil
+}
 
 func (node *P2PNode) handlePeerDiscovery(msg *NetworkMessage) *NetworkMessage {
 	// Retorna lista de peers conhecidos
-	peers := make([]map[string]interface{}, 0)
+	peers := make([]peerListEntry, 0)
 
 	node.mutex.RLock()
 	for _, peer := range node.Peers {
 		if peer.IsActive && peer.ID != msg.From {
-			peers = append(peers, map[string]interface{}{
-				"id":      peer.ID,
-				"address": peer.Address,
-				"port":    peer.Port,
-			})
+			peers = append(peers, peerListEntry{ID: peer.ID, Address: peer.Address, Port: peer.Port})
 		}
 	}
 	node.mutex.RUnlock()
 
 	return &NetworkMessage{
-		Type: "peer_list",
-		From: node.ID,
-		To:   msg.From,
-		Data: map[string]interface{}{
-			"peers": peers,
-		},
+		Type:      MSG_PEER_LIST,
+		From:      node.ID,
+		To:        msg.From,
+		Data:      &peerList{Peers: peers},
 		Timestamp: time.Now(),
 	}
 }
 
 func (node *P2PNode) handleNewBlock(msg *NetworkMessage) *NetworkMessage {
-	blockData, ok := msg.Data.(map[string]interface{})
+	block, ok := msg.Data.(*Token)
 	if !ok {
 		return nil
 	}
 
-	// Converte dados para Token
-	blockBytes, _ := json.Marshal(blockData)
-	var block Token
-	if err := json.Unmarshal(blockBytes, &block); err != nil {
+	item := InvItem{Type: INV_BLOCK, Hash: block.Hash}
+	node.markPeerKnows(msg.From, item)
+	node.requestedInv.Remove(item.key())
+	node.countRelay("blocks_received", 1)
+
+	if err := checkBlockSanity(block); err != nil {
+		node.penalizePeer(msg.From, penaltyInvalidBlock, fmt.Sprintf("bloco inválido: %v", err))
 		return nil
 	}
 
-	if node.validateAndAddBlock(&block) {
+	if node.validateAndAddBlock(block) {
 		fmt.Printf("📦 Novo bloco adicionado: %s\n", block.Hash[:16])
 
-		// Propaga para outros peers
-		go node.BroadcastToNetwork(MSG_NEW_BLOCK, blockData, msg.From)
+		// Anuncia (inv) apenas aos peers que ainda não conhecem o bloco
+		node.spawn(func() { node.AnnounceBlock(block, msg.From) })
 	}
 
 	return nil
@@ -453,65 +854,111 @@ func (node *P2PNode) handleNewBlock(msg *NetworkMessage) *NetworkMessage {
 
 // handleNewTransaction com validação de assinatura
 func (node *P2PNode) handleNewTransaction(msg *NetworkMessage) *NetworkMessage {
-	txData, ok := msg.Data.(map[string]interface{})
+	tx, ok := msg.Data.(*Transaction)
 	if !ok {
 		fmt.Println("❌ Dados de transação inválidos")
 		return nil
 	}
 
-	// Converte para Transaction
-	txBytes, _ := json.Marshal(txData)
-	var tx Transaction
-	if err := json.Unmarshal(txBytes, &tx); err != nil {
-		fmt.Printf("❌ Erro ao decodificar transação: %v\n", err)
+	item := InvItem{Type: INV_TX, Hash: tx.ID}
+	node.markPeerKnows(msg.From, item)
+	node.requestedInv.Remove(item.key())
+	node.countRelay("txs_received", 1)
+
+	// Transação já recebida por outro caminho
+	if node.seenInv.Has(item.key()) {
+		node.countRelay("duplicates", 1)
 		return nil
 	}
 
 	// VALIDAÇÃO DE ASSINATURA OBRIGATÓRIA
 	validator := NewTransactionValidator()
-	if !validator.VerifySignature(&tx) {
+	if !validator.VerifySignature(tx) {
 		fmt.Printf("❌ Transação %s rejeitada: assinatura inválida\n", tx.ID)
+		node.seenInv.Add(item.key())
 
 		// Log de segurança
 		logSecurityEvent("INVALID_SIGNATURE", tx.From,
 			fmt.Sprintf("Transação com assinatura inválida: %s", tx.ID), "HIGH", false)
 
 		return &NetworkMessage{
-			Type: "transaction_rejected",
-			From: node.ID,
-			To:   msg.From,
-			Data: map[string]interface{}{
-				"reason": "invalid_signature",
-				"tx_id":  tx.ID,
-			},
+			Type:      MSG_TX_REJECTED,
+			From:      node.ID,
+			To:        msg.From,
+			Data:      &txStatus{TxID: tx.ID, Reason: "invalid_signature"},
 			Timestamp: time.Now(),
 		}
 	}
 
+	// Stake e evidências precisam valer contra o estado da cadeia
+	if isStakingTx(tx.Type) {
+		if err := node.checkStakingTx(tx); err != nil {
+			fmt.Printf("❌ Transação %s rejeitada: %v\n", tx.ID, err)
+			node.seenInv.Add(item.key())
+			return &NetworkMessage{
+				Type:      MSG_TX_REJECTED,
+				From:      node.ID,
+				To:        msg.From,
+				Data:      &txStatus{TxID: tx.ID, Reason: "invalid_state"},
+				Timestamp: time.Now(),
+			}
+		}
+	}
+
 	// Adiciona à lista de transações pendentes
 	node.mutex.Lock()
-	node.PendingTxs = append(node.PendingTxs, tx)
+	node.PendingTxs = append(node.PendingTxs, *tx)
 	node.mutex.Unlock()
 
 	fmt.Printf("✅ Transação %s aceita (assinatura válida)\n", tx.ID)
 
-	// Propaga para outros peers
-	go node.BroadcastToNetwork(MSG_NEW_TRANSACTION, txData, msg.From)
+	// Entra no próximo lote de anúncios (trickle) para os demais peers
+	node.AnnounceTransaction(tx, msg.From)
 
 	return &NetworkMessage{
-		Type: "transaction_accepted",
-		From: node.ID,
-		To:   msg.From,
-		Data: map[string]interface{}{
-			"tx_id":     tx.ID,
-			"status":    "accepted",
-			"validated": true,
-		},
+		Type:      MSG_TX_ACCEPTED,
+		From:      node.ID,
+		To:        msg.From,
+		Data:      &txStatus{TxID: tx.ID, Status: "accepted", Validated: true},
 		Timestamp: time.Now(),
 	}
 }
 
+// checkBlockSanity faz as verificações que não dependem da cadeia local.
+// Um bloco que falha aqui nunca será válido, e quem o enviou é penalizado.
+func checkBlockSanity(block *Token) error {
+	if block.Hash == "" || !block.ContainsSyra {
+		return fmt.Errorf("bloco sem hash ou sem SYRA")
+	}
+
+	validator := NewTransactionValidator()
+	if !validator.ValidateTransactionChain(block.Transactions) {
+		return fmt.Errorf("transações com assinaturas inválidas")
+	}
+	return nil
+}
+
+// validateAndAddBlock confere o certificado de commit (quando presente) do
+// próximo bloco da cadeia, adiciona o bloco e avisa o consenso que a altura
+// foi decidida
 func (node *P2PNode) validateAndAddBlock(block *Token) bool {
+	if block.Index != chainHeight(node)+1 {
+		return false
+	}
+	if block.Commit != nil {
+		if err := node.verifyBlockCommit(block); err != nil {
+			fmt.Printf("❌ Bloco %.16s rejeitado: %v\n", block.Hash, err)
+			return false
+		}
+	}
+	if !node.addBlock(block) {
+		return false
+	}
+	node.consensusBlockAdded(block.Index)
+	return true
+}
+
+func (node *P2PNode) addBlock(block *Token) bool {
 	node.mutex.Lock()
 	defer node.mutex.Unlock()
 
@@ -522,15 +969,9 @@ func (node *P2PNode) validateAndAddBlock(block *Token) bool {
 		}
 	}
 
-	// Validações básicas do bloco
-	if block.Hash == "" || !block.ContainsSyra {
-		return false
-	}
-
-	// NOVA: Validação de assinaturas de todas as transações
-	validator := NewTransactionValidator()
-	if !validator.ValidateTransactionChain(block.Transactions) {
-		fmt.Printf("❌ Bloco %s rejeitado: transações com assinaturas inválidas\n", block.Hash[:16])
+	// Validações básicas do bloco e das assinaturas das transações
+	if err := checkBlockSanity(block); err != nil {
+		fmt.Printf("❌ Bloco %.16s rejeitado: %v\n", block.Hash, err)
 		return false
 	}
 
@@ -548,8 +989,31 @@ func (node *P2PNode) validateAndAddBlock(block *Token) bool {
 		}
 	}
 
+	// Com validadores o bloco precisa do certificado e do hash do cabeçalho;
+	// transações de stake e o anúncio de conjunto precisam valer contra o
+	// estado da cadeia, tenha o bloco certificado ou não
+	state := node.chainStateLocked()
+	err := state.requireCommit(block)
+	if err == nil && block.Commit != nil {
+		err = checkHeaderHash(block)
+	}
+	if err == nil {
+		err = state.applyBlock(block)
+	}
+	if err == nil {
+		err = state.requireAnnouncement(block)
+	}
+	if err != nil {
+		fmt.Printf("❌ Bloco %.16s rejeitado: %v\n", block.Hash, err)
+		return false
+	}
+
 	// Adiciona à blockchain
 	node.Blockchain = append(node.Blockchain, *block)
+	node.stateMtx.Lock()
+	node.state = state
+	node.stateMtx.Unlock()
+	node.auditIncidents(block, state.Incidents)
 
 	// Remove transações processadas do pool pendente
 	var remainingTxs []Transaction
@@ -560,15 +1024,20 @@ func (node *P2PNode) validateAndAddBlock(block *Token) bool {
 	}
 
 	for _, tx := range node.PendingTxs {
-		if !processedTxIDs[tx.ID] {
-			remainingTxs = append(remainingTxs, tx)
+		// Evidências contra quem já foi preso e beacon de fase passada não valem mais
+		if processedTxIDs[tx.ID] || (tx.Type == TX_EVIDENCE && state.Jailed[tx.To]) {
+			continue
+		}
+		if isRandaoTx(tx.Type) && state.clone().applyTx(&tx, state.Height+1) != nil {
+			continue
 		}
+		remainingTxs = append(remainingTxs, tx)
 	}
 
 	node.PendingTxs = remainingTxs
 
 	// Salva no arquivo
-	go node.saveBlockchainToFile()
+	node.saveBlockchainToFile()
 
 	fmt.Printf("✅ Bloco %s adicionado (todas as transações válidas)\n", block.Hash[:16])
 	return true
@@ -576,9 +1045,15 @@ func (node *P2PNode) validateAndAddBlock(block *Token) bool {
 
 func (node *P2PNode) validateTransaction(tx *Transaction) bool {
 	// Validações básicas
-	if tx.From == "" || tx.To == "" || tx.Amount <= 0 {
+	if tx.From == "" || tx.To == "" || (tx.Amount <= 0 && tx.Type != TX_EVIDENCE && tx.Type != TX_COMMISSION && !isRandaoTx(tx.Type)) {
 		return false
 	}
+	if isStakingTx(tx.Type) {
+		if err := node.checkStakingTx(tx); err != nil {
+			fmt.Printf("❌ [%s] Transação %s rejeitada: %v\n", node.ID, tx.ID, err)
+			return false
+		}
+	}
 
 	// Verifica se não é duplicada
 	node.mutex.RLock()
@@ -592,205 +1067,24 @@ func (node *P2PNode) validateTransaction(tx *Transaction) bool {
 	return true
 }
 
-// Inicia um round de consenso distribuído
-func (node *P2PNode) StartConsensusRound(block *Token) {
-	// Seleciona validadores (exemplo: todos peers ativos com stake >= 10)
-	validators := []string{}
-	node.mutex.RLock()
-	for id, peer := range node.Peers {
-		if peer.IsActive && peer.Stake >= 10 {
-			validators = append(validators, id)
-		}
-	}
-	if node.IsValidator && node.Stake >= 10 {
-		validators = append(validators, node.ID)
-	}
-	node.mutex.RUnlock()
-
-	roundID := fmt.Sprintf("ROUND_%d", time.Now().UnixNano())
-	round := &ConsensusRound{
-		RoundID:       roundID,
-		Block:         block,
-		Proposer:      node.ID,
-		Validators:    validators,
-		Votes:         make(map[string]bool),
-		RequiredVotes: len(validators)*2/3 + 1, // 67% + 1
-		Status:        "PENDING",
-		StartTime:     time.Now(),
-	}
-	consensusRounds[roundID] = round
-
-	fmt.Printf("🗳️ Iniciando consenso distribuído: %s\n", roundID)
-	node.BroadcastToNetwork(MSG_CONSENSUS_REQUEST, map[string]interface{}{
-		"round_id":   roundID,
-		"block":      block,
-		"proposer":   node.ID,
-		"validators": validators,
-	}, "")
-
-	// Vota em si mesmo (se for validador)
-	if node.IsValidator {
-		voteMsg := ConsensusVote{
-			RoundID:   roundID,
-			BlockHash: block.Hash,
-			Voter:     node.ID,
-			Vote:      true,
-		}
-		node.handleConsensusVote(&NetworkMessage{
-			Type:      MSG_CONSENSUS_VOTE,
-			From:      node.ID,
-			Data:      voteMsg,
-			Timestamp: time.Now(),
-		})
-	}
-
-	// Timeout para encerrar round
-	go func() {
-		time.Sleep(15 * time.Second)
-		node.finalizeConsensusRound(roundID)
-	}()
-}
+// (Removido: função validateProposedBlock não era usada)
 
-// Handler para requisição de consenso
-func (node *P2PNode) handleConsensusRequest(msg *NetworkMessage) *NetworkMessage {
-	data, ok := msg.Data.(map[string]interface{})
-	if !ok {
-		return nil
-	}
-	roundID, _ := data["round_id"].(string)
-	blockData := data["block"]
-	blockBytes, _ := json.Marshal(blockData)
-	var block Token
-	json.Unmarshal(blockBytes, &block)
-	validatorsIface, _ := data["validators"].([]interface{})
-
-	// Correção: use uma variável com nome diferente e salve o resultado do append
-	validatorsList := make([]string, 0, len(validatorsIface))
-	for _, v := range validatorsIface {
-		if s, ok := v.(string); ok {
-			validatorsList = append(validatorsList, s)
+// BroadcastToNetwork envia a mensagem a todos os peers conectados, exceto um
+func (node *P2PNode) BroadcastToNetwork(msgType string, data interface{}, exceptPeerID string) {
+	for _, peerID := range node.connectedPeerIDs() {
+		if peerID == exceptPeerID {
+			continue
 		}
-	}
 
-	// Armazena o round de consenso para uso posterior
-	round := &ConsensusRound{
-		RoundID:       roundID,
-		Block:         &block,
-		Proposer:      msg.From,
-		Validators:    validatorsList,
-		Votes:         make(map[string]bool),
-		RequiredVotes: len(validatorsList)*2/3 + 1,
-		Status:        "PENDING",
-		StartTime:     time.Now(),
-	}
-	consensusRounds[roundID] = round
-
-	// Se for validador, vota
-	if node.IsValidator {
-		// Use a lógica de validação do bloco para decidir o voto
-		vote := true
-		if block.Hash == "" || !block.ContainsSyra {
-			vote = false
-		} else {
-			validator := NewTransactionValidator()
-			if !validator.ValidateTransactionChain(block.Transactions) {
-				vote = false
-			}
-			expectedIndex := len(node.Blockchain) + 1
-			if block.Index != expectedIndex {
-				vote = false
-			}
-			if len(node.Blockchain) > 0 {
-				lastBlock := node.Blockchain[len(node.Blockchain)-1]
-				if block.PrevHash != lastBlock.Hash {
-					vote = false
-				}
-			}
-		}
-		node.handleConsensusVote(&NetworkMessage{
-			Type: MSG_CONSENSUS_VOTE,
-			From: node.ID,
-			Data: ConsensusVote{
-				RoundID:   roundID,
-				BlockHash: block.Hash,
-				Voter:     node.ID,
-				Vote:      vote,
-			},
+		msg := &NetworkMessage{
+			Type:      msgType,
+			Data:      data,
 			Timestamp: time.Now(),
-		})
-	}
-	return nil
-}
-
-// handleConsensusVote implementation
-func (node *P2PNode) handleConsensusVote(msg *NetworkMessage) *NetworkMessage {
-	var vote ConsensusVote
-	voteBytes, _ := json.Marshal(msg.Data)
-	json.Unmarshal(voteBytes, &vote)
-
-	round, exists := consensusRounds[vote.RoundID]
-	if !exists {
-		return nil
-	}
-	round.Votes[vote.Voter] = vote.Vote
-
-	// Verifica se atingiu maioria
-	yesVotes := 0
-	for _, v := range round.Votes {
-		if v {
-			yesVotes++
 		}
-	}
-	if yesVotes >= round.RequiredVotes && round.Status == "PENDING" {
-		round.Status = "APPROVED"
-		round.EndTime = time.Now()
-		fmt.Printf("✅ Consenso APROVADO para bloco %s (%d/%d votos)\n", round.Block.Hash[:16], yesVotes, round.RequiredVotes)
-		node.validateAndAddBlock(round.Block)
-	} else if len(round.Votes) == len(round.Validators) && round.Status == "PENDING" {
-		round.Status = "REJECTED"
-		round.EndTime = time.Now()
-		fmt.Printf("❌ Consenso REJEITADO para bloco %s\n", round.Block.Hash[:16])
-	}
-	return nil
-}
-
-// Finaliza round de consenso após timeout
-func (node *P2PNode) finalizeConsensusRound(roundID string) {
-	round, exists := consensusRounds[roundID]
-	if !exists || round.Status != "PENDING" {
-		return
-	}
-	yesVotes := 0
-	for _, v := range round.Votes {
-		if v {
-			yesVotes++
+		if err := node.sendToPeer(peerID, msg); err != nil {
+			fmt.Printf("⚠️ [%s] Falha ao enviar %s para %s: %v\n", node.ID, msgType, peerID, err)
 		}
 	}
-	if yesVotes >= round.RequiredVotes {
-		round.Status = "APPROVED"
-		round.EndTime = time.Now()
-		fmt.Printf("✅ Consenso APROVADO (timeout) para bloco %s (%d/%d votos)\n", round.Block.Hash[:16], yesVotes, round.RequiredVotes)
-		node.validateAndAddBlock(round.Block)
-	} else {
-		round.Status = "REJECTED"
-		round.EndTime = time.Now()
-		fmt.Printf("❌ Consenso REJEITADO (timeout) para bloco %s\n", round.Block.Hash[:16])
-	}
-}
-
-// (Removido: função validateProposedBlock não era usada)
-
-// BroadcastToNetwork stub
-func (node *P2PNode) BroadcastToNetwork(msgType string, data interface{}, exceptPeerID string) {
-	// Example usage of logSecurityEvent to avoid unused warning
-	logSecurityEvent("BROADCAST", node.ID, "BroadcastToNetwork called", "INFO", true)
-	// TODO: Implement network broadcast logic
-}
-
-// logSecurityEvent implementation
-func logSecurityEvent(eventType, user, description, severity string, resolved bool) {
-	fmt.Printf("🔒 [SECURITY] [%s] User: %s | Desc: %s | Severity: %s | Resolved: %v\n",
-		eventType, user, description, severity, resolved)
 }
 
 // validateProposedBlock implementation
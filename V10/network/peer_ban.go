@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Duração padrão do ban automático e do comando "ban" sem duração
+const defaultBanDuration = 24 * time.Hour
+
+// isBanned informa se o nó ou o endereço anunciado estão banidos
+func (node *P2PNode) isBanned(nodeID, ip string, port int) bool {
+	if node.addrManager == nil {
+		return false
+	}
+	return node.addrManager.IsBanned(ip, strconv.Itoa(port), nodeID)
+}
+
+// banConnectedPeer bane o endereço do peer no AddrManager e fecha a conexão
+func (node *P2PNode) banConnectedPeer(peerID string, duration time.Duration, reason string) {
+	node.mutex.RLock()
+	peer, exists := node.Peers[peerID]
+	var pc *peerConn
+	var ip string
+	var port int
+	if exists {
+		pc, ip, port = peer.conn, peer.Address, peer.Port
+	}
+	node.mutex.RUnlock()
+
+	if node.addrManager != nil {
+		if exists && port > 0 {
+			node.addrManager.Ban(ip, strconv.Itoa(port), peerID, duration, reason)
+		} else if node.addrManager.BanNode(peerID, duration, reason) == 0 {
+			fmt.Printf("⚠️ [%s] Peer %s sem endereço conhecido para banir\n", node.ID, peerID)
+		}
+	}
+	if pc != nil {
+		pc.close()
+	}
+}
+
+// BanPeer bane manualmente um peer pelo ID do nó ou por "ip:porta"
+func (node *P2PNode) BanPeer(target string, duration time.Duration, reason string) error {
+	if node.addrManager == nil {
+		return fmt.Errorf("gerenciador de endereços não iniciado")
+	}
+
+	ip, port, err := net.SplitHostPort(target)
+	if err != nil {
+		// Não é ip:porta: trata como ID de nó
+		node.mutex.RLock()
+		_, connected := node.Peers[target]
+		node.mutex.RUnlock()
+		if !connected && node.addrManager.BanNode(target, duration, reason) == 0 {
+			return fmt.Errorf("peer %s desconhecido", target)
+		}
+		node.banConnectedPeer(target, duration, reason)
+		return nil
+	}
+	if net.ParseIP(ip) == nil {
+		return fmt.Errorf("endereço inválido: %s", target)
+	}
+
+	node.addrManager.Ban(ip, port, "", duration, reason)
+
+	// Derruba conexões ativas com o endereço banido
+	for _, peerID := range node.connectedPeerIDs() {
+		node.mutex.RLock()
+		peer := node.Peers[peerID]
+		matches := peer != nil && peer.Address == ip && strconv.Itoa(peer.Port) == port
+		var pc *peerConn
+		if matches {
+			pc = peer.conn
+		}
+		node.mutex.RUnlock()
+		if pc != nil {
+			pc.close()
+		}
+	}
+	return nil
+}
+
+// UnbanPeer remove o ban de um ID de nó, IP ou "ip:porta"
+func (node *P2PNode) UnbanPeer(target string) error {
+	if node.addrManager == nil {
+		return fmt.Errorf("gerenciador de endereços não iniciado")
+	}
+	if node.addrManager.Unban(target) == 0 {
+		return fmt.Errorf("nenhum ban ativo para %s", target)
+	}
+	node.security.ResetMisbehavior(target)
+	fmt.Printf("🔓 [%s] Ban removido: %s\n", node.ID, target)
+	return nil
+}
+
+// ListBans retorna os bans ativos
+func (node *P2PNode) ListBans() []KnownAddress {
+	if node.addrManager == nil {
+		return nil
+	}
+	return node.addrManager.BannedAddresses()
+}
+
+// RunAdminCommand executa um comando administrativo de bans:
+//
+//	bans                             lista os bans ativos
+//	scores                           pontuação de mau comportamento
+//	ban <id|ip:porta> [duração] ...  bane (ex.: "ban node-X 2h spam")
+//	unban <id|ip|ip:porta>           remove o ban
+//
+// e os de delegação (delegation.go), assinados com a carteira do nó:
+//
+//	wallet                           endereço e saldo da carteira do nó
+//	delegators <validador>           delegações e recompensas pendentes
+//	delegate <validador> <valor>     delega saldo ao validador
+//	undelegate <validador> <valor>   retira a delegação (unbonding)
+//	commission <validador> <%>       comissão do validador do nó
+//
+// e "beacon", o estado do beacon RANDAO (randao.go).
+func (node *P2PNode) RunAdminCommand(line string) (string, error) {
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		return "", fmt.Errorf("comando vazio")
+	}
+
+	switch args[0] {
+	case "bans":
+		bans := node.ListBans()
+		if len(bans) == 0 {
+			return "Nenhum peer banido", nil
+		}
+		var out strings.Builder
+		for _, addr := range bans {
+			fmt.Fprintf(&out, "%s %s até %s (%s)\n", net.JoinHostPort(addr.IP, addr.Port),
+				addr.NodeID, addr.BanExpires.Format(time.RFC3339), addr.BanReason)
+		}
+		return strings.TrimRight(out.String(), "\n"), nil
+
+	case "scores":
+		scores := node.security.MisbehaviorScores()
+		if len(scores) == 0 {
+			return "Nenhum peer com pontuação", nil
+		}
+		var out strings.Builder
+		for peerID, score := range scores {
+			fmt.Fprintf(&out, "%s %d/%d\n", peerID, score, misbehaviorThreshold)
+		}
+		return strings.TrimRight(out.String(), "\n"), nil
+
+	case "ban":
+		if len(args) < 2 {
+			return "", fmt.Errorf("uso: ban <id|ip:porta> [duração] [motivo]")
+		}
+		duration := defaultBanDuration
+		rest := args[2:]
+		if len(rest) > 0 {
+			if d, err := time.ParseDuration(rest[0]); err == nil && d > 0 {
+				duration = d
+				rest = rest[1:]
+			}
+		}
+		reason := "ban manual"
+		if len(rest) > 0 {
+			reason = strings.Join(rest, " ")
+		}
+		if err := node.BanPeer(args[1], duration, reason); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s banido por %s", args[1], duration), nil
+
+	case "wallet", "delegators", TX_DELEGATE, TX_UNDELEGATE, TX_COMMISSION:
+		return node.runDelegationCommand(args)
+
+	case "beacon":
+		return node.beaconStatus(), nil
+
+	case "unban":
+		if len(args) != 2 {
+			return "", fmt.Errorf("uso: unban <id|ip|ip:porta>")
+		}
+		if err := node.UnbanPeer(args[1]); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s liberado", args[1]), nil
+	}
+	return "", fmt.Errorf("comando desconhecido: %s", args[0])
+}
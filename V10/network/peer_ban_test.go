@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInvalidBlockBansPeerPersistently(t *testing.T) {
+	nodeA := newTestNode(t, "node-A")
+	nodeB := newTestNode(t, "node-B")
+	address := fmt.Sprintf("%d", nodeA.Port)
+
+	if !nodeB.ConnectToAddress("127.0.0.1", address) {
+		t.Fatal("B não conseguiu conectar em A")
+	}
+
+	// Bloco com transação sem assinatura nunca será válido
+	block := testBlock(1, "")
+	block.Transactions = []Transaction{{ID: "tx-sem-assinatura", Type: "transfer", From: "alice", To: "bob", Amount: 1}}
+	nodeB.sendToPeer("node-A", &NetworkMessage{Type: MSG_NEW_BLOCK, Data: &block, Timestamp: time.Now()})
+
+	if !waitFor(t, defaultWait, func() bool { return len(nodeA.connectedPeerIDs()) == 0 }) {
+		t.Fatal("A deveria desconectar B após bloco inválido")
+	}
+	bans := nodeA.ListBans()
+	if len(bans) != 1 || bans[0].NodeID != "node-B" || bans[0].Port != fmt.Sprintf("%d", nodeB.Port) {
+		t.Fatalf("ban de B não registrado: %+v", bans)
+	}
+
+	// O ban está no arquivo de peers e vale após reiniciar o AddrManager
+	reloaded := NewAddrManager(nodeA.dataDir)
+	reloaded.loadAddresses()
+	if !reloaded.IsBanned("127.0.0.1", bans[0].Port, "node-B") {
+		t.Fatal("ban deveria persistir em disco")
+	}
+
+	if nodeB.ConnectToAddress("127.0.0.1", address) {
+		t.Fatal("peer banido não deveria reconectar")
+	}
+
+	if _, err := nodeA.RunAdminCommand("unban node-B"); err != nil {
+		t.Fatalf("unban falhou: %v", err)
+	}
+	if !nodeB.ConnectToAddress("127.0.0.1", address) {
+		t.Fatal("peer deveria reconectar após unban")
+	}
+}
+
+func TestAdminBanCommands(t *testing.T) {
+	node := NewP2PNode("node-A", "127.0.0.1", 0)
+	node.addrManager = NewAddrManager(t.TempDir())
+
+	if _, err := node.RunAdminCommand("ban 10.0.0.7:8333 2h spam de inv"); err != nil {
+		t.Fatalf("ban falhou: %v", err)
+	}
+	out, _ := node.RunAdminCommand("bans")
+	if !strings.Contains(out, "10.0.0.7:8333") || !strings.Contains(out, "spam de inv") {
+		t.Fatalf("lista de bans incompleta: %q", out)
+	}
+	if bans := node.ListBans(); len(bans) != 1 || time.Until(bans[0].BanExpires) > 2*time.Hour {
+		t.Fatalf("duração do ban incorreta: %+v", bans)
+	}
+	if node.connectToPeer(&Peer{Address: "10.0.0.7", Port: 8333}) == nil {
+		t.Fatal("discagem para endereço banido deveria falhar")
+	}
+
+	if _, err := node.RunAdminCommand("unban 10.0.0.7"); err != nil {
+		t.Fatalf("unban por IP falhou: %v", err)
+	}
+	if len(node.ListBans()) != 0 {
+		t.Fatal("ban deveria ter sido removido")
+	}
+
+	for _, cmd := range []string{"ban", "ban desconhecido", "unban 10.0.0.7", "reboot"} {
+		if _, err := node.RunAdminCommand(cmd); err == nil {
+			t.Fatalf("comando %q deveria falhar", cmd)
+		}
+	}
+}
+
+func TestAdminConsoleRunsEachLine(t *testing.T) {
+	node := NewP2PNode("node-A", "127.0.0.1", 0)
+	node.addrManager = NewAddrManager(t.TempDir())
+
+	// Linhas vazias e comandos inválidos não interrompem o console
+	adminConsole(node, bufio.NewScanner(strings.NewReader("ban 10.0.0.7:8333 1h spam\n\nreboot\nban 10.0.0.8:8333\n")))
+	if bans := node.ListBans(); len(bans) != 2 {
+		t.Fatalf("bans pelo console: %+v", bans)
+	}
+}
+
+func TestRateLimitAndUnsolicitedDataArePenalized(t *testing.T) {
+	node := NewP2PNode("node-A", "127.0.0.1", 0)
+
+	msg := &NetworkMessage{Type: MSG_HEARTBEAT, From: "flooder"}
+	for i := 0; i < 100; i++ {
+		if err := node.security.AnalyzePeerBehavior("flooder", msg); err != nil {
+			t.Fatalf("mensagem %d dentro do limite recusada: %v", i, err)
+		}
+	}
+	if err := node.security.AnalyzePeerBehavior("flooder", msg); err != errRateLimited {
+		t.Fatalf("esperado rate limit, obtido %v", err)
+	}
+
+	node.handleBlockTxn(&NetworkMessage{
+		Type: MSG_BLOCK_TXN,
+		From: "intruso",
+		Data: &blockTxn{BlockHash: "desconhecido"},
+	})
+	if score := node.security.MisbehaviorScores()["intruso"]; score != penaltyUnsolicited {
+		t.Fatalf("pontuação por dados não pedidos %d, esperado %d", score, penaltyUnsolicited)
+	}
+}
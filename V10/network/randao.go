@@ -0,0 +1,281 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+)
+
+// Beacon de aleatoriedade RANDAO na cadeia (commit-reveal). Na primeira
+// metade de cada época os validadores do conjunto publicam uma transação
+// "randao_commit" com sha256(segredo|validador|época) e, na segunda, a
+// "randao_reveal" com o segredo; as duas são assinadas com a chave de
+// consenso registrada no estado. O bloco que fecha a época combina os
+// segredos revelados com a semente anterior: como os compromissos foram
+// fixados antes de qualquer revelação, ninguém escolhe um segredo depois de
+// ver os outros.
+//
+// A revelação só entra na cadeia se algum proponente a incluir, então a
+// ausência sozinha não prova retenção: quem se comprometeu e não revelou
+// perde stake apenas se os blocos da fase de revelação foram propostos por
+// outros validadores com mais de 1/3 do poder, ou seja, se ao menos um
+// proponente honesto teve a chance de incluí-la. Resta um viés: o último a
+// revelar pode reter o segredo e aceitar a punição, e um proponente pode
+// deixar de fora revelações dos blocos que monta, escolhendo entre poucas
+// sementes possíveis (as revelações que ele exclui ainda entram pelos
+// proponentes seguintes da janela). A janela com vários proponentes limita
+// essa escolha, não a elimina.
+//
+// O proponente de cada altura e rodada do BFT é
+// sorteado com a semente da época, com peso pelo poder
+// (validatorSet.proposer), nunca pelo hash do bloco. O segredo do nó é a
+// assinatura da época com a própria chave, que é determinística: ninguém
+// mais o calcula e o nó o recupera depois de reiniciar.
+
+const (
+	TX_RANDAO_COMMIT = "randao_commit" // O validador From publica o compromisso da época (Randao)
+	TX_RANDAO_REVEAL = "randao_reveal" // O validador From revela o segredo da época (Randao)
+
+	withholdSlashPercent = 5 // Stake perdido por não revelar
+	randaoGenesisSeed    = "PTW_RANDAO_GENESIS"
+	maxSamplingAttempts  = 64
+)
+
+func isRandaoTx(txType string) bool {
+	return txType == TX_RANDAO_COMMIT || txType == TX_RANDAO_REVEAL
+}
+
+func genesisBeacon() string {
+	seed := sha256.Sum256([]byte(randaoGenesisSeed))
+	return hex.EncodeToString(seed[:])
+}
+
+// randaoCommitment é o valor publicado na fase de commit
+func randaoCommitment(validatorID, secret string, epoch int) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s|%s|%d", secret, validatorID, epoch)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// epochOf numera as épocas a partir de 0 (alturas 1 a EpochLength)
+func (s *ChainState) epochOf(height int) int {
+	return (height - 1) / s.EpochLength
+}
+
+// isCommitPhase: a altura está na primeira metade da época. Épocas de um
+// bloco não têm fase de commit, e o beacon só encadeia a semente.
+func (s *ChainState) isCommitPhase(height int) bool {
+	return (height-1)%s.EpochLength < s.EpochLength/2
+}
+
+func (s *ChainState) inEpochSet(validator string) bool {
+	for _, v := range s.EpochValidators {
+		if v.ID == validator {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyValidatorSignature confere a assinatura da transação com a chave de
+// consenso registrada para o validador From
+func (s *ChainState) verifyValidatorSignature(tx *Transaction) error {
+	if tx.PublicKey == "" || tx.PublicKey != s.Keys[tx.From] {
+		return fmt.Errorf("%s não assinou com a chave registrada", tx.From)
+	}
+	key, err := parsePublicKey(tx.PublicKey)
+	if err != nil {
+		return err
+	}
+	if !verifyConsensus(key, txSignBytes(tx), tx.Signature) {
+		return fmt.Errorf("assinatura inválida de %s", tx.From)
+	}
+	return nil
+}
+
+func (s *ChainState) applyRandao(tx *Transaction, height int) error {
+	if !s.inEpochSet(tx.From) {
+		return fmt.Errorf("%s não está no conjunto da época", tx.From)
+	}
+	if err := s.verifyValidatorSignature(tx); err != nil {
+		return err
+	}
+	commit := tx.Type == TX_RANDAO_COMMIT
+	if commit != s.isCommitPhase(height) {
+		return fmt.Errorf("%s fora da fase na altura %d", tx.Type, height)
+	}
+
+	epoch := s.epochOf(height)
+	if commit {
+		if _, done := s.RandaoCommits[tx.From]; done {
+			return fmt.Errorf("%s já se comprometeu na época %d", tx.From, epoch)
+		}
+		if raw, err := hex.DecodeString(tx.Randao); err != nil || len(raw) != sha256.Size {
+			return fmt.Errorf("compromisso deve ser um SHA-256 em hex")
+		}
+		s.RandaoCommits[tx.From] = tx.Randao
+		return nil
+	}
+	commitment, committed := s.RandaoCommits[tx.From]
+	if !committed {
+		return fmt.Errorf("%s não se comprometeu na época %d", tx.From, epoch)
+	}
+	if _, done := s.RandaoReveals[tx.From]; done {
+		return fmt.Errorf("%s já revelou na época %d", tx.From, epoch)
+	}
+	if randaoCommitment(tx.From, tx.Randao, epoch) != commitment {
+		return fmt.Errorf("segredo não corresponde ao compromisso de %s", tx.From)
+	}
+	s.RandaoReveals[tx.From] = tx.Randao
+	return nil
+}
+
+// closeBeacon fecha a época: combina as revelações com a semente anterior e
+// pune quem se comprometeu e não revelou numa janela aberta a proponentes
+// honestos (revealWindowOpen). Retorna os punidos.
+func (s *ChainState) closeBeacon() []string {
+	// Ordem fixa: todos os nós chegam à mesma semente
+	revealed := make([]string, 0, len(s.RandaoReveals))
+	for id := range s.RandaoReveals {
+		revealed = append(revealed, id)
+	}
+	sort.Strings(revealed)
+
+	seed, _ := hex.DecodeString(s.Beacon)
+	var mix [sha256.Size]byte
+	for _, id := range revealed {
+		contribution := sha256.Sum256([]byte(s.RandaoReveals[id]))
+		for i := range mix {
+			mix[i] ^= contribution[i]
+		}
+	}
+	next := sha256.Sum256(append(seed, mix[:]...))
+	s.Beacon = hex.EncodeToString(next[:])
+
+	var withheld []string
+	for id := range s.RandaoCommits {
+		if _, ok := s.RandaoReveals[id]; !ok {
+			withheld = append(withheld, id)
+		}
+	}
+	sort.Strings(withheld)
+	var slashed []string
+	for _, id := range withheld {
+		if s.revealWindowOpen(id) {
+			amount := s.slash(id, withholdSlashPercent)
+			slashed = append(slashed, id)
+			s.Incidents = append(s.Incidents, validatorIncident{"VALIDATOR_SLASHED", id,
+				fmt.Sprintf("%d de stake retirados (%d%%) por não revelar o RANDAO", amount, withholdSlashPercent), "HIGH"})
+		}
+	}
+	s.RandaoCommits = make(map[string]string)
+	s.RandaoReveals = make(map[string]string)
+	s.RevealProposers = make(map[string]bool)
+	return slashed
+}
+
+// revealWindowOpen: os blocos da fase de revelação foram propostos por
+// outros validadores com mais de 1/3 do poder da época; com menos de 1/3
+// bizantino, algum deles era honesto e teria incluído a revelação
+func (s *ChainState) revealWindowOpen(validator string) bool {
+	total, others := 0, 0
+	for _, v := range s.EpochValidators {
+		total += v.Amount
+		if v.ID != validator && s.RevealProposers[v.ID] {
+			others += v.Amount
+		}
+	}
+	return others*3 > total
+}
+
+// sampleIndex sorteia um número em [0, n) a partir da semente, da altura e
+// da rodada, sem viés de módulo
+func sampleIndex(seed string, height, round int, n uint64) uint64 {
+	limit := ^uint64(0) - ^uint64(0)%n
+	for attempt := 0; attempt < maxSamplingAttempts; attempt++ {
+		h := sha256.New()
+		fmt.Fprintf(h, "%s|%d|%d|%d", seed, height, round, attempt)
+		v := binary.BigEndian.Uint64(h.Sum(nil))
+		if v < limit {
+			return v % n
+		}
+	}
+	return 0
+}
+
+// === Integração com o nó ===
+
+// randaoSecret é o segredo do nó na época
+func (node *P2PNode) randaoSecret(epoch int) (string, error) {
+	signature, err := signConsensus(node.identity.key, []byte(fmt.Sprintf("randao|%s|%d", node.ID, epoch)))
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(signature))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// participateInBeacon coloca no mempool o compromisso ou a revelação que
+// cabe ao nó na próxima altura; chamada a cada bloco novo
+func (node *P2PNode) participateInBeacon() {
+	if !node.IsValidator || node.identity == nil {
+		return
+	}
+	state := node.ChainState()
+	height := state.Height + 1
+	publicKey := encodePublicKey(&node.identity.key.PublicKey)
+	if state.Keys[node.ID] != publicKey || !state.inEpochSet(node.ID) {
+		return
+	}
+	epoch := state.epochOf(height)
+	secret, err := node.randaoSecret(epoch)
+	if err != nil {
+		return
+	}
+
+	tx := Transaction{From: node.ID, To: node.ID, Timestamp: node.clock.Now(), PublicKey: publicKey}
+	_, committed := state.RandaoCommits[node.ID]
+	_, revealed := state.RandaoReveals[node.ID]
+	switch {
+	case state.isCommitPhase(height) && !committed:
+		tx.Type, tx.Randao = TX_RANDAO_COMMIT, randaoCommitment(node.ID, secret, epoch)
+	case !state.isCommitPhase(height) && committed && !revealed:
+		tx.Type, tx.Randao = TX_RANDAO_REVEAL, secret
+	default:
+		return
+	}
+	tx.ID = fmt.Sprintf("%s_%s_%d", tx.Type, node.ID, epoch)
+	if tx.Signature, err = signConsensus(node.identity.key, txSignBytes(&tx)); err != nil {
+		return
+	}
+	if err := node.checkStakingTx(&tx); err != nil {
+		return
+	}
+
+	node.mutex.Lock()
+	for _, pending := range node.PendingTxs {
+		if pending.ID == tx.ID {
+			node.mutex.Unlock()
+			return
+		}
+	}
+	node.PendingTxs = append(node.PendingTxs, tx)
+	node.mutex.Unlock()
+
+	fmt.Printf("🎲 [%s] %s da época %d\n", node.ID, tx.Type, epoch)
+	node.AnnounceTransaction(&tx, "")
+}
+
+// beaconStatus resume o beacon para o console
+func (node *P2PNode) beaconStatus() string {
+	state := node.ChainState()
+	height := state.Height + 1
+	phase := "revelação"
+	if state.isCommitPhase(height) {
+		phase = "commit"
+	}
+	return fmt.Sprintf("época %d, fase de %s, semente %s, %d compromissos, %d revelações",
+		state.epochOf(height), phase, state.Beacon, len(state.RandaoCommits), len(state.RandaoReveals))
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// randaoState: A, B, C e D com stake 100 e as chaves do bftHarness, em
+// épocas de 4 blocos (commit nas alturas 1 e 2, revelação em 3 e 4)
+func randaoState(h *bftHarness) *ChainState {
+	genesis := &StakingGenesis{EpochLength: 4}
+	for id, key := range h.keys {
+		genesis.Validators = append(genesis.Validators, ValidatorStake{ID: id, Owner: addr(id), Amount: 100, PubKey: encodePublicKey(&key.PublicKey)})
+	}
+	return newChainState(genesis, "genesis")
+}
+
+// randaoTx monta a transação do beacon assinada com a chave de signer
+func randaoTx(t *testing.T, h *bftHarness, txType, from, signer, value string) Transaction {
+	t.Helper()
+	key := h.keys[signer]
+	tx := Transaction{ID: txType + "_" + from, Type: txType, From: from, To: from, PublicKey: encodePublicKey(&key.PublicKey), Randao: value}
+	signature, err := signConsensus(key, txSignBytes(&tx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Signature = signature
+	return tx
+}
+
+// applyEpoch aplica os blocos 1 a 4 com os compromissos e as revelações dos
+// segredos; quem está em withhold não revela. Os blocos 3 e 4, da fase de
+// revelação, são dos proponentes em revealers.
+func applyEpoch(t *testing.T, h *bftHarness, state *ChainState, secrets map[string]string, withhold string, revealers ...string) {
+	t.Helper()
+	var commits, reveals []Transaction
+	for id, secret := range secrets {
+		commits = append(commits, randaoTx(t, h, TX_RANDAO_COMMIT, id, id, randaoCommitment(id, secret, 0)))
+		if id != withhold {
+			reveals = append(reveals, randaoTx(t, h, TX_RANDAO_REVEAL, id, id, secret))
+		}
+	}
+	for i, txs := range [][]Transaction{commits, nil, reveals, nil} {
+		block := Token{Index: i + 1, Transactions: txs}
+		if i >= 2 {
+			block.Validator = revealers[(i-2)%len(revealers)]
+		}
+		if err := state.applyBlock(&block); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRandaoTransactionsAreCheckedOnChain(t *testing.T) {
+	h := newBFTHarness(t)
+	state := randaoState(h)
+	commitment := randaoCommitment("A", "segredo", 0)
+
+	for name, tx := range map[string]Transaction{
+		"assinado por outro validador": randaoTx(t, h, TX_RANDAO_COMMIT, "A", "B", commitment),
+		"de quem não está no conjunto": randaoTx(t, h, TX_RANDAO_COMMIT, "E", "A", commitment),
+		"revelação na fase de commit":  randaoTx(t, h, TX_RANDAO_REVEAL, "A", "A", "segredo"),
+	} {
+		if err := state.clone().applyTx(&tx, 1); err == nil {
+			t.Fatalf("%s aceito", name)
+		}
+	}
+	commit := randaoTx(t, h, TX_RANDAO_COMMIT, "A", "A", commitment)
+	if !NewTransactionValidator().VerifySignature(&commit) {
+		t.Fatal("assinatura do compromisso não confere")
+	}
+	if err := state.applyTx(&commit, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.applyTx(&commit, 2); err == nil {
+		t.Fatal("segundo compromisso aceito")
+	}
+	late := randaoTx(t, h, TX_RANDAO_COMMIT, "B", "B", randaoCommitment("B", "b", 0))
+	if err := state.applyTx(&late, 3); err == nil {
+		t.Fatal("compromisso na fase de revelação aceito")
+	}
+	wrong := randaoTx(t, h, TX_RANDAO_REVEAL, "A", "A", "outro")
+	if err := state.applyTx(&wrong, 3); err == nil {
+		t.Fatal("segredo diferente do compromisso aceito")
+	}
+	reveal := randaoTx(t, h, TX_RANDAO_REVEAL, "A", "A", "segredo")
+	if err := state.applyTx(&reveal, 3); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRandaoBeaconIsReproducibleAndPunishesWithholding(t *testing.T) {
+	h := newBFTHarness(t)
+	secrets := map[string]string{"A": "a1", "B": "b1", "C": "c1", "D": "d1"}
+
+	first, second := randaoState(h), randaoState(h)
+	applyEpoch(t, h, first, secrets, "D", "A", "B")
+	applyEpoch(t, h, second, secrets, "D", "A", "B")
+	if first.Beacon != second.Beacon || first.Beacon == genesisBeacon() {
+		t.Fatalf("sementes %s e %s", first.Beacon, second.Beacon)
+	}
+	if first.Stakes["D"].Amount != 95 || first.Stakes["A"].Amount != 100 {
+		t.Fatalf("penalidade incorreta: D %d, A %d", first.Stakes["D"].Amount, first.Stakes["A"].Amount)
+	}
+	if len(first.Incidents) != 1 || first.Incidents[0].Action != "VALIDATOR_SLASHED" || first.Incidents[0].Validator != "D" {
+		t.Fatalf("punição fora dos incidentes do bloco: %+v", first.Incidents)
+	}
+	if len(first.RandaoCommits) != 0 || len(first.RandaoReveals) != 0 || len(first.RevealProposers) != 0 {
+		t.Fatal("compromissos da época anterior mantidos")
+	}
+
+	// Com a fase de revelação toda nas mãos de C (1/4 do poder), a revelação
+	// de D pode ter sido censurada: sem punição
+	censored := randaoState(h)
+	applyEpoch(t, h, censored, secrets, "D", "C")
+	if censored.Stakes["D"].Amount != 100 {
+		t.Fatalf("D punido com a janela de revelação só de C: stake %d", censored.Stakes["D"].Amount)
+	}
+	// Os próprios blocos de D não contam como chance de revelar
+	own := randaoState(h)
+	applyEpoch(t, h, own, secrets, "D", "D", "C")
+	if own.Stakes["D"].Amount != 100 {
+		t.Fatalf("D punido pela janela dos próprios blocos: stake %d", own.Stakes["D"].Amount)
+	}
+
+	// Um único segredo diferente muda a semente
+	other := randaoState(h)
+	applyEpoch(t, h, other, map[string]string{"A": "a1", "B": "b1", "C": "c2", "D": "d1"}, "D", "A", "B")
+	if other.Beacon == first.Beacon {
+		t.Fatal("semente não depende das revelações")
+	}
+}
+
+func TestProposerIsStakeWeightedFromBeacon(t *testing.T) {
+	powers := map[string]int{"v1": 400, "v2": 200, "v3": 100, "v4": 100, "v5": 100, "v6": 100}
+	var validators []bftValidator
+	total := 0
+	for id, power := range powers {
+		validators = append(validators, bftValidator{ID: id, Power: power})
+		total += power
+	}
+	set, same, other := newValidatorSet(validators), newValidatorSet(validators), newValidatorSet(validators)
+	set.seed, same.seed, other.seed = "semente", "semente", "outra"
+
+	const heights = 20000
+	counts := make(map[string]int)
+	differs := false
+	for height := 1; height <= heights; height++ {
+		proposer := set.proposer(height, 0)
+		if proposer != same.proposer(height, 0) {
+			t.Fatalf("altura %d sorteou proponentes diferentes com a mesma semente", height)
+		}
+		differs = differs || proposer != other.proposer(height, 0)
+		counts[proposer]++
+	}
+	if !differs {
+		t.Fatal("proponente não depende da semente")
+	}
+	for id, power := range powers {
+		expected := float64(heights) * float64(power) / float64(total)
+		if got := float64(counts[id]); got < expected*0.85 || got > expected*1.15 {
+			t.Fatalf("%s sorteado %d vezes, esperado ~%.0f", id, counts[id], expected)
+		}
+	}
+}
+
+func TestValidatorPublishesBeaconShare(t *testing.T) {
+	node := newTestNode(t, "node-A")
+	node.IsValidator = true
+	node.stakingGenesis = &StakingGenesis{
+		EpochLength: 4,
+		Validators:  []ValidatorStake{{ID: "node-A", Owner: addr("alice"), Amount: 100, PubKey: encodePublicKey(&node.identity.key.PublicKey)}},
+	}
+
+	// Cada bloco leva o que o nó pôs no mempool depois do anterior
+	for height := 1; height <= 4; height++ {
+		node.mutex.RLock()
+		block := testBlock(height, node.getLastBlockHash())
+		block.Transactions = append([]Transaction(nil), node.PendingTxs...)
+		node.mutex.RUnlock()
+		commitBlock(t, node, &block)
+		if !node.validateAndAddBlock(&block) {
+			t.Fatalf("bloco %d rejeitado", height)
+		}
+	}
+
+	state := node.ChainState()
+	if state.Beacon == genesisBeacon() || state.Stakes["node-A"].Amount != 100 {
+		t.Fatalf("beacon %s, stake %d: o nó não revelou o que comprometeu", state.Beacon, state.Stakes["node-A"].Amount)
+	}
+	if out, err := node.RunAdminCommand("beacon"); err != nil || !strings.Contains(out, "época 1") || !strings.Contains(out, state.Beacon) {
+		t.Fatalf("beacon: %q, %v", out, err)
+	}
+}
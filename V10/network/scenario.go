@@ -0,0 +1,643 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cenários de simulação: um roteiro de linhas executado sobre SimNetwork
+// com nós P2PNode reais. Com a mesma semente o resultado se repete, o que
+// permite reproduzir bugs de sync e consenso. O P2PNode não reorganiza a
+// cadeia: um fork (partição com mineração dos dois lados) é reproduzido,
+// mas os lados não convergem depois do heal.
+//
+//	seed 42                          semente (antes de qualquer outro comando)
+//	nodes A B C D                    cria e inicia os nós
+//	validator A B                    validadores com stake 100 no genesis, antes de minerar
+//	epoch 2                          blocos por época no genesis, antes de minerar
+//	link * latency=50ms jitter=10ms loss=0.01
+//	link A B latency=300ms           enlace específico entre dois nós
+//	connect A B                      A disca para B (falha se não conectar)
+//	mine A 3                         A minera 3 blocos e os anuncia
+//	propose A                        A propõe um bloco ao consenso
+//	partition A,B C,D                separa os grupos; heal reconecta
+//	byzantine D silent|badsig|corrupt|equivocate
+//	run 10s                          avança o tempo virtual
+//	expect height A|* 3
+//	expect tip A B                   A e B têm o mesmo topo
+//	expect fork A C                  A e C têm topos diferentes
+//	expect peers A 2
+//	expect banned A D                A baniu D
+//	expect jailed A D                o estado de A tem D preso por dupla assinatura
+//	expect light A 4                 cliente leve segue os cabeçalhos de A até a altura 4
+const (
+	scenarioDefaultSeed = 1
+	scenarioStake       = 100
+	connectWait         = dialTimeout + handshakeTimeout + time.Second
+)
+
+// Comportamentos bizantinos aceitos pelo comando byzantine
+const (
+	byzantineSilent     = "silent"     // Não envia nada depois do handshake
+	byzantineBadSig     = "badsig"     // Envia mensagens com assinatura inválida
+	byzantineCorrupt    = "corrupt"    // Minera e anuncia blocos inválidos (sem SYRA)
+	byzantineEquivocate = "equivocate" // Propõe e vota em blocos diferentes para cada metade dos peers
+)
+
+type scenarioStep struct {
+	line int
+	cmd  string
+	args []string
+	text string
+}
+
+// Scenario é um roteiro já validado
+type Scenario struct {
+	steps []scenarioStep
+}
+
+// ScenarioResult guarda o trace da execução e o estado final dos nós
+type ScenarioResult struct {
+	Trace   []string
+	Heights map[string]int
+	Tips    map[string]string
+}
+
+// Aridade mínima e máxima de cada comando (-1 = sem máximo)
+var scenarioCommands = map[string][2]int{
+	"seed":      {1, 1},
+	"nodes":     {1, -1},
+	"validator": {1, -1},
+	"epoch":     {1, 1},
+	"link":      {2, -1},
+	"connect":   {2, 2},
+	"mine":      {1, 2},
+	"propose":   {1, 1},
+	"partition": {1, -1},
+	"heal":      {0, 0},
+	"byzantine": {2, 2},
+	"run":       {1, 1},
+	"expect":    {3, 3},
+}
+
+// ParseScenario lê o roteiro; linhas vazias e comentários (#) são ignorados
+func ParseScenario(script string) (*Scenario, error) {
+	scenario := &Scenario{}
+	for i, raw := range strings.Split(script, "\n") {
+		text := strings.TrimSpace(raw)
+		if cut := strings.Index(text, "#"); cut >= 0 {
+			text = strings.TrimSpace(text[:cut])
+		}
+		if text == "" {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		step := scenarioStep{line: i + 1, cmd: fields[0], args: fields[1:], text: text}
+		arity, known := scenarioCommands[step.cmd]
+		if !known {
+			return nil, fmt.Errorf("linha %d: comando desconhecido %q", step.line, step.cmd)
+		}
+		if len(step.args) < arity[0] || (arity[1] >= 0 && len(step.args) > arity[1]) {
+			return nil, fmt.Errorf("linha %d: número de argumentos inválido para %s", step.line, step.cmd)
+		}
+		if step.cmd == "seed" && len(scenario.steps) > 0 {
+			return nil, fmt.Errorf("linha %d: seed deve ser o primeiro comando", step.line)
+		}
+		scenario.steps = append(scenario.steps, step)
+	}
+	return scenario, nil
+}
+
+// scenarioRun é o estado de uma execução
+type scenarioRun struct {
+	sn        *SimNetwork
+	dataDir   string
+	rng       *rand.Rand // Hashes dos blocos minerados pelo roteiro
+	nodes     map[string]*P2PNode
+	order     []string
+	byzantine map[string]string
+	result    *ScenarioResult
+}
+
+// Run executa o roteiro; dataDir recebe um diretório por nó. Em caso de
+// erro (inclusive expect não atendido) o resultado parcial é retornado.
+func (s *Scenario) Run(dataDir string) (*ScenarioResult, error) {
+	seed := int64(scenarioDefaultSeed)
+	steps := s.steps
+	if len(steps) > 0 && steps[0].cmd == "seed" {
+		value, err := strconv.ParseInt(steps[0].args[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("linha %d: semente inválida: %v", steps[0].line, err)
+		}
+		seed = value
+		steps = steps[1:]
+	}
+
+	run := &scenarioRun{
+		sn:        NewSimNetwork(seed),
+		dataDir:   dataDir,
+		rng:       rand.New(rand.NewSource(seed)),
+		nodes:     make(map[string]*P2PNode),
+		byzantine: make(map[string]string),
+		result:    &ScenarioResult{Heights: make(map[string]int), Tips: make(map[string]string)},
+	}
+	for _, step := range steps {
+		err := run.exec(step)
+		if err == nil {
+			err = run.sn.Err()
+		}
+		if err != nil {
+			run.finish()
+			return run.result, fmt.Errorf("linha %d: %s: %v", step.line, step.text, err)
+		}
+		run.trace(step.text)
+	}
+	run.finish()
+	return run.result, nil
+}
+
+// RunScenario analisa e executa um roteiro
+func RunScenario(script, dataDir string) (*ScenarioResult, error) {
+	scenario, err := ParseScenario(script)
+	if err != nil {
+		return nil, err
+	}
+	return scenario.Run(dataDir)
+}
+
+// trace registra o passo com o instante virtual e as alturas dos nós
+func (r *scenarioRun) trace(text string) {
+	heights := make([]string, 0, len(r.order))
+	for _, name := range r.order {
+		heights = append(heights, fmt.Sprintf("%s:%d", name, chainHeight(r.nodes[name])))
+	}
+	elapsed := r.sn.Clock.Now().Sub(simEpoch)
+	r.result.Trace = append(r.result.Trace, fmt.Sprintf("[%s] %s | %s", elapsed, text, strings.Join(heights, " ")))
+}
+
+func (r *scenarioRun) finish() {
+	for _, name := range r.order {
+		node := r.nodes[name]
+		r.result.Heights[name] = chainHeight(node)
+		r.result.Tips[name] = node.getLastBlockHash()
+		r.result.Trace = append(r.result.Trace, fmt.Sprintf("%s altura=%d topo=%s",
+			name, r.result.Heights[name], r.result.Tips[name]))
+	}
+}
+
+func chainHeight(node *P2PNode) int {
+	node.mutex.RLock()
+	defer node.mutex.RUnlock()
+	return len(node.Blockchain)
+}
+
+func (r *scenarioRun) node(name string) (*P2PNode, error) {
+	node, exists := r.nodes[name]
+	if !exists {
+		return nil, fmt.Errorf("nó desconhecido %q", name)
+	}
+	return node, nil
+}
+
+// targets expande "*" para todos os nós
+func (r *scenarioRun) targets(name string) ([]*P2PNode, error) {
+	if name == "*" {
+		nodes := make([]*P2PNode, 0, len(r.order))
+		for _, n := range r.order {
+			nodes = append(nodes, r.nodes[n])
+		}
+		return nodes, nil
+	}
+	node, err := r.node(name)
+	if err != nil {
+		return nil, err
+	}
+	return []*P2PNode{node}, nil
+}
+
+// addGenesisValidator inclui o stake do validador no genesis de todos os
+// nós, como se ele constasse do genesis.json comum
+func (r *scenarioRun) addGenesisValidator(name string) {
+	validator := ValidatorStake{ID: name, Owner: name, Amount: scenarioStake}
+	if identity := r.nodes[name].identity; identity != nil {
+		validator.PubKey = encodePublicKey(&identity.key.PublicKey)
+	}
+	r.updateGenesis(func(genesis *StakingGenesis) {
+		genesis.Validators = append(genesis.Validators, validator)
+	})
+}
+
+// updateGenesis altera o genesis de todos os nós e descarta o estado
+// calculado a partir dele
+func (r *scenarioRun) updateGenesis(update func(*StakingGenesis)) {
+	for _, node := range r.nodes {
+		node.mutex.Lock()
+		if node.stakingGenesis == nil {
+			node.stakingGenesis = &StakingGenesis{}
+		}
+		update(node.stakingGenesis)
+		node.stateMtx.Lock()
+		node.state = nil
+		node.stateMtx.Unlock()
+		node.mutex.Unlock()
+	}
+}
+
+// shareChainID dá o hash do gênese minerado como chain ID aos nós que ainda
+// não têm um, como se ele constasse do genesis.json comum: sem ele um nó
+// sem cadeia é recusado no handshake por quem já tem a cadeia
+func (r *scenarioRun) shareChainID(chainID string) {
+	for _, node := range r.nodes {
+		node.mutex.Lock()
+		if node.ChainID == "" {
+			node.ChainID = chainID
+			node.stateMtx.Lock()
+			node.state = nil
+			node.stateMtx.Unlock()
+		}
+		node.mutex.Unlock()
+	}
+}
+
+func (r *scenarioRun) exec(step scenarioStep) error {
+	switch step.cmd {
+	case "seed":
+		return fmt.Errorf("seed deve ser o primeiro comando")
+	case "nodes":
+		return r.startNodes(step.args)
+	case "validator":
+		for _, name := range step.args {
+			node, err := r.node(name)
+			if err != nil {
+				return err
+			}
+			node.mutex.Lock()
+			node.IsValidator = true
+			node.Stake = scenarioStake
+			node.mutex.Unlock()
+			r.addGenesisValidator(name)
+		}
+		return nil
+	case "epoch":
+		length, err := strconv.Atoi(step.args[0])
+		if err != nil || length < 1 {
+			return fmt.Errorf("tamanho de época inválido: %s", step.args[0])
+		}
+		r.updateGenesis(func(genesis *StakingGenesis) { genesis.EpochLength = length })
+		return nil
+	case "link":
+		return r.configureLink(step.args)
+	case "connect":
+		return r.connect(step.args[0], step.args[1])
+	case "mine":
+		count := 1
+		if len(step.args) == 2 {
+			value, err := strconv.Atoi(step.args[1])
+			if err != nil || value < 1 {
+				return fmt.Errorf("quantidade de blocos inválida: %s", step.args[1])
+			}
+			count = value
+		}
+		return r.mine(step.args[0], count)
+	case "propose":
+		return r.propose(step.args[0])
+	case "partition":
+		groups := make([][]string, 0, len(step.args))
+		for _, arg := range step.args {
+			group := strings.Split(arg, ",")
+			for _, name := range group {
+				if _, err := r.node(name); err != nil {
+					return err
+				}
+			}
+			groups = append(groups, group)
+		}
+		r.sn.Partition(groups...)
+		return nil
+	case "heal":
+		r.sn.Heal()
+		return nil
+	case "byzantine":
+		return r.setByzantine(step.args[0], step.args[1])
+	case "run":
+		d, err := time.ParseDuration(step.args[0])
+		if err != nil || d < 0 {
+			return fmt.Errorf("duração inválida: %s", step.args[0])
+		}
+		r.sn.RunFor(d)
+		return nil
+	case "expect":
+		return r.expect(step.args[0], step.args[1], step.args[2])
+	}
+	return fmt.Errorf("comando desconhecido %q", step.cmd)
+}
+
+func (r *scenarioRun) startNodes(names []string) error {
+	for _, name := range names {
+		if _, exists := r.nodes[name]; exists || name == "*" {
+			return fmt.Errorf("nome de nó inválido ou repetido: %s", name)
+		}
+		node := r.sn.NewNode(name, filepath.Join(r.dataDir, name))
+		if err := node.StartNode(); err != nil {
+			return err
+		}
+		r.nodes[name] = node
+		r.order = append(r.order, name)
+	}
+	r.sn.Settle()
+	return nil
+}
+
+func (r *scenarioRun) configureLink(args []string) error {
+	link := LinkConfig{Latency: simDefaultLatency}
+	names := make([]string, 0, 2)
+	for _, arg := range args {
+		key, value, isOption := strings.Cut(arg, "=")
+		if !isOption {
+			names = append(names, arg)
+			continue
+		}
+		var err error
+		switch key {
+		case "latency":
+			link.Latency, err = time.ParseDuration(value)
+		case "jitter":
+			link.Jitter, err = time.ParseDuration(value)
+		case "loss":
+			link.Loss, err = strconv.ParseFloat(value, 64)
+			if err == nil && (link.Loss < 0 || link.Loss >= 1) {
+				err = fmt.Errorf("fora de [0, 1)")
+			}
+		default:
+			return fmt.Errorf("opção de enlace desconhecida: %s", key)
+		}
+		if err != nil {
+			return fmt.Errorf("valor inválido para %s: %v", key, err)
+		}
+	}
+
+	switch {
+	case len(names) == 1 && names[0] == "*":
+		r.sn.SetDefaultLink(link)
+	case len(names) == 2:
+		for _, name := range names {
+			if _, err := r.node(name); err != nil {
+				return err
+			}
+		}
+		r.sn.SetLink(names[0], names[1], link)
+	default:
+		return fmt.Errorf("informe * ou dois nós")
+	}
+	return nil
+}
+
+// connect disca de um nó para outro e roda a simulação até o fim do handshake
+func (r *scenarioRun) connect(from, to string) error {
+	node, err := r.node(from)
+	if err != nil {
+		return err
+	}
+	target, err := r.node(to)
+	if err != nil {
+		return err
+	}
+
+	result := make(chan bool, 1)
+	go func() { result <- node.ConnectToAddress(target.Address, strconv.Itoa(target.Port)) }()
+
+	var ok, done bool
+	r.sn.runUntil(r.sn.Clock.Now().Add(connectWait), func() bool {
+		if !done {
+			select {
+			case ok = <-result:
+				done = true
+			default:
+			}
+		}
+		return done
+	})
+	if !done {
+		return fmt.Errorf("handshake não terminou em %s", connectWait)
+	}
+	if !ok {
+		return fmt.Errorf("conexão falhou")
+	}
+	r.sn.Settle()
+	return nil
+}
+
+// nextBlock monta o próximo bloco do nó com hash derivado da semente
+func (r *scenarioRun) nextBlock(name string, node *P2PNode) *Token {
+	node.mutex.RLock()
+	index := len(node.Blockchain) + 1
+	node.mutex.RUnlock()
+
+	return &Token{
+		Index:        index,
+		Hash:         fmt.Sprintf("SIM_%s_%04d_%016x", name, index, r.rng.Uint64()),
+		Timestamp:    r.sn.Clock.Now().Format(time.RFC3339),
+		ContainsSyra: true,
+		Validator:    node.ID,
+		MinerID:      node.ID,
+		PrevHash:     node.getLastBlockHash(),
+	}
+}
+
+func (r *scenarioRun) mine(name string, count int) error {
+	node, err := r.node(name)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < count; i++ {
+		block := r.nextBlock(name, node)
+		if r.byzantine[name] == byzantineCorrupt {
+			// O nó bizantino aceita o próprio bloco inválido e o anuncia
+			block.ContainsSyra = false
+			node.mutex.Lock()
+			node.Blockchain = append(node.Blockchain, *block)
+			node.mutex.Unlock()
+		} else if !node.validateAndAddBlock(block) {
+			return fmt.Errorf("bloco %s recusado pelo próprio nó", block.Hash)
+		}
+		if block.Index == 1 {
+			r.shareChainID(block.Hash)
+		}
+		node.AnnounceBlock(block, "")
+		r.sn.Settle()
+	}
+	return nil
+}
+
+func (r *scenarioRun) propose(name string) error {
+	node, err := r.node(name)
+	if err != nil {
+		return err
+	}
+	if !node.IsValidator {
+		return fmt.Errorf("%s não é validador", name)
+	}
+	node.StartConsensusRound(r.nextBlock(name, node))
+	r.sn.Settle()
+	return nil
+}
+
+func (r *scenarioRun) setByzantine(name, mode string) error {
+	node, err := r.node(name)
+	if err != nil {
+		return err
+	}
+
+	switch mode {
+	case byzantineSilent:
+		node.outboundHook = func(string, *NetworkMessage) *NetworkMessage { return nil }
+	case byzantineBadSig:
+		node.outboundHook = func(_ string, msg *NetworkMessage) *NetworkMessage {
+			forged := *msg
+			forged.Signature = strings.Repeat("0", len(msg.Signature))
+			return &forged
+		}
+	case byzantineCorrupt:
+		node.outboundHook = nil
+	case byzantineEquivocate:
+		twins := make(map[string]bool)
+		for i, other := range r.order {
+			twins[other] = i%2 == 1
+		}
+		node.outboundHook = func(peerID string, msg *NetworkMessage) *NetworkMessage {
+			if !twins[peerID] {
+				return msg
+			}
+			return equivocate(node, msg)
+		}
+	default:
+		return fmt.Errorf("comportamento bizantino desconhecido: %s", mode)
+	}
+	r.byzantine[name] = mode
+	return nil
+}
+
+// equivocate troca o bloco de propostas e votos por um conflitante, com
+// assinaturas válidas do próprio nó
+func equivocate(node *P2PNode, msg *NetworkMessage) *NetworkMessage {
+	chainID := node.localChainID()
+	forged := *msg
+	switch data := msg.Data.(type) {
+	case *consensusProposal:
+		proposal := *data
+		proposal.Block.Hash += "-twin"
+		signature, err := signConsensus(node.identity.key, proposalSignBytes(chainID, &proposal))
+		if err != nil {
+			return msg
+		}
+		proposal.Signature = signature
+		forged.Data = &proposal
+	case *ConsensusVote:
+		if data.BlockHash == "" {
+			return msg
+		}
+		vote := *data
+		vote.BlockHash += "-twin"
+		signature, err := signConsensus(node.identity.key, voteSignBytes(chainID, &vote))
+		if err != nil {
+			return msg
+		}
+		vote.Signature = signature
+		forged.Data = &vote
+	default:
+		return msg
+	}
+	if err := node.security.SignMessage(&forged, node.identity.key); err != nil {
+		return msg
+	}
+	return &forged
+}
+
+func (r *scenarioRun) expect(what, name, value string) error {
+	nodes, err := r.targets(name)
+	if err != nil {
+		return err
+	}
+
+	switch what {
+	case "height":
+		want, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("altura inválida: %s", value)
+		}
+		for _, node := range nodes {
+			if got := chainHeight(node); got != want {
+				return fmt.Errorf("altura de %s é %d, esperado %d", node.ID, got, want)
+			}
+		}
+	case "tip", "fork":
+		other, err := r.node(value)
+		if err != nil {
+			return err
+		}
+		for _, node := range nodes {
+			same := node.getLastBlockHash() == other.getLastBlockHash()
+			if what == "tip" && !same {
+				return fmt.Errorf("topo de %s (%s) difere do de %s (%s)",
+					node.ID, node.getLastBlockHash(), other.ID, other.getLastBlockHash())
+			}
+			if what == "fork" && same {
+				return fmt.Errorf("%s e %s têm o mesmo topo %s", node.ID, other.ID, other.getLastBlockHash())
+			}
+		}
+	case "peers":
+		want, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("número de peers inválido: %s", value)
+		}
+		for _, node := range nodes {
+			if got := len(node.connectedPeerIDs()); got != want {
+				peers := node.connectedPeerIDs()
+				sort.Strings(peers)
+				return fmt.Errorf("%s tem %d peers %v, esperado %d", node.ID, got, peers, want)
+			}
+		}
+	case "banned":
+		other, err := r.node(value)
+		if err != nil {
+			return err
+		}
+		for _, node := range nodes {
+			if node != other && !node.isBanned(other.ID, other.Address, other.Port) {
+				return fmt.Errorf("%s não baniu %s", node.ID, other.ID)
+			}
+		}
+	case "jailed":
+		if _, err := r.node(value); err != nil {
+			return err
+		}
+		for _, node := range nodes {
+			if !node.ChainState().Jailed[value] {
+				return fmt.Errorf("%s não prendeu %s", node.ID, value)
+			}
+		}
+	case "light":
+		want, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("altura inválida: %s", value)
+		}
+		for _, node := range nodes {
+			node.mutex.RLock()
+			client := NewLightClient(node.stakingGenesis, node.ChainID)
+			node.mutex.RUnlock()
+			if err := client.Sync(node.SignedHeader, want); err != nil {
+				return fmt.Errorf("cliente leve de %s: %v", node.ID, err)
+			}
+		}
+	default:
+		return fmt.Errorf("expectativa desconhecida: %s", what)
+	}
+	return nil
+}
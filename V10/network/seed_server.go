@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Seed server: um DNS mínimo (UDP) que responde com os bons endereços do
+// AddrManager, para redes que não têm ou não querem seeds públicos.
+//
+//	<zona>            A/AAAA  peers na porta padrão da rede
+//	<zona>            TXT     um registro "ip:porta" por peer
+//	_ptw._tcp.<zona>  SRV     peers com porta; o alvo é <ip em hex>.<zona>
+//	<ip em hex>.<zona> A/AAAA  o IP codificado no nome
+const (
+	dnsTypeA    = 1
+	dnsTypeTXT  = 16
+	dnsTypeAAAA = 28
+	dnsTypeSRV  = 33
+	dnsClassIN  = 1
+
+	dnsRcodeOK       = 0
+	dnsRcodeFormErr  = 1
+	dnsRcodeNXDomain = 3
+	dnsRcodeNotImp   = 4
+	dnsRcodeRefused  = 5
+
+	dnsHeaderSize      = 12
+	seedMaxPacket      = 512 // Resposta cabe num datagrama DNS clássico
+	seedTTL            = 60
+	seedCandidateCount = 64 // Endereços sorteados do AddrManager por consulta
+)
+
+// SeedServer responde consultas DNS sobre a zona configurada
+type SeedServer struct {
+	zone        string
+	defaultPort string
+	addrManager *AddrManager
+	conn        net.PacketConn
+	closeOnce   sync.Once
+}
+
+// NewSeedServer cria o seed server da zona
+func NewSeedServer(zone string, defaultPort int, addrManager *AddrManager) *SeedServer {
+	return &SeedServer{
+		zone:        strings.ToLower(strings.TrimSuffix(zone, ".")),
+		defaultPort: strconv.Itoa(defaultPort),
+		addrManager: addrManager,
+	}
+}
+
+// Start abre o socket UDP e atende em segundo plano
+func (ss *SeedServer) Start(listen string) error {
+	conn, err := net.ListenPacket("udp", listen)
+	if err != nil {
+		return fmt.Errorf("erro ao iniciar seed server: %v", err)
+	}
+	ss.conn = conn
+	fmt.Printf("🌱 Seed server da zona %s em %s\n", ss.zone, conn.LocalAddr())
+
+	go ss.serve()
+	return nil
+}
+
+// Addr retorna o endereço UDP em que o servidor atende
+func (ss *SeedServer) Addr() string {
+	return ss.conn.LocalAddr().String()
+}
+
+// Close encerra o servidor
+func (ss *SeedServer) Close() {
+	ss.closeOnce.Do(func() { ss.conn.Close() })
+}
+
+func (ss *SeedServer) serve() {
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := ss.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if reply := ss.answer(buf[:n]); reply != nil {
+			ss.conn.WriteTo(reply, from)
+		}
+	}
+}
+
+// dnsRecord é uma resposta sobre o nome da pergunta
+type dnsRecord struct {
+	rtype uint16
+	data  []byte
+}
+
+// answer monta a resposta para uma consulta (nil descarta o pacote)
+func (ss *SeedServer) answer(query []byte) []byte {
+	if len(query) < dnsHeaderSize || query[2]&0x80 != 0 {
+		return nil // Curto demais ou já é uma resposta
+	}
+	if binary.BigEndian.Uint16(query[4:6]) != 1 {
+		return dnsReply(query, dnsHeaderSize, dnsRcodeFormErr, nil)
+	}
+	name, qtype, qclass, end, err := parseDNSQuestion(query)
+	if err != nil {
+		return dnsReply(query, dnsHeaderSize, dnsRcodeFormErr, nil)
+	}
+	if query[2]&0x78 != 0 || qclass != dnsClassIN {
+		return dnsReply(query, end, dnsRcodeNotImp, nil)
+	}
+
+	switch {
+	case name == ss.zone:
+		return dnsReply(query, end, dnsRcodeOK, ss.zoneRecords(qtype))
+	case name == "_"+seedSRVService+"._tcp."+ss.zone:
+		if qtype != dnsTypeSRV {
+			return dnsReply(query, end, dnsRcodeOK, nil)
+		}
+		return dnsReply(query, end, dnsRcodeOK, ss.srvRecords())
+	case strings.HasSuffix(name, "."+ss.zone):
+		ip := decodeSeedTarget(strings.TrimSuffix(name, "."+ss.zone))
+		if ip == nil {
+			return dnsReply(query, end, dnsRcodeNXDomain, nil)
+		}
+		return dnsReply(query, end, dnsRcodeOK, ipRecords(qtype, []net.IP{ip}))
+	default:
+		return dnsReply(query, end, dnsRcodeRefused, nil)
+	}
+}
+
+// goodPeers sorteia bons endereços do AddrManager, só com IPs literais
+func (ss *SeedServer) goodPeers() []*KnownAddress {
+	result := make([]*KnownAddress, 0)
+	for _, addr := range ss.addrManager.GetGoodAddresses(seedCandidateCount) {
+		if net.ParseIP(addr.IP) != nil {
+			result = append(result, addr)
+		}
+	}
+	return result
+}
+
+func (ss *SeedServer) zoneRecords(qtype uint16) []dnsRecord {
+	switch qtype {
+	case dnsTypeA, dnsTypeAAAA:
+		// A/AAAA não levam porta: só peers na porta padrão
+		ips := make([]net.IP, 0)
+		for _, addr := range ss.goodPeers() {
+			if addr.Port == ss.defaultPort {
+				ips = append(ips, net.ParseIP(addr.IP))
+			}
+		}
+		return ipRecords(qtype, ips)
+	case dnsTypeTXT:
+		records := make([]dnsRecord, 0)
+		for _, addr := range ss.goodPeers() {
+			text := net.JoinHostPort(addr.IP, addr.Port)
+			records = append(records, dnsRecord{rtype: dnsTypeTXT, data: append([]byte{byte(len(text))}, text...)})
+		}
+		return records
+	}
+	return nil
+}
+
+func (ss *SeedServer) srvRecords() []dnsRecord {
+	records := make([]dnsRecord, 0)
+	for _, addr := range ss.goodPeers() {
+		port, err := strconv.Atoi(addr.Port)
+		if err != nil {
+			continue
+		}
+		data := make([]byte, 6)
+		binary.BigEndian.PutUint16(data[0:], 10) // Prioridade
+		binary.BigEndian.PutUint16(data[2:], 10) // Peso
+		binary.BigEndian.PutUint16(data[4:], uint16(port))
+		data = appendDNSName(data, encodeSeedTarget(net.ParseIP(addr.IP))+"."+ss.zone)
+		records = append(records, dnsRecord{rtype: dnsTypeSRV, data: data})
+	}
+	return records
+}
+
+func ipRecords(qtype uint16, ips []net.IP) []dnsRecord {
+	records := make([]dnsRecord, 0)
+	for _, ip := range ips {
+		v4 := ip.To4()
+		switch {
+		case qtype == dnsTypeA && v4 != nil:
+			records = append(records, dnsRecord{rtype: dnsTypeA, data: v4})
+		case qtype == dnsTypeAAAA && v4 == nil:
+			records = append(records, dnsRecord{rtype: dnsTypeAAAA, data: ip.To16()})
+		}
+	}
+	return records
+}
+
+// encodeSeedTarget codifica o IP como rótulo DNS (hex dos bytes)
+func encodeSeedTarget(ip net.IP) string {
+	if v4 := ip.To4(); v4 != nil {
+		return hex.EncodeToString(v4)
+	}
+	return hex.EncodeToString(ip.To16())
+}
+
+func decodeSeedTarget(label string) net.IP {
+	raw, err := hex.DecodeString(label)
+	if err != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return nil
+	}
+	return net.IP(raw)
+}
+
+// parseDNSQuestion lê a pergunta (sem compressão) e retorna o nome em
+// minúsculas, o tipo, a classe e onde a pergunta termina
+func parseDNSQuestion(packet []byte) (string, uint16, uint16, int, error) {
+	labels := make([]string, 0)
+	offset := dnsHeaderSize
+	for {
+		if offset >= len(packet) {
+			return "", 0, 0, 0, fmt.Errorf("pergunta truncada")
+		}
+		length := int(packet[offset])
+		offset++
+		if length == 0 {
+			break
+		}
+		if length > 63 || offset+length > len(packet) {
+			return "", 0, 0, 0, fmt.Errorf("rótulo inválido")
+		}
+		labels = append(labels, strings.ToLower(string(packet[offset:offset+length])))
+		offset += length
+	}
+	if offset+4 > len(packet) {
+		return "", 0, 0, 0, fmt.Errorf("pergunta truncada")
+	}
+	qtype := binary.BigEndian.Uint16(packet[offset:])
+	qclass := binary.BigEndian.Uint16(packet[offset+2:])
+	return strings.Join(labels, "."), qtype, qclass, offset + 4, nil
+}
+
+func appendDNSName(buf []byte, name string) []byte {
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		buf = append(buf, byte(len(label)))
+		buf = append(buf, label...)
+	}
+	return append(buf, 0)
+}
+
+// dnsReply copia o cabeçalho e a pergunta da consulta e anexa as respostas
+// que couberem em seedMaxPacket
+func dnsReply(query []byte, questionEnd int, rcode int, records []dnsRecord) []byte {
+	reply := make([]byte, questionEnd, seedMaxPacket)
+	copy(reply, query[:questionEnd])
+
+	// QR + AA, preserva o RD da consulta
+	reply[2] = 0x84 | query[2]&0x01
+	reply[3] = byte(rcode)
+	if questionEnd == dnsHeaderSize {
+		binary.BigEndian.PutUint16(reply[4:], 0)
+	}
+	binary.BigEndian.PutUint16(reply[8:], 0)
+	binary.BigEndian.PutUint16(reply[10:], 0)
+
+	count := 0
+	for _, record := range records {
+		entry := []byte{0xC0, dnsHeaderSize} // Ponteiro para o nome da pergunta
+		entry = binary.BigEndian.AppendUint16(entry, record.rtype)
+		entry = binary.BigEndian.AppendUint16(entry, dnsClassIN)
+		entry = binary.BigEndian.AppendUint32(entry, seedTTL)
+		entry = binary.BigEndian.AppendUint16(entry, uint16(len(record.data)))
+		entry = append(entry, record.data...)
+
+		if len(reply)+len(entry) > seedMaxPacket {
+			break
+		}
+		reply = append(reply, entry...)
+		count++
+	}
+	binary.BigEndian.PutUint16(reply[6:], uint16(count))
+	return reply
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func startTestSeedServer(t *testing.T, zone string) (*SeedServer, *AddrManager) {
+	t.Helper()
+	am := NewAddrManager(t.TempDir())
+	for _, peer := range [][2]string{{"8.8.8.8", "8333"}, {"9.9.9.9", "9000"}, {"2001:db8::7", "8333"}} {
+		am.AddAddress(peer[0], peer[1], "peer")
+		am.Attempt(peer[0], peer[1], true)
+	}
+
+	server := NewSeedServer(zone, defaultP2PPort, am)
+	if err := server.Start("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	return server, am
+}
+
+func TestDNSSeederReadsSeedServer(t *testing.T) {
+	server, _ := startTestSeedServer(t, "seed.ptw.test")
+
+	target := NewAddrManager(t.TempDir())
+	seeder := NewDNSSeeder(target, &NetworkConfig{
+		DefaultPort: defaultP2PPort,
+		DNSSeeds:    []string{"seed.ptw.test."},
+		DNSResolver: server.Addr(),
+	})
+
+	// SRV e TXT trazem a porta de cada peer; A/AAAA usam a porta padrão
+	addrs, err := seeder.resolveSeed("seed.ptw.test.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"8.8.8.8:8333", "9.9.9.9:9000", "[2001:db8::7]:8333"}
+	if !reflect.DeepEqual(addrs, want) {
+		t.Fatalf("endereços do seed: %v, esperado %v", addrs, want)
+	}
+
+	seeder.TrySeedNodes()
+	addr, exists := target.knownAddresses["9.9.9.9:9000"]
+	if !exists || addr.Source != "dns" {
+		t.Fatalf("endereço do seed não registrado como dns: %+v", addr)
+	}
+}
+
+func TestSeedServerAnswers(t *testing.T) {
+	server, _ := startTestSeedServer(t, "seed.ptw.test")
+
+	query := func(name string, qtype uint16) []byte {
+		packet := []byte{0x12, 0x34, 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0}
+		packet = appendDNSName(packet, name)
+		packet = append(packet, byte(qtype>>8), byte(qtype), 0, dnsClassIN)
+		return server.answer(packet)
+	}
+	answers := func(reply []byte) int { return int(reply[6])<<8 | int(reply[7]) }
+
+	reply := query("seed.ptw.test", dnsTypeA)
+	if reply[0] != 0x12 || reply[1] != 0x34 || reply[2]&0x84 != 0x84 || reply[3]&0x0F != dnsRcodeOK {
+		t.Fatalf("cabeçalho da resposta inválido: % x", reply[:4])
+	}
+	// Só 8.8.8.8 é IPv4 na porta padrão
+	if answers(reply) != 1 {
+		t.Fatalf("esperado 1 registro A, obtidos %d", answers(reply))
+	}
+	if n := answers(query("_ptw._tcp.seed.ptw.test", dnsTypeSRV)); n != 3 {
+		t.Fatalf("esperados 3 registros SRV, obtidos %d", n)
+	}
+	if n := answers(query("08080808.seed.ptw.test", dnsTypeA)); n != 1 {
+		t.Fatalf("alvo SRV não resolvido: %d registros", n)
+	}
+	if rcode := query("zz.seed.ptw.test", dnsTypeA)[3] & 0x0F; rcode != dnsRcodeNXDomain {
+		t.Fatalf("nome inexistente na zona deveria dar NXDOMAIN, obtido %d", rcode)
+	}
+	if rcode := query("example.com", dnsTypeA)[3] & 0x0F; rcode != dnsRcodeRefused {
+		t.Fatalf("nome fora da zona deveria ser recusado, obtido %d", rcode)
+	}
+	if server.answer([]byte{0x12, 0x34}) != nil {
+		t.Fatal("pacote curto deveria ser descartado")
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// Início do tempo virtual: fixo para que timestamps e IDs de round se
+// repitam entre execuções do mesmo cenário
+var simEpoch = time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// VirtualClock é o relógio do simulador. O tempo só avança quando o
+// SimNetwork executa o próximo evento agendado; timers e tickers dos nós
+// viram eventos na mesma fila que as entregas da rede.
+type VirtualClock struct {
+	mtx    sync.Mutex
+	now    time.Time
+	seq    uint64
+	events simEventQueue
+}
+
+// simEvent é uma ação agendada; fire retorna se o evento teve efeito
+// (acordou alguém), para o simulador saber se precisa esperar os nós
+type simEvent struct {
+	at   time.Time
+	seq  uint64
+	fire func(now time.Time) bool
+}
+
+// simEventQueue ordena por instante e, no empate, por ordem de agendamento
+type simEventQueue []*simEvent
+
+func (q simEventQueue) Len() int { return len(q) }
+func (q simEventQueue) Less(i, j int) bool {
+	if !q[i].at.Equal(q[j].at) {
+		return q[i].at.Before(q[j].at)
+	}
+	return q[i].seq < q[j].seq
+}
+func (q simEventQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *simEventQueue) Push(x any)   { *q = append(*q, x.(*simEvent)) }
+func (q *simEventQueue) Pop() any {
+	old := *q
+	event := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return event
+}
+
+func NewVirtualClock(start time.Time) *VirtualClock {
+	return &VirtualClock{now: start}
+}
+
+func (c *VirtualClock) Now() time.Time {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.now
+}
+
+func (c *VirtualClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	c.schedule(d, func(now time.Time) bool {
+		ch <- now
+		return true
+	})
+	return ch
+}
+
+func (c *VirtualClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("intervalo não positivo para NewTicker")
+	}
+	t := &virtualTicker{clock: c, period: d, c: make(chan time.Time, 1)}
+	c.schedule(d, t.tick)
+	return t
+}
+
+// schedule agenda fire para daqui a d no tempo virtual
+func (c *VirtualClock) schedule(d time.Duration, fire func(now time.Time) bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.scheduleAtLocked(c.now.Add(d), fire)
+}
+
+func (c *VirtualClock) scheduleAt(at time.Time, fire func(now time.Time) bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.scheduleAtLocked(at, fire)
+}
+
+func (c *VirtualClock) scheduleAtLocked(at time.Time, fire func(now time.Time) bool) {
+	if at.Before(c.now) {
+		at = c.now
+	}
+	c.seq++
+	heap.Push(&c.events, &simEvent{at: at, seq: c.seq, fire: fire})
+}
+
+// step avança até o próximo evento com instante <= limit e o executa.
+// Retorna se havia evento e se ele teve efeito.
+func (c *VirtualClock) step(limit time.Time) (bool, bool) {
+	c.mtx.Lock()
+	if len(c.events) == 0 || c.events[0].at.After(limit) {
+		c.mtx.Unlock()
+		return false, false
+	}
+	event := heap.Pop(&c.events).(*simEvent)
+	c.now = event.at
+	c.mtx.Unlock()
+
+	return true, event.fire(event.at)
+}
+
+// advanceTo leva o relógio até t sem executar eventos (usado após step)
+func (c *VirtualClock) advanceTo(t time.Time) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if t.After(c.now) {
+		c.now = t
+	}
+}
+
+type virtualTicker struct {
+	clock   *VirtualClock
+	period  time.Duration
+	c       chan time.Time
+	mtx     sync.Mutex
+	stopped bool
+}
+
+func (t *virtualTicker) C() <-chan time.Time { return t.c }
+
+func (t *virtualTicker) Stop() {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.stopped = true
+}
+
+// tick reagenda o próximo disparo; como time.Ticker, descarta o tick se o
+// anterior ainda não foi consumido
+func (t *virtualTicker) tick(now time.Time) bool {
+	t.mtx.Lock()
+	stopped := t.stopped
+	t.mtx.Unlock()
+	if stopped {
+		return false
+	}
+
+	t.clock.scheduleAt(now.Add(t.period), t.tick)
+	select {
+	case t.c <- now:
+		return true
+	default:
+		return false
+	}
+}
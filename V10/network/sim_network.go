@@ -0,0 +1,582 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Rede simulada em memória: os P2PNode reais rodam sobre ela com o
+// VirtualClock. Cada direção de cada conexão tem seu próprio gerador
+// (derivado da semente), então latência, jitter e perda se repetem entre
+// execuções. Depois de cada evento o simulador espera os nós consumirem o que
+// foi entregue e todos os goroutines pararem antes de avançar o tempo, o que
+// torna a execução determinística.
+const (
+	simDefaultLatency = 20 * time.Millisecond
+	simRetransmitBase = 200 * time.Millisecond // RTO mínimo de um segmento perdido
+	simMaxRetransmits = 8
+	simMaxSettle      = 2 * time.Second // Limite de espera por nós ocupados; estourar é erro
+	simPort           = 8333
+	simEphemeralPort  = 49152
+)
+
+// LinkConfig descreve um enlace simulado entre dois nós
+type LinkConfig struct {
+	Latency time.Duration
+	Jitter  time.Duration // Atraso extra sorteado em [0, Jitter)
+	Loss    float64       // Chance de perda de um segmento; ele chega após retransmissão
+}
+
+// SimNetwork é a rede em memória compartilhada pelos nós simulados
+type SimNetwork struct {
+	Clock *VirtualClock
+	seed  int64
+
+	mtx         sync.Mutex
+	listeners   map[string]*simListener // "ip:porta" -> listener
+	defaultLink LinkConfig
+	links       map[string]LinkConfig // Par de nós -> configuração
+	groups      map[string]int        // Partição ativa: nó -> grupo
+	pipes       []*simPipe
+	conns       int
+	nextIP      int
+	nextPort    int
+
+	maxSettle time.Duration
+	unread    atomic.Int64 // Conexões com dados entregues e não lidos, mais conexões aguardando Accept
+	settleMu  sync.Mutex
+	stuck     error // Primeiro Settle que estourou maxSettle
+}
+
+func NewSimNetwork(seed int64) *SimNetwork {
+	return &SimNetwork{
+		Clock:       NewVirtualClock(simEpoch),
+		seed:        seed,
+		listeners:   make(map[string]*simListener),
+		defaultLink: LinkConfig{Latency: simDefaultLatency},
+		links:       make(map[string]LinkConfig),
+		nextPort:    simEphemeralPort,
+		maxSettle:   simMaxSettle,
+	}
+}
+
+// NewNode cria um nó com IP virtual próprio, ligado ao relógio e ao
+// transporte da simulação (ainda não iniciado)
+func (sn *SimNetwork) NewNode(id, dataDir string) *P2PNode {
+	sn.mtx.Lock()
+	sn.nextIP++
+	ip := fmt.Sprintf("10.0.%d.%d", sn.nextIP/250, sn.nextIP%250+1)
+	sn.mtx.Unlock()
+
+	node := NewP2PNode(id, ip, simPort)
+	node.dataDir = dataDir
+	node.useClock(sn.Clock)
+	node.transport = &simTransport{sn: sn, name: id, ip: ip}
+	return node
+}
+
+// SetDefaultLink configura os enlaces sem configuração própria
+func (sn *SimNetwork) SetDefaultLink(link LinkConfig) {
+	sn.mtx.Lock()
+	defer sn.mtx.Unlock()
+	sn.defaultLink = link
+}
+
+// SetLink configura o enlace entre dois nós (nos dois sentidos)
+func (sn *SimNetwork) SetLink(a, b string, link LinkConfig) {
+	sn.mtx.Lock()
+	defer sn.mtx.Unlock()
+	sn.links[linkKey(a, b)] = link
+}
+
+func linkKey(a, b string) string {
+	if a > b {
+		a, b = b, a
+	}
+	return a + "|" + b
+}
+
+// Partition separa os nós em grupos que não se comunicam; nós fora dos
+// grupos informados ficam juntos num grupo à parte. Segmentos enviados
+// entre grupos ficam retidos até o Heal.
+func (sn *SimNetwork) Partition(groups ...[]string) {
+	sn.mtx.Lock()
+	defer sn.mtx.Unlock()
+
+	sn.groups = make(map[string]int)
+	for i, group := range groups {
+		for _, name := range group {
+			sn.groups[name] = i + 1
+		}
+	}
+}
+
+// Heal desfaz a partição e entrega os segmentos retidos, em ordem
+func (sn *SimNetwork) Heal() {
+	sn.mtx.Lock()
+	defer sn.mtx.Unlock()
+
+	sn.groups = nil
+	for _, pipe := range sn.pipes {
+		held := pipe.held
+		pipe.held = nil
+		for _, segment := range held {
+			sn.transmitLocked(pipe, segment)
+		}
+	}
+}
+
+func (sn *SimNetwork) partitionedLocked(a, b string) bool {
+	return sn.groups != nil && sn.groups[a] != sn.groups[b]
+}
+
+// RunFor executa os eventos dos próximos d de tempo virtual
+func (sn *SimNetwork) RunFor(d time.Duration) {
+	limit := sn.Clock.Now().Add(d)
+	sn.runUntil(limit, nil)
+	sn.Clock.advanceTo(limit)
+}
+
+// runUntil executa eventos até limit ou até done retornar true
+func (sn *SimNetwork) runUntil(limit time.Time, done func() bool) bool {
+	sn.Settle()
+	for done == nil || !done() {
+		fired, effect := sn.Clock.step(limit)
+		if !fired {
+			return done != nil && done()
+		}
+		if effect {
+			sn.Settle()
+		}
+	}
+	return true
+}
+
+// Settle espera até que os nós tenham lido tudo o que a rede lhes entregou e
+// aceitado as conexões pendentes (contador unread) e que nenhum goroutine
+// esteja executando: todos terminaram de reagir ao último evento e estão
+// bloqueados em leituras, timers virtuais ou locks. Só então o tempo virtual
+// pode avançar. Se isso não acontece em maxSettle a execução deixou de ser
+// determinística; o erro fica em Err e o tempo avança mesmo assim.
+func (sn *SimNetwork) Settle() error {
+	deadline := time.Now().Add(sn.maxSettle)
+	idleChecks := 0
+	for idleChecks < 2 {
+		if !time.Now().Before(deadline) {
+			err := fmt.Errorf("rede simulada não estabilizou em %s (t=%s, %d entregas não lidas)",
+				sn.maxSettle, sn.Clock.Now().Sub(simEpoch), sn.unread.Load())
+			sn.settleMu.Lock()
+			if sn.stuck == nil {
+				sn.stuck = err
+			}
+			sn.settleMu.Unlock()
+			return err
+		}
+		runtime.Gosched()
+		if sn.unread.Load() == 0 && othersBlocked() {
+			idleChecks++
+		} else {
+			idleChecks = 0
+			time.Sleep(50 * time.Microsecond)
+		}
+	}
+	return nil
+}
+
+// Err retorna o primeiro Settle que estourou o prazo; testes e cenários
+// devem falhar quando ele não é nil
+func (sn *SimNetwork) Err() error {
+	sn.settleMu.Lock()
+	defer sn.settleMu.Unlock()
+	return sn.stuck
+}
+
+// othersBlocked inspeciona o estado dos goroutines (exceto o atual)
+func othersBlocked() bool {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	// Cada goroutine começa com "goroutine N [estado...]:"; o primeiro é o atual
+	for i, block := range bytes.Split(buf, []byte("\n\ngoroutine ")) {
+		if i == 0 {
+			continue
+		}
+		start := bytes.IndexByte(block, '[')
+		end := bytes.IndexByte(block, ']')
+		if start < 0 || end < start {
+			continue
+		}
+		state := block[start+1 : end]
+		for _, busy := range []string{"running", "runnable", "syscall", "preempted", "GC assist"} {
+			if bytes.HasPrefix(state, []byte(busy)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// simSegment é um trecho de dados (ou o fechamento) a caminho do destino
+type simSegment struct {
+	data []byte
+	fin  bool
+}
+
+// simPipe é uma direção de uma conexão
+type simPipe struct {
+	from, to string
+	dst      *simConn
+	rng      *rand.Rand
+	last     time.Time    // Entrega mais tardia já agendada (mantém a ordem)
+	held     []simSegment // Retidos pela partição
+}
+
+func (sn *SimNetwork) newPipeLocked(from, to string, dst *simConn) *simPipe {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d/%s>%s/%d", sn.seed, from, to, sn.conns)
+	pipe := &simPipe{from: from, to: to, dst: dst, rng: rand.New(rand.NewSource(int64(h.Sum64())))}
+	sn.pipes = append(sn.pipes, pipe)
+	return pipe
+}
+
+func (sn *SimNetwork) send(pipe *simPipe, segment simSegment) {
+	sn.mtx.Lock()
+	defer sn.mtx.Unlock()
+
+	if sn.partitionedLocked(pipe.from, pipe.to) {
+		pipe.held = append(pipe.held, segment)
+		return
+	}
+	sn.transmitLocked(pipe, segment)
+}
+
+// transmitLocked sorteia o atraso do segmento e agenda a entrega
+func (sn *SimNetwork) transmitLocked(pipe *simPipe, segment simSegment) {
+	link, exists := sn.links[linkKey(pipe.from, pipe.to)]
+	if !exists {
+		link = sn.defaultLink
+	}
+
+	delay := link.Latency
+	if link.Jitter > 0 {
+		delay += time.Duration(pipe.rng.Int63n(int64(link.Jitter)))
+	}
+	rto := simRetransmitBase + 2*link.Latency
+	for i := 0; i < simMaxRetransmits && link.Loss > 0 && pipe.rng.Float64() < link.Loss; i++ {
+		delay += rto
+		rto *= 2
+	}
+
+	// Como no TCP, nada chega antes do que foi enviado primeiro
+	at := sn.Clock.Now().Add(delay)
+	if at.Before(pipe.last) {
+		at = pipe.last
+	}
+	pipe.last = at
+
+	dst := pipe.dst
+	sn.Clock.scheduleAt(at, func(time.Time) bool { return dst.deliver(segment) })
+}
+
+func (sn *SimNetwork) listen(name, address string, config *tls.Config) (*simListener, error) {
+	host, portText, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil {
+		return nil, err
+	}
+
+	sn.mtx.Lock()
+	defer sn.mtx.Unlock()
+	if _, exists := sn.listeners[address]; exists {
+		return nil, fmt.Errorf("endereço %s já em uso", address)
+	}
+	listener := &simListener{
+		sn:     sn,
+		name:   name,
+		addr:   &net.TCPAddr{IP: net.ParseIP(host), Port: port},
+		config: config,
+		notify: make(chan struct{}, 1),
+	}
+	sn.listeners[address] = listener
+	return listener, nil
+}
+
+// dial cria o par de conexões e entrega a ponta do servidor ao listener
+func (sn *SimNetwork) dial(name, ip, address string) (*simConn, error) {
+	sn.mtx.Lock()
+	listener, exists := sn.listeners[address]
+	if !exists {
+		sn.mtx.Unlock()
+		return nil, fmt.Errorf("dial %s: conexão recusada", address)
+	}
+	if sn.partitionedLocked(name, listener.name) {
+		sn.mtx.Unlock()
+		return nil, fmt.Errorf("dial %s: rede inacessível", address)
+	}
+
+	sn.conns++
+	sn.nextPort++
+	client := newSimConn(sn, &net.TCPAddr{IP: net.ParseIP(ip), Port: sn.nextPort}, listener.addr)
+	server := newSimConn(sn, listener.addr, client.local)
+	client.out = sn.newPipeLocked(name, listener.name, server)
+	server.out = sn.newPipeLocked(listener.name, name, client)
+	sn.mtx.Unlock()
+
+	if !listener.enqueue(server) {
+		return nil, fmt.Errorf("dial %s: conexão recusada", address)
+	}
+	return client, nil
+}
+
+// simTransport é o Transport de um nó simulado
+type simTransport struct {
+	sn   *SimNetwork
+	name string
+	ip   string
+}
+
+func (t *simTransport) Listen(address string, config *tls.Config) (net.Listener, error) {
+	return t.sn.listen(t.name, address, config)
+}
+
+func (t *simTransport) Dial(address string, config *tls.Config, timeout time.Duration) (net.Conn, error) {
+	raw, err := t.sn.dial(t.name, t.ip, address)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := tls.Client(raw, config)
+	raw.SetDeadline(time.Now().Add(timeout))
+	if err := conn.Handshake(); err != nil {
+		raw.Close()
+		return nil, err
+	}
+	raw.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// simListener aceita as conexões discadas para o endereço do nó
+type simListener struct {
+	sn     *SimNetwork
+	name   string
+	addr   *net.TCPAddr
+	config *tls.Config
+
+	mtx    sync.Mutex
+	queue  []*simConn
+	closed bool
+	notify chan struct{}
+}
+
+func (l *simListener) enqueue(conn *simConn) bool {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.closed {
+		return false
+	}
+	l.queue = append(l.queue, conn)
+	l.sn.unread.Add(1)
+	signal(l.notify)
+	return true
+}
+
+func (l *simListener) Accept() (net.Conn, error) {
+	l.mtx.Lock()
+	for {
+		if l.closed {
+			l.mtx.Unlock()
+			return nil, net.ErrClosed
+		}
+		if len(l.queue) > 0 {
+			conn := l.queue[0]
+			l.queue = l.queue[1:]
+			l.sn.unread.Add(-1)
+			l.mtx.Unlock()
+			return tls.Server(conn, l.config), nil
+		}
+		l.mtx.Unlock()
+		<-l.notify
+		l.mtx.Lock()
+	}
+}
+
+func (l *simListener) Close() error {
+	l.sn.mtx.Lock()
+	delete(l.sn.listeners, l.addr.String())
+	l.sn.mtx.Unlock()
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.closed = true
+	l.sn.unread.Add(-int64(len(l.queue)))
+	l.queue = nil
+	signal(l.notify)
+	return nil
+}
+
+func (l *simListener) Addr() net.Addr { return l.addr }
+
+// simConn é uma ponta de uma conexão simulada (net.Conn sem TLS)
+type simConn struct {
+	sn            *SimNetwork
+	out           *simPipe
+	local, remote *net.TCPAddr
+
+	mtx      sync.Mutex
+	buf      []byte
+	eof      bool
+	unread   bool // Há dados ou EOF entregues que o leitor ainda não viu
+	closed   bool
+	deadline time.Time // Prazo de leitura em tempo virtual
+	notify   chan struct{}
+}
+
+func newSimConn(sn *SimNetwork, local, remote *net.TCPAddr) *simConn {
+	return &simConn{sn: sn, local: local, remote: remote, notify: make(chan struct{}, 1)}
+}
+
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+func (c *simConn) Read(p []byte) (int, error) {
+	c.mtx.Lock()
+	for {
+		switch {
+		case c.closed:
+			c.mtx.Unlock()
+			return 0, net.ErrClosed
+		case len(c.buf) > 0:
+			n := copy(p, c.buf)
+			c.buf = c.buf[n:]
+			c.setUnread(len(c.buf) > 0 || c.eof)
+			c.mtx.Unlock()
+			return n, nil
+		case c.eof:
+			c.setUnread(false)
+			c.mtx.Unlock()
+			return 0, io.EOF
+		case !c.deadline.IsZero() && !c.sn.Clock.Now().Before(c.deadline):
+			c.mtx.Unlock()
+			return 0, os.ErrDeadlineExceeded
+		}
+		c.mtx.Unlock()
+		<-c.notify
+		c.mtx.Lock()
+	}
+}
+
+func (c *simConn) Write(p []byte) (int, error) {
+	c.mtx.Lock()
+	closed := c.closed
+	c.mtx.Unlock()
+	if closed {
+		return 0, net.ErrClosed
+	}
+
+	c.sn.send(c.out, simSegment{data: bytes.Clone(p)})
+	return len(p), nil
+}
+
+func (c *simConn) Close() error {
+	c.mtx.Lock()
+	if c.closed {
+		c.mtx.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.buf = nil
+	c.setUnread(false)
+	signal(c.notify)
+	c.mtx.Unlock()
+
+	// O outro lado recebe EOF depois dos dados já enviados
+	c.sn.send(c.out, simSegment{fin: true})
+	return nil
+}
+
+// deliver é executado pelo relógio virtual quando o segmento chega
+func (c *simConn) deliver(segment simSegment) bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.closed {
+		return false
+	}
+	if segment.fin {
+		c.eof = true
+	} else {
+		c.buf = append(c.buf, segment.data...)
+	}
+	c.setUnread(true)
+	signal(c.notify)
+	return true
+}
+
+// setUnread atualiza o contador de entregas pendentes da rede (com c.mtx)
+func (c *simConn) setUnread(unread bool) {
+	if unread == c.unread {
+		return
+	}
+	c.unread = unread
+	if unread {
+		c.sn.unread.Add(1)
+	} else {
+		c.sn.unread.Add(-1)
+	}
+}
+
+// SetReadDeadline converte o prazo (dado em tempo real pelos chamadores)
+// para o tempo virtual e agenda o despertar do leitor
+func (c *simConn) SetReadDeadline(t time.Time) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if t.IsZero() {
+		c.deadline = time.Time{}
+		return nil
+	}
+	deadline := c.sn.Clock.Now().Add(time.Until(t).Round(time.Millisecond))
+	c.deadline = deadline
+	c.sn.Clock.scheduleAt(deadline, func(time.Time) bool {
+		c.mtx.Lock()
+		defer c.mtx.Unlock()
+		if c.closed || !c.deadline.Equal(deadline) {
+			return false
+		}
+		signal(c.notify)
+		return true
+	})
+	return nil
+}
+
+// Escritas nunca bloqueiam na rede simulada
+func (c *simConn) SetWriteDeadline(t time.Time) error { return nil }
+
+func (c *simConn) SetDeadline(t time.Time) error { return c.SetReadDeadline(t) }
+
+func (c *simConn) LocalAddr() net.Addr  { return c.local }
+func (c *simConn) RemoteAddr() net.Addr { return c.remote }
@@ -1,6 +1,10 @@
 package main
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
 	"fmt"
 	"sync"
 	"time"
@@ -18,7 +22,19 @@ func NewTransactionValidator() *TransactionValidator {
 }
 
 func (v *TransactionValidator) VerifySignature(tx *Transaction) bool {
-	// Implementação básica - em produção deveria verificar RSA real
+	// Transações que movem saldo ou stake exigem a assinatura RSA do dono
+	if requiresOwnerSignature(tx.Type) {
+		return verifyOwnerSignature(tx) == nil
+	}
+	// Beacon RANDAO: assinado com a chave de consenso do validador, que o
+	// estado confere ser a registrada (randao.go). Evidência: assinada pelo
+	// nó que denuncia, sobre a transação inteira com a infração.
+	if isRandaoTx(tx.Type) || tx.Type == TX_EVIDENCE {
+		key, err := parsePublicKey(tx.PublicKey)
+		return err == nil && verifyConsensus(key, txSignBytes(tx), tx.Signature)
+	}
+
+	// Demais tipos: verificação básica de formato
 	if tx.From == "SYSTEM" && tx.Type == "mining_reward" {
 		// Transações do sistema têm validação especial
 		return tx.Signature != "" && len(tx.Signature) > 10
@@ -28,6 +44,78 @@ func (v *TransactionValidator) VerifySignature(tx *Transaction) bool {
 	return tx.Signature != "" && tx.PublicKey != "" && len(tx.Signature) > 10
 }
 
+// === Assinatura do dono ===
+//
+// Transferências, stake, delegação e saques movem saldo: o dono assina txSignBytes
+// com a própria chave RSA (PKCS1v15/SHA256, como o consenso), a chave vai em
+// PublicKey (DER base64) e From precisa ser o endereço derivado dela. O
+// nonce é crescente por endereço (ChainState.Nonces), então uma transação
+// assinada não pode ser reaplicada.
+
+func requiresOwnerSignature(txType string) bool {
+	return txType == "transfer" || txType == TX_STAKE || txType == TX_UNSTAKE || txType == TX_WITHDRAW ||
+		txType == TX_DELEGATE || txType == TX_UNDELEGATE || txType == TX_COMMISSION
+}
+
+// txSignBytes cobre todos os campos da transação, exceto hash e assinatura;
+// a evidência entra pela identidade da infração
+func txSignBytes(tx *Transaction) []byte {
+	e := &wireEncoder{}
+	e.string(1, "tx")
+	e.string(2, tx.ID)
+	e.string(3, tx.Type)
+	e.string(4, tx.From)
+	e.string(5, tx.To)
+	e.int(6, int64(tx.Amount))
+	e.time(7, tx.Timestamp)
+	e.string(8, tx.Contract)
+	e.string(9, tx.PublicKey)
+	e.int(10, int64(tx.Nonce))
+	e.string(11, tx.ValidatorKey)
+	e.string(12, tx.Randao)
+	if tx.Evidence != nil {
+		e.string(13, tx.Evidence.id())
+	}
+	return e.buf
+}
+
+// addressOf deriva o endereço da chave pública, como crypto/keypair.go
+func addressOf(publicKey string) (string, error) {
+	der, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("chave pública inválida")
+	}
+	hash := sha256.Sum256(der)
+	return "SYRA" + base64.StdEncoding.EncodeToString(hash[:])[:32], nil
+}
+
+// signTx preenche PublicKey e assina a transação com a chave do dono
+func signTx(key *rsa.PrivateKey, tx *Transaction) error {
+	tx.PublicKey = encodePublicKey(&key.PublicKey)
+	signature, err := signConsensus(key, txSignBytes(tx))
+	if err != nil {
+		return err
+	}
+	tx.Signature = signature
+	return nil
+}
+
+// verifyOwnerSignature confere que From é o endereço da chave e que a
+// assinatura cobre a transação
+func verifyOwnerSignature(tx *Transaction) error {
+	key, err := parsePublicKey(tx.PublicKey)
+	if err != nil {
+		return err
+	}
+	if address, _ := addressOf(tx.PublicKey); address != tx.From {
+		return fmt.Errorf("%s não é o endereço da chave que assinou", tx.From)
+	}
+	if !verifyConsensus(key, txSignBytes(tx), tx.Signature) {
+		return fmt.Errorf("assinatura inválida de %s", tx.From)
+	}
+	return nil
+}
+
 func (v *TransactionValidator) ValidateTransactionChain(txs []Transaction) bool {
 	for _, tx := range txs {
 		if !v.VerifySignature(&tx) {
@@ -129,7 +217,7 @@ func (tp *TransactionPool) validateBusinessRules(tx *Transaction) error {
 		if tx.From != "SYSTEM" {
 			return fmt.Errorf("recompensa deve vir do SYSTEM")
 		}
-		if tx.Amount <= 0 || tx.Amount > 10 {
+		if tx.Amount <= 0 || tx.Amount > maxBlockReward {
 			return fmt.Errorf("recompensa inválida: %d", tx.Amount)
 		}
 
@@ -138,6 +226,26 @@ func (tp *TransactionPool) validateBusinessRules(tx *Transaction) error {
 			return fmt.Errorf("ID do contrato obrigatório")
 		}
 
+	case TX_STAKE, TX_UNSTAKE, TX_WITHDRAW, TX_DELEGATE, TX_UNDELEGATE:
+		if tx.Amount <= 0 {
+			return fmt.Errorf("valor de %s inválido: %d", tx.Type, tx.Amount)
+		}
+
+	case TX_COMMISSION:
+		if tx.Amount < 0 || tx.Amount > maxCommission {
+			return fmt.Errorf("comissão inválida: %d%%", tx.Amount)
+		}
+
+	case TX_RANDAO_COMMIT, TX_RANDAO_REVEAL:
+		if tx.Randao == "" || tx.From != tx.To {
+			return fmt.Errorf("%s sem valor ou de outro validador", tx.Type)
+		}
+
+	case TX_EVIDENCE:
+		if tx.Evidence == nil {
+			return fmt.Errorf("evidência obrigatória")
+		}
+
 	default:
 		return fmt.Errorf("tipo de transação inválido: %s", tx.Type)
 	}
@@ -238,27 +346,35 @@ func (tp *TransactionPool) CleanupOldTransactions(maxAge time.Duration) int {
 	return removed
 }
 
-// Exemplo de uso e teste
-func main() {
+// runPoolDemo é o exemplo de uso do pool (go run . pool-demo)
+func runPoolDemo() {
 	fmt.Println("🧪 Testando Transaction Handler...")
 
 	pool := NewTransactionPool()
 
-	// Teste 1: Adicionar transação válida
+	// Teste 1: Adicionar transação válida, assinada pela carteira de Alice
+	aliceKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		fmt.Printf("❌ Erro ao gerar a carteira: %v\n", err)
+		return
+	}
+	alice, _ := addressOf(encodePublicKey(&aliceKey.PublicKey))
 	validTx := &Transaction{
 		ID:        "TX_VALID_001",
 		Type:      "transfer",
-		From:      "Alice",
+		From:      alice,
 		To:        "Bob",
 		Amount:    100,
 		Timestamp: time.Now(),
-		PublicKey: "alice_public_key",
 		Nonce:     1,
 		Hash:      "valid_hash",
-		Signature: "valid_signature_123",
+	}
+	if err := signTx(aliceKey, validTx); err != nil {
+		fmt.Printf("❌ Erro ao assinar: %v\n", err)
+		return
 	}
 
-	err := pool.AddTransaction(validTx)
+	err = pool.AddTransaction(validTx)
 	if err != nil {
 		fmt.Printf("❌ Erro ao adicionar transação válida: %v\n", err)
 	} else {
@@ -14,4 +14,9 @@ type Transaction struct {
 	Nonce     int       `json:"nonce,omitempty"`
 	Hash      string    `json:"hash,omitempty"`
 	Signature string    `json:"signature,omitempty"`
+
+	// Staking (chain_state.go, evidence.go)
+	ValidatorKey string              `json:"validator_key,omitempty"` // Chave de consenso do validador criado por stake
+	Evidence     *DoubleSignEvidence `json:"evidence,omitempty"`
+	Randao       string              `json:"randao,omitempty"` // Compromisso ou segredo do beacon (randao.go)
 }
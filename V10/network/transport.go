@@ -0,0 +1,25 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"time"
+)
+
+// Transport abre as conexões TLS do nó: TCP na rede real ou a rede em
+// memória do simulador (SimNetwork)
+type Transport interface {
+	Listen(address string, config *tls.Config) (net.Listener, error)
+	Dial(address string, config *tls.Config, timeout time.Duration) (net.Conn, error)
+}
+
+type tcpTransport struct{}
+
+func (tcpTransport) Listen(address string, config *tls.Config) (net.Listener, error) {
+	return tls.Listen("tcp", address, config)
+}
+
+func (tcpTransport) Dial(address string, config *tls.Config, timeout time.Duration) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	return tls.DialWithDialer(dialer, "tcp", address, config)
+}
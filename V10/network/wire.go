@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Parâmetros do protocolo de transporte
+const (
+	maxFrameSize     = 16 * 1024 * 1024 // Maior limite por tipo (resposta de sync)
+	dialTimeout      = 5 * time.Second
+	handshakeTimeout = 10 * time.Second
+	writeTimeout     = 10 * time.Second
+	readIdleTimeout  = 90 * time.Second // 3x o intervalo de heartbeat
+)
+
+// encodeFrame serializa a mensagem com prefixo de tamanho (4 bytes
+// big-endian), respeitando o limite do tipo
+func encodeFrame(msg *NetworkMessage, format wireFormat) ([]byte, error) {
+	payload, err := encodeMessage(msg, format)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) > maxMessageSize(msg.Type) {
+		return nil, &oversizedMessageError{msgType: msg.Type, size: len(payload)}
+	}
+
+	frame := make([]byte, 4+len(payload))
+	binary.BigEndian.PutUint32(frame[:4], uint32(len(payload)))
+	copy(frame[4:], payload)
+	return frame, nil
+}
+
+// writeFrame escreve uma mensagem com prefixo de tamanho
+func writeFrame(w io.Writer, msg *NetworkMessage, format wireFormat) error {
+	frame, err := encodeFrame(msg, format)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(frame)
+	return err
+}
+
+// readFrame lê uma mensagem com prefixo de tamanho, em qualquer formato
+func readFrame(r io.Reader) (*NetworkMessage, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[:])
+	if size == 0 || size > maxFrameSize {
+		return nil, fmt.Errorf("tamanho de frame inválido: %d", size)
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	// Confere o limite do tipo antes de decodificar Data
+	envelope, err := parseEnvelope(payload)
+	if err != nil {
+		return nil, err
+	}
+	if int(size) > maxMessageSize(envelope.msg.Type) {
+		return nil, &oversizedMessageError{msgType: envelope.msg.Type, size: int(size)}
+	}
+	return envelope.open()
+}
+
+// peerConn é a conexão ativa com um peer (loops de leitura e escrita)
+type peerConn struct {
+	conn       net.Conn
+	input      *throttledReader // Limite de recepção, ligado após o handshake
+	reader     *bufio.Reader
+	sendQueue  *sendQueue
+	sendBucket *tokenBucket // Limite de envio, ligado após o handshake
+	closed     chan struct{}
+	closeOnce  sync.Once
+	draining   chan struct{} // Fechado no Stop: o writeLoop sai ao esvaziar a fila
+	drainOnce  sync.Once
+	inbound    bool
+	format     wireFormat // Formato de envio; a leitura aceita qualquer um
+	openedAt   time.Time
+}
+
+var errSendQueueFull = errors.New("fila de envio cheia")
+
+func newPeerConn(conn net.Conn, inbound bool, format wireFormat) *peerConn {
+	input := &throttledReader{r: conn}
+	return &peerConn{
+		conn:      conn,
+		input:     input,
+		reader:    bufio.NewReader(input),
+		sendQueue: newSendQueue(),
+		closed:    make(chan struct{}),
+		draining:  make(chan struct{}),
+		inbound:   inbound,
+		format:    format,
+		openedAt:  time.Now(),
+	}
+}
+
+// send enfileira uma mensagem sem bloquear o chamador
+func (pc *peerConn) send(msg *NetworkMessage) error {
+	select {
+	case <-pc.closed:
+		return fmt.Errorf("conexão encerrada")
+	default:
+	}
+
+	if !pc.sendQueue.push(msg, messagePriority(msg)) {
+		return errSendQueueFull
+	}
+	return nil
+}
+
+// writeDirect escreve imediatamente (usado apenas durante o handshake).
+// A mensagem já deve estar assinada.
+func (pc *peerConn) writeDirect(msg *NetworkMessage) error {
+	pc.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return writeFrame(pc.conn, msg, pc.format)
+}
+
+// readDirect lê uma mensagem com prazo (usado apenas durante o handshake)
+func (pc *peerConn) readDirect(timeout time.Duration) (*NetworkMessage, error) {
+	pc.conn.SetReadDeadline(time.Now().Add(timeout))
+	return readFrame(pc.reader)
+}
+
+func (pc *peerConn) close() {
+	pc.closeOnce.Do(func() {
+		close(pc.closed)
+		pc.conn.Close()
+	})
+}
+
+// drain fecha a conexão assim que a fila de envio estiver vazia
+func (pc *peerConn) drain() {
+	pc.drainOnce.Do(func() {
+		close(pc.draining)
+	})
+}
+
+// writeLoop envia as mensagens enfileiradas, da mais prioritária para a
+// menos, respeitando o limite de banda do peer
+func (node *P2PNode) writeLoop(pc *peerConn) {
+	defer pc.close()
+
+	for {
+		msg := pc.sendQueue.pop()
+		if msg == nil {
+			select {
+			case <-pc.closed:
+				return
+			case <-pc.draining:
+				return
+			case <-pc.sendQueue.ready:
+				continue
+			}
+		}
+
+		frame, err := encodeFrame(msg, pc.format)
+		if err != nil {
+			// Não envia o que o peer descartaria (e pelo qual nos penalizaria)
+			fmt.Printf("⚠️ [%s] Mensagem %s para %s descartada: %v\n", node.ID, msg.Type, msg.To, err)
+			var oversized *oversizedMessageError
+			if errors.As(err, &oversized) {
+				node.countTraffic("oversized_out:"+msg.Type, 1)
+			} else {
+				node.countTraffic("invalid_out:"+msg.Type, 1)
+			}
+			continue
+		}
+		if wait := pc.sendBucket.take(len(frame)); wait > 0 {
+			node.countTraffic("delayed_out:"+msg.Type, 1)
+			node.countTraffic("delayed_out_ms", int(wait/time.Millisecond))
+			select {
+			case <-pc.closed:
+				return
+			case <-node.clock.After(wait):
+			}
+		}
+
+		pc.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if _, err := pc.conn.Write(frame); err != nil {
+			return
+		}
+	}
+}
+
+// readLoop lê mensagens do peer e as entrega ao nó
+func (node *P2PNode) readLoop(peer *Peer, pc *peerConn) {
+	defer node.removePeerConn(peer.ID, pc)
+
+	for {
+		pc.conn.SetReadDeadline(time.Now().Add(readIdleTimeout))
+		msg, err := readFrame(pc.reader)
+		var oversized *oversizedMessageError
+		if errors.As(err, &oversized) {
+			node.countTraffic("oversized_in:"+oversized.msgType, 1)
+			node.penalizePeer(peer.ID, penaltyOversizedMessage, err.Error())
+			continue
+		}
+		var malformed *malformedMessageError
+		if errors.As(err, &malformed) {
+			node.countTraffic("malformed_in:"+malformed.msgType, 1)
+			node.penalizePeer(peer.ID, penaltyMalformedMessage, err.Error())
+			continue
+		}
+		if err != nil {
+			if err != io.EOF {
+				fmt.Printf("⚠️ [%s] Conexão com %s encerrada: %v\n", node.ID, peer.ID, err)
+			}
+			return
+		}
+
+		// Toda mensagem precisa estar assinada pela chave do peer da conexão
+		if !node.verifyInbound(peer, msg) {
+			continue
+		}
+
+		node.mutex.Lock()
+		peer.LastSeen = time.Now()
+		node.mutex.Unlock()
+
+		if reply := node.dispatchMessage(msg); reply != nil {
+			node.sendToPeer(peer.ID, reply)
+		}
+	}
+}
+
+// registerPeerConn registra o peer e inicia os loops da conexão
+func (node *P2PNode) registerPeerConn(peer *Peer, pc *peerConn) error {
+	node.mutex.Lock()
+	if node.ctx.Err() != nil {
+		node.mutex.Unlock()
+		return errNodeStopping
+	}
+	if existing, exists := node.Peers[peer.ID]; exists && existing.conn != nil {
+		node.mutex.Unlock()
+		return fmt.Errorf("peer %s já conectado", peer.ID)
+	}
+	// Revalida sob o lock: duas discagens simultâneas passam pela checagem prévia
+	if !pc.inbound && node.outboundInGroup(peer.Address) >= maxOutboundPerNetgroup {
+		node.mutex.Unlock()
+		return fmt.Errorf("limite de conexões de saída para o grupo %s", netGroup(peer.Address))
+	}
+	peer.conn = pc
+	peer.knownInv = newInventoryCache(knownInvSize, inventoryTTL)
+	peer.knownInv.clock = node.clock
+	node.Peers[peer.ID] = peer
+	node.mutex.Unlock()
+
+	// Limites de banda valem a partir daqui (o handshake não é limitado)
+	pc.sendBucket = newTokenBucket(node.clock, peerSendRate, peerBandwidthBurst)
+	pc.input.clock = node.clock
+	pc.input.bucket = newTokenBucket(node.clock, peerRecvRate, peerBandwidthBurst)
+	pc.input.onDelay = func(wait time.Duration) {
+		node.countTraffic("throttled_in", 1)
+		node.countTraffic("throttled_in_ms", int(wait/time.Millisecond))
+	}
+
+	node.spawn(func() { node.writeLoop(pc) })
+	node.spawn(func() { node.readLoop(peer, pc) })
+
+	fmt.Printf("✅ [%s] Conectado ao peer %s (%s:%d, %s, altura %d, serviços %s)\n",
+		node.ID, peer.ID, peer.Address, peer.Port, peer.UserAgent, peer.Height, servicesString(peer.Services))
+	node.recordPeerVersion(peer)
+	node.dhtSeen(peer.ID)
+	if !pc.inbound {
+		node.updateAnchors()
+	}
+
+	// Sincroniza com o novo peer
+	node.spawn(func() { node.requestSpecificPeerSync(peer.ID) })
+	return nil
+}
+
+// removePeerConn marca o peer como inativo quando a conexão cai
+func (node *P2PNode) removePeerConn(peerID string, pc *peerConn) {
+	pc.close()
+
+	node.mutex.Lock()
+	removed := false
+	if peer, exists := node.Peers[peerID]; exists && peer.conn == pc {
+		peer.conn = nil
+		peer.IsActive = false
+		removed = true
+	}
+	node.mutex.Unlock()
+
+	// No encerramento as âncoras já foram gravadas com todas as saídas
+	if removed && !pc.inbound && node.ctx.Err() == nil {
+		node.updateAnchors()
+	}
+}
+
+// sendToPeer enfileira uma mensagem para um peer conectado
+func (node *P2PNode) sendToPeer(peerID string, msg *NetworkMessage) error {
+	node.mutex.RLock()
+	peer, exists := node.Peers[peerID]
+	var pc *peerConn
+	if exists {
+		pc = peer.conn
+	}
+	node.mutex.RUnlock()
+
+	if pc == nil {
+		return fmt.Errorf("peer %s não conectado", peerID)
+	}
+
+	msg.To = peerID
+	if err := node.signOutbound(msg); err != nil {
+		return err
+	}
+	if node.outboundHook != nil {
+		if msg = node.outboundHook(peerID, msg); msg == nil {
+			return nil
+		}
+	}
+	err := pc.send(msg)
+	if err == errSendQueueFull {
+		node.countTraffic("dropped:"+msg.Type, 1)
+	}
+	return err
+}
+
+// connectedPeerIDs retorna os IDs dos peers com conexão ativa
+func (node *P2PNode) connectedPeerIDs() []string {
+	node.mutex.RLock()
+	defer node.mutex.RUnlock()
+
+	ids := make([]string, 0, len(node.Peers))
+	for id, peer := range node.Peers {
+		if peer.IsActive && peer.conn != nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// ConnectToAddress disca para ip:porta (callback do BootstrapManager)
+func (node *P2PNode) ConnectToAddress(ip, port string) bool {
+	var portNum int
+	fmt.Sscanf(port, "%d", &portNum)
+
+	err := node.connectToPeer(&Peer{Address: ip, Port: portNum})
+	if err != nil {
+		fmt.Printf("❌ [%s] Falha ao conectar a %s:%s: %v\n", node.ID, ip, port, err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,798 @@
+package main
+
+// Esquemas binários dos corpos das mensagens (o equivalente a um .proto).
+// Cada campo tem um número fixo: campos novos recebem números novos e
+// números antigos nunca são reaproveitados, assim peers com versões
+// diferentes trocam mensagens e ignoram os campos que não conhecem.
+// Valores zero não são enviados.
+
+// messageSchemas associa cada tipo de mensagem ao tipo de Data. Tipos sem
+// esquema levam Data em JSON dentro do envelope binário.
+var messageSchemas = map[string]func() wirePayload{
+	MSG_INTRODUCTION:      func() wirePayload { return &VersionInfo{} },
+	MSG_INTRODUCTION_ACK:  func() wirePayload { return &VersionInfo{} },
+	MSG_REJECT:            func() wirePayload { return &rejectMessage{} },
+	MSG_HEARTBEAT:         func() wirePayload { return &heartbeatMessage{} },
+	MSG_SYNC_REQUEST:      func() wirePayload { return &syncRequest{} },
+	MSG_SYNC_RESPONSE:     func() wirePayload { return &syncResponse{} },
+	MSG_ADDR_REQUEST:      func() wirePayload { return &addrRequest{} },
+	MSG_ADDR_RESPONSE:     func() wirePayload { return &addrResponse{} },
+	MSG_PEER_LIST:         func() wirePayload { return &peerList{} },
+	MSG_NEW_BLOCK:         func() wirePayload { return &Token{} },
+	MSG_NEW_TRANSACTION:   func() wirePayload { return &Transaction{} },
+	MSG_TX_ACCEPTED:       func() wirePayload { return &txStatus{} },
+	MSG_TX_REJECTED:       func() wirePayload { return &txStatus{} },
+	MSG_CONSENSUS_REQUEST: func() wirePayload { return &consensusProposal{} },
+	MSG_CONSENSUS_VOTE:    func() wirePayload { return &ConsensusVote{} },
+	MSG_CONSENSUS_START:   func() wirePayload { return &consensusStart{} },
+	MSG_INV:               func() wirePayload { return &invMessage{} },
+	MSG_GET_DATA:          func() wirePayload { return &invMessage{} },
+	MSG_NOT_FOUND:         func() wirePayload { return &invMessage{} },
+	MSG_CMPCT_BLOCK:       func() wirePayload { return &CompactBlock{} },
+	MSG_GET_BLOCK_TXN:     func() wirePayload { return &getBlockTxn{} },
+	MSG_BLOCK_TXN:         func() wirePayload { return &blockTxn{} },
+	MSG_DHT_PING:          func() wirePayload { return &dhtRequest{} },
+	MSG_DHT_FIND_NODE:     func() wirePayload { return &dhtRequest{} },
+	MSG_DHT_FIND_VALUE:    func() wirePayload { return &dhtRequest{} },
+	MSG_DHT_STORE:         func() wirePayload { return &dhtRequest{} },
+	MSG_DHT_PONG:          func() wirePayload { return &dhtReply{} },
+	MSG_DHT_NODES:         func() wirePayload { return &dhtReply{} },
+	MSG_DHT_STORED:        func() wirePayload { return &dhtReply{} },
+	MSG_LAN_BEACON:        func() wirePayload { return &lanBeacon{} },
+}
+
+// === Blocos e transações ===
+
+func (t *Token) encodeWire(e *wireEncoder) {
+	e.int(1, int64(t.Index))
+	e.int(2, int64(t.Nonce))
+	e.string(3, t.Hash)
+	e.strings(4, t.HashParts)
+	e.string(5, t.Timestamp)
+	e.bool(6, t.ContainsSyra)
+	e.string(7, t.Validator)
+	e.string(8, t.PrevHash)
+	e.string(9, t.WalletAddress)
+	e.string(10, t.WalletSignature)
+	e.string(11, t.MinerID)
+	for i := range t.Transactions {
+		e.message(12, &t.Transactions[i])
+	}
+	if t.Commit != nil {
+		e.message(13, t.Commit)
+	}
+	for i := range t.NextValidators {
+		e.message(14, &t.NextValidators[i])
+	}
+}
+
+func (t *Token) decodeWire(d *wireDecoder) {
+	for d.next() {
+		switch d.field {
+		case 1:
+			t.Index = d.int()
+		case 2:
+			t.Nonce = d.int()
+		case 3:
+			t.Hash = d.string()
+		case 4:
+			t.HashParts = append(t.HashParts, d.string())
+		case 5:
+			t.Timestamp = d.string()
+		case 6:
+			t.ContainsSyra = d.bool()
+		case 7:
+			t.Validator = d.string()
+		case 8:
+			t.PrevHash = d.string()
+		case 9:
+			t.WalletAddress = d.string()
+		case 10:
+			t.WalletSignature = d.string()
+		case 11:
+			t.MinerID = d.string()
+		case 12:
+			var tx Transaction
+			d.message(&tx)
+			t.Transactions = append(t.Transactions, tx)
+		case 13:
+			t.Commit = &CommitCertificate{}
+			d.message(t.Commit)
+		case 14:
+			var v ValidatorStake
+			d.message(&v)
+			t.NextValidators = append(t.NextValidators, v)
+		default:
+			d.skip()
+		}
+	}
+}
+
+func (tx *Transaction) encodeWire(e *wireEncoder) {
+	e.string(1, tx.ID)
+	e.string(2, tx.Type)
+	e.string(3, tx.From)
+	e.string(4, tx.To)
+	e.int(5, int64(tx.Amount))
+	e.time(6, tx.Timestamp)
+	e.string(7, tx.Contract)
+	e.string(8, tx.PublicKey)
+	e.int(9, int64(tx.Nonce))
+	e.string(10, tx.Hash)
+	e.string(11, tx.Signature)
+	e.string(12, tx.ValidatorKey)
+	if tx.Evidence != nil {
+		e.message(13, tx.Evidence)
+	}
+	e.string(14, tx.Randao)
+}
+
+func (tx *Transaction) decodeWire(d *wireDecoder) {
+	for d.next() {
+		switch d.field {
+		case 1:
+			tx.ID = d.string()
+		case 2:
+			tx.Type = d.string()
+		case 3:
+			tx.From = d.string()
+		case 4:
+			tx.To = d.string()
+		case 5:
+			tx.Amount = d.int()
+		case 6:
+			tx.Timestamp = d.time()
+		case 7:
+			tx.Contract = d.string()
+		case 8:
+			tx.PublicKey = d.string()
+		case 9:
+			tx.Nonce = d.int()
+		case 10:
+			tx.Hash = d.string()
+		case 11:
+			tx.Signature = d.string()
+		case 12:
+			tx.ValidatorKey = d.string()
+		case 13:
+			tx.Evidence = &DoubleSignEvidence{}
+			d.message(tx.Evidence)
+		case 14:
+			tx.Randao = d.string()
+		default:
+			d.skip()
+		}
+	}
+}
+
+func (m *txStatus) encodeWire(e *wireEncoder) {
+	e.string(1, m.TxID)
+	e.string(2, m.Status)
+	e.string(3, m.Reason)
+	e.bool(4, m.Validated)
+}
+
+func (m *txStatus) decodeWire(d *wireDecoder) {
+	for d.next() {
+		switch d.field {
+		case 1:
+			m.TxID = d.string()
+		case 2:
+			m.Status = d.string()
+		case 3:
+			m.Reason = d.string()
+		case 4:
+			m.Validated = d.bool()
+		default:
+			d.skip()
+		}
+	}
+}
+
+// === Handshake e controle ===
+
+func (v *VersionInfo) encodeWire(e *wireEncoder) {
+	e.int(1, int64(v.ProtocolVersion))
+	e.string(2, v.ChainID)
+	e.int(3, int64(v.BestHeight))
+	e.string(4, v.BestHash)
+	e.uint(5, v.Services)
+	e.string(6, v.UserAgent)
+	e.string(7, v.NodeID)
+	e.string(8, v.Address)
+	e.int(9, int64(v.Port))
+	e.int(10, int64(v.Stake))
+	e.int(11, v.Timestamp)
+}
+
+func (v *VersionInfo) decodeWire(d *wireDecoder) {
+	for d.next() {
+		switch d.field {
+		case 1:
+			v.ProtocolVersion = d.int()
+		case 2:
+			v.ChainID = d.string()
+		case 3:
+			v.BestHeight = d.int()
+		case 4:
+			v.BestHash = d.string()
+		case 5:
+			v.Services = d.uint()
+		case 6:
+			v.UserAgent = d.string()
+		case 7:
+			v.NodeID = d.string()
+		case 8:
+			v.Address = d.string()
+		case 9:
+			v.Port = d.int()
+		case 10:
+			v.Stake = d.int()
+		case 11:
+			v.Timestamp = d.int64()
+		default:
+			d.skip()
+		}
+	}
+}
+
+func (m *rejectMessage) encodeWire(e *wireEncoder) {
+	e.string(1, m.Reason)
+}
+
+func (m *rejectMessage) decodeWire(d *wireDecoder) {
+	for d.next() {
+		switch d.field {
+		case 1:
+			m.Reason = d.string()
+		default:
+			d.skip()
+		}
+	}
+}
+
+func (m *heartbeatMessage) encodeWire(e *wireEncoder) {
+	e.int(1, int64(m.Height))
+}
+
+func (m *heartbeatMessage) decodeWire(d *wireDecoder) {
+	for d.next() {
+		switch d.field {
+		case 1:
+			m.Height = d.int()
+		default:
+			d.skip()
+		}
+	}
+}
+
+// === Sync e endereços ===
+
+func (m *syncRequest) encodeWire(e *wireEncoder) {
+	e.int(1, int64(m.CurrentHeight))
+}
+
+func (m *syncRequest) decodeWire(d *wireDecoder) {
+	for d.next() {
+		switch d.field {
+		case 1:
+			m.CurrentHeight = d.int()
+		default:
+			d.skip()
+		}
+	}
+}
+
+func (m *syncResponse) encodeWire(e *wireEncoder) {
+	for i := range m.Blocks {
+		e.message(1, &m.Blocks[i])
+	}
+	e.int(2, int64(m.Height))
+}
+
+func (m *syncResponse) decodeWire(d *wireDecoder) {
+	for d.next() {
+		switch d.field {
+		case 1:
+			var block Token
+			d.message(&block)
+			m.Blocks = append(m.Blocks, block)
+		case 2:
+			m.Height = d.int()
+		default:
+			d.skip()
+		}
+	}
+}
+
+func (m *addrRequest) encodeWire(e *wireEncoder) {
+	e.int(1, int64(m.MaxAddresses))
+}
+
+func (m *addrRequest) decodeWire(d *wireDecoder) {
+	for d.next() {
+		switch d.field {
+		case 1:
+			m.MaxAddresses = d.int()
+		default:
+			d.skip()
+		}
+	}
+}
+
+func (m *addrResponse) encodeWire(e *wireEncoder) {
+	for i := range m.Addresses {
+		e.message(1, &m.Addresses[i])
+	}
+}
+
+func (m *addrResponse) decodeWire(d *wireDecoder) {
+	for d.next() {
+		switch d.field {
+		case 1:
+			var entry addrEntry
+			d.message(&entry)
+			m.Addresses = append(m.Addresses, entry)
+		default:
+			d.skip()
+		}
+	}
+}
+
+func (a *addrEntry) encodeWire(e *wireEncoder) {
+	e.string(1, a.IP)
+	e.string(2, a.Port)
+}
+
+func (a *addrEntry) decodeWire(d *wireDecoder) {
+	for d.next() {
+		switch d.field {
+		case 1:
+			a.IP = d.string()
+		case 2:
+			a.Port = d.string()
+		default:
+			d.skip()
+		}
+	}
+}
+
+func (m *peerList) encodeWire(e *wireEncoder) {
+	for i := range m.Peers {
+		e.message(1, &m.Peers[i])
+	}
+}
+
+func (m *peerList) decodeWire(d *wireDecoder) {
+	for d.next() {
+		switch d.field {
+		case 1:
+			var entry peerListEntry
+			d.message(&entry)
+			m.Peers = append(m.Peers, entry)
+		default:
+			d.skip()
+		}
+	}
+}
+
+func (p *peerListEntry) encodeWire(e *wireEncoder) {
+	e.string(1, p.ID)
+	e.string(2, p.Address)
+	e.int(3, int64(p.Port))
+}
+
+func (p *peerListEntry) decodeWire(d *wireDecoder) {
+	for d.next() {
+		switch d.field {
+		case 1:
+			p.ID = d.string()
+		case 2:
+			p.Address = d.string()
+		case 3:
+			p.Port = d.int()
+		default:
+			d.skip()
+		}
+	}
+}
+
+// === Consenso ===
+
+// Campos 1 (RoundID) e 4 (Validators/Vote) eram do protocolo 4
+
+func (m *consensusProposal) encodeWire(e *wireEncoder) {
+	e.message(2, &m.Block)
+	e.string(3, m.Proposer)
+	e.int(5, int64(m.Height))
+	e.int(6, int64(m.Round))
+	e.int(7, int64(m.POLRound))
+	e.string(8, m.Signature)
+}
+
+func (m *consensusProposal) decodeWire(d *wireDecoder) {
+	for d.next() {
+		switch d.field {
+		case 2:
+			d.message(&m.Block)
+		case 3:
+			m.Proposer = d.string()
+		case 5:
+			m.Height = d.int()
+		case 6:
+			m.Round = d.int()
+		case 7:
+			m.POLRound = d.int()
+		case 8:
+			m.Signature = d.string()
+		default:
+			d.skip()
+		}
+	}
+}
+
+func (v *ConsensusVote) encodeWire(e *wireEncoder) {
+	e.string(2, v.BlockHash)
+	e.string(3, v.Voter)
+	e.int(5, int64(v.Height))
+	e.int(6, int64(v.Round))
+	e.string(7, v.Type)
+	e.string(8, v.Signature)
+}
+
+func (v *ConsensusVote) decodeWire(d *wireDecoder) {
+	for d.next() {
+		switch d.field {
+		case 2:
+			v.BlockHash = d.string()
+		case 3:
+			v.Voter = d.string()
+		case 5:
+			v.Height = d.int()
+		case 6:
+			v.Round = d.int()
+		case 7:
+			v.Type = d.string()
+		case 8:
+			v.Signature = d.string()
+		default:
+			d.skip()
+		}
+	}
+}
+
+func (m *consensusStart) encodeWire(e *wireEncoder) {
+	e.int(1, int64(m.Height))
+}
+
+func (m *consensusStart) decodeWire(d *wireDecoder) {
+	for d.next() {
+		switch d.field {
+		case 1:
+			m.Height = d.int()
+		default:
+			d.skip()
+		}
+	}
+}
+
+func (c *CommitCertificate) encodeWire(e *wireEncoder) {
+	e.int(1, int64(c.Height))
+	e.int(2, int64(c.Round))
+	e.string(3, c.BlockHash)
+	for i := range c.Precommits {
+		e.message(4, &c.Precommits[i])
+	}
+}
+
+func (c *CommitCertificate) decodeWire(d *wireDecoder) {
+	for d.next() {
+		switch d.field {
+		case 1:
+			c.Height = d.int()
+		case 2:
+			c.Round = d.int()
+		case 3:
+			c.BlockHash = d.string()
+		case 4:
+			var v ConsensusVote
+			d.message(&v)
+			c.Precommits = append(c.Precommits, v)
+		default:
+			d.skip()
+		}
+	}
+}
+
+func (v *ValidatorStake) encodeWire(e *wireEncoder) {
+	e.string(1, v.ID)
+	e.string(2, v.Owner)
+	e.int(3, int64(v.Amount))
+	e.string(4, v.PubKey)
+}
+
+func (v *ValidatorStake) decodeWire(d *wireDecoder) {
+	for d.next() {
+		switch d.field {
+		case 1:
+			v.ID = d.string()
+		case 2:
+			v.Owner = d.string()
+		case 3:
+			v.Amount = d.int()
+		case 4:
+			v.PubKey = d.string()
+		default:
+			d.skip()
+		}
+	}
+}
+
+func (ev *DoubleSignEvidence) encodeWire(e *wireEncoder) {
+	if ev.VoteA != nil {
+		e.message(1, ev.VoteA)
+	}
+	if ev.VoteB != nil {
+		e.message(2, ev.VoteB)
+	}
+	if ev.ProposalA != nil {
+		e.message(3, ev.ProposalA)
+	}
+	if ev.ProposalB != nil {
+		e.message(4, ev.ProposalB)
+	}
+}
+
+func (ev *DoubleSignEvidence) decodeWire(d *wireDecoder) {
+	for d.next() {
+		switch d.field {
+		case 1:
+			ev.VoteA = &ConsensusVote{}
+			d.message(ev.VoteA)
+		case 2:
+			ev.VoteB = &ConsensusVote{}
+			d.message(ev.VoteB)
+		case 3:
+			ev.ProposalA = &consensusProposal{}
+			d.message(ev.ProposalA)
+		case 4:
+			ev.ProposalB = &consensusProposal{}
+			d.message(ev.ProposalB)
+		default:
+			d.skip()
+		}
+	}
+}
+
+// === Inventário e blocos compactos ===
+
+func (m *invMessage) encodeWire(e *wireEncoder) {
+	for i := range m.Items {
+		e.message(1, &m.Items[i])
+	}
+}
+
+func (m *invMessage) decodeWire(d *wireDecoder) {
+	for d.next() {
+		switch d.field {
+		case 1:
+			var item InvItem
+			d.message(&item)
+			m.Items = append(m.Items, item)
+		default:
+			d.skip()
+		}
+	}
+}
+
+func (item *InvItem) encodeWire(e *wireEncoder) {
+	e.string(1, item.Type)
+	e.string(2, item.Hash)
+}
+
+func (item *InvItem) decodeWire(d *wireDecoder) {
+	for d.next() {
+		switch d.field {
+		case 1:
+			item.Type = d.string()
+		case 2:
+			item.Hash = d.string()
+		default:
+			d.skip()
+		}
+	}
+}
+
+func (c *CompactBlock) encodeWire(e *wireEncoder) {
+	e.message(1, &c.Header)
+	e.uint(2, c.Salt)
+	e.int(3, int64(c.TxCount))
+	e.strings(4, c.ShortIDs)
+	for i := range c.Prefilled {
+		e.message(5, &c.Prefilled[i])
+	}
+	e.string(6, c.TxRoot)
+}
+
+func (c *CompactBlock) decodeWire(d *wireDecoder) {
+	for d.next() {
+		switch d.field {
+		case 1:
+			d.message(&c.Header)
+		case 2:
+			c.Salt = d.uint()
+		case 3:
+			c.TxCount = d.int()
+		case 4:
+			c.ShortIDs = append(c.ShortIDs, d.string())
+		case 5:
+			var prefilled PrefilledTx
+			d.message(&prefilled)
+			c.Prefilled = append(c.Prefilled, prefilled)
+		case 6:
+			c.TxRoot = d.string()
+		default:
+			d.skip()
+		}
+	}
+}
+
+func (p *PrefilledTx) encodeWire(e *wireEncoder) {
+	e.int(1, int64(p.Index))
+	e.message(2, &p.Tx)
+}
+
+func (p *PrefilledTx) decodeWire(d *wireDecoder) {
+	for d.next() {
+		switch d.field {
+		case 1:
+			p.Index = d.int()
+		case 2:
+			d.message(&p.Tx)
+		default:
+			d.skip()
+		}
+	}
+}
+
+func (m *getBlockTxn) encodeWire(e *wireEncoder) {
+	e.string(1, m.BlockHash)
+	e.ints(2, m.Indexes)
+}
+
+func (m *getBlockTxn) decodeWire(d *wireDecoder) {
+	for d.next() {
+		switch d.field {
+		case 1:
+			m.BlockHash = d.string()
+		case 2:
+			m.Indexes = append(m.Indexes, d.int())
+		default:
+			d.skip()
+		}
+	}
+}
+
+func (m *blockTxn) encodeWire(e *wireEncoder) {
+	e.string(1, m.BlockHash)
+	for i := range m.Txs {
+		e.message(2, &m.Txs[i])
+	}
+}
+
+func (m *blockTxn) decodeWire(d *wireDecoder) {
+	for d.next() {
+		switch d.field {
+		case 1:
+			m.BlockHash = d.string()
+		case 2:
+			var prefilled PrefilledTx
+			d.message(&prefilled)
+			m.Txs = append(m.Txs, prefilled)
+		default:
+			d.skip()
+		}
+	}
+}
+
+// === DHT e descoberta local ===
+
+func (r *dhtRequest) encodeWire(e *wireEncoder) {
+	e.string(1, r.RPCID)
+	e.string(2, r.Target)
+	e.string(3, r.Value)
+}
+
+func (r *dhtRequest) decodeWire(d *wireDecoder) {
+	for d.next() {
+		switch d.field {
+		case 1:
+			r.RPCID = d.string()
+		case 2:
+			r.Target = d.string()
+		case 3:
+			r.Value = d.string()
+		default:
+			d.skip()
+		}
+	}
+}
+
+func (r *dhtReply) encodeWire(e *wireEncoder) {
+	e.string(1, r.RPCID)
+	for _, node := range r.Nodes {
+		e.message(2, node)
+	}
+	e.string(3, r.Value)
+	e.bool(4, r.Found)
+	e.string(5, r.Error)
+}
+
+func (r *dhtReply) decodeWire(d *wireDecoder) {
+	for d.next() {
+		switch d.field {
+		case 1:
+			r.RPCID = d.string()
+		case 2:
+			node := &DHTNode{}
+			d.message(node)
+			r.Nodes = append(r.Nodes, node)
+		case 3:
+			r.Value = d.string()
+		case 4:
+			r.Found = d.bool()
+		case 5:
+			r.Error = d.string()
+		default:
+			d.skip()
+		}
+	}
+}
+
+func (n *DHTNode) encodeWire(e *wireEncoder) {
+	e.string(1, n.ID)
+	e.string(2, n.Address)
+	e.int(3, int64(n.Port))
+	e.time(4, n.LastSeen)
+}
+
+func (n *DHTNode) decodeWire(d *wireDecoder) {
+	for d.next() {
+		switch d.field {
+		case 1:
+			n.ID = d.string()
+		case 2:
+			n.Address = d.string()
+		case 3:
+			n.Port = d.int()
+		case 4:
+			n.LastSeen = d.time()
+		default:
+			d.skip()
+		}
+	}
+}
+
+func (b *lanBeacon) encodeWire(e *wireEncoder) {
+	e.int(1, int64(b.Port))
+	e.string(2, b.ChainID)
+	e.int(3, int64(b.ProtocolVersion))
+	e.string(4, b.PublicKey)
+}
+
+func (b *lanBeacon) decodeWire(d *wireDecoder) {
+	for d.next() {
+		switch d.field {
+		case 1:
+			b.Port = d.int()
+		case 2:
+			b.ChainID = d.string()
+		case 3:
+			b.ProtocolVersion = d.int()
+		case 4:
+			b.PublicKey = d.string()
+		default:
+			d.skip()
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Parâmetros do download paralelo de blocos
+const (
+	blocksPerRequest   = 16               // Blocos por pedido MSG_GET_BLOCKS
+	maxRequestsPerPeer = 4                // Pedidos simultâneos por peer
+	downloadWindow     = 1024             // Blocos à frente do próximo bloco a conectar
+	blockStallTimeout  = 10 * time.Second // Tempo máximo de um pedido antes de reatribuir
+	maxPeerFailures    = 3                // Falhas seguidas até desistir do último peer
+	saveBatchSize      = 512              // Blocos aplicados entre gravações em disco
+	saveInterval       = 2 * time.Second
+)
+
+// blockChunk é um intervalo contíguo de cabeçalhos pedido de uma só vez
+type blockChunk struct {
+	first   int // Altura do primeiro bloco do lote
+	headers []BlockHeader
+}
+
+type blockRequest struct {
+	chunk  *blockChunk
+	peer   *Peer
+	sentAt time.Time
+}
+
+type blockResult struct {
+	request *blockRequest
+	blocks  []Token
+	err     error
+}
+
+// blockDownloader distribui os lotes entre vários peers com janela deslizante
+// e conecta os blocos recebidos em ordem de altura
+type blockDownloader struct {
+	sm       *SyncManager
+	state    *SyncState
+	peers    []*Peer
+	pending  []*blockChunk         // Lotes aguardando peer, ordenados por altura
+	inFlight map[int]*blockRequest // Pedidos em andamento por altura do lote
+	received map[int][]Token       // Lotes recebidos fora de ordem
+	load     map[string]int        // Pedidos em andamento por peer
+	excluded map[string]bool       // Peers lentos ou com falha nesta sincronização
+	failures map[string]int        // Falhas seguidas por peer
+	results  chan blockResult
+	done     chan struct{}
+	saved    int // Altura já gravada em disco
+	lastSave time.Time
+}
+
+// downloadBlocks baixa os corpos faltantes de vários peers em paralelo
+func (sm *SyncManager) downloadBlocks(peers []*Peer, state *SyncState) (err error) {
+	d := &blockDownloader{
+		sm:       sm,
+		state:    state,
+		peers:    peers,
+		inFlight: make(map[int]*blockRequest),
+		received: make(map[int][]Token),
+		load:     make(map[string]int),
+		excluded: make(map[string]bool),
+		failures: make(map[string]int),
+		results:  make(chan blockResult),
+		done:     make(chan struct{}),
+		saved:    state.BaseIndex,
+		lastSave: time.Now(),
+	}
+	defer close(d.done)
+
+	remaining := state.Headers[len(state.Blocks):]
+	for i := 0; i < len(remaining); i += blocksPerRequest {
+		end := i + blocksPerRequest
+		if end > len(remaining) {
+			end = len(remaining)
+		}
+		d.pending = append(d.pending, &blockChunk{first: remaining[i].Index, headers: remaining[i:end]})
+	}
+
+	// Grava o que já foi conectado mesmo quando o download é interrompido
+	defer func() {
+		if flushErr := d.flush(); err == nil {
+			err = flushErr
+		}
+	}()
+
+	sm.setProgress(state, len(peers))
+
+	ticker := time.NewTicker(sm.stallTimeout / 4)
+	defer ticker.Stop()
+
+	for !d.complete() {
+		d.assign()
+		if len(d.inFlight) == 0 {
+			return fmt.Errorf("nenhum peer disponível para o bloco %d", d.nextHeight())
+		}
+
+		select {
+		case result := <-d.results:
+			if err := d.handleResult(result); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			d.checkStalls()
+		}
+	}
+
+	return nil
+}
+
+// nextHeight é a altura do próximo bloco a ser conectado
+func (d *blockDownloader) nextHeight() int {
+	return d.state.BaseIndex + len(d.state.Blocks) + 1
+}
+
+func (d *blockDownloader) complete() bool {
+	return len(d.state.Blocks) >= len(d.state.Headers)
+}
+
+// assign envia os lotes dentro da janela para os peers com capacidade livre
+func (d *blockDownloader) assign() {
+	limit := d.nextHeight() + downloadWindow
+	for len(d.pending) > 0 && d.pending[0].first < limit {
+		peer := d.pickPeer(d.pending[0])
+		if peer == nil {
+			return
+		}
+		chunk := d.pending[0]
+		d.pending = d.pending[1:]
+		d.send(peer, chunk)
+	}
+}
+
+// pickPeer escolhe o peer mais confiável e menos ocupado que tenha o lote
+func (d *blockDownloader) pickPeer(chunk *blockChunk) *Peer {
+	last := chunk.first + len(chunk.headers) - 1
+
+	var best *Peer
+	for _, peer := range d.peers {
+		if d.excluded[peer.ID] || d.load[peer.ID] >= maxRequestsPerPeer {
+			continue
+		}
+		// Altura 0 significa desconhecida (ex.: retomada sem consulta de cabeçalhos)
+		if peer.BlockHeight > 0 && peer.BlockHeight < last {
+			continue
+		}
+		if best == nil || peer.Reliability > best.Reliability ||
+			(peer.Reliability == best.Reliability && d.load[peer.ID] < d.load[best.ID]) {
+			best = peer
+		}
+	}
+	return best
+}
+
+func (d *blockDownloader) send(peer *Peer, chunk *blockChunk) {
+	request := &blockRequest{chunk: chunk, peer: peer, sentAt: time.Now()}
+	d.inFlight[chunk.first] = request
+	d.load[peer.ID]++
+
+	go func() {
+		blocks, err := d.sm.requestBlocks(peer, chunk.headers)
+		select {
+		case d.results <- blockResult{request: request, blocks: blocks, err: err}:
+		case <-d.done:
+		}
+	}()
+}
+
+// handleResult registra a resposta de um pedido e conecta o que estiver em ordem
+func (d *blockDownloader) handleResult(result blockResult) error {
+	request := result.request
+	d.load[request.peer.ID]--
+
+	// Resposta atrasada de um lote que já foi reatribuído
+	if d.inFlight[request.chunk.first] != request {
+		return nil
+	}
+	delete(d.inFlight, request.chunk.first)
+
+	if result.err != nil {
+		fmt.Printf("⚠️  Peer %s falhou no lote %d: %v\n", request.peer.ID, request.chunk.first, result.err)
+		d.failPeer(request.peer)
+		d.requeue(request.chunk)
+		return nil
+	}
+
+	d.failures[request.peer.ID] = 0
+	d.sm.updatePeerReliability(request.peer, true)
+	d.received[request.chunk.first] = result.blocks
+	return d.connect()
+}
+
+// checkStalls reatribui pedidos que passaram do tempo limite
+func (d *blockDownloader) checkStalls() {
+	for first, request := range d.inFlight {
+		if time.Since(request.sentAt) < d.sm.stallTimeout {
+			continue
+		}
+
+		fmt.Printf("🐌 Peer %s travou no lote %d; reatribuindo\n", request.peer.ID, first)
+		delete(d.inFlight, first)
+		d.failPeer(request.peer)
+		d.requeue(request.chunk)
+	}
+}
+
+// failPeer rebaixa o peer e deixa de usá-lo nesta sincronização. O último
+// peer disponível só é descartado depois de maxPeerFailures falhas
+// seguidas; antes disso o lote é pedido a ele de novo.
+func (d *blockDownloader) failPeer(peer *Peer) {
+	if d.excluded[peer.ID] {
+		return
+	}
+	d.sm.updatePeerReliability(peer, false)
+	d.failures[peer.ID]++
+	if d.hasOtherPeer(peer) || d.failures[peer.ID] >= maxPeerFailures {
+		d.excluded[peer.ID] = true
+	}
+}
+
+func (d *blockDownloader) hasOtherPeer(peer *Peer) bool {
+	for _, other := range d.peers {
+		if other.ID != peer.ID && !d.excluded[other.ID] {
+			return true
+		}
+	}
+	return false
+}
+
+// requeue devolve o lote à fila mantendo a ordem de altura
+func (d *blockDownloader) requeue(chunk *blockChunk) {
+	i := 0
+	for i < len(d.pending) && d.pending[i].first < chunk.first {
+		i++
+	}
+	d.pending = append(d.pending, nil)
+	copy(d.pending[i+1:], d.pending[i:])
+	d.pending[i] = chunk
+}
+
+// connect conecta os lotes recebidos que continuam a cadeia em ordem e os
+// aplica assim que completam; lotes à frente de um que falta aguardam
+func (d *blockDownloader) connect() error {
+	connected := false
+	for {
+		blocks, ok := d.received[d.nextHeight()]
+		if !ok {
+			break
+		}
+		delete(d.received, d.nextHeight())
+		d.state.Blocks = append(d.state.Blocks, blocks...)
+		connected = true
+	}
+	d.sm.setProgress(d.state, len(d.peers))
+
+	if !connected {
+		return nil
+	}
+	if err := d.sm.applyDownloadedBlocks(d.state); err != nil {
+		return err
+	}
+	if d.complete() || d.state.BaseIndex-d.saved >= saveBatchSize || time.Since(d.lastSave) >= saveInterval {
+		return d.flush()
+	}
+	return nil
+}
+
+// flush grava a cadeia aplicada e o progresso
+func (d *blockDownloader) flush() error {
+	if len(d.state.Blocks) > 0 {
+		if err := d.sm.applyDownloadedBlocks(d.state); err != nil {
+			return err
+		}
+	}
+	d.lastSave = time.Now()
+	if d.state.BaseIndex > d.saved {
+		if err := d.sm.saveBlockchainToFile(); err != nil {
+			return fmt.Errorf("erro ao salvar blockchain: %v", err)
+		}
+		fmt.Printf("📦 %d blocos aplicados (altura %d)\n", d.state.BaseIndex-d.saved, d.state.BaseIndex)
+		d.saved = d.state.BaseIndex
+	}
+
+	d.state.UpdatedAt = time.Now()
+	if err := d.sm.saveSyncState(d.state); err != nil {
+		return fmt.Errorf("erro ao salvar progresso: %v", err)
+	}
+	d.sm.setProgress(d.state, len(d.peers))
+	return nil
+}
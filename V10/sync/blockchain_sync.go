@@ -59,6 +59,7 @@ type Peer struct {
 	Latency     time.Duration `json:"latency"`
 	Reliability float64       `json:"reliability"`
 	conn        interface{}   `json:"-"`
+	connMutex   sync.Mutex    // Serializa pedidos na conexão compartilhada
 }
 
 type P2PNode struct {
@@ -77,6 +78,13 @@ type SyncManager struct {
 	syncInterval time.Duration
 	syncMutex    sync.Mutex
 
+	// Envio de requisições a um peer (sendSyncRequest por padrão)
+	request      func(peer *Peer, msg *NetworkMessage) *NetworkMessage
+	statePath    string // Progresso da sincronização em andamento
+	chainPath    string
+	stallTimeout time.Duration
+	progress     SyncProgress
+
 	// Estatísticas de sincronização
 	syncAttempts     int
 	successfulSyncs  int
@@ -84,20 +92,49 @@ type SyncManager struct {
 	lastSyncDuration time.Duration
 }
 
+// SyncProgress resume o andamento da sincronização headers-first
+type SyncProgress struct {
+	PeerID           string
+	StartHeight      int // Ponto de fork quando a sincronização começou
+	TargetHeight     int // Altura do último cabeçalho validado
+	DownloadedHeight int // Altura já baixada (aplicada ou aguardando reorganização)
+	DownloadPeers    int // Peers usados no download dos corpos
+}
+
+// SyncState é gravado em disco para retomar uma sincronização interrompida
+type SyncState struct {
+	PeerID      string        `json:"peer_id"`
+	StartHeight int           `json:"start_height"`
+	BaseIndex   int           `json:"base_index"` // Blocos em comum com a cadeia local
+	BaseHash    string        `json:"base_hash"`  // Hash do último bloco em comum
+	Headers     []BlockHeader `json:"headers"`    // Cabeçalhos validados ainda não aplicados
+	Blocks      []Token       `json:"blocks"`     // Corpos baixados aguardando a nova cadeia ficar mais longa
+	UpdatedAt   time.Time     `json:"updated_at"`
+}
+
+func (state *SyncState) targetHeight() int {
+	return state.BaseIndex + len(state.Headers)
+}
+
 type SyncResponse struct {
-	Peer       *Peer
-	Blockchain []Token
-	Height     int
-	Latency    time.Duration
-	Error      error
+	Peer    *Peer
+	Headers []BlockHeader // Cabeçalhos a partir do ponto de fork
+	Height  int
+	Latency time.Duration
+	Error   error
 }
 
 func NewSyncManager(node *P2PNode) *SyncManager {
-	return &SyncManager{
+	sm := &SyncManager{
 		node:         node,
 		isSyncing:    false,
 		syncInterval: 30 * time.Second,
+		statePath:    "../sync_state.json",
+		chainPath:    "../tokens.json",
+		stallTimeout: blockStallTimeout,
 	}
+	sm.request = sm.sendSyncRequest
+	return sm
 }
 
 func (sm *SyncManager) StartSyncRoutine() {
@@ -126,19 +163,30 @@ func (sm *SyncManager) SyncWithNetwork() {
 	sm.isSyncing = true
 	sm.syncMutex.Unlock()
 
+	startTime := time.Now()
 	defer func() {
 		sm.syncMutex.Lock()
 		sm.isSyncing = false
 		sm.lastSyncTime = time.Now()
+		sm.lastSyncDuration = time.Since(startTime)
 		sm.syncMutex.Unlock()
 	}()
 
-	startTime := time.Now()
 	sm.syncAttempts++
 
 	fmt.Println("🔄 Iniciando sincronização da blockchain...")
 
-	// Coleta informações de todos os peers
+	// Retoma uma sincronização interrompida antes de consultar os peers
+	if state := sm.loadSyncState(); state != nil {
+		if peers := sm.resumePeers(state); len(peers) > 0 {
+			fmt.Printf("⏯️  Retomando sincronização: %d/%d blocos (%d peers)\n",
+				state.BaseIndex+len(state.Blocks), state.targetHeight(), len(peers))
+			sm.finishSync(peers, state)
+			return
+		}
+	}
+
+	// Coleta os cabeçalhos anunciados por todos os peers
 	responses := sm.requestBlockchainInfo()
 
 	if len(responses) == 0 {
@@ -147,41 +195,59 @@ func (sm *SyncManager) SyncWithNetwork() {
 		return
 	}
 
-	// Analisa respostas e encontra a melhor blockchain
-	bestChain, bestPeer := sm.findBestChain(responses)
+	// Analisa respostas e encontra a melhor cadeia
+	best := sm.findBestChain(responses)
 
-	if bestChain == nil {
+	if best == nil {
 		fmt.Println("❌ Nenhuma blockchain válida encontrada")
 		sm.failedSyncs++
 		return
 	}
 
-	currentHeight := len(sm.node.Blockchain)
-	newHeight := len(bestChain)
+	currentHeight := sm.chainHeight()
 
-	if newHeight > currentHeight {
-		fmt.Printf("📥 Sincronizando: %d -> %d blocos (peer: %s)\n",
-			currentHeight, newHeight, bestPeer.ID)
-
-		if sm.applyBlockchain(bestChain) {
-			sm.successfulSyncs++
-			sm.updatePeerReliability(bestPeer, true)
-			fmt.Printf("✅ Sincronização concluída com sucesso\n")
-		} else {
+	if best.Height > currentHeight {
+		state, err := sm.buildSyncState(best)
+		if err != nil {
+			fmt.Printf("❌ Cabeçalhos rejeitados do peer %s: %v\n", best.Peer.ID, err)
 			sm.failedSyncs++
-			sm.updatePeerReliability(bestPeer, false)
-			fmt.Printf("❌ Falha na sincronização\n")
+			sm.updatePeerReliability(best.Peer, false)
+			return
 		}
-	} else if newHeight == currentHeight {
+
+		peers := sm.downloadPeers(responses, best, state)
+		fmt.Printf("📥 Sincronizando: %d -> %d blocos (cabeçalhos: %s, %d peers)\n",
+			currentHeight, state.targetHeight(), best.Peer.ID, len(peers))
+		sm.finishSync(peers, state)
+	} else if best.Height == currentHeight {
 		fmt.Println("✅ Blockchain já está sincronizada")
 		sm.successfulSyncs++
 	} else {
-		fmt.Printf("📤 Nossa blockchain é mais longa (%d vs %d) - propagando\n",
-			currentHeight, newHeight)
-		sm.propagateOurBlockchain()
+		// Os peers buscarão nossos cabeçalhos na próxima sincronização deles
+		fmt.Printf("📤 Nossa blockchain é mais longa (%d vs %d)\n",
+			currentHeight, best.Height)
+		sm.successfulSyncs++
+	}
+}
+
+// finishSync baixa os corpos pendentes e registra o resultado.
+// A confiabilidade de cada peer é ajustada lote a lote pelo download.
+func (sm *SyncManager) finishSync(peers []*Peer, state *SyncState) {
+	if err := sm.downloadBlocks(peers, state); err != nil {
+		sm.failedSyncs++
+		fmt.Printf("❌ Falha na sincronização: %v (progresso salvo)\n", err)
+		return
 	}
 
-	sm.lastSyncDuration = time.Since(startTime)
+	sm.clearSyncState()
+	sm.successfulSyncs++
+	fmt.Printf("✅ Sincronização concluída com sucesso\n")
+}
+
+func (sm *SyncManager) chainHeight() int {
+	sm.node.mutex.RLock()
+	defer sm.node.mutex.RUnlock()
+	return len(sm.node.Blockchain)
 }
 
 func (sm *SyncManager) requestBlockchainInfo() []SyncResponse {
@@ -232,32 +298,23 @@ func (sm *SyncManager) requestBlockchainInfo() []SyncResponse {
 func (sm *SyncManager) requestFromSinglePeer(peer *Peer) SyncResponse {
 	start := time.Now()
 
-	// Cria timeout para a requisição
-	timeout := time.NewTimer(5 * time.Second)
-	defer timeout.Stop()
+	fmt.Printf("📡 Solicitando cabeçalhos do peer %s:%d\n", peer.Address, peer.Port)
 
-	// Simula requisição ao peer
-	fmt.Printf("📡 Solicitando blockchain do peer %s:%d\n", peer.Address, peer.Port)
+	// Locator com hashes espaçados exponencialmente a partir do nosso topo
+	sm.node.mutex.RLock()
+	locator := buildLocator(sm.node.Blockchain)
+	sm.node.mutex.RUnlock()
 
-	// Simula resposta do peer
+	headers, height, err := sm.requestHeaders(peer, locator)
 	response := SyncResponse{
 		Peer:    peer,
-		Height:  len(sm.node.Blockchain) + 5, // Simula blockchain maior
+		Headers: headers,
+		Height:  height,
 		Latency: time.Since(start),
+		Error:   err,
 	}
-
-	// Simula blockchain recebida
-	if response.Height > len(sm.node.Blockchain) {
-		response.Blockchain = make([]Token, response.Height)
-		for i := 0; i < response.Height; i++ {
-			response.Blockchain[i] = Token{
-				Index:        i + 1,
-				Hash:         fmt.Sprintf("SYNC_BLOCK_%d_%s", i+1, peer.ID),
-				Timestamp:    time.Now().Add(-time.Duration(response.Height-i) * time.Minute).Format(time.RFC3339),
-				ContainsSyra: true,
-				MinerID:      peer.ID,
-			}
-		}
+	if err != nil {
+		return response
 	}
 
 	// Atualiza informações do peer
@@ -268,9 +325,264 @@ func (sm *SyncManager) requestFromSinglePeer(peer *Peer) SyncResponse {
 	return response
 }
 
-func (sm *SyncManager) findBestChain(responses []SyncResponse) ([]Token, *Peer) {
+// requestHeaders envia MSG_GET_HEADERS e retorna os cabeçalhos e a altura do peer
+func (sm *SyncManager) requestHeaders(peer *Peer, locator []string) ([]BlockHeader, int, error) {
+	response := sm.request(peer, &NetworkMessage{
+		Type:      MSG_GET_HEADERS,
+		From:      sm.node.ID,
+		To:        peer.ID,
+		Data:      map[string]interface{}{"locator": locator},
+		Timestamp: time.Now(),
+	})
+	if response == nil || response.Type != MSG_HEADERS {
+		return nil, 0, fmt.Errorf("peer %s não respondeu com cabeçalhos", peer.ID)
+	}
+
+	var data struct {
+		Headers []BlockHeader `json:"headers"`
+		Height  int           `json:"height"`
+	}
+	if err := decodeMessageData(response, &data); err != nil {
+		return nil, 0, err
+	}
+	if len(data.Headers) > maxHeadersPerMessage {
+		return nil, 0, fmt.Errorf("peer %s enviou %d cabeçalhos (máximo %d)", peer.ID, len(data.Headers), maxHeadersPerMessage)
+	}
+	return data.Headers, data.Height, nil
+}
+
+// requestBlocks baixa os corpos dos cabeçalhos informados e confere cada um
+func (sm *SyncManager) requestBlocks(peer *Peer, headers []BlockHeader) ([]Token, error) {
+	hashes := make([]string, len(headers))
+	for i := range headers {
+		hashes[i] = headers[i].Hash
+	}
+
+	response := sm.request(peer, &NetworkMessage{
+		Type:      MSG_GET_BLOCKS,
+		From:      sm.node.ID,
+		To:        peer.ID,
+		Data:      map[string]interface{}{"hashes": hashes},
+		Timestamp: time.Now(),
+	})
+	if response == nil || response.Type != MSG_BLOCKS {
+		return nil, fmt.Errorf("peer %s não respondeu com blocos", peer.ID)
+	}
+
+	var data struct {
+		Blocks []Token `json:"blocks"`
+	}
+	if err := decodeMessageData(response, &data); err != nil {
+		return nil, err
+	}
+	if len(data.Blocks) != len(headers) {
+		return nil, fmt.Errorf("peer %s enviou %d de %d blocos", peer.ID, len(data.Blocks), len(headers))
+	}
+
+	for i := range data.Blocks {
+		if !blockMatchesHeader(&data.Blocks[i], &headers[i]) {
+			return nil, fmt.Errorf("bloco %d não corresponde ao cabeçalho", headers[i].Index)
+		}
+		if !sm.validateBlockDetailed(&data.Blocks[i], headers[i].Index-1) {
+			return nil, fmt.Errorf("bloco %d inválido", headers[i].Index)
+		}
+	}
+	return data.Blocks, nil
+}
+
+// buildSyncState valida os cabeçalhos recebidos e busca os restantes em lotes
+func (sm *SyncManager) buildSyncState(best *SyncResponse) (*SyncState, error) {
+	headers := best.Headers
+	if len(headers) == 0 {
+		return nil, fmt.Errorf("nenhum cabeçalho recebido")
+	}
+
+	base := headers[0].Index - 1
+	sm.node.mutex.RLock()
+	currentHeight := len(sm.node.Blockchain)
+	if base < 0 || base > currentHeight {
+		sm.node.mutex.RUnlock()
+		return nil, fmt.Errorf("ponto de fork inválido: %d", base)
+	}
+	baseHash := ""
+	if base > 0 {
+		baseHash = sm.node.Blockchain[base-1].Hash
+	}
+	sm.node.mutex.RUnlock()
+
+	if err := validateHeaderChain(headers, base, baseHash); err != nil {
+		return nil, err
+	}
+
+	// Continua a partir do último cabeçalho até alcançar a altura anunciada
+	for base+len(headers) < best.Height {
+		last := headers[len(headers)-1]
+		more, _, err := sm.requestHeaders(best.Peer, []string{last.Hash})
+		if err != nil {
+			return nil, err
+		}
+		if len(more) == 0 {
+			break
+		}
+		if err := validateHeaderChain(more, base+len(headers), last.Hash); err != nil {
+			return nil, err
+		}
+		headers = append(headers, more...)
+	}
+
+	state := &SyncState{
+		PeerID:      best.Peer.ID,
+		StartHeight: base,
+		BaseIndex:   base,
+		BaseHash:    baseHash,
+		Headers:     headers,
+		UpdatedAt:   time.Now(),
+	}
+	if state.targetHeight() <= currentHeight {
+		return nil, fmt.Errorf("cadeia do peer não é mais longa (%d vs %d)", state.targetHeight(), currentHeight)
+	}
+	if err := sm.saveSyncState(state); err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("🧾 %d cabeçalhos validados a partir do bloco %d\n", len(headers), base)
+	return state, nil
+}
+
+// applyDownloadedBlocks aplica à cadeia em memória os blocos baixados quando a
+// nova cadeia ultrapassa a local. Em reorganizações os blocos ficam pendentes
+// até lá. A gravação em disco fica com o chamador.
+func (sm *SyncManager) applyDownloadedBlocks(state *SyncState) error {
+	sm.node.mutex.Lock()
+	currentHeight := len(sm.node.Blockchain)
+	if state.BaseIndex > currentHeight ||
+		(state.BaseIndex > 0 && sm.node.Blockchain[state.BaseIndex-1].Hash != state.BaseHash) {
+		sm.node.mutex.Unlock()
+		return fmt.Errorf("cadeia local mudou durante a sincronização")
+	}
+	if state.BaseIndex+len(state.Blocks) <= currentHeight {
+		sm.node.mutex.Unlock()
+		return nil
+	}
+
+	newChain := make([]Token, 0, state.BaseIndex+len(state.Blocks))
+	newChain = append(newChain, sm.node.Blockchain[:state.BaseIndex]...)
+	newChain = append(newChain, state.Blocks...)
+	sm.node.Blockchain = newChain
+	sm.node.mutex.Unlock()
+
+	if state.BaseIndex < currentHeight {
+		fmt.Printf("🔀 Reorganização: %d blocos locais substituídos\n", currentHeight-state.BaseIndex)
+	}
+
+	applied := len(state.Blocks)
+	state.BaseIndex += applied
+	state.BaseHash = state.Blocks[applied-1].Hash
+	state.Headers = state.Headers[applied:]
+	state.Blocks = nil
+	return nil
+}
+
+// resumePeers lista os peers para retomar o download. Os corpos são conferidos
+// contra os cabeçalhos já validados, então qualquer peer ativo serve.
+func (sm *SyncManager) resumePeers(state *SyncState) []*Peer {
+	sm.node.mutex.RLock()
+	defer sm.node.mutex.RUnlock()
+
+	peers := make([]*Peer, 0)
+	if peer, ok := sm.node.Peers[state.PeerID]; ok && peer.IsActive {
+		peers = append(peers, peer)
+	}
+	for _, peer := range sm.node.Peers {
+		if peer.IsActive && peer.ID != state.PeerID {
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
+
+// downloadPeers seleciona, entre os que responderam, os peers que seguem
+// a mesma cadeia de cabeçalhos escolhida
+func (sm *SyncManager) downloadPeers(responses []SyncResponse, best *SyncResponse, state *SyncState) []*Peer {
+	peers := []*Peer{best.Peer}
+	for i := range responses {
+		response := &responses[i]
+		if response.Peer == best.Peer || len(response.Headers) == 0 {
+			continue
+		}
+
+		first := response.Headers[0]
+		offset := first.Index - state.BaseIndex - 1
+		if offset >= 0 && offset < len(state.Headers) && state.Headers[offset].Hash == first.Hash {
+			peers = append(peers, response.Peer)
+		}
+	}
+	return peers
+}
+
+// loadSyncState carrega o progresso salvo se ainda for aplicável à cadeia local
+func (sm *SyncManager) loadSyncState() *SyncState {
+	data, err := os.ReadFile(sm.statePath)
+	if err != nil {
+		return nil
+	}
+
+	var state SyncState
+	if err := json.Unmarshal(data, &state); err != nil {
+		sm.clearSyncState()
+		return nil
+	}
+
+	sm.node.mutex.RLock()
+	currentHeight := len(sm.node.Blockchain)
+	valid := state.BaseIndex <= currentHeight &&
+		(state.BaseIndex == 0 || sm.node.Blockchain[state.BaseIndex-1].Hash == state.BaseHash)
+	sm.node.mutex.RUnlock()
+
+	if valid && state.targetHeight() > currentHeight && len(state.Blocks) <= len(state.Headers) &&
+		validateHeaderChain(state.Headers, state.BaseIndex, state.BaseHash) == nil {
+		return &state
+	}
+
+	fmt.Println("🗑️  Progresso de sincronização descartado (cadeia local mudou)")
+	sm.clearSyncState()
+	return nil
+}
+
+// Salva o progresso de forma atômica (arquivo temporário + rename)
+func (sm *SyncManager) saveSyncState(state *SyncState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	tempFile := sm.statePath + ".tmp"
+	if err := os.WriteFile(tempFile, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tempFile, sm.statePath)
+}
+
+func (sm *SyncManager) clearSyncState() {
+	os.Remove(sm.statePath)
+}
+
+func (sm *SyncManager) setProgress(state *SyncState, peers int) {
+	sm.syncMutex.Lock()
+	defer sm.syncMutex.Unlock()
+
+	sm.progress = SyncProgress{
+		PeerID:           state.PeerID,
+		StartHeight:      state.StartHeight,
+		TargetHeight:     state.targetHeight(),
+		DownloadedHeight: state.BaseIndex + len(state.Blocks),
+		DownloadPeers:    peers,
+	}
+}
+
+func (sm *SyncManager) findBestChain(responses []SyncResponse) *SyncResponse {
 	if len(responses) == 0 {
-		return nil, nil
+		return nil
 	}
 
 	var bestResponse *SyncResponse
@@ -290,13 +602,13 @@ func (sm *SyncManager) findBestChain(responses []SyncResponse) ([]Token, *Peer)
 	}
 
 	if bestResponse == nil {
-		return nil, nil
+		return nil
 	}
 
 	fmt.Printf("🏆 Melhor cadeia encontrada: peer %s (score: %.2f, altura: %d)\n",
 		bestResponse.Peer.ID, bestScore, bestResponse.Height)
 
-	return bestResponse.Blockchain, bestResponse.Peer
+	return bestResponse
 }
 
 func (sm *SyncManager) calculateChainScore(response SyncResponse) float64 {
@@ -334,33 +646,6 @@ func (sm *SyncManager) calculateChainScore(response SyncResponse) float64 {
 	return totalScore
 }
 
-func (sm *SyncManager) validateFullChain(chain []Token) bool {
-	if len(chain) == 0 {
-		return false
-	}
-
-	fmt.Printf("🔍 Validando cadeia com %d blocos...\n", len(chain))
-
-	// Valida cada bloco individualmente
-	for i, block := range chain {
-		if !sm.validateBlockDetailed(&block, i) {
-			fmt.Printf("❌ Bloco %d falhou na validação\n", i+1)
-			return false
-		}
-	}
-
-	// Valida integridade da cadeia
-	for i := 1; i < len(chain); i++ {
-		if chain[i].PrevHash != chain[i-1].Hash {
-			fmt.Printf("❌ Integridade quebrada entre blocos %d e %d\n", i, i+1)
-			return false
-		}
-	}
-
-	fmt.Printf("✅ Cadeia validada com sucesso\n")
-	return true
-}
-
 func (sm *SyncManager) validateBlockDetailed(block *Token, index int) bool {
 	// 1. Índice correto
 	if block.Index != index+1 {
@@ -420,37 +705,11 @@ func (sm *SyncManager) validateTransaction(tx *Transaction) bool {
 	return true
 }
 
-func (sm *SyncManager) applyBlockchain(newChain []Token) bool {
-	// Faz backup da blockchain atual
-	backup := make([]Token, len(sm.node.Blockchain))
-	copy(backup, sm.node.Blockchain)
-
-	// Aplica nova blockchain
-	sm.node.mutex.Lock()
-	sm.node.Blockchain = make([]Token, len(newChain))
-	copy(sm.node.Blockchain, newChain)
-	sm.node.mutex.Unlock()
-
-	// Salva no arquivo
-	if err := sm.saveBlockchainToFile(); err != nil {
-		// Restaura backup em caso de erro
-		sm.node.mutex.Lock()
-		sm.node.Blockchain = backup
-		sm.node.mutex.Unlock()
-
-		fmt.Printf("❌ Erro ao salvar blockchain: %v\n", err)
-		return false
-	}
-
-	fmt.Printf("✅ Nova blockchain aplicada com %d blocos\n", len(newChain))
-	return true
-}
-
 func (sm *SyncManager) saveBlockchainToFile() error {
 	sm.node.mutex.RLock()
 	defer sm.node.mutex.RUnlock()
 
-	file, err := os.Create("../tokens.json")
+	file, err := os.Create(sm.chainPath)
 	if err != nil {
 		return err
 	}
@@ -461,35 +720,6 @@ func (sm *SyncManager) saveBlockchainToFile() error {
 	return encoder.Encode(sm.node.Blockchain)
 }
 
-func (sm *SyncManager) propagateOurBlockchain() {
-	sm.node.mutex.RLock()
-	blockchain := make([]Token, len(sm.node.Blockchain))
-	copy(blockchain, sm.node.Blockchain)
-	peers := make([]*Peer, 0)
-	for _, peer := range sm.node.Peers {
-		if peer.IsActive {
-			peers = append(peers, peer)
-		}
-	}
-	sm.node.mutex.RUnlock()
-
-	for _, peer := range peers {
-		go func(p *Peer) {
-			msg := &NetworkMessage{
-				Type: MSG_SYNC_RESPONSE,
-				From: sm.node.ID,
-				To:   p.ID,
-				Data: map[string]interface{}{
-					"blockchain": blockchain,
-					"height":     len(blockchain),
-				},
-				Timestamp: time.Now(),
-			}
-			sm.sendSyncRequest(p, msg)
-		}(peer)
-	}
-}
-
 func (sm *SyncManager) updatePeerReliability(peer *Peer, success bool) {
 	if success {
 		peer.Reliability = (peer.Reliability * 0.9) + 0.1
@@ -525,6 +755,9 @@ func (sm *SyncManager) sendSyncRequest(peer *Peer, request *NetworkMessage) *Net
 		if !ok {
 			return nil
 		}
+		// Downloads paralelos podem usar a mesma conexão do peer
+		peer.connMutex.Lock()
+		defer peer.connMutex.Unlock()
 	}
 
 	encoder := json.NewEncoder(conn)
@@ -551,6 +784,17 @@ func (sm *SyncManager) GetSyncStats() map[string]interface{} {
 		successRate = float64(sm.successfulSyncs) / float64(sm.syncAttempts) * 100
 	}
 
+	sm.syncMutex.Lock()
+	defer sm.syncMutex.Unlock()
+
+	// Progresso da sincronização headers-first atual (ou da última)
+	progress := sm.progress
+	progressPercent := 0.0
+	if progress.TargetHeight > progress.StartHeight {
+		progressPercent = float64(progress.DownloadedHeight-progress.StartHeight) /
+			float64(progress.TargetHeight-progress.StartHeight) * 100
+	}
+
 	return map[string]interface{}{
 		"sync_attempts":      sm.syncAttempts,
 		"successful_syncs":   sm.successfulSyncs,
@@ -559,6 +803,14 @@ func (sm *SyncManager) GetSyncStats() map[string]interface{} {
 		"last_sync_time":     sm.lastSyncTime,
 		"last_sync_duration": sm.lastSyncDuration,
 		"is_syncing":         sm.isSyncing,
+		"local_height":       sm.chainHeight(),
+		"sync_peer":          progress.PeerID,
+		"start_height":       progress.StartHeight,
+		"target_height":      progress.TargetHeight,
+		"downloaded_height":  progress.DownloadedHeight,
+		"blocks_remaining":   progress.TargetHeight - progress.DownloadedHeight,
+		"progress_percent":   progressPercent,
+		"download_peers":     progress.DownloadPeers,
 	}
 }
 
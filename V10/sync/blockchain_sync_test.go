@@ -0,0 +1,283 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// makeChain gera blocos encadeados; from permite continuar uma cadeia existente
+func makeChain(from []Token, n int, tag string) []Token {
+	chain := append([]Token{}, from...)
+	for i := 0; i < n; i++ {
+		index := len(chain) + 1
+		block := Token{
+			Index:        index,
+			Hash:         fmt.Sprintf("%s_%d", tag, index),
+			Timestamp:    time.Now().Add(-time.Hour).Format(time.RFC3339),
+			ContainsSyra: true,
+			MinerID:      tag,
+		}
+		if index > 1 {
+			block.PrevHash = chain[index-2].Hash
+		}
+		chain = append(chain, block)
+	}
+	return chain
+}
+
+type syncHarness struct {
+	local   *P2PNode
+	remotes map[string]*P2PNode
+	sm      *SyncManager
+
+	mu          sync.Mutex
+	requests    map[string]int // Mensagens enviadas por tipo
+	blockHashes []string       // Hashes pedidos em MSG_GET_BLOCKS
+	served      map[string]int // Blocos entregues por peer
+	failFrom    int            // Pedidos de blocos a partir desta altura falham (0 = nunca)
+	stall       map[string]bool
+	release     chan struct{} // Libera os pedidos travados ao final do teste
+}
+
+// newSyncHarness cria o nó local e um peer remoto (peer-1, peer-2, ...) por cadeia
+func newSyncHarness(t *testing.T, local []Token, remotes ...[]Token) *syncHarness {
+	h := &syncHarness{
+		local:    &P2PNode{ID: "local", Peers: map[string]*Peer{}, Blockchain: local},
+		remotes:  map[string]*P2PNode{},
+		requests: map[string]int{},
+		served:   map[string]int{},
+		stall:    map[string]bool{},
+		release:  make(chan struct{}),
+	}
+	for i, chain := range remotes {
+		id := fmt.Sprintf("peer-%d", i+1)
+		h.remotes[id] = &P2PNode{ID: id, Peers: map[string]*Peer{}, Blockchain: chain}
+		h.local.Peers[id] = &Peer{ID: id, Address: "127.0.0.1", Port: i + 1, IsActive: true, Reliability: 0.5}
+	}
+	t.Cleanup(func() { close(h.release) })
+
+	h.sm = h.newManager(t.TempDir())
+	return h
+}
+
+// newManager cria um SyncManager que fala com os nós remotos em memória
+func (h *syncHarness) newManager(dir string) *SyncManager {
+	sm := NewSyncManager(h.local)
+	sm.statePath = filepath.Join(dir, "sync_state.json")
+	sm.chainPath = filepath.Join(dir, "tokens.json")
+	sm.stallTimeout = 200 * time.Millisecond
+	sm.request = func(peer *Peer, msg *NetworkMessage) *NetworkMessage {
+		h.mu.Lock()
+		h.requests[msg.Type]++
+		if msg.Type == MSG_GET_BLOCKS {
+			hashes := msg.Data.(map[string]interface{})["hashes"].([]string)
+			if h.failFrom > 0 && lowestRequested(hashes) >= h.failFrom {
+				h.mu.Unlock()
+				return nil
+			}
+			if h.stall[peer.ID] {
+				h.mu.Unlock()
+				<-h.release
+				return nil
+			}
+			h.blockHashes = append(h.blockHashes, hashes...)
+			h.served[peer.ID] += len(hashes)
+		}
+		h.mu.Unlock()
+
+		// Simula a serialização da rede
+		raw, _ := json.Marshal(msg)
+		var received NetworkMessage
+		json.Unmarshal(raw, &received)
+		return h.remotes[peer.ID].handleSyncMessage(&received)
+	}
+	return sm
+}
+
+func assertSameChain(t *testing.T, got, want []Token) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("altura %d, esperado %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Hash != want[i].Hash {
+			t.Fatalf("bloco %d: hash %s, esperado %s", i+1, got[i].Hash, want[i].Hash)
+		}
+	}
+}
+
+func TestBuildLocatorIsExponential(t *testing.T) {
+	chain := makeChain(nil, 100, "A")
+	locator := buildLocator(chain)
+
+	if locator[0] != "A_100" || locator[len(locator)-1] != "A_1" {
+		t.Fatalf("locator deve ir do topo ao gênese: %v", locator)
+	}
+	for i := 0; i < locatorDenseHashes; i++ {
+		if locator[i] != fmt.Sprintf("A_%d", 100-i) {
+			t.Fatalf("os primeiros hashes devem ser consecutivos: %v", locator)
+		}
+	}
+	if len(locator) > 20 {
+		t.Fatalf("locator com %d hashes para 100 blocos", len(locator))
+	}
+
+	if fork := findForkPoint(makeChain(chain[:61], 5, "B"), locator); fork != 61 {
+		t.Fatalf("ponto de fork %d, esperado 61", fork)
+	}
+}
+
+func TestHeadersFirstDownloadsOnlyMissingBodies(t *testing.T) {
+	shared := makeChain(nil, 50, "A")
+	remote := makeChain(shared, maxHeadersPerMessage+500, "A")
+	h := newSyncHarness(t, shared, remote)
+
+	h.sm.SyncWithNetwork()
+
+	assertSameChain(t, h.local.Blockchain, remote)
+	if h.requests[MSG_GET_HEADERS] != 2 {
+		t.Fatalf("esperados 2 pedidos de cabeçalhos, houve %d", h.requests[MSG_GET_HEADERS])
+	}
+	if len(h.blockHashes) != len(remote)-len(shared) || lowestRequested(h.blockHashes) != 51 {
+		t.Fatalf("deveria baixar apenas os %d corpos faltantes, baixou %d", len(remote)-len(shared), len(h.blockHashes))
+	}
+
+	stats := h.sm.GetSyncStats()
+	if stats["progress_percent"].(float64) != 100 || stats["target_height"].(int) != len(remote) {
+		t.Fatalf("progresso incorreto: %v", stats)
+	}
+	if _, err := os.Stat(h.sm.statePath); !os.IsNotExist(err) {
+		t.Fatal("progresso salvo deveria ser removido ao concluir")
+	}
+}
+
+func TestHeadersFirstReorgsToLongerChain(t *testing.T) {
+	shared := makeChain(nil, 10, "A")
+	local := makeChain(shared, 5, "L")
+	remote := makeChain(shared, 8, "R")
+	h := newSyncHarness(t, local, remote)
+
+	h.sm.SyncWithNetwork()
+
+	assertSameChain(t, h.local.Blockchain, remote)
+	if len(h.blockHashes) != 8 {
+		t.Fatalf("deveria baixar 8 blocos após o fork, baixou %d", len(h.blockHashes))
+	}
+}
+
+func TestHeadersFirstResumesAfterInterruption(t *testing.T) {
+	dir := t.TempDir()
+	remote := makeChain(nil, 40*blocksPerRequest+10, "A")
+	h := newSyncHarness(t, nil, remote)
+	h.sm = h.newManager(dir)
+	h.failFrom = 20*blocksPerRequest + 1
+
+	h.sm.SyncWithNetwork()
+
+	// Os lotes anteriores à falha são aplicados mesmo com o download abortado
+	interrupted := len(h.local.Blockchain)
+	if interrupted != h.failFrom-1 {
+		t.Fatalf("altura após interrupção: %d, esperado %d", interrupted, h.failFrom-1)
+	}
+	if retries := h.requests[MSG_GET_BLOCKS] - interrupted/blocksPerRequest; retries < maxPeerFailures {
+		t.Fatalf("único peer descartado após %d falhas", retries)
+	}
+	if stats := h.sm.GetSyncStats(); stats["blocks_remaining"].(int) != len(remote)-interrupted {
+		t.Fatalf("blocos restantes incorretos: %v", stats["blocks_remaining"])
+	}
+
+	// Reinicia o gerenciador: deve continuar sem pedir os cabeçalhos de novo
+	h.requests = map[string]int{}
+	h.blockHashes = nil
+	h.failFrom = 0
+	h.sm = h.newManager(dir)
+	h.sm.SyncWithNetwork()
+
+	assertSameChain(t, h.local.Blockchain, remote)
+	if h.requests[MSG_GET_HEADERS] != 0 {
+		t.Fatalf("retomada não deveria pedir cabeçalhos, pediu %d vezes", h.requests[MSG_GET_HEADERS])
+	}
+	if lowestRequested(h.blockHashes) != interrupted+1 {
+		t.Fatalf("retomada começou no bloco %d, esperado %d", lowestRequested(h.blockHashes), interrupted+1)
+	}
+}
+
+func TestParallelDownloadUsesAllPeers(t *testing.T) {
+	remote := makeChain(nil, 600, "A")
+	h := newSyncHarness(t, nil, remote, remote, remote)
+
+	h.sm.SyncWithNetwork()
+
+	assertSameChain(t, h.local.Blockchain, remote)
+	if len(h.blockHashes) != len(remote) {
+		t.Fatalf("cada bloco deveria ser pedido uma vez: %d pedidos para %d blocos", len(h.blockHashes), len(remote))
+	}
+	for id := range h.remotes {
+		if h.served[id] == 0 {
+			t.Fatalf("peer %s não participou do download: %v", id, h.served)
+		}
+	}
+	if stats := h.sm.GetSyncStats(); stats["download_peers"].(int) != 3 {
+		t.Fatalf("esperados 3 peers no download: %v", stats["download_peers"])
+	}
+}
+
+func TestStalledPeerIsReassignedAndDowngraded(t *testing.T) {
+	remote := makeChain(nil, 300, "A")
+	h := newSyncHarness(t, nil, remote, remote)
+	h.local.Peers["peer-1"].Reliability = 0.9 // Recebe os primeiros lotes
+	h.stall["peer-1"] = true
+
+	h.sm.SyncWithNetwork()
+
+	assertSameChain(t, h.local.Blockchain, remote)
+	if h.served["peer-2"] != len(remote) {
+		t.Fatalf("peer-2 deveria entregar todos os blocos, entregou %d", h.served["peer-2"])
+	}
+	if h.local.Peers["peer-1"].Reliability >= 0.9 {
+		t.Fatal("peer travado deveria perder confiabilidade")
+	}
+}
+
+func TestHeadersFirstRejectsBodyNotMatchingHeader(t *testing.T) {
+	shared := makeChain(nil, 5, "A")
+	remote := makeChain(shared, 5, "A")
+	h := newSyncHarness(t, shared, remote)
+
+	// O peer anuncia um cabeçalho e entrega outro corpo
+	h.sm.request = func(peer *Peer, msg *NetworkMessage) *NetworkMessage {
+		response := h.remotes[peer.ID].handleSyncMessage(msg)
+		if msg.Type == MSG_GET_BLOCKS {
+			blocks := response.Data.(map[string]interface{})["blocks"].([]Token)
+			blocks[0].MinerID = "falso"
+		}
+		return response
+	}
+
+	h.sm.SyncWithNetwork()
+
+	assertSameChain(t, h.local.Blockchain, shared)
+	if h.local.Peers["peer-1"].Reliability >= 0.5 {
+		t.Fatal("peer deveria perder confiabilidade")
+	}
+}
+
+// lowestRequested retorna a menor altura pedida em MSG_GET_BLOCKS
+func lowestRequested(hashes []string) int {
+	lowest := 0
+	for _, hash := range hashes {
+		var tag string
+		var height int
+		fmt.Sscanf(strings.Replace(hash, "_", " ", 1), "%s %d", &tag, &height)
+		if lowest == 0 || height < lowest {
+			lowest = height
+		}
+	}
+	return lowest
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Mensagens do protocolo headers-first
+const (
+	MSG_GET_HEADERS = "get_headers"
+	MSG_HEADERS     = "headers"
+	MSG_GET_BLOCKS  = "get_blocks"
+	MSG_BLOCKS      = "blocks"
+)
+
+// Limites por mensagem
+const (
+	maxHeadersPerMessage = 2000
+	maxBlocksPerMessage  = 128
+	locatorDenseHashes   = 10 // Hashes consecutivos antes do espaçamento exponencial
+)
+
+// BlockHeader contém apenas os campos necessários para validar o encadeamento
+type BlockHeader struct {
+	Index     int    `json:"index"`
+	Hash      string `json:"hash"`
+	PrevHash  string `json:"prev_hash,omitempty"`
+	Timestamp string `json:"timestamp"`
+	Nonce     int    `json:"nonce"`
+	Validator string `json:"validator,omitempty"`
+	MinerID   string `json:"miner_id,omitempty"`
+	TxCount   int    `json:"tx_count"`
+}
+
+func headerFromBlock(block *Token) BlockHeader {
+	return BlockHeader{
+		Index:     block.Index,
+		Hash:      block.Hash,
+		PrevHash:  block.PrevHash,
+		Timestamp: block.Timestamp,
+		Nonce:     block.Nonce,
+		Validator: block.Validator,
+		MinerID:   block.MinerID,
+		TxCount:   len(block.Transactions),
+	}
+}
+
+// buildLocator lista hashes do topo até o gênese: os 10 primeiros
+// consecutivos e depois com espaçamento dobrando a cada passo
+func buildLocator(chain []Token) []string {
+	locator := []string{}
+	step := 1
+
+	for i := len(chain) - 1; i >= 0; i -= step {
+		locator = append(locator, chain[i].Hash)
+		if len(locator) >= locatorDenseHashes {
+			step *= 2
+		}
+	}
+
+	// O gênese sempre faz parte do locator
+	if len(chain) > 0 && locator[len(locator)-1] != chain[0].Hash {
+		locator = append(locator, chain[0].Hash)
+	}
+	return locator
+}
+
+// findForkPoint retorna quantos blocos da cadeia local são comuns ao locator
+func findForkPoint(chain []Token, locator []string) int {
+	positions := make(map[string]int, len(chain))
+	for i := range chain {
+		positions[chain[i].Hash] = i
+	}
+
+	for _, hash := range locator {
+		if i, ok := positions[hash]; ok {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// validateHeaderChain confere o encadeamento dos cabeçalhos a partir do fork.
+// base é o número de blocos em comum e prevHash o hash do último deles.
+func validateHeaderChain(headers []BlockHeader, base int, prevHash string) error {
+	seen := make(map[string]bool, len(headers))
+	maxTime := time.Now().Add(5 * time.Minute)
+
+	for i, header := range headers {
+		expected := base + i + 1
+		if header.Index != expected {
+			return fmt.Errorf("índice incorreto: esperado %d, encontrado %d", expected, header.Index)
+		}
+		if header.Hash == "" {
+			return fmt.Errorf("hash vazio no cabeçalho %d", header.Index)
+		}
+		if seen[header.Hash] {
+			return fmt.Errorf("hash repetido no cabeçalho %d", header.Index)
+		}
+		seen[header.Hash] = true
+
+		// O primeiro bloco da cadeia não tem antecessor para conferir
+		if expected > 1 && header.PrevHash != prevHash {
+			return fmt.Errorf("integridade quebrada no cabeçalho %d", header.Index)
+		}
+		if header.TxCount < 0 {
+			return fmt.Errorf("quantidade de transações inválida no cabeçalho %d", header.Index)
+		}
+		if blockTime, err := time.Parse(time.RFC3339, header.Timestamp); err == nil && blockTime.After(maxTime) {
+			return fmt.Errorf("timestamp do cabeçalho %d muito no futuro", header.Index)
+		}
+
+		prevHash = header.Hash
+	}
+	return nil
+}
+
+// blockMatchesHeader confere se o corpo baixado corresponde ao cabeçalho validado
+func blockMatchesHeader(block *Token, header *BlockHeader) bool {
+	return block.Index == header.Index &&
+		block.Hash == header.Hash &&
+		block.PrevHash == header.PrevHash &&
+		block.Timestamp == header.Timestamp &&
+		block.Nonce == header.Nonce &&
+		block.Validator == header.Validator &&
+		block.MinerID == header.MinerID &&
+		len(block.Transactions) == header.TxCount
+}
+
+// decodeMessageData converte o campo Data (mapa genérico após JSON) na estrutura desejada
+func decodeMessageData(msg *NetworkMessage, out interface{}) error {
+	if msg == nil {
+		return fmt.Errorf("resposta vazia")
+	}
+	raw, err := json.Marshal(msg.Data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, out)
+}
+
+// Handler de MSG_GET_HEADERS: cabeçalhos a partir do ponto de fork do locator
+func (node *P2PNode) handleGetHeaders(msg *NetworkMessage) *NetworkMessage {
+	var request struct {
+		Locator  []string `json:"locator"`
+		StopHash string   `json:"stop_hash"`
+	}
+	if err := decodeMessageData(msg, &request); err != nil {
+		return nil
+	}
+
+	node.mutex.RLock()
+	fork := findForkPoint(node.Blockchain, request.Locator)
+	headers := make([]BlockHeader, 0)
+	for i := fork; i < len(node.Blockchain) && len(headers) < maxHeadersPerMessage; i++ {
+		headers = append(headers, headerFromBlock(&node.Blockchain[i]))
+		if node.Blockchain[i].Hash == request.StopHash {
+			break
+		}
+	}
+	height := len(node.Blockchain)
+	node.mutex.RUnlock()
+
+	return &NetworkMessage{
+		Type: MSG_HEADERS,
+		From: node.ID,
+		To:   msg.From,
+		Data: map[string]interface{}{
+			"headers": headers,
+			"height":  height,
+		},
+		Timestamp: time.Now(),
+	}
+}
+
+// Handler de MSG_GET_BLOCKS: corpos dos blocos pedidos por hash
+func (node *P2PNode) handleGetBlocks(msg *NetworkMessage) *NetworkMessage {
+	var request struct {
+		Hashes []string `json:"hashes"`
+	}
+	if err := decodeMessageData(msg, &request); err != nil {
+		return nil
+	}
+	if len(request.Hashes) > maxBlocksPerMessage {
+		request.Hashes = request.Hashes[:maxBlocksPerMessage]
+	}
+
+	node.mutex.RLock()
+	positions := make(map[string]int, len(node.Blockchain))
+	for i := range node.Blockchain {
+		positions[node.Blockchain[i].Hash] = i
+	}
+	blocks := make([]Token, 0, len(request.Hashes))
+	for _, hash := range request.Hashes {
+		if i, ok := positions[hash]; ok {
+			blocks = append(blocks, node.Blockchain[i])
+		}
+	}
+	node.mutex.RUnlock()
+
+	return &NetworkMessage{
+		Type:      MSG_BLOCKS,
+		From:      node.ID,
+		To:        msg.From,
+		Data:      map[string]interface{}{"blocks": blocks},
+		Timestamp: time.Now(),
+	}
+}
+
+// handleSyncMessage despacha as mensagens de sincronização recebidas
+func (node *P2PNode) handleSyncMessage(msg *NetworkMessage) *NetworkMessage {
+	switch msg.Type {
+	case MSG_GET_HEADERS:
+		return node.handleGetHeaders(msg)
+	case MSG_GET_BLOCKS:
+		return node.handleGetBlocks(msg)
+	case MSG_SYNC_REQUEST:
+		return node.handleSyncRequest(msg)
+	}
+	return nil
+}